@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"mix/internal/format"
+	"mix/internal/llm/models"
+	"mix/internal/llm/provider"
+
+	"github.com/spf13/cobra"
+)
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "List the supported models",
+	Long: `List the models that can be configured for an agent, with their provider,
+context window, default max tokens and capabilities.
+
+The id column is the value to use for an agent's model in .mix.json.
+
+Example:
+  mix models
+  mix models --output-format json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, _ := cmd.Flags().GetString("output-format")
+		parsed, err := format.Parse(outputFormat)
+		if err != nil {
+			return fmt.Errorf("invalid format option: %s\n%s", outputFormat, format.GetHelpText())
+		}
+		return writeModels(cmd.OutOrStdout(), parsed)
+	},
+}
+
+// ModelInfo describes a supported model for the models command
+type ModelInfo struct {
+	ID               models.ModelID       `json:"id"`
+	Name             string               `json:"name"`
+	Provider         models.ModelProvider `json:"provider"`
+	ContextWindow    int64                `json:"contextWindow"`
+	DefaultMaxTokens int64                `json:"defaultMaxTokens"`
+	Capabilities     []string             `json:"capabilities"`
+}
+
+// supportedModels returns the supported models ordered by provider and id
+func supportedModels() []ModelInfo {
+	infos := make([]ModelInfo, 0, len(models.SupportedModels))
+	for _, model := range models.SupportedModels {
+		if model.Provider == models.ProviderMock {
+			continue
+		}
+		infos = append(infos, ModelInfo{
+			ID:               model.ID,
+			Name:             model.Name,
+			Provider:         model.Provider,
+			ContextWindow:    model.ContextWindow,
+			DefaultMaxTokens: model.DefaultMaxTokens,
+			Capabilities:     capabilityNames(provider.ModelCapabilities(model)),
+		})
+	}
+	slices.SortFunc(infos, func(a, b ModelInfo) int {
+		if c := strings.Compare(string(a.Provider), string(b.Provider)); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.ID), string(b.ID))
+	})
+	return infos
+}
+
+func capabilityNames(capabilities provider.Capabilities) []string {
+	names := []string{}
+	for _, capability := range []struct {
+		name      string
+		supported bool
+	}{
+		{"tools", capabilities.Tools},
+		{"attachments", capabilities.Attachments},
+		{"reasoning", capabilities.Reasoning},
+		{"streaming", capabilities.Streaming},
+		{"response_format", capabilities.ResponseFormat},
+	} {
+		if capability.supported {
+			names = append(names, capability.name)
+		}
+	}
+	return names
+}
+
+func writeModels(w io.Writer, outputFormat format.OutputFormat) error {
+	infos := supportedModels()
+	if outputFormat == format.JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(infos)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tPROVIDER\tCONTEXT\tMAX TOKENS\tCAPABILITIES")
+	for _, info := range infos {
+		fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%s\n", info.ID, info.Provider, info.ContextWindow, info.DefaultMaxTokens, strings.Join(info.Capabilities, ", "))
+	}
+	return table.Flush()
+}
+
+func init() {
+	modelsCmd.Flags().StringP("output-format", "f", format.Text.String(), "Output format (text, json)")
+}
@@ -8,8 +8,10 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"mix/internal/api"
@@ -20,6 +22,7 @@ import (
 	httphandlers "mix/internal/http"
 	"mix/internal/llm/agent"
 	"mix/internal/logging"
+	"mix/internal/session"
 	"mix/internal/version"
 
 	"github.com/spf13/cobra"
@@ -36,12 +39,25 @@ and content creation workflows.`,
   # CLI mode with prompt (direct output)
   mix -p "Explain the use of context in Go"
 
+  # CLI mode with the prompt piped in on stdin
+  cat notes.md | mix -p -
+
   # CLI mode with JSON output format
   mix -p "Explain the use of context in Go" -f json
 
+  # Continue the most recent session, or pick one of the recent sessions
+  mix --continue -p "Now add tests for it"
+  mix --resume -p "Now add tests for it"
+
   # Start HTTP API server
   mix --http-port 8080
 
+  # Start faster with only built-in tools
+  mix --no-mcp -p "Your prompt here"
+
+  # Show the effective config after merging files and environment
+  mix --print-config
+
   # Run with debug logging
   mix -d -p "Your prompt here"
 
@@ -69,12 +85,24 @@ and content creation workflows.`,
 		httpPort, _ := cmd.Flags().GetInt("http-port")
 		httpHost, _ := cmd.Flags().GetString("http-host")
 		skipPermissions, _ := cmd.Flags().GetBool("dangerously-skip-permissions")
+		noMCP, _ := cmd.Flags().GetBool("no-mcp")
+		configFile, _ := cmd.Flags().GetString("config")
+		printConfig, _ := cmd.Flags().GetBool("print-config")
+		continueSession, _ := cmd.Flags().GetBool("continue")
+		resumeSession, _ := cmd.Flags().GetBool("resume")
 
 		// Validate format option
 		if !format.IsValid(outputFormat) {
 			return fmt.Errorf("invalid format option: %s\n%s", outputFormat, format.GetHelpText())
 		}
 
+		// Resolved before --cwd changes the directory a relative path is taken from
+		if configFile != "" {
+			if err := config.SetConfigFile(configFile); err != nil {
+				return err
+			}
+		}
+
 		if cwd != "" {
 			err := os.Chdir(cwd)
 			if err != nil {
@@ -88,10 +116,23 @@ and content creation workflows.`,
 			}
 			cwd = c
 		}
-		_, err := config.Load(cwd, debug, skipPermissions)
+		cfg, err := config.Load(cwd, debug, skipPermissions)
 		if err != nil {
 			return err
 		}
+		if noMCP {
+			cfg.DisableMCP = true
+		}
+
+		// Print the merged config, without secrets, and exit
+		if printConfig {
+			data, err := json.MarshalIndent(cfg.Redacted(), "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal config: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
 
 		// Connect DB, this will also run migrations
 		conn, err := db.Connect()
@@ -111,7 +152,9 @@ and content creation workflows.`,
 		defer app.Shutdown()
 
 		// Initialize MCP tools early for both modes
-		initMCPTools(ctx, app)
+		if !cfg.DisableMCP {
+			initMCPTools(ctx, app)
+		}
 
 		// HTTP server mode (blocks, no other modes)
 		if httpPort > 0 {
@@ -123,9 +166,22 @@ and content creation workflows.`,
 			return runQuery(ctx, app, query, outputFormat)
 		}
 
+		// "-p -" reads the prompt from stdin, as does no prompt when data is redirected in.
+		// JSON-RPC over stdin is only read with --query json, handled above.
+		if prompt == stdinPrompt || (prompt == "" && hasStdinData()) {
+			prompt, err = readPrompt(os.Stdin, isPipe(os.Stdin))
+			if err != nil {
+				return err
+			}
+		}
+
 		// CLI-only mode (when prompt provided)
 		if prompt != "" {
-			return app.RunNonInteractive(ctx, prompt, outputFormat, quiet)
+			sessionID, err := sessionToContinue(ctx, app, continueSession, resumeSession)
+			if err != nil {
+				return err
+			}
+			return app.RunNonInteractive(ctx, sessionID, prompt, outputFormat, quiet)
 		}
 
 		// Default: Show help when no mode is specified
@@ -194,6 +250,92 @@ func hasStdinData() bool {
 	return (stat.Mode()&os.ModeCharDevice) == 0 && stat.Size() > 0
 }
 
+// recentSessionCount is how many sessions --resume offers
+const recentSessionCount = 5
+
+// sessionToContinue returns the session a CLI-only prompt continues: the most recent one
+// with --continue, the one picked from the recent sessions with --resume, or "" for a
+// new session
+func sessionToContinue(ctx context.Context, app *app.App, continueSession, resumeSession bool) (string, error) {
+	if !continueSession && !resumeSession {
+		return "", nil
+	}
+	sessions, err := app.RecentSessions(ctx, recentSessionCount)
+	if err != nil {
+		return "", err
+	}
+	if continueSession {
+		if len(sessions) == 0 {
+			return "", fmt.Errorf("--continue: there is no previous session to continue")
+		}
+		return sessions[0].ID, nil
+	}
+	if len(sessions) == 0 {
+		fmt.Fprintln(os.Stderr, "No previous sessions, starting a new one")
+		return "", nil
+	}
+	if isPipe(os.Stdin) {
+		return "", fmt.Errorf("--resume needs a terminal to pick a session; use --continue to continue the most recent one")
+	}
+	return pickSession(os.Stdin, os.Stderr, sessions)
+}
+
+// pickSession lists sessions on out and reads the number of the one to continue from
+// in. An empty answer, or the end of the input, starts a new session.
+func pickSession(in io.Reader, out io.Writer, sessions []session.Session) (string, error) {
+	fmt.Fprintln(out, "Recent sessions:")
+	for i, sess := range sessions {
+		updated := time.Unix(sess.UpdatedAt, 0).Format("2006-01-02 15:04")
+		fmt.Fprintf(out, "  %d) %s (%d messages, %s)\n", i+1, sess.Title, sess.MessageCount, updated)
+	}
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "Session to continue [1-%d], or Enter for a new session: ", len(sessions))
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return "", scanner.Err()
+		}
+		answer := strings.TrimSpace(scanner.Text())
+		if answer == "" {
+			return "", nil
+		}
+		choice, err := strconv.Atoi(answer)
+		if err == nil && choice >= 1 && choice <= len(sessions) {
+			return sessions[choice-1].ID, nil
+		}
+		fmt.Fprintf(out, "%q is not one of the sessions\n", answer)
+	}
+}
+
+// stdinPrompt is the --prompt value that reads the prompt from stdin
+const stdinPrompt = "-"
+
+// isPipe reports whether f is a pipe or redirected file rather than a terminal
+func isPipe(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (stat.Mode() & os.ModeCharDevice) == 0
+}
+
+// readPrompt reads a prompt piped to stdin, trimming surrounding whitespace
+func readPrompt(stdin io.Reader, piped bool) (string, error) {
+	if !piped {
+		return "", fmt.Errorf("--prompt - reads the prompt from stdin, but nothing was piped in")
+	}
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", fmt.Errorf("error reading prompt from stdin: %w", err)
+	}
+	prompt := strings.TrimSpace(string(data))
+	if prompt == "" {
+		return "", fmt.Errorf("the prompt read from stdin is empty")
+	}
+	return prompt, nil
+}
+
 func handleJSONRPCFromStdin(ctx context.Context, handler *api.QueryHandler, outputFormat string) error {
 	// Check if stdin has data before trying to read
 	if !hasStdinData() {
@@ -203,7 +345,7 @@ Usage examples:
   echo '{"method": "sessions.list", "id": 1}' | %s --query json --output-format json
   echo '{"method": "sessions.create", "params": {"title": "New Session"}, "id": 1}' | %s --query json --output-format json
   
-Available methods: sessions.list, sessions.create, sessions.select, sessions.delete, tools.list, mcp.list, commands.list`,
+Available methods: sessions.list, sessions.create, sessions.select, sessions.delete, tools.list, tools.describe, mcp.list, mcp.add, mcp.remove, mcp.test, commands.list, agents.create`,
 			os.Args[0], os.Args[0])
 	}
 
@@ -261,8 +403,14 @@ func outputJSONRPCResponse(response *api.QueryResponse, outputFormat string) {
 
 // SSE handler functions moved to internal/http/sse.go
 
+// shutdownTimeout bounds how long the HTTP server waits for streams and requests to
+// finish after an interrupt
+const shutdownTimeout = 10 * time.Second
+
 func startHTTPServer(ctx context.Context, app *app.App, host string, port int) error {
 	handler := api.NewQueryHandler(app)
+	app.StartSessionCleanup(ctx)
+	app.StartFileWatcher(ctx)
 
 	// Create dedicated HTTP mux
 	mux := http.NewServeMux()
@@ -278,12 +426,22 @@ func startHTTPServer(ctx context.Context, app *app.App, host string, port int) e
 		httphandlers.HandleSSEStream(ctx, handler, w, r)
 	})
 
+	// Add WebSocket endpoint mirroring the SSE stream
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		httphandlers.HandleWebSocket(ctx, handler, w, r)
+	})
+
 	// Add message queue endpoint for persistent SSE
 	mux.HandleFunc("/stream/", func(w http.ResponseWriter, r *http.Request) {
 		// Handle stream endpoints
-		if strings.HasSuffix(r.URL.Path, "/message") {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/message"):
 			httphandlers.HandleMessageQueue(w, r)
-		} else {
+		case strings.HasSuffix(r.URL.Path, "/pause"):
+			httphandlers.HandlePauseSession(w, r)
+		case strings.HasSuffix(r.URL.Path, "/resume"):
+			httphandlers.HandleResumeSession(w, r)
+		default:
 			http.NotFound(w, r)
 		}
 	})
@@ -363,11 +521,23 @@ func startHTTPServer(ctx context.Context, app *app.App, host string, port int) e
 	// Immediate feedback to user
 	logging.Info("Starting HTTP JSON-RPC server", "address", addr)
 
-	// Handle graceful shutdown
+	// Ctrl+C or SIGTERM ends the open streams with a final event before the server
+	// stops; handlers keep ctx so in-flight work is not cut off by the signal itself
+	signals, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownDone := make(chan struct{})
 	go func() {
-		<-ctx.Done()
+		defer close(shutdownDone)
+		<-signals.Done()
+		// A second interrupt kills the process
+		stop()
 		logging.Info("Shutting down HTTP server")
-		server.Shutdown(context.Background())
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httphandlers.Shutdown(shutdownCtx); err != nil {
+			logging.Warn("Streams did not close before the shutdown timeout", "error", err)
+		}
+		server.Shutdown(shutdownCtx)
 	}()
 
 	// Start server and provide ready confirmation
@@ -380,6 +550,8 @@ func startHTTPServer(ctx context.Context, app *app.App, host string, port int) e
 		return fmt.Errorf("HTTP server failed: %v", err)
 	}
 
+	// ListenAndServe returns as soon as shutdown starts; wait for requests to finish
+	<-shutdownDone
 	return nil
 }
 
@@ -395,12 +567,17 @@ func init() {
 	rootCmd.Flags().BoolP("version", "v", false, "Version")
 	rootCmd.Flags().BoolP("debug", "d", false, "Debug")
 	rootCmd.Flags().StringP("cwd", "c", "", "Current working directory")
+	rootCmd.Flags().String("config", "", "Config file to load instead of searching for .mix.json")
+	rootCmd.Flags().Bool("print-config", false, "Print the effective config as JSON, with secrets redacted, and exit")
 
 	// CLI-only mode flags
-	rootCmd.Flags().StringP("prompt", "p", "", "Run in CLI mode with this prompt")
+	rootCmd.Flags().StringP("prompt", "p", "", "Run in CLI mode with this prompt, or - to read it from stdin")
 	rootCmd.Flags().StringP("output-format", "f", format.Text.String(),
 		"Output format for CLI-only mode (text, json)")
 	rootCmd.Flags().BoolP("quiet", "q", false, "Hide spinner in CLI-only mode")
+	rootCmd.Flags().Bool("continue", false, "Continue the most recent session in CLI-only mode")
+	rootCmd.Flags().Bool("resume", false, "Pick one of the recent sessions to continue in CLI-only mode")
+	rootCmd.MarkFlagsMutuallyExclusive("continue", "resume")
 
 	// Data query flags
 	rootCmd.Flags().String("query", "", "Query structured data: sessions, tools, mcp, commands")
@@ -409,6 +586,9 @@ func init() {
 	rootCmd.Flags().Int("http-port", 0, "Start HTTP JSON-RPC server on this port (0 = disabled)")
 	rootCmd.Flags().String("http-host", "localhost", "HTTP server host")
 
+	// MCP flags
+	rootCmd.Flags().Bool("no-mcp", false, "Disable MCP servers and use only built-in tools")
+
 	// Permission flags
 	rootCmd.Flags().Bool("dangerously-skip-permissions", false, "Skip all permission prompts (DANGEROUS - use only in trusted environments)")
 
@@ -417,6 +597,7 @@ func init() {
 		return format.SupportedFormats, cobra.ShellCompDirectiveNoFileComp
 	})
 
-	// Add auth subcommand
+	// Add subcommands
 	rootCmd.AddCommand(authCmd)
+	rootCmd.AddCommand(modelsCmd)
 }
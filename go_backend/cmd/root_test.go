@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"mix/internal/format"
+	"mix/internal/llm/models"
+	"mix/internal/session"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPrompt(t *testing.T) {
+	t.Run("piped content", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		defer r.Close()
+		_, err = w.WriteString("Summarize this file:\n\npackage main\n\n")
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		require.True(t, isPipe(r))
+		prompt, err := readPrompt(r, isPipe(r))
+		require.NoError(t, err)
+		assert.Equal(t, "Summarize this file:\n\npackage main", prompt)
+	})
+
+	t.Run("nothing piped", func(t *testing.T) {
+		_, err := readPrompt(strings.NewReader("ignored"), false)
+		assert.ErrorContains(t, err, "nothing was piped in")
+	})
+
+	t.Run("empty input", func(t *testing.T) {
+		_, err := readPrompt(strings.NewReader(" \n\t"), true)
+		assert.ErrorContains(t, err, "empty")
+	})
+}
+
+func TestPickSession(t *testing.T) {
+	sessions := []session.Session{
+		{ID: "first", Title: "Fix the login bug", MessageCount: 12},
+		{ID: "second", Title: "Write release notes", MessageCount: 3},
+	}
+	pick := func(input string) (string, string) {
+		var out strings.Builder
+		id, err := pickSession(strings.NewReader(input), &out, sessions)
+		require.NoError(t, err)
+		return id, out.String()
+	}
+
+	id, out := pick("2\n")
+	assert.Equal(t, "second", id)
+	assert.Contains(t, out, "1) Fix the login bug (12 messages,")
+	assert.Contains(t, out, "2) Write release notes (3 messages,")
+
+	id, _ = pick("\n")
+	assert.Empty(t, id, "Enter starts a new session")
+
+	id, _ = pick("")
+	assert.Empty(t, id, "end of input starts a new session")
+
+	id, out = pick("7\nlatest\n1\n")
+	assert.Equal(t, "first", id)
+	assert.Contains(t, out, `"7" is not one of the sessions`)
+	assert.Contains(t, out, `"latest" is not one of the sessions`)
+}
+
+func TestWriteModels(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		var out strings.Builder
+		require.NoError(t, writeModels(&out, format.Text))
+		assert.Regexp(t, `(?m)^claude-4-sonnet\s+anthropic\s+200000\s+\d+\s+tools, attachments, reasoning, streaming$`, out.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out strings.Builder
+		require.NoError(t, writeModels(&out, format.JSON))
+		var infos []ModelInfo
+		require.NoError(t, json.Unmarshal([]byte(out.String()), &infos))
+
+		index := slices.IndexFunc(infos, func(info ModelInfo) bool { return info.ID == models.Claude4Sonnet })
+		require.NotEqual(t, -1, index)
+		assert.Equal(t, models.ProviderAnthropic, infos[index].Provider)
+		assert.Contains(t, infos[index].Capabilities, "tools")
+	})
+}
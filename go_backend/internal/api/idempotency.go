@@ -0,0 +1,66 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// idempotencyKeyTTL is how long a messages.send result is kept for retries with the same key
+const idempotencyKeyTTL = 10 * time.Minute
+
+// idempotencyEntry is a send that was started with an idempotency key. done is closed
+// once response is set.
+type idempotencyEntry struct {
+	done     chan struct{}
+	response *QueryResponse
+	expires  time.Time
+}
+
+// idempotencyCache remembers messages.send results by session and idempotency key, so a
+// client retrying after a timeout gets the first result instead of a second agent run
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// begin returns the entry for a key and whether the caller owns it. The owner must call
+// finish; anyone else waits on entry.done for the owner's response.
+func (c *idempotencyCache) begin(sessionID, key string, now time.Time) (*idempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, entry := range c.entries {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	cacheKey := sessionID + "\x00" + key
+	if entry, ok := c.entries[cacheKey]; ok {
+		return entry, false
+	}
+	entry := &idempotencyEntry{done: make(chan struct{})}
+	c.entries[cacheKey] = entry
+	return entry, true
+}
+
+// finish records the owner's response. Failed sends are forgotten so they can be retried.
+func (c *idempotencyCache) finish(sessionID, key string, entry *idempotencyEntry, response *QueryResponse, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.response = response
+	entry.expires = now.Add(c.ttl)
+	if response.Error != nil {
+		delete(c.entries, sessionID+"\x00"+key)
+	}
+	close(entry.done)
+}
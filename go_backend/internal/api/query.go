@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
@@ -13,7 +14,9 @@ import (
 	"mix/internal/commands"
 	"mix/internal/config"
 	"mix/internal/llm/agent"
-	"mix/internal/llm/tools"
+	"mix/internal/llm/models"
+	"mix/internal/llm/provider"
+	"mix/internal/session"
 )
 
 // JSON-RPC Request
@@ -39,17 +42,56 @@ type QueryError struct {
 // Structured data types
 type SessionData struct {
 	ID               string    `json:"id"`
+	ParentID         string    `json:"parentId,omitempty"`
 	Title            string    `json:"title"`
 	MessageCount     int64     `json:"messageCount"`
 	PromptTokens     int64     `json:"promptTokens"`
 	CompletionTokens int64     `json:"completionTokens"`
 	Cost             float64   `json:"cost"`
 	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+type MetricsData struct {
+	SessionID string                       `json:"sessionId,omitempty"`
+	Tools     map[string]agent.ToolMetrics `json:"tools"`
+}
+
+// AgentInfoData describes the agent answering messages and the model it uses
+type AgentInfoData struct {
+	Agent           config.AgentName     `json:"agent"`
+	Model           models.ModelID       `json:"model"`
+	ModelName       string               `json:"modelName"`
+	Provider        models.ModelProvider `json:"provider"`
+	ContextWindow   int64                `json:"contextWindow"`
+	MaxTokens       int64                `json:"maxTokens"`
+	ReasoningEffort string               `json:"reasoningEffort,omitempty"`
+}
+
+// AgentData describes an agent created with agents.create. Its id is passed as agentId
+// to messages.send to run messages on it.
+type AgentData struct {
+	ID        string               `json:"id"`
+	Model     models.ModelID       `json:"model"`
+	ModelName string               `json:"modelName"`
+	Provider  models.ModelProvider `json:"provider"`
 }
 
 type ToolData struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// ConflictsWith lists the other MCP servers whose tool has the same prefixed name.
+	// Only the tool of the server first in name order is loaded.
+	ConflictsWith []string `json:"conflictsWith,omitempty"`
+}
+
+// ToolSchemaData is the result of tools.describe. Parameters is the JSON schema of the
+// tool's input, an object schema whose required list matches Required.
+type ToolSchemaData struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+	Required    []string       `json:"required"`
 }
 
 type MCPServerData struct {
@@ -60,9 +102,19 @@ type MCPServerData struct {
 }
 
 type CommandData struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Type        string `json:"type"` // "builtin" or "file"
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"` // "builtin" or "file"
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+// CommandRunData is the result of commands.run. Result holds the command's output when
+// it is JSON, as most builtin commands return.
+type CommandRunData struct {
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    string          `json:"output"`
+	Result    json.RawMessage `json:"result,omitempty"`
 }
 
 type MessageData struct {
@@ -73,10 +125,24 @@ type MessageData struct {
 	Response  string `json:"response,omitempty"`
 }
 
+type DeletedMessagesData struct {
+	SessionID    string   `json:"sessionId"`
+	Deleted      []string `json:"deleted"`
+	MessageCount int64    `json:"messageCount"`
+}
+
+// RegeneratedMessageData is the result of messages.regenerate: the ids of the messages
+// that were deleted and the new response
+type RegeneratedMessageData struct {
+	Deleted []string    `json:"deleted"`
+	Message MessageData `json:"message"`
+}
+
 // Query handler
 type QueryHandler struct {
 	app             *app.App
 	commandRegistry *commands.Registry
+	idempotency     *idempotencyCache
 }
 
 func NewQueryHandler(app *app.App) *QueryHandler {
@@ -94,6 +160,7 @@ func NewQueryHandler(app *app.App) *QueryHandler {
 	return &QueryHandler{
 		app:             app,
 		commandRegistry: registry,
+		idempotency:     newIdempotencyCache(idempotencyKeyTTL),
 	}
 }
 
@@ -123,18 +190,44 @@ func (h *QueryHandler) Handle(ctx context.Context, req *QueryRequest) *QueryResp
 		return h.handleSessionsSelect(ctx, req)
 	case "sessions.create":
 		return h.handleSessionsCreate(ctx, req)
+	case "sessions.duplicate":
+		return h.handleSessionsDuplicate(ctx, req)
 	case "messages.send":
 		return h.handleMessagesSend(ctx, req)
 	case "messages.history":
 		return h.handleMessagesHistory(ctx, req)
 	case "messages.cross-session-history":
 		return h.handleMessagesCrossSessionHistory(ctx, req)
+	case "messages.delete":
+		return h.handleMessagesDelete(ctx, req)
+	case "messages.regenerate":
+		return h.handleMessagesRegenerate(ctx, req)
 	case "mcp.list":
 		return h.handleMCPList(ctx, req)
+	case "mcp.add":
+		return h.handleMCPAdd(ctx, req)
+	case "mcp.remove":
+		return h.handleMCPRemove(ctx, req)
+	case "mcp.test":
+		return h.handleMCPTest(ctx, req)
+	case "tools.list":
+		return h.handleToolsList(ctx, req)
+	case "tools.describe":
+		return h.handleToolsDescribe(ctx, req)
 	case "commands.list":
 		return h.handleCommandsList(ctx, req)
 	case "commands.get":
 		return h.handleCommandsGet(ctx, req)
+	case "commands.run":
+		return h.handleCommandsRun(ctx, req)
+	case "metrics":
+		return h.handleMetrics(ctx, req)
+	case "agent.info":
+		return h.handleAgentInfo(ctx, req)
+	case "agents.create":
+		return h.handleAgentsCreate(ctx, req)
+	case "agents.delete":
+		return h.handleAgentsDelete(ctx, req)
 	default:
 		return &QueryResponse{
 			Error: &QueryError{
@@ -189,12 +282,14 @@ func (h *QueryHandler) handleSessionsList(ctx context.Context, req *QueryRequest
 	for _, s := range sessions {
 		result = append(result, SessionData{
 			ID:               s.ID,
+			ParentID:         s.ParentSessionID,
 			Title:            s.Title,
 			MessageCount:     s.MessageCount,
 			PromptTokens:     s.PromptTokens,
 			CompletionTokens: s.CompletionTokens,
 			Cost:             s.Cost,
 			CreatedAt:        time.Unix(s.CreatedAt, 0),
+			UpdatedAt:        time.Unix(s.UpdatedAt, 0),
 		})
 	}
 
@@ -242,12 +337,14 @@ func (h *QueryHandler) handleSessionsGet(ctx context.Context, req *QueryRequest)
 
 	result := SessionData{
 		ID:               session.ID,
+		ParentID:         session.ParentSessionID,
 		Title:            session.Title,
 		MessageCount:     session.MessageCount,
 		PromptTokens:     session.PromptTokens,
 		CompletionTokens: session.CompletionTokens,
 		Cost:             session.Cost,
 		CreatedAt:        time.Unix(session.CreatedAt, 0),
+		UpdatedAt:        time.Unix(session.UpdatedAt, 0),
 	}
 
 	return &QueryResponse{
@@ -280,12 +377,14 @@ func (h *QueryHandler) handleSessionsCurrent(ctx context.Context, req *QueryRequ
 
 	result := SessionData{
 		ID:               currentSession.ID,
+		ParentID:         currentSession.ParentSessionID,
 		Title:            currentSession.Title,
 		MessageCount:     currentSession.MessageCount,
 		PromptTokens:     currentSession.PromptTokens,
 		CompletionTokens: currentSession.CompletionTokens,
 		Cost:             currentSession.Cost,
 		CreatedAt:        time.Unix(currentSession.CreatedAt, 0),
+		UpdatedAt:        time.Unix(currentSession.UpdatedAt, 0),
 	}
 
 	return &QueryResponse{
@@ -349,6 +448,7 @@ func (h *QueryHandler) handleSessionsSelect(ctx context.Context, req *QueryReque
 func (h *QueryHandler) handleSessionsCreate(ctx context.Context, req *QueryRequest) *QueryResponse {
 	var params struct {
 		Title      string `json:"title"`
+		ParentID   string `json:"parentId,omitempty"`
 		SetCurrent bool   `json:"setCurrent,omitempty"`
 	}
 
@@ -363,17 +463,27 @@ func (h *QueryHandler) handleSessionsCreate(ctx context.Context, req *QueryReque
 	}
 
 	if params.Title == "" {
-		return &QueryResponse{
-			Error: &QueryError{
-				Code:    -32602,
-				Message: "Missing required parameter: title",
-			},
-			ID: req.ID,
+		params.Title = config.Get().DefaultSessionTitle(time.Now())
+	}
+
+	createSession := h.app.Sessions.Create
+	if params.ParentID != "" {
+		if _, err := h.app.Sessions.Get(ctx, params.ParentID); err != nil {
+			return &QueryResponse{
+				Error: &QueryError{
+					Code:    -32602,
+					Message: "Parent session not found: " + params.ParentID,
+				},
+				ID: req.ID,
+			}
+		}
+		createSession = func(ctx context.Context, title string) (session.Session, error) {
+			return h.app.Sessions.CreateChild(ctx, params.ParentID, title)
 		}
 	}
 
 	// Create session
-	session, err := h.app.Sessions.Create(ctx, params.Title)
+	session, err := createSession(ctx, params.Title)
 	if err != nil {
 		return &QueryResponse{
 			Error: &QueryError{
@@ -400,12 +510,14 @@ func (h *QueryHandler) handleSessionsCreate(ctx context.Context, req *QueryReque
 
 	result := SessionData{
 		ID:               session.ID,
+		ParentID:         session.ParentSessionID,
 		Title:            session.Title,
 		MessageCount:     session.MessageCount,
 		PromptTokens:     session.PromptTokens,
 		CompletionTokens: session.CompletionTokens,
 		Cost:             session.Cost,
 		CreatedAt:        time.Unix(session.CreatedAt, 0),
+		UpdatedAt:        time.Unix(session.UpdatedAt, 0),
 	}
 
 	return &QueryResponse{
@@ -414,125 +526,129 @@ func (h *QueryHandler) handleSessionsCreate(ctx context.Context, req *QueryReque
 	}
 }
 
-func (h *QueryHandler) handleMCPList(ctx context.Context, req *QueryRequest) *QueryResponse {
-	cfg := config.Get()
-
-	var result []MCPServerData
+func (h *QueryHandler) handleSessionsDuplicate(ctx context.Context, req *QueryRequest) *QueryResponse {
+	var params struct {
+		ID            string `json:"id"`
+		Title         string `json:"title"`
+		PreserveUsage bool   `json:"preserveUsage,omitempty"`
+	}
 
-	if len(cfg.MCPServers) == 0 {
+	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return &QueryResponse{
-			Result: result, // Empty array
-			ID:     req.ID,
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
 		}
 	}
 
-	// Get MCP tools to check connection status and group by server
-	// Create temporary manager for informational listing
-	tempManager2 := agent.NewMCPClientManager()
-	defer tempManager2.Close()
-	mcpTools := agent.GetMcpTools(ctx, h.app.Permissions, tempManager2)
-
-	// Group tools by server name
-	serverTools := make(map[string][]tools.BaseTool)
-	for _, tool := range mcpTools {
-		if toolInfo := tool.Info(); strings.Contains(toolInfo.Name, "_") {
-			serverName := strings.Split(toolInfo.Name, "_")[0]
-			serverTools[serverName] = append(serverTools[serverName], tool)
+	if params.ID == "" || params.Title == "" {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Missing required parameters: id and title",
+			},
+			ID: req.ID,
 		}
 	}
 
-	// Sort server names for consistent output
-	var serverNames []string
-	for name := range cfg.MCPServers {
-		serverNames = append(serverNames, name)
-	}
-	sort.Strings(serverNames)
-
-	for _, name := range serverNames {
-		tools := serverTools[name]
-
-		// Determine connection status
-		connected := len(tools) > 0
-		status := "connected"
-		if !connected {
-			status = "failed"
+	if _, err := h.app.Sessions.Get(ctx, params.ID); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Session not found: " + params.ID,
+			},
+			ID: req.ID,
 		}
+	}
 
-		// Convert tools to ToolData
-		var toolsData []ToolData
-		for _, tool := range tools {
-			info := tool.Info()
-			// Remove server prefix from tool name for cleaner display
-			toolName := info.Name
-			if strings.Contains(toolName, "_") {
-				parts := strings.SplitN(toolName, "_", 2)
-				if len(parts) > 1 {
-					toolName = parts[1]
-				}
-			}
-			toolsData = append(toolsData, ToolData{
-				Name:        toolName,
-				Description: info.Description,
-			})
+	session, err := h.app.DuplicateSession(ctx, params.ID, params.Title, params.PreserveUsage)
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Failed to duplicate session: " + err.Error(),
+			},
+			ID: req.ID,
 		}
-
-		// Sort tools by name
-		sort.Slice(toolsData, func(i, j int) bool {
-			return toolsData[i].Name < toolsData[j].Name
-		})
-
-		result = append(result, MCPServerData{
-			Name:      name,
-			Connected: connected,
-			Status:    status,
-			Tools:     toolsData,
-		})
 	}
 
 	return &QueryResponse{
-		Result: result,
-		ID:     req.ID,
+		Result: SessionData{
+			ID:               session.ID,
+			Title:            session.Title,
+			MessageCount:     session.MessageCount,
+			PromptTokens:     session.PromptTokens,
+			CompletionTokens: session.CompletionTokens,
+			Cost:             session.Cost,
+			CreatedAt:        time.Unix(session.CreatedAt, 0),
+			UpdatedAt:        time.Unix(session.UpdatedAt, 0),
+		},
+		ID: req.ID,
 	}
 }
 
-func (h *QueryHandler) handleCommandsList(ctx context.Context, req *QueryRequest) *QueryResponse {
-	allCommands := h.commandRegistry.GetAllCommands()
-
-	var result []CommandData
-	builtins := map[string]bool{
-		"help": true, "clear": true, "session": true,
-		"sessions": true, "tools": true, "mcp": true,
+func (h *QueryHandler) handleMetrics(ctx context.Context, req *QueryRequest) *QueryResponse {
+	var params struct {
+		SessionID string `json:"sessionId"`
 	}
 
-	for name, cmd := range allCommands {
-		cmdType := "file"
-		if builtins[name] {
-			cmdType = "builtin"
+	// Params are optional; without a sessionId the aggregates cover all sessions
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return &QueryResponse{
+				Error: &QueryError{
+					Code:    -32602,
+					Message: "Invalid params: " + err.Error(),
+				},
+				ID: req.ID,
+			}
 		}
+	}
 
-		result = append(result, CommandData{
-			Name:        name,
-			Description: cmd.Description(),
-			Type:        cmdType,
-		})
+	return &QueryResponse{
+		Result: MetricsData{
+			SessionID: params.SessionID,
+			Tools:     h.app.CoderAgent.ToolMetrics(params.SessionID),
+		},
+		ID: req.ID,
 	}
+}
 
-	// Sort by name
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].Name < result[j].Name
-	})
+func (h *QueryHandler) handleAgentInfo(ctx context.Context, req *QueryRequest) *QueryResponse {
+	model := h.app.CoderAgent.Model()
+	agentConfig := config.Get().Agents[config.AgentMain]
 
-	return &QueryResponse{
-		Result: result,
-		ID:     req.ID,
+	// The model's default applies when the agent doesn't set its own limit
+	maxTokens := model.DefaultMaxTokens
+	if agentConfig.MaxTokens > 0 {
+		maxTokens = agentConfig.MaxTokens
 	}
+	info := AgentInfoData{
+		Agent:         config.AgentMain,
+		Model:         model.ID,
+		ModelName:     model.Name,
+		Provider:      model.Provider,
+		ContextWindow: model.ContextWindow,
+		MaxTokens:     maxTokens,
+	}
+	if model.CanReason {
+		info.ReasoningEffort = agentConfig.ReasoningEffort
+	}
+
+	return &QueryResponse{Result: info, ID: req.ID}
 }
 
-func (h *QueryHandler) handleCommandsGet(ctx context.Context, req *QueryRequest) *QueryResponse {
+// handleAgentsCreate creates an agent with its own model and API key, isolated from the
+// main agent and every other created agent
+func (h *QueryHandler) handleAgentsCreate(ctx context.Context, req *QueryRequest) *QueryResponse {
 	var params struct {
-		Name string `json:"name"`
+		Model models.ModelID `json:"model"`
+		// APIKey replaces the configured key of the model's provider for this agent only
+		APIKey          string `json:"apiKey,omitempty"`
+		ReasoningEffort string `json:"reasoningEffort,omitempty"`
 	}
-
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return &QueryResponse{
 			Error: &QueryError{
@@ -542,56 +658,43 @@ func (h *QueryHandler) handleCommandsGet(ctx context.Context, req *QueryRequest)
 			ID: req.ID,
 		}
 	}
-
-	if params.Name == "" {
+	if params.Model == "" {
 		return &QueryResponse{
 			Error: &QueryError{
 				Code:    -32602,
-				Message: "Missing required parameter: name",
+				Message: "Missing required parameter: model",
 			},
 			ID: req.ID,
 		}
 	}
 
-	cmd, exists := h.commandRegistry.GetCommand(params.Name)
-	if !exists {
+	id, created, err := h.app.CreateAgent(agent.AgentOverrides{
+		Model:           params.Model,
+		APIKey:          params.APIKey,
+		ReasoningEffort: params.ReasoningEffort,
+	})
+	if err != nil {
 		return &QueryResponse{
 			Error: &QueryError{
 				Code:    -32000,
-				Message: "Command not found: " + params.Name,
+				Message: err.Error(),
 			},
 			ID: req.ID,
 		}
 	}
 
-	builtins := map[string]bool{
-		"help": true, "clear": true, "session": true,
-		"sessions": true, "tools": true, "mcp": true,
-	}
-
-	cmdType := "file"
-	if builtins[params.Name] {
-		cmdType = "builtin"
-	}
-
-	result := CommandData{
-		Name:        cmd.Name(),
-		Description: cmd.Description(),
-		Type:        cmdType,
-	}
-
+	model := created.Model()
 	return &QueryResponse{
-		Result: result,
+		Result: AgentData{ID: id, Model: model.ID, ModelName: model.Name, Provider: model.Provider},
 		ID:     req.ID,
 	}
 }
 
-func (h *QueryHandler) handleMessagesSend(ctx context.Context, req *QueryRequest) *QueryResponse {
+// handleAgentsDelete removes an agent created with agents.create
+func (h *QueryHandler) handleAgentsDelete(ctx context.Context, req *QueryRequest) *QueryResponse {
 	var params struct {
-		SessionID string `json:"sessionId"`
-		Content   string `json:"content"`
+		ID string `json:"id"`
 	}
-
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return &QueryResponse{
 			Error: &QueryError{
@@ -601,111 +704,676 @@ func (h *QueryHandler) handleMessagesSend(ctx context.Context, req *QueryRequest
 			ID: req.ID,
 		}
 	}
-
-	if params.SessionID == "" {
+	if params.ID == "" {
 		return &QueryResponse{
 			Error: &QueryError{
 				Code:    -32602,
-				Message: "Missing required parameter: sessionId",
+				Message: "Missing required parameter: id",
 			},
 			ID: req.ID,
 		}
 	}
 
-	if params.Content == "" {
+	if err := h.app.DeleteAgent(params.ID); err != nil {
 		return &QueryResponse{
 			Error: &QueryError{
-				Code:    -32602,
-				Message: "Missing required parameter: content",
+				Code:    -32000,
+				Message: "Failed to delete agent: " + err.Error(),
 			},
 			ID: req.ID,
 		}
 	}
 
-	// Set the session as current
-	err := h.app.SetCurrentSession(params.SessionID)
-	if err != nil {
-		return &QueryResponse{
-			Error: &QueryError{
-				Code:    -32000,
-				Message: "Failed to set session: " + err.Error(),
-			},
-			ID: req.ID,
-		}
+	return &QueryResponse{
+		Result: map[string]string{"message": "Deleted agent: " + params.ID},
+		ID:     req.ID,
 	}
+}
 
-	// Check if this is a slash command and handle it immediately
-	if commands.IsSlashCommand(params.Content) {
-		parsed, parseErr := commands.ParseCommand(params.Content)
-		if parseErr != nil {
-			return &QueryResponse{
-				Error: &QueryError{
-					Code:    -32602,
-					Message: "Invalid slash command: " + parseErr.Error(),
-				},
-				ID: req.ID,
-			}
+// otherServers returns the servers in a conflict other than server
+func otherServers(conflict []string, server string) []string {
+	var others []string
+	for _, name := range conflict {
+		if name != server {
+			others = append(others, name)
 		}
+	}
+	return others
+}
 
-		log.Printf("Executing command: '%s' with args: '%s'", parsed.Name, parsed.Arguments)
-
-		commandResult, execErr := h.commandRegistry.ExecuteCommand(ctx, parsed.Name, parsed.Arguments)
-		if execErr != nil {
-			log.Printf("Command execution failed for '%s': %v", parsed.Name, execErr)
-
-			// Check if it's a "command not found" error
-			if strings.Contains(execErr.Error(), "command not found") {
-				// List available commands for debugging
-				allCommands := h.commandRegistry.GetAllCommands()
-				commandNames := getCommandNames(allCommands)
-				log.Printf("Available commands: %v", commandNames)
-
-				return &QueryResponse{
-					Error: &QueryError{
-						Code:    -32000,
-						Message: fmt.Sprintf("Command '%s' not found. Available commands: %v", parsed.Name, commandNames),
-					},
-					ID: req.ID,
-				}
-			}
-
-			return &QueryResponse{
-				Error: &QueryError{
-					Code:    -32000,
-					Message: "Command execution failed: " + execErr.Error(),
-				},
-				ID: req.ID,
-			}
-		}
+func (h *QueryHandler) handleMCPList(ctx context.Context, req *QueryRequest) *QueryResponse {
+	cfg := config.Get()
 
-		log.Printf("Command '%s' executed successfully, result length: %d", parsed.Name, len(commandResult))
+	var result []MCPServerData
 
-		// Return the command result immediately as a message
+	if len(cfg.MCPServers) == 0 {
 		return &QueryResponse{
-			Result: map[string]interface{}{
-				"id":       "cmd-" + parsed.Name,
-				"role":     "assistant",
-				"content":  params.Content,
-				"response": commandResult,
-			},
-			ID: req.ID,
+			Result: result, // Empty array
+			ID:     req.ID,
 		}
 	}
 
-	// Send message to agent
-	done, err := h.app.CoderAgent.Run(ctx, params.SessionID, params.Content)
-	if err != nil {
+	// Servers are still listed when MCP is disabled, but never connected to
+	if cfg.DisableMCP {
+		var serverNames []string
+		for name := range cfg.MCPServers {
+			serverNames = append(serverNames, name)
+		}
+		sort.Strings(serverNames)
+		for _, name := range serverNames {
+			result = append(result, MCPServerData{Name: name, Status: "disabled", Tools: []ToolData{}})
+		}
 		return &QueryResponse{
-			Error: &QueryError{
-				Code:    -32000,
-				Message: "Failed to send message: " + err.Error(),
-			},
-			ID: req.ID,
+			Result: result,
+			ID:     req.ID,
 		}
 	}
 
-	// Wait for response
-	result := <-done
+	// Get MCP tools to check connection status and group by server
+	// Create temporary manager for informational listing
+	tempManager2 := agent.NewMCPClientManager()
+	defer tempManager2.Close()
+	serverTools := agent.GetMcpToolsByServer(ctx, h.app.Permissions, tempManager2)
+	conflicts := agent.MCPToolConflicts(serverTools)
+
+	// Sort server names for consistent output
+	var serverNames []string
+	for name := range cfg.MCPServers {
+		serverNames = append(serverNames, name)
+	}
+	sort.Strings(serverNames)
+
+	for _, name := range serverNames {
+		tools := serverTools[name]
+
+		// Determine connection status
+		connected := len(tools) > 0
+		status := "connected"
+		if !connected {
+			status = "failed"
+		}
+
+		// Convert tools to ToolData, named as the server names them
+		var toolsData []ToolData
+		for _, tool := range tools {
+			info := tool.Info()
+			_, toolName, _ := agent.MCPToolName(tool)
+			toolsData = append(toolsData, ToolData{
+				Name:          toolName,
+				Description:   info.Description,
+				ConflictsWith: otherServers(conflicts[info.Name], name),
+			})
+		}
+
+		// Sort tools by name
+		sort.Slice(toolsData, func(i, j int) bool {
+			return toolsData[i].Name < toolsData[j].Name
+		})
+
+		result = append(result, MCPServerData{
+			Name:      name,
+			Connected: connected,
+			Status:    status,
+			Tools:     toolsData,
+		})
+	}
+
+	return &QueryResponse{
+		Result: result,
+		ID:     req.ID,
+	}
+}
+
+func (h *QueryHandler) handleMCPAdd(ctx context.Context, req *QueryRequest) *QueryResponse {
+	var params struct {
+		Name   string           `json:"name"`
+		Server config.MCPServer `json:"server"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	status, err := h.app.AddMCPServer(ctx, params.Name, params.Server)
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Failed to add MCP server: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	return &QueryResponse{Result: status, ID: req.ID}
+}
+
+func (h *QueryHandler) handleMCPRemove(ctx context.Context, req *QueryRequest) *QueryResponse {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	if err := h.app.RemoveMCPServer(ctx, params.Name); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Failed to remove MCP server: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	return &QueryResponse{
+		Result: map[string]string{"message": "Removed MCP server: " + params.Name},
+		ID:     req.ID,
+	}
+}
+
+// handleMCPTest reconnects to a configured MCP server and reports whether it connected
+func (h *QueryHandler) handleMCPTest(ctx context.Context, req *QueryRequest) *QueryResponse {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	status, err := h.app.TestMCPServer(ctx, params.Name)
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	return &QueryResponse{Result: status, ID: req.ID}
+}
+
+func (h *QueryHandler) handleCommandsList(ctx context.Context, req *QueryRequest) *QueryResponse {
+	allCommands := h.commandRegistry.GetAllCommands()
+
+	var result []CommandData
+	builtins := map[string]bool{
+		"help": true, "clear": true, "session": true,
+		"sessions": true, "tools": true, "mcp": true,
+	}
+
+	for name, cmd := range allCommands {
+		cmdType := "file"
+		if builtins[name] {
+			cmdType = "builtin"
+		}
+
+		result = append(result, CommandData{
+			Name:        name,
+			Description: cmd.Description(),
+			Type:        cmdType,
+			Aliases:     h.commandRegistry.GetAliases(name),
+		})
+	}
+
+	// Sort by name
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return &QueryResponse{
+		Result: result,
+		ID:     req.ID,
+	}
+}
+
+func (h *QueryHandler) handleToolsList(ctx context.Context, req *QueryRequest) *QueryResponse {
+	result := []ToolData{}
+	for _, tool := range h.app.CoderAgent.Tools() {
+		info := tool.Info()
+		result = append(result, ToolData{Name: info.Name, Description: info.Description})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return &QueryResponse{Result: result, ID: req.ID}
+}
+
+func (h *QueryHandler) handleToolsDescribe(ctx context.Context, req *QueryRequest) *QueryResponse {
+	var params struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	if params.Name == "" {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Missing required parameter: name",
+			},
+			ID: req.ID,
+		}
+	}
+
+	for _, tool := range h.app.CoderAgent.Tools() {
+		info := tool.Info()
+		if info.Name != params.Name {
+			continue
+		}
+		properties := info.Parameters
+		if properties == nil {
+			properties = map[string]any{}
+		}
+		required := info.Required
+		if required == nil {
+			required = []string{}
+		}
+		return &QueryResponse{
+			Result: ToolSchemaData{
+				Name:        info.Name,
+				Description: info.Description,
+				Parameters: map[string]any{
+					"type":       "object",
+					"properties": properties,
+					"required":   required,
+				},
+				Required: required,
+			},
+			ID: req.ID,
+		}
+	}
+
+	return &QueryResponse{
+		Error: &QueryError{
+			Code:    -32000,
+			Message: "Tool not found: " + params.Name,
+		},
+		ID: req.ID,
+	}
+}
+
+func (h *QueryHandler) handleCommandsGet(ctx context.Context, req *QueryRequest) *QueryResponse {
+	var params struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	if params.Name == "" {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Missing required parameter: name",
+			},
+			ID: req.ID,
+		}
+	}
+
+	cmd, exists := h.commandRegistry.GetCommand(params.Name)
+	if !exists {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Command not found: " + params.Name,
+			},
+			ID: req.ID,
+		}
+	}
+
+	builtins := map[string]bool{
+		"help": true, "clear": true, "session": true,
+		"sessions": true, "tools": true, "mcp": true,
+	}
+
+	cmdType := "file"
+	if builtins[params.Name] {
+		cmdType = "builtin"
+	}
+
+	result := CommandData{
+		Name:        cmd.Name(),
+		Description: cmd.Description(),
+		Type:        cmdType,
+		Aliases:     h.commandRegistry.GetAliases(cmd.Name()),
+	}
+
+	return &QueryResponse{
+		Result: result,
+		ID:     req.ID,
+	}
+}
+
+func (h *QueryHandler) handleCommandsRun(ctx context.Context, req *QueryRequest) *QueryResponse {
+	var params struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+		SessionID string `json:"sessionId"`
+		// Confirm lets a destructive command such as /clear --hard run
+		Confirm bool `json:"confirm,omitempty"`
+	}
+
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	name := strings.TrimPrefix(strings.TrimSpace(params.Name), "/")
+	if name == "" {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Missing required parameter: name",
+			},
+			ID: req.ID,
+		}
+	}
+
+	// Commands act on the current session, so select the requested one first
+	if params.SessionID != "" {
+		if err := h.app.SetCurrentSession(params.SessionID); err != nil {
+			return &QueryResponse{
+				Error: &QueryError{
+					Code:    -32000,
+					Message: "Failed to set session: " + err.Error(),
+				},
+				ID: req.ID,
+			}
+		}
+	}
+
+	if params.Confirm {
+		ctx = commands.WithConfirmation(ctx)
+	}
+	output, err := h.commandRegistry.ExecuteCommand(ctx, name, params.Arguments)
+	if errors.Is(err, commands.ErrCommandNotFound) {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Command not found: " + name,
+			},
+			ID: req.ID,
+		}
+	}
+	if errors.Is(err, commands.ErrConfirmationRequired) {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: err.Error() + "; pass confirm: true to run it",
+			},
+			ID: req.ID,
+		}
+	}
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32603,
+				Message: err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	result := CommandRunData{
+		Name:      name,
+		Arguments: params.Arguments,
+		Output:    output,
+	}
+	if json.Valid([]byte(output)) {
+		result.Result = json.RawMessage(output)
+	}
+
+	return &QueryResponse{
+		Result: result,
+		ID:     req.ID,
+	}
+}
+
+func (h *QueryHandler) handleMessagesSend(ctx context.Context, req *QueryRequest) (resp *QueryResponse) {
+	var params struct {
+		SessionID string `json:"sessionId"`
+		Content   string `json:"content"`
+		// ToolChoice is "auto", "none", "required", or the name of a tool the model must call
+		ToolChoice string `json:"toolChoice,omitempty"`
+		// IdempotencyKey makes a retried send return the first send's result
+		IdempotencyKey string `json:"idempotencyKey,omitempty"`
+		// Confirm lets a destructive slash command such as /clear --hard run
+		Confirm bool `json:"confirm,omitempty"`
+		// AgentID runs the message on an agent created with agents.create instead of
+		// the main agent
+		AgentID string `json:"agentId,omitempty"`
+	}
+
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	if params.SessionID == "" {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Missing required parameter: sessionId",
+			},
+			ID: req.ID,
+		}
+	}
+
+	if params.Content == "" {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Missing required parameter: content",
+			},
+			ID: req.ID,
+		}
+	}
+
+	toolChoice, err := provider.ParseToolChoice(params.ToolChoice)
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	runAgent, err := h.app.Agent(params.AgentID)
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Agent not found: " + params.AgentID,
+			},
+			ID: req.ID,
+		}
+	}
+
+	if params.IdempotencyKey != "" {
+		entry, owner := h.idempotency.begin(params.SessionID, params.IdempotencyKey, time.Now())
+		if !owner {
+			select {
+			case <-entry.done:
+			case <-ctx.Done():
+				return &QueryResponse{
+					Error: &QueryError{
+						Code:    -32000,
+						Message: "Request cancelled: " + ctx.Err().Error(),
+					},
+					ID: req.ID,
+				}
+			}
+			return &QueryResponse{Result: entry.response.Result, Error: entry.response.Error, ID: req.ID}
+		}
+		defer func() {
+			h.idempotency.finish(params.SessionID, params.IdempotencyKey, entry, resp, time.Now())
+		}()
+	}
+
+	// Set the session as current
+	err = h.app.SetCurrentSession(params.SessionID)
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Failed to set session: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	// Check if this is a slash command and handle it immediately
+	if commands.IsSlashCommand(params.Content) {
+		parsed, parseErr := commands.ParseCommand(params.Content)
+		if parseErr != nil {
+			return &QueryResponse{
+				Error: &QueryError{
+					Code:    -32602,
+					Message: "Invalid slash command: " + parseErr.Error(),
+				},
+				ID: req.ID,
+			}
+		}
+
+		log.Printf("Executing command: '%s' with args: '%s'", parsed.Name, parsed.Arguments)
+
+		commandCtx := ctx
+		if params.Confirm {
+			commandCtx = commands.WithConfirmation(ctx)
+		}
+		commandResult, execErr := h.commandRegistry.ExecuteCommand(commandCtx, parsed.Name, parsed.Arguments)
+		if execErr != nil {
+			log.Printf("Command execution failed for '%s': %v", parsed.Name, execErr)
+
+			if errors.Is(execErr, commands.ErrConfirmationRequired) {
+				return &QueryResponse{
+					Error: &QueryError{
+						Code:    -32602,
+						Message: execErr.Error() + "; send it again with confirm: true to run it",
+					},
+					ID: req.ID,
+				}
+			}
+
+			// Check if it's a "command not found" error
+			if strings.Contains(execErr.Error(), "command not found") {
+				// List available commands for debugging
+				allCommands := h.commandRegistry.GetAllCommands()
+				commandNames := getCommandNames(allCommands)
+				log.Printf("Available commands: %v", commandNames)
+
+				return &QueryResponse{
+					Error: &QueryError{
+						Code:    -32000,
+						Message: fmt.Sprintf("Command '%s' not found. Available commands: %v", parsed.Name, commandNames),
+					},
+					ID: req.ID,
+				}
+			}
+
+			return &QueryResponse{
+				Error: &QueryError{
+					Code:    -32000,
+					Message: "Command execution failed: " + execErr.Error(),
+				},
+				ID: req.ID,
+			}
+		}
+
+		log.Printf("Command '%s' executed successfully, result length: %d", parsed.Name, len(commandResult))
+
+		// An expanded prompt template is sent to the agent like a typed message
+		if prompt, ok := commands.PromptFromOutput(commandResult); ok {
+			params.Content = prompt
+		} else {
+			// Return the command result immediately as a message
+			return &QueryResponse{
+				Result: map[string]interface{}{
+					"id":       "cmd-" + parsed.Name,
+					"role":     "assistant",
+					"content":  params.Content,
+					"response": commandResult,
+				},
+				ID: req.ID,
+			}
+		}
+	}
+
+	content, err := agent.LimitMessageLength(params.Content)
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	// Send message to agent. The session is reserved for the run, since another agent
+	// may be asked to run on it at the same time.
+	done, err := h.app.RunReserved(params.SessionID, func() (<-chan agent.AgentEvent, error) {
+		return runAgent.Run(provider.WithToolChoice(ctx, toolChoice), params.SessionID, content)
+	})
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Failed to send message: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	result := finalEvent(done)
 
 	// Check for processing errors
 	if result.Error != nil {
@@ -796,6 +1464,169 @@ func (h *QueryHandler) handleMessagesHistory(ctx context.Context, req *QueryRequ
 	}
 }
 
+func (h *QueryHandler) handleMessagesDelete(ctx context.Context, req *QueryRequest) *QueryResponse {
+	var params struct {
+		SessionID string `json:"sessionId"`
+		MessageID string `json:"messageId"`
+	}
+
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	if params.SessionID == "" || params.MessageID == "" {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Missing required parameters: sessionId and messageId",
+			},
+			ID: req.ID,
+		}
+	}
+
+	msg, err := h.app.Messages.Get(ctx, params.MessageID)
+	if err != nil || msg.SessionID != params.SessionID {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Message not found in session: " + params.MessageID,
+			},
+			ID: req.ID,
+		}
+	}
+
+	if h.app.IsSessionBusy(params.SessionID) {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Cannot delete messages while the session is processing",
+			},
+			ID: req.ID,
+		}
+	}
+
+	// Tool calls and their results are removed together so the history stays valid
+	deleted, err := h.app.Messages.DeleteWithToolPairs(ctx, params.MessageID)
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Failed to delete message: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	sess, err := h.app.Sessions.Get(ctx, params.SessionID)
+	if err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Message deleted but failed to get session: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	return &QueryResponse{
+		Result: DeletedMessagesData{
+			SessionID:    params.SessionID,
+			Deleted:      deleted,
+			MessageCount: sess.MessageCount,
+		},
+		ID: req.ID,
+	}
+}
+
+// handleMessagesRegenerate replaces an assistant message and everything after it with a
+// new response to the user message it answered
+func (h *QueryHandler) handleMessagesRegenerate(ctx context.Context, req *QueryRequest) *QueryResponse {
+	var params struct {
+		SessionID string `json:"sessionId"`
+		MessageID string `json:"messageId"`
+	}
+
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Invalid params: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	if params.SessionID == "" || params.MessageID == "" {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32602,
+				Message: "Missing required parameters: sessionId and messageId",
+			},
+			ID: req.ID,
+		}
+	}
+
+	events, deleted, err := h.app.RegenerateMessage(ctx, params.SessionID, params.MessageID)
+	if err != nil {
+		code := -32000
+		if errors.Is(err, app.ErrMessageNotFound) || errors.Is(err, app.ErrNotAssistantMessage) || errors.Is(err, app.ErrNoPrompt) {
+			code = -32602
+		}
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    code,
+				Message: "Failed to regenerate message: " + err.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	result := finalEvent(events)
+	if result.Error != nil {
+		return &QueryResponse{
+			Error: &QueryError{
+				Code:    -32000,
+				Message: "Agent processing failed: " + result.Error.Error(),
+			},
+			ID: req.ID,
+		}
+	}
+
+	return &QueryResponse{
+		Result: RegeneratedMessageData{
+			Deleted: deleted,
+			Message: MessageData{
+				ID:        result.Message.ID,
+				SessionID: params.SessionID,
+				Role:      "assistant",
+				Content:   result.Message.Content().String(),
+			},
+		},
+		ID: req.ID,
+	}
+}
+
+// finalEvent waits for the last event of an agent run; the events before it report the
+// turn's progress
+func finalEvent(events <-chan agent.AgentEvent) agent.AgentEvent {
+	var result agent.AgentEvent
+	done := false
+	// Read to the end, the session stays reserved until the channel closes
+	for event := range events {
+		if !done {
+			result = event
+			done = event.Done
+		}
+	}
+	return result
+}
+
 func (h *QueryHandler) handleMessagesCrossSessionHistory(ctx context.Context, req *QueryRequest) *QueryResponse {
 	var params struct {
 		ExcludeSessionID string `json:"excludeSessionId"`
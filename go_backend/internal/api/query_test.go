@@ -0,0 +1,892 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"mix/internal/app"
+	"mix/internal/commands"
+	"mix/internal/config"
+	"mix/internal/db"
+	"mix/internal/llm/agent"
+	"mix/internal/llm/models"
+	"mix/internal/llm/tools"
+	"mix/internal/message"
+	"mix/internal/permission"
+	"mix/internal/session"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestApp returns an app with sessions and messages backed by a fresh database
+func newTestApp(t *testing.T) *app.App {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, db.SetupTestDatabase(conn))
+
+	queries := db.New(conn)
+	return &app.App{
+		Sessions: session.NewService(queries),
+		Messages: message.NewService(queries),
+	}
+}
+
+func newTestQueryHandler(t *testing.T) *QueryHandler {
+	t.Helper()
+	return &QueryHandler{
+		app:         newTestApp(t),
+		idempotency: newIdempotencyCache(idempotencyKeyTTL),
+	}
+}
+
+// loadTestConfig loads the config from a .mix.json in a temporary home directory
+func loadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfgJSON := `{"agents": {"main": {"model": "claude-4-sonnet"}, "sub": {"model": "claude-4-sonnet"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".mix.json"), []byte(cfgJSON), 0o644))
+
+	cfg, err := config.Load(home, false, false)
+	require.NoError(t, err)
+	return cfg
+}
+
+func rpcRequest(t *testing.T, method string, params interface{}) *QueryRequest {
+	t.Helper()
+	raw, err := json.Marshal(params)
+	require.NoError(t, err)
+	return &QueryRequest{Method: method, Params: raw, ID: 1}
+}
+
+func TestHandleSessionsCreate_Parent(t *testing.T) {
+	ctx := context.Background()
+	h := newTestQueryHandler(t)
+
+	parent := h.handleSessionsCreate(ctx, rpcRequest(t, "sessions.create", map[string]interface{}{"title": "parent"}))
+	require.Nil(t, parent.Error)
+	parentID := parent.Result.(SessionData).ID
+	assert.Empty(t, parent.Result.(SessionData).ParentID)
+
+	child := h.handleSessionsCreate(ctx, rpcRequest(t, "sessions.create", map[string]interface{}{
+		"title":    "child",
+		"parentId": parentID,
+	}))
+	require.Nil(t, child.Error)
+	assert.Equal(t, parentID, child.Result.(SessionData).ParentID)
+
+	stored, err := h.app.Sessions.Get(ctx, child.Result.(SessionData).ID)
+	require.NoError(t, err)
+	assert.Equal(t, parentID, stored.ParentSessionID)
+
+	missing := h.handleSessionsCreate(ctx, rpcRequest(t, "sessions.create", map[string]interface{}{
+		"title":    "orphan",
+		"parentId": "does-not-exist",
+	}))
+	require.NotNil(t, missing.Error)
+	assert.Equal(t, -32602, missing.Error.Code)
+	assert.Contains(t, missing.Error.Message, "Parent session not found")
+}
+
+func TestHandleSessionsCreate_DefaultTitle(t *testing.T) {
+	ctx := context.Background()
+	h := newTestQueryHandler(t)
+
+	cfg := config.Get()
+	previousFormat, previousDir := cfg.SessionTitleFormat, cfg.WorkingDir
+	t.Cleanup(func() { cfg.SessionTitleFormat, cfg.WorkingDir = previousFormat, previousDir })
+	cfg.WorkingDir = "/home/me/projects/mix"
+	cfg.SessionTitleFormat = "{{dir}} on {{date}}"
+
+	resp := h.handleSessionsCreate(ctx, rpcRequest(t, "sessions.create", map[string]interface{}{}))
+	require.Nil(t, resp.Error)
+	title := resp.Result.(SessionData).Title
+	assert.Regexp(t, `^mix on \d{4}-\d{2}-\d{2}$`, title)
+
+	stored, err := h.app.Sessions.Get(ctx, resp.Result.(SessionData).ID)
+	require.NoError(t, err)
+	assert.Equal(t, title, stored.Title)
+
+	// A given title is used as is
+	resp = h.handleSessionsCreate(ctx, rpcRequest(t, "sessions.create", map[string]interface{}{"title": "Logo ideas"}))
+	require.Nil(t, resp.Error)
+	assert.Equal(t, "Logo ideas", resp.Result.(SessionData).Title)
+}
+
+func TestHandleMessagesDelete(t *testing.T) {
+	ctx := context.Background()
+	h := newTestQueryHandler(t)
+
+	sess, err := h.app.Sessions.Create(ctx, "cleanup")
+	require.NoError(t, err)
+	create := func(role message.MessageRole, parts ...message.ContentPart) message.Message {
+		msg, err := h.app.Messages.Create(ctx, sess.ID, message.CreateMessageParams{Role: role, Parts: parts})
+		require.NoError(t, err)
+		return msg
+	}
+	user := create(message.User, message.TextContent{Text: "list files"})
+	toolUse := create(message.Assistant, message.ToolCall{ID: "call-1", Name: "ls", Input: "{}", Finished: true})
+	toolResult := create(message.Tool, message.ToolResult{ToolCallID: "call-1", Name: "ls", Content: "garbage"})
+	reply := create(message.Assistant, message.TextContent{Text: "done"})
+
+	deleteMessage := func(sessionID, messageID string) *QueryResponse {
+		return h.handleMessagesDelete(ctx, rpcRequest(t, "messages.delete", map[string]string{
+			"sessionId": sessionID,
+			"messageId": messageID,
+		}))
+	}
+	remaining := func() []string {
+		messages, err := h.app.Messages.List(ctx, sess.ID)
+		require.NoError(t, err)
+		var ids []string
+		for _, msg := range messages {
+			ids = append(ids, msg.ID)
+		}
+		return ids
+	}
+
+	t.Run("single message", func(t *testing.T) {
+		response := deleteMessage(sess.ID, reply.ID)
+		require.Nil(t, response.Error)
+		result := response.Result.(DeletedMessagesData)
+		assert.Equal(t, []string{reply.ID}, result.Deleted)
+		assert.Equal(t, int64(3), result.MessageCount)
+	})
+
+	t.Run("tool result removes its tool use", func(t *testing.T) {
+		response := deleteMessage(sess.ID, toolResult.ID)
+		require.Nil(t, response.Error)
+		result := response.Result.(DeletedMessagesData)
+		assert.ElementsMatch(t, []string{toolResult.ID, toolUse.ID}, result.Deleted)
+		assert.Equal(t, int64(1), result.MessageCount)
+		assert.Equal(t, []string{user.ID}, remaining())
+	})
+
+	t.Run("message from another session", func(t *testing.T) {
+		other, err := h.app.Sessions.Create(ctx, "other")
+		require.NoError(t, err)
+		response := deleteMessage(other.ID, user.ID)
+		require.NotNil(t, response.Error)
+		assert.Equal(t, -32602, response.Error.Code)
+		assert.Equal(t, []string{user.ID}, remaining())
+	})
+
+	t.Run("missing params", func(t *testing.T) {
+		response := deleteMessage(sess.ID, "")
+		require.NotNil(t, response.Error)
+		assert.Equal(t, -32602, response.Error.Code)
+	})
+}
+
+func TestHandleMCPList_Disabled(t *testing.T) {
+	cfg := config.Get()
+	cfg.MCPServers = map[string]config.MCPServer{
+		"video": {Type: config.MCPStdio, Command: "mix-test-missing-mcp-server"},
+	}
+	cfg.DisableMCP = true
+	t.Cleanup(func() {
+		cfg.MCPServers = make(map[string]config.MCPServer)
+		cfg.DisableMCP = false
+	})
+
+	h := newTestQueryHandler(t)
+	response := h.handleMCPList(context.Background(), rpcRequest(t, "mcp.list", nil))
+	require.Nil(t, response.Error)
+	assert.Equal(t, []MCPServerData{{Name: "video", Status: "disabled", Tools: []ToolData{}}}, response.Result)
+}
+
+func TestHandleMCPList_UnderscoreNames(t *testing.T) {
+	serve := func(toolNames ...string) config.MCPServer {
+		s := server.NewMCPServer("test", "1.0.0")
+		for _, name := range toolNames {
+			s.AddTool(mcp.NewTool(name, mcp.WithDescription(name)), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return mcp.NewToolResultText("ok"), nil
+			})
+		}
+		testServer := server.NewTestServer(s)
+		t.Cleanup(func() {
+			testServer.CloseClientConnections()
+			testServer.Close()
+		})
+		return config.MCPServer{Type: config.MCPSse, URL: testServer.URL + "/sse"}
+	}
+
+	cfg := config.Get()
+	cfg.MCPServers = map[string]config.MCPServer{
+		"a":   serve("b_c", "read_file"),
+		"a_b": serve("c"),
+	}
+	t.Cleanup(func() { cfg.MCPServers = make(map[string]config.MCPServer) })
+
+	h := newTestQueryHandler(t)
+	response := h.handleMCPList(context.Background(), rpcRequest(t, "mcp.list", nil))
+	require.Nil(t, response.Error)
+	assert.Equal(t, []MCPServerData{
+		{Name: "a", Connected: true, Status: "connected", Tools: []ToolData{
+			{Name: "b_c", Description: "b_c", ConflictsWith: []string{"a_b"}},
+			{Name: "read_file", Description: "read_file"},
+		}},
+		{Name: "a_b", Connected: true, Status: "connected", Tools: []ToolData{
+			{Name: "c", Description: "c", ConflictsWith: []string{"a"}},
+		}},
+	}, response.Result)
+}
+
+func TestHandleCommandsRun(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+	h := newTestQueryHandler(t)
+	h.commandRegistry = commands.NewRegistry()
+	require.NoError(t, h.commandRegistry.LoadCommands(h.app))
+
+	t.Run("builtin command", func(t *testing.T) {
+		resp := h.Handle(ctx, rpcRequest(t, "commands.run", map[string]string{"name": "/help"}))
+		require.Nil(t, resp.Error)
+
+		result := resp.Result.(CommandRunData)
+		assert.Equal(t, "help", result.Name)
+		var help struct {
+			Type     string        `json:"type"`
+			Commands []interface{} `json:"commands"`
+		}
+		require.NoError(t, json.Unmarshal(result.Result, &help))
+		assert.Equal(t, "help", help.Type)
+		assert.NotEmpty(t, help.Commands)
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		resp := h.Handle(ctx, rpcRequest(t, "commands.run", map[string]string{"name": "no-such-command"}))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, -32602, resp.Error.Code)
+		assert.Contains(t, resp.Error.Message, "no-such-command")
+	})
+
+	t.Run("missing name", func(t *testing.T) {
+		resp := h.Handle(ctx, rpcRequest(t, "commands.run", map[string]string{"arguments": "x"}))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, -32602, resp.Error.Code)
+	})
+
+	t.Run("destructive command without confirmation", func(t *testing.T) {
+		resp := h.Handle(ctx, rpcRequest(t, "commands.run", map[string]any{"name": "clear", "arguments": "--hard"}))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, -32602, resp.Error.Code)
+		assert.Contains(t, resp.Error.Message, "confirm")
+
+		resp = h.Handle(ctx, rpcRequest(t, "commands.run", map[string]any{"name": "clear", "arguments": "--hard", "confirm": true}))
+		require.Nil(t, resp.Error)
+	})
+}
+
+// countingAgent answers every run with a numbered reply
+type countingAgent struct {
+	agent.Service
+	runs int
+}
+
+func (a *countingAgent) IsSessionBusy(sessionID string) bool { return false }
+
+func (a *countingAgent) Run(ctx context.Context, sessionID string, content string, attachments ...message.Attachment) (<-chan agent.AgentEvent, error) {
+	a.runs++
+	events := make(chan agent.AgentEvent, 1)
+	events <- agent.AgentEvent{
+		Type: agent.AgentEventTypeResponse,
+		Message: message.Message{
+			ID:    fmt.Sprintf("reply-%d", a.runs),
+			Role:  message.Assistant,
+			Parts: []message.ContentPart{message.TextContent{Text: fmt.Sprintf("reply %d", a.runs)}},
+		},
+		SessionID: sessionID,
+		Done:      true,
+	}
+	close(events)
+	return events, nil
+}
+
+// replyingAgent stores each message it is sent with a reply, like the real agent
+type replyingAgent struct {
+	agent.Service
+	messages    message.Service
+	prompts     []string
+	attachments [][]message.Attachment
+}
+
+func (a *replyingAgent) IsSessionBusy(sessionID string) bool { return false }
+
+func (a *replyingAgent) Run(ctx context.Context, sessionID string, content string, attachments ...message.Attachment) (<-chan agent.AgentEvent, error) {
+	a.prompts = append(a.prompts, content)
+	a.attachments = append(a.attachments, attachments)
+	if _, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: content}}}); err != nil {
+		return nil, err
+	}
+	reply, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{Role: message.Assistant, Parts: []message.ContentPart{message.TextContent{Text: "again: " + content}}})
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan agent.AgentEvent, 1)
+	events <- agent.AgentEvent{Type: agent.AgentEventTypeResponse, Message: reply, SessionID: sessionID, Done: true}
+	close(events)
+	return events, nil
+}
+
+func TestHandleMessagesRegenerate(t *testing.T) {
+	ctx := context.Background()
+	h := newTestQueryHandler(t)
+	replying := &replyingAgent{messages: h.app.Messages}
+	h.app.CoderAgent = replying
+
+	sess, err := h.app.Sessions.Create(ctx, "regenerate")
+	require.NoError(t, err)
+	create := func(role message.MessageRole, parts ...message.ContentPart) message.Message {
+		msg, err := h.app.Messages.Create(ctx, sess.ID, message.CreateMessageParams{Role: role, Parts: parts})
+		require.NoError(t, err)
+		return msg
+	}
+	firstPrompt := create(message.User, message.TextContent{Text: "list files"})
+	firstReply := create(message.Assistant, message.TextContent{Text: "main.go"})
+	image := message.BinaryContent{Path: "/tmp/diagram.png", MIMEType: "image/png", Data: []byte("png")}
+	secondPrompt := create(message.User, message.TextContent{Text: "describe the diagram"}, image)
+	toolUse := create(message.Assistant, message.ToolCall{ID: "call-1", Name: "view", Input: "{}", Finished: true})
+	toolResult := create(message.Tool, message.ToolResult{ToolCallID: "call-1", Name: "view", Content: "boxes"})
+	secondReply := create(message.Assistant, message.TextContent{Text: "It shows boxes"})
+	thirdPrompt := create(message.User, message.TextContent{Text: "thanks"})
+	thirdReply := create(message.Assistant, message.TextContent{Text: "You're welcome"})
+
+	regenerate := func(sessionID, messageID string) *QueryResponse {
+		return h.Handle(ctx, rpcRequest(t, "messages.regenerate", map[string]string{
+			"sessionId": sessionID,
+			"messageId": messageID,
+		}))
+	}
+
+	t.Run("rejects messages the model didn't write", func(t *testing.T) {
+		for _, msg := range []message.Message{secondPrompt, toolResult} {
+			resp := regenerate(sess.ID, msg.ID)
+			require.NotNil(t, resp.Error)
+			assert.Equal(t, -32602, resp.Error.Code)
+		}
+		other, err := h.app.Sessions.Create(ctx, "other")
+		require.NoError(t, err)
+		resp := regenerate(other.ID, secondReply.ID)
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, -32602, resp.Error.Code)
+		assert.Empty(t, replying.prompts)
+	})
+
+	t.Run("middle message", func(t *testing.T) {
+		resp := regenerate(sess.ID, toolUse.ID)
+		require.Nil(t, resp.Error)
+		result := resp.Result.(RegeneratedMessageData)
+		assert.Equal(t, []string{secondPrompt.ID, toolUse.ID, toolResult.ID, secondReply.ID, thirdPrompt.ID, thirdReply.ID}, result.Deleted)
+		assert.Equal(t, "again: describe the diagram", result.Message.Content)
+
+		// The prompt is sent again with its attachment
+		require.Equal(t, []string{"describe the diagram"}, replying.prompts)
+		require.Len(t, replying.attachments[0], 1)
+		assert.Equal(t, "/tmp/diagram.png", replying.attachments[0][0].FilePath)
+		assert.Equal(t, []byte("png"), replying.attachments[0][0].Content)
+
+		messages, err := h.app.Messages.List(ctx, sess.ID)
+		require.NoError(t, err)
+		var texts []string
+		for _, msg := range messages {
+			texts = append(texts, msg.Content().Text)
+		}
+		assert.Equal(t, []string{"list files", "main.go", "describe the diagram", "again: describe the diagram"}, texts)
+		assert.Equal(t, firstPrompt.ID, messages[0].ID)
+		assert.Equal(t, firstReply.ID, messages[1].ID)
+	})
+
+	t.Run("summarized message", func(t *testing.T) {
+		sess.SummaryMessageID = firstReply.ID
+		_, err := h.app.Sessions.Save(ctx, sess)
+		require.NoError(t, err)
+
+		resp := regenerate(sess.ID, firstReply.ID)
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, -32602, resp.Error.Code)
+		assert.Contains(t, resp.Error.Message, "summary")
+	})
+}
+
+func TestHandleMessagesSend_IdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	h := newTestQueryHandler(t)
+	counting := &countingAgent{}
+	h.app.CoderAgent = counting
+
+	sess, err := h.app.Sessions.Create(ctx, "idempotent")
+	require.NoError(t, err)
+	send := func(key string) MessageData {
+		resp := h.Handle(ctx, rpcRequest(t, "messages.send", map[string]string{
+			"sessionId":      sess.ID,
+			"content":        "hello",
+			"idempotencyKey": key,
+		}))
+		require.Nil(t, resp.Error)
+		return resp.Result.(MessageData)
+	}
+
+	first := send("attempt-1")
+	assert.Equal(t, "reply 1", first.Response)
+
+	// A retry with the same key gets the first result without running the agent again
+	assert.Equal(t, first, send("attempt-1"))
+	assert.Equal(t, 1, counting.runs)
+
+	// A new key is a new message
+	assert.Equal(t, "reply 2", send("attempt-2").Response)
+	assert.Equal(t, 2, counting.runs)
+}
+
+func TestHandleMessagesSend_MessageLimit(t *testing.T) {
+	ctx := context.Background()
+	h := newTestQueryHandler(t)
+	replying := &replyingAgent{messages: h.app.Messages}
+	h.app.CoderAgent = replying
+
+	cfg := config.Get()
+	original := cfg.MessageLimit
+	t.Cleanup(func() { cfg.MessageLimit = original })
+
+	sess, err := h.app.Sessions.Create(ctx, "limited")
+	require.NoError(t, err)
+	send := func() *QueryResponse {
+		return h.Handle(ctx, rpcRequest(t, "messages.send", map[string]string{
+			"sessionId": sess.ID,
+			"content":   "this message is too long",
+		}))
+	}
+
+	cfg.MessageLimit = config.MessageLimitConfig{MaxLength: 10, Policy: config.MessageLimitReject}
+	resp := send()
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, -32602, resp.Error.Code)
+	assert.Contains(t, resp.Error.Message, "message is too long")
+	assert.Empty(t, replying.prompts)
+
+	cfg.MessageLimit = config.MessageLimitConfig{MaxLength: 10, Policy: config.MessageLimitTruncate}
+	resp = send()
+	require.Nil(t, resp.Error)
+	assert.Equal(t, []string{"this messa"}, replying.prompts)
+}
+
+func TestHandleMessagesSend_PromptTemplate(t *testing.T) {
+	ctx := context.Background()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	promptsDir := filepath.Join(home, ".mix", "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "review.md"), []byte("Review {{file}} carefully.\n"), 0o644))
+
+	h := newTestQueryHandler(t)
+	h.commandRegistry = commands.NewRegistry()
+	require.NoError(t, h.commandRegistry.LoadCommands(h.app))
+	replying := &replyingAgent{messages: h.app.Messages}
+	h.app.CoderAgent = replying
+
+	sess, err := h.app.Sessions.Create(ctx, "prompt")
+	require.NoError(t, err)
+	resp := h.Handle(ctx, rpcRequest(t, "messages.send", map[string]string{
+		"sessionId": sess.ID,
+		"content":   "/prompt review file=agent.go",
+	}))
+	require.Nil(t, resp.Error)
+
+	// The expanded template is run as the user's message
+	assert.Equal(t, []string{"Review agent.go carefully."}, replying.prompts)
+	assert.Equal(t, "Review agent.go carefully.", resp.Result.(MessageData).Content)
+}
+
+func TestIdempotencyCache_Expiry(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute)
+	now := time.Now()
+
+	entry, owner := cache.begin("session", "key", now)
+	require.True(t, owner)
+	cache.finish("session", "key", entry, &QueryResponse{Result: "done"}, now)
+
+	cached, owner := cache.begin("session", "key", now.Add(30*time.Second))
+	assert.False(t, owner)
+	assert.Equal(t, "done", cached.response.Result)
+
+	// Keys are per session
+	_, owner = cache.begin("other-session", "key", now)
+	assert.True(t, owner)
+
+	_, owner = cache.begin("session", "key", now.Add(2*time.Minute))
+	assert.True(t, owner, "expired keys are forgotten")
+
+	// Failed sends are not cached
+	entry, _ = cache.begin("session", "failing", now)
+	cache.finish("session", "failing", entry, &QueryResponse{Error: &QueryError{Code: -32000}}, now)
+	_, owner = cache.begin("session", "failing", now)
+	assert.True(t, owner)
+}
+
+// modelAgent reports a fixed model
+type modelAgent struct {
+	agent.Service
+	model models.Model
+}
+
+func (a *modelAgent) Model() models.Model {
+	return a.model
+}
+
+func TestHandleAgentInfo(t *testing.T) {
+	ctx := context.Background()
+	h := newTestQueryHandler(t)
+
+	cfg := config.Get()
+	original, configured := cfg.Agents[config.AgentMain]
+	t.Cleanup(func() {
+		if configured {
+			cfg.Agents[config.AgentMain] = original
+		} else {
+			delete(cfg.Agents, config.AgentMain)
+		}
+	})
+
+	info := func(t *testing.T, model models.ModelID, agentConfig config.Agent) AgentInfoData {
+		agentConfig.Model = model
+		cfg.Agents[config.AgentMain] = agentConfig
+		h.app.CoderAgent = &modelAgent{model: models.SupportedModels[model]}
+		resp := h.Handle(ctx, &QueryRequest{Method: "agent.info", ID: 1})
+		require.Nil(t, resp.Error)
+		return resp.Result.(AgentInfoData)
+	}
+
+	t.Run("configured agent", func(t *testing.T) {
+		model := models.SupportedModels[models.Claude4Sonnet]
+		assert.Equal(t, AgentInfoData{
+			Agent:         config.AgentMain,
+			Model:         models.Claude4Sonnet,
+			ModelName:     model.Name,
+			Provider:      models.ProviderAnthropic,
+			ContextWindow: model.ContextWindow,
+			MaxTokens:     4096,
+		}, info(t, models.Claude4Sonnet, config.Agent{MaxTokens: 4096}))
+	})
+
+	t.Run("model defaults and reasoning effort", func(t *testing.T) {
+		model := models.SupportedModels[models.O4Mini]
+		got := info(t, models.O4Mini, config.Agent{ReasoningEffort: "high"})
+		assert.Equal(t, model.DefaultMaxTokens, got.MaxTokens)
+		assert.Equal(t, "high", got.ReasoningEffort)
+	})
+
+	t.Run("reasoning effort is left out for models that can't reason", func(t *testing.T) {
+		got := info(t, models.GPT41, config.Agent{ReasoningEffort: "high"})
+		assert.Empty(t, got.ReasoningEffort)
+	})
+}
+
+func TestHandleAgentsCreate(t *testing.T) {
+	ctx := context.Background()
+	h := newTestQueryHandler(t)
+
+	// No stored OAuth credentials, so Anthropic uses the API key
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.Get()
+	original := *cfg
+	cfg.Providers = map[models.ModelProvider]config.Provider{models.ProviderAnthropic: {APIKey: "configured-key"}}
+	cfg.Agents = map[config.AgentName]config.Agent{
+		config.AgentMain: {Model: models.Claude4Sonnet},
+		config.AgentSub:  {Model: models.Claude4Sonnet},
+	}
+	// The system prompt is loaded from the module root
+	workingDir, err := filepath.Abs("../..")
+	require.NoError(t, err)
+	cfg.WorkingDir = workingDir
+	t.Cleanup(func() {
+		cfg.Providers, cfg.Agents, cfg.WorkingDir = original.Providers, original.Agents, original.WorkingDir
+	})
+
+	// Each turn is answered with the model and key it was sent with, once both turns
+	// have arrived, so the agents must be running at the same time
+	arrived := make(chan struct{}, 2)
+	bothArrived := make(chan struct{})
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		// Title requests can still be in flight when the test ends and the server closes
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reply := body.Model + " " + r.Header.Get("X-Api-Key")
+		if !body.Stream {
+			// Title requests
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id": "msg_title", "type": "message", "role": "assistant", "model": %q, "content": [{"type": "text", "text": "Title"}], "stop_reason": "end_turn", "usage": {"input_tokens": 1, "output_tokens": 1}}`, body.Model)
+			return
+		}
+
+		arrived <- struct{}{}
+		if len(arrived) == 2 {
+			once.Do(func() { close(bothArrived) })
+		}
+		select {
+		case <-bothArrived:
+		case <-time.After(5 * time.Second):
+			http.Error(w, "the other agent's turn never arrived", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			fmt.Sprintf(`{"type": "message_start", "message": {"id": "msg_1", "type": "message", "role": "assistant", "model": %q, "content": [], "usage": {"input_tokens": 5, "output_tokens": 1}}}`, body.Model),
+			`{"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}`,
+			fmt.Sprintf(`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": %q}}`, reply),
+			`{"type": "content_block_stop", "index": 0}`,
+			`{"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 3}}`,
+			`{"type": "message_stop"}`,
+		} {
+			var payload struct {
+				Type string `json:"type"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(event), &payload))
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", payload.Type, event)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("ANTHROPIC_BASE_URL", server.URL)
+
+	create := func(t *testing.T, params map[string]string) AgentData {
+		resp := h.Handle(ctx, rpcRequest(t, "agents.create", params))
+		require.Nil(t, resp.Error)
+		return resp.Result.(AgentData)
+	}
+	sonnet := create(t, map[string]string{"model": string(models.Claude4Sonnet), "apiKey": "sonnet-key"})
+	haiku := create(t, map[string]string{"model": string(models.Claude35Haiku), "apiKey": "haiku-key"})
+	assert.NotEqual(t, sonnet.ID, haiku.ID)
+	assert.Equal(t, models.Claude35Haiku, haiku.Model)
+	assert.Equal(t, models.ProviderAnthropic, haiku.Provider)
+
+	send := func(agentID string) *QueryResponse {
+		sess, err := h.app.Sessions.Create(ctx, "test session")
+		require.NoError(t, err)
+		return h.Handle(ctx, rpcRequest(t, "messages.send", map[string]string{
+			"sessionId": sess.ID,
+			"content":   "Which model are you?",
+			"agentId":   agentID,
+		}))
+	}
+
+	var wg sync.WaitGroup
+	responses := make([]*QueryResponse, 2)
+	for i, id := range []string{sonnet.ID, haiku.ID} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = send(id)
+		}()
+	}
+	wg.Wait()
+
+	for i, want := range []string{
+		models.SupportedModels[models.Claude4Sonnet].APIModel + " sonnet-key",
+		models.SupportedModels[models.Claude35Haiku].APIModel + " haiku-key",
+	} {
+		require.Nil(t, responses[i].Error)
+		assert.Contains(t, fmt.Sprint(responses[i].Result), want)
+	}
+
+	// Creating agents leaves the configuration alone
+	assert.Equal(t, models.Claude4Sonnet, cfg.Agents[config.AgentMain].Model)
+	assert.Equal(t, "configured-key", cfg.Providers[models.ProviderAnthropic].APIKey)
+
+	t.Run("unknown agent", func(t *testing.T) {
+		resp := send("missing")
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, -32000, resp.Error.Code)
+	})
+
+	t.Run("missing model", func(t *testing.T) {
+		resp := h.Handle(ctx, rpcRequest(t, "agents.create", map[string]string{}))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, -32602, resp.Error.Code)
+	})
+
+	t.Run("unsupported model", func(t *testing.T) {
+		resp := h.Handle(ctx, rpcRequest(t, "agents.create", map[string]string{"model": "no-such-model"}))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, -32000, resp.Error.Code)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		resp := h.Handle(ctx, rpcRequest(t, "agents.delete", map[string]string{"id": haiku.ID}))
+		require.Nil(t, resp.Error)
+
+		resp = send(haiku.ID)
+		require.NotNil(t, resp.Error)
+		assert.Contains(t, resp.Error.Message, "Agent not found")
+
+		resp = h.Handle(ctx, rpcRequest(t, "agents.delete", map[string]string{"id": haiku.ID}))
+		require.NotNil(t, resp.Error)
+		assert.Contains(t, resp.Error.Message, "agent not found")
+
+		resp = h.Handle(ctx, rpcRequest(t, "agents.delete", map[string]string{}))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, -32602, resp.Error.Code)
+	})
+}
+
+// mcpAgent records the MCP tools it is given
+type mcpAgent struct {
+	agent.Service
+	mcpTools []tools.BaseTool
+	updates  int
+}
+
+func (a *mcpAgent) IsBusy() bool { return false }
+
+func (a *mcpAgent) SetMCPTools(mcpTools []tools.BaseTool) error {
+	a.mcpTools = mcpTools
+	a.updates++
+	return nil
+}
+
+func TestHandleMCPAddRemove(t *testing.T) {
+	ctx := context.Background()
+	h := newTestQueryHandler(t)
+	coder := &mcpAgent{}
+	h.app.CoderAgent = coder
+
+	loadTestConfig(t)
+	configPath := filepath.Join(os.Getenv("HOME"), ".mix.json")
+
+	savedServers := func(t *testing.T) map[string]config.MCPServer {
+		data, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		var saved config.Config
+		require.NoError(t, json.Unmarshal(data, &saved))
+		return saved.MCPServers
+	}
+
+	// The server is saved even though it cannot be reached, and the failure is reported
+	resp := h.Handle(ctx, rpcRequest(t, "mcp.add", map[string]interface{}{
+		"name":   "broken",
+		"server": map[string]interface{}{"command": "mix-test-missing-mcp-server", "args": []string{"--stdio"}},
+	}))
+	require.Nil(t, resp.Error)
+	status := resp.Result.(agent.MCPServerStatus)
+	assert.Equal(t, "broken", status.Name)
+	assert.False(t, status.Connected)
+	assert.NotEmpty(t, status.Error)
+
+	assert.Equal(t, config.MCPServer{Type: config.MCPStdio, Command: "mix-test-missing-mcp-server", Args: []string{"--stdio"}}, config.Get().MCPServers["broken"])
+	assert.Contains(t, savedServers(t), "broken")
+	assert.Equal(t, 1, coder.updates, "the agent's MCP tools are reloaded")
+
+	resp = h.Handle(ctx, rpcRequest(t, "mcp.test", map[string]string{"name": "broken"}))
+	require.Nil(t, resp.Error)
+	assert.False(t, resp.Result.(agent.MCPServerStatus).Connected)
+
+	// Invalid servers are rejected without touching the config
+	resp = h.Handle(ctx, rpcRequest(t, "mcp.add", map[string]interface{}{"name": "remote", "server": map[string]interface{}{"type": "sse"}}))
+	require.NotNil(t, resp.Error)
+	assert.Contains(t, resp.Error.Message, "needs a URL")
+	assert.NotContains(t, savedServers(t), "remote")
+
+	resp = h.Handle(ctx, rpcRequest(t, "mcp.remove", map[string]string{"name": "broken"}))
+	require.Nil(t, resp.Error)
+	assert.NotContains(t, config.Get().MCPServers, "broken")
+	assert.NotContains(t, savedServers(t), "broken")
+	assert.Equal(t, 2, coder.updates)
+	assert.Empty(t, coder.mcpTools)
+
+	resp = h.Handle(ctx, rpcRequest(t, "mcp.test", map[string]string{"name": "broken"}))
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, -32602, resp.Error.Code)
+
+	resp = h.Handle(ctx, rpcRequest(t, "mcp.remove", map[string]string{"name": "broken"}))
+	require.NotNil(t, resp.Error)
+}
+
+// toolsAgent offers a fixed set of tools
+type toolsAgent struct {
+	agent.Service
+	tools []tools.BaseTool
+}
+
+func (a *toolsAgent) Tools() []tools.BaseTool { return a.tools }
+
+func TestHandleToolsDescribe(t *testing.T) {
+	ctx := context.Background()
+	h := newTestQueryHandler(t)
+	h.app.CoderAgent = &toolsAgent{tools: []tools.BaseTool{
+		tools.NewLsTool(),
+		tools.NewBashTool(permission.NewPermissionService()),
+	}}
+
+	t.Run("lists tools by name", func(t *testing.T) {
+		response := h.Handle(ctx, rpcRequest(t, "tools.list", nil))
+		require.Nil(t, response.Error)
+		list := response.Result.([]ToolData)
+		require.Len(t, list, 2)
+		assert.Equal(t, tools.BashToolName, list[0].Name)
+		assert.Equal(t, tools.LSToolName, list[1].Name)
+	})
+
+	t.Run("built-in tool schema", func(t *testing.T) {
+		response := h.Handle(ctx, rpcRequest(t, "tools.describe", map[string]string{"name": tools.BashToolName}))
+		require.Nil(t, response.Error)
+
+		// Round-trip through JSON as a client would see it
+		raw, err := json.Marshal(response.Result)
+		require.NoError(t, err)
+		var schema struct {
+			Name        string   `json:"name"`
+			Description string   `json:"description"`
+			Required    []string `json:"required"`
+			Parameters  struct {
+				Type       string                    `json:"type"`
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"parameters"`
+		}
+		require.NoError(t, json.Unmarshal(raw, &schema))
+
+		assert.Equal(t, tools.BashToolName, schema.Name)
+		assert.NotEmpty(t, schema.Description)
+		assert.Equal(t, []string{"command"}, schema.Required)
+		assert.Equal(t, "object", schema.Parameters.Type)
+		assert.Equal(t, []string{"command"}, schema.Parameters.Required)
+		assert.Equal(t, "string", schema.Parameters.Properties["command"]["type"])
+		assert.Equal(t, "number", schema.Parameters.Properties["timeout"]["type"])
+	})
+
+	t.Run("unknown tool", func(t *testing.T) {
+		response := h.Handle(ctx, rpcRequest(t, "tools.describe", map[string]string{"name": "teleport"}))
+		require.NotNil(t, response.Error)
+		assert.Equal(t, -32000, response.Error.Code)
+		assert.Equal(t, "Tool not found: teleport", response.Error.Message)
+	})
+
+	t.Run("missing name", func(t *testing.T) {
+		response := h.Handle(ctx, rpcRequest(t, "tools.describe", map[string]string{}))
+		require.NotNil(t, response.Error)
+		assert.Equal(t, -32602, response.Error.Code)
+	})
+}
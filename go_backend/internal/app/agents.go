@@ -0,0 +1,147 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"mix/internal/config"
+	"mix/internal/llm/agent"
+
+	"github.com/google/uuid"
+)
+
+// ErrAgentNotFound is returned when no agent has the requested id
+var ErrAgentNotFound = errors.New("agent not found")
+
+// ErrAgentBusy is returned when deleting an agent that is processing a message
+var ErrAgentBusy = errors.New("agent is processing a message")
+
+// CreateAgent creates an agent isolated from CoderAgent and the other agents, with its
+// own providers built from the configuration and overrides, and returns its id. The
+// agent shares the app's sessions, messages and MCP connections, and its subagents use
+// the configured sub agent.
+func (a *App) CreateAgent(overrides agent.AgentOverrides) (string, agent.Service, error) {
+	created, err := agent.NewIsolatedAgent(
+		config.AgentMain,
+		overrides,
+		a.Sessions,
+		a.Messages,
+		agent.CoderAgentTools(
+			a.Permissions,
+			a.Sessions,
+			a.Messages,
+			a.History,
+			a.mcpManager(),
+		),
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create agent: %w", err)
+	}
+
+	id := uuid.New().String()
+	a.agentsMu.Lock()
+	defer a.agentsMu.Unlock()
+	if a.agents == nil {
+		a.agents = make(map[string]agent.Service)
+	}
+	a.agents[id] = created
+	return id, created, nil
+}
+
+// Agent returns the agent with the given id, or CoderAgent when id is empty
+func (a *App) Agent(id string) (agent.Service, error) {
+	if id == "" {
+		return a.CoderAgent, nil
+	}
+	a.agentsMu.RLock()
+	defer a.agentsMu.RUnlock()
+	found, ok := a.agents[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAgentNotFound, id)
+	}
+	return found, nil
+}
+
+// DeleteAgent removes an agent created with CreateAgent. An agent that is processing a
+// message can't be deleted; cancel its run first.
+func (a *App) DeleteAgent(id string) error {
+	a.agentsMu.Lock()
+	defer a.agentsMu.Unlock()
+	found, ok := a.agents[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, id)
+	}
+	if found.IsBusy() {
+		return fmt.Errorf("%w: %s", ErrAgentBusy, id)
+	}
+	delete(a.agents, id)
+	return nil
+}
+
+// IsSessionBusy reports whether the session is reserved for a run, or CoderAgent or any
+// created agent is processing a message in it
+func (a *App) IsSessionBusy(sessionID string) bool {
+	if _, reserved := a.reservedSessions.Load(sessionID); reserved {
+		return true
+	}
+	return a.isAgentBusy(sessionID)
+}
+
+// ReserveSession claims the session for a run until release is called, so runs started
+// through different agents can't overlap. It fails with agent.ErrSessionBusy when the
+// session is already reserved or an agent is processing a message in it.
+func (a *App) ReserveSession(sessionID string) (release func(), err error) {
+	if _, loaded := a.reservedSessions.LoadOrStore(sessionID, struct{}{}); loaded {
+		return nil, agent.ErrSessionBusy
+	}
+	if a.isAgentBusy(sessionID) {
+		a.reservedSessions.Delete(sessionID)
+		return nil, agent.ErrSessionBusy
+	}
+	return sync.OnceFunc(func() { a.reservedSessions.Delete(sessionID) }), nil
+}
+
+// RunReserved reserves the session and starts a run on it with run. The reservation is
+// held until the returned channel closes, so callers must read it to the end.
+func (a *App) RunReserved(sessionID string, run func() (<-chan agent.AgentEvent, error)) (<-chan agent.AgentEvent, error) {
+	release, err := a.ReserveSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := run()
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return releaseWhenClosed(events, release), nil
+}
+
+// releaseWhenClosed forwards a run's events and calls release once they are all read
+func releaseWhenClosed(events <-chan agent.AgentEvent, release func()) <-chan agent.AgentEvent {
+	forwarded := make(chan agent.AgentEvent)
+	go func() {
+		defer release()
+		defer close(forwarded)
+		for event := range events {
+			forwarded <- event
+		}
+	}()
+	return forwarded
+}
+
+// isAgentBusy reports whether CoderAgent or any created agent is processing a message
+// in the session
+func (a *App) isAgentBusy(sessionID string) bool {
+	if a.CoderAgent != nil && a.CoderAgent.IsSessionBusy(sessionID) {
+		return true
+	}
+	a.agentsMu.RLock()
+	defer a.agentsMu.RUnlock()
+	for _, created := range a.agents {
+		if created.IsSessionBusy(sessionID) {
+			return true
+		}
+	}
+	return false
+}
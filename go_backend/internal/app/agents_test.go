@@ -0,0 +1,103 @@
+package app
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mix/internal/llm/agent"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionAgent is processing messages in the given sessions
+type sessionAgent struct {
+	agent.Service
+	busy map[string]bool
+}
+
+func (a *sessionAgent) IsSessionBusy(sessionID string) bool { return a.busy[sessionID] }
+
+func (a *sessionAgent) IsBusy() bool { return len(a.busy) > 0 }
+
+func TestIsSessionBusy(t *testing.T) {
+	testApp := newTestApp(t)
+	assert.False(t, testApp.IsSessionBusy("session"), "no agents")
+
+	testApp.CoderAgent = &sessionAgent{busy: map[string]bool{"coder-session": true}}
+	testApp.agents = map[string]agent.Service{
+		"created": &sessionAgent{busy: map[string]bool{"created-session": true}},
+	}
+
+	assert.True(t, testApp.IsSessionBusy("coder-session"))
+	assert.True(t, testApp.IsSessionBusy("created-session"), "sessions busy on created agents count too")
+	assert.False(t, testApp.IsSessionBusy("idle-session"))
+}
+
+func TestDeleteAgent(t *testing.T) {
+	testApp := newTestApp(t)
+	testApp.agents = map[string]agent.Service{
+		"idle": &sessionAgent{},
+		"busy": &sessionAgent{busy: map[string]bool{"session": true}},
+	}
+
+	require.NoError(t, testApp.DeleteAgent("idle"))
+	_, err := testApp.Agent("idle")
+	assert.ErrorIs(t, err, ErrAgentNotFound)
+	assert.ErrorIs(t, testApp.DeleteAgent("idle"), ErrAgentNotFound)
+
+	assert.ErrorIs(t, testApp.DeleteAgent("busy"), ErrAgentBusy)
+	_, err = testApp.Agent("busy")
+	assert.NoError(t, err, "a busy agent is kept")
+}
+
+func TestRunReserved(t *testing.T) {
+	testApp := newTestApp(t)
+	testApp.CoderAgent = &sessionAgent{busy: map[string]bool{"coder-session": true}}
+
+	_, err := testApp.ReserveSession("coder-session")
+	assert.ErrorIs(t, err, agent.ErrSessionBusy, "an agent is already processing a message")
+
+	t.Run("concurrent runs on one session", func(t *testing.T) {
+		const runners = 10
+		var started, refused atomic.Int32
+		runEvents := make(chan agent.AgentEvent)
+		var wg sync.WaitGroup
+		for range runners {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				events, err := testApp.RunReserved("session", func() (<-chan agent.AgentEvent, error) {
+					started.Add(1)
+					return runEvents, nil
+				})
+				if err != nil {
+					assert.ErrorIs(t, err, agent.ErrSessionBusy)
+					refused.Add(1)
+					return
+				}
+				for range events {
+				}
+			}()
+		}
+
+		// Every other runner is refused while the first run holds the session
+		require.Eventually(t, func() bool { return refused.Load() == runners-1 }, time.Second, time.Millisecond)
+		assert.Equal(t, int32(1), started.Load(), "only one run may start")
+		assert.True(t, testApp.IsSessionBusy("session"))
+		close(runEvents)
+		wg.Wait()
+		assert.False(t, testApp.IsSessionBusy("session"), "the reservation ends with the run")
+	})
+
+	t.Run("run fails to start", func(t *testing.T) {
+		_, err := testApp.RunReserved("session", func() (<-chan agent.AgentEvent, error) {
+			return nil, errors.New("no provider")
+		})
+		assert.EqualError(t, err, "no provider")
+		assert.False(t, testApp.IsSessionBusy("session"))
+	})
+}
@@ -5,12 +5,16 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"sync"
 
 	"mix/internal/config"
 	"mix/internal/db"
 	"mix/internal/format"
 	"mix/internal/history"
 	"mix/internal/llm/agent"
+	"mix/internal/llm/tools"
 	"mix/internal/logging"
 	"mix/internal/message"
 	"mix/internal/permission"
@@ -25,8 +29,23 @@ type App struct {
 
 	CoderAgent agent.Service
 
-	// Current session tracking for API session selection
+	// agents are the isolated agents created through CreateAgent, by id
+	agents   map[string]agent.Service
+	agentsMu sync.RWMutex
+
+	// reservedSessions are the sessions a run was started in through RunReserved
+	reservedSessions sync.Map
+
+	// MCPManager holds the agent's MCP client connections
+	MCPManager *agent.MCPClientManager
+
+	// FileWatcher is set while files read by the agent are watched for external changes
+	FileWatcher *tools.FileWatcher
+
+	// Current session tracking for API session selection. Requests for different
+	// agents run concurrently, so it is guarded by currentSessionMu.
 	currentSessionID string
+	currentSessionMu sync.RWMutex
 }
 
 func New(ctx context.Context, conn *sql.DB) (*App, error) {
@@ -44,6 +63,7 @@ func New(ctx context.Context, conn *sql.DB) (*App, error) {
 
 	// Create MCP manager for this agent
 	mcpManager := agent.NewMCPClientManager()
+	app.MCPManager = mcpManager
 
 	var err error
 	app.CoderAgent, err = agent.NewAgent(
@@ -69,12 +89,13 @@ func New(ctx context.Context, conn *sql.DB) (*App, error) {
 // Removed theme initialization for embedded binary
 
 // RunNonInteractive handles the execution flow when a prompt is provided via CLI flag.
-func (a *App) RunNonInteractive(ctx context.Context, prompt string, outputFormat string, quiet bool) error {
+// The prompt continues the session sessionID, or starts a new session when it is empty.
+func (a *App) RunNonInteractive(ctx context.Context, sessionID, prompt string, outputFormat string, quiet bool) error {
 	logging.Info("Running in non-interactive mode")
 
-	// Processing message for non-interactive mode
-	if !quiet {
-		fmt.Println("Processing...")
+	prompt, err := agent.LimitMessageLength(prompt)
+	if err != nil {
+		return err
 	}
 
 	const maxPromptLengthForTitle = 100
@@ -88,18 +109,34 @@ func (a *App) RunNonInteractive(ctx context.Context, prompt string, outputFormat
 	}
 	title := titlePrefix + titleSuffix
 
-	sess, err := a.Sessions.Create(ctx, title)
-	if err != nil {
-		return fmt.Errorf("failed to create session for non-interactive mode: %w", err)
+	var sess session.Session
+	if sessionID != "" {
+		sess, err = a.Sessions.Get(ctx, sessionID)
+		if err != nil {
+			return fmt.Errorf("failed to load session %s: %w", sessionID, err)
+		}
+		logging.Info("Continuing session for non-interactive run", "session_id", sess.ID)
+	} else {
+		sess, err = a.Sessions.Create(ctx, title)
+		if err != nil {
+			return fmt.Errorf("failed to create session for non-interactive mode: %w", err)
+		}
+		logging.Info("Created session for non-interactive run", "session_id", sess.ID)
 	}
-	logging.Info("Created session for non-interactive run", "session_id", sess.ID)
 
-	done, err := a.CoderAgent.Run(ctx, sess.ID, prompt)
+	events, err := a.RunReserved(sess.ID, func() (<-chan agent.AgentEvent, error) {
+		return a.CoderAgent.Run(ctx, sess.ID, prompt)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to start agent processing stream: %w", err)
 	}
 
-	result := <-done
+	// Show the phase and elapsed time on stderr so it stays out of the output
+	var status *processingStatus
+	if !quiet {
+		status = newProcessingStatus(os.Stderr)
+	}
+	result := waitForResult(events, status)
 	if result.Error != nil {
 		if errors.Is(result.Error, context.Canceled) || errors.Is(result.Error, agent.ErrRequestCancelled) {
 			logging.Info("Agent processing cancelled", "session_id", sess.ID)
@@ -121,41 +158,110 @@ func (a *App) RunNonInteractive(ctx context.Context, prompt string, outputFormat
 	return nil
 }
 
-// SetCurrentSession sets the current session ID for API operations
-func (a *App) SetCurrentSession(sessionID string) error {
-	if sessionID == "" {
-		a.currentSessionID = ""
-		return nil
+// RecentSessions returns up to limit top-level sessions that have messages, most
+// recently updated first, for picking a session to continue
+func (a *App) RecentSessions(ctx context.Context, limit int) ([]session.Session, error) {
+	sessions, err := a.Sessions.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
 	}
+	return recentSessions(sessions, limit), nil
+}
 
-	// Verify session exists
-	_, err := a.Sessions.Get(context.Background(), sessionID)
-	if err != nil {
-		return fmt.Errorf("session not found: %w", err)
+func recentSessions(sessions []session.Session, limit int) []session.Session {
+	var recent []session.Session
+	for _, sess := range sessions {
+		if sess.ParentSessionID == "" && sess.MessageCount > 0 {
+			recent = append(recent, sess)
+		}
 	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		if recent[i].UpdatedAt != recent[j].UpdatedAt {
+			return recent[i].UpdatedAt > recent[j].UpdatedAt
+		}
+		return recent[i].CreatedAt > recent[j].CreatedAt
+	})
+	if len(recent) > limit {
+		recent = recent[:limit]
+	}
+	return recent
+}
 
+// SetCurrentSession sets the current session ID for API operations
+func (a *App) SetCurrentSession(sessionID string) error {
+	if sessionID != "" {
+		// Verify session exists
+		if _, err := a.Sessions.Get(context.Background(), sessionID); err != nil {
+			return fmt.Errorf("session not found: %w", err)
+		}
+	}
+
+	a.currentSessionMu.Lock()
+	defer a.currentSessionMu.Unlock()
 	a.currentSessionID = sessionID
 	return nil
 }
 
 // GetCurrentSession returns the currently selected session, or nil if none selected
 func (a *App) GetCurrentSession(ctx context.Context) (*session.Session, error) {
-	if a.currentSessionID == "" {
+	currentID := a.GetCurrentSessionID()
+	if currentID == "" {
 		return nil, nil
 	}
 
-	sess, err := a.Sessions.Get(ctx, a.currentSessionID)
+	sess, err := a.Sessions.Get(ctx, currentID)
 	if err != nil {
 		// Reset current session if it no longer exists
-		a.currentSessionID = ""
+		a.currentSessionMu.Lock()
+		if a.currentSessionID == currentID {
+			a.currentSessionID = ""
+		}
+		a.currentSessionMu.Unlock()
 		return nil, fmt.Errorf("current session no longer exists: %w", err)
 	}
 
 	return &sess, nil
 }
 
+// DuplicateSession copies a session and all of its messages into a new, independent
+// session titled title. Token counts and cost start at zero unless preserveUsage is set.
+func (a *App) DuplicateSession(ctx context.Context, sessionID, title string, preserveUsage bool) (session.Session, error) {
+	source, err := a.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		return session.Session{}, fmt.Errorf("session not found: %w", err)
+	}
+	messages, err := a.Messages.List(ctx, sessionID)
+	if err != nil {
+		return session.Session{}, fmt.Errorf("failed to list messages: %w", err)
+	}
+
+	duplicate, err := a.Sessions.Create(ctx, title)
+	if err != nil {
+		return session.Session{}, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	copiedIDs := make(map[string]string, len(messages))
+	for _, msg := range messages {
+		copied, err := a.Messages.Copy(ctx, duplicate.ID, msg)
+		if err != nil {
+			return session.Session{}, fmt.Errorf("failed to copy message %s: %w", msg.ID, err)
+		}
+		copiedIDs[msg.ID] = copied.ID
+	}
+
+	duplicate.SummaryMessageID = copiedIDs[source.SummaryMessageID]
+	if preserveUsage {
+		duplicate.PromptTokens = source.PromptTokens
+		duplicate.CompletionTokens = source.CompletionTokens
+		duplicate.Cost = source.Cost
+	}
+	return a.Sessions.Save(ctx, duplicate)
+}
+
 // GetCurrentSessionID returns the current session ID (may be empty)
 func (a *App) GetCurrentSessionID() string {
+	a.currentSessionMu.RLock()
+	defer a.currentSessionMu.RUnlock()
 	return a.currentSessionID
 }
 
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"mix/internal/db"
+	"mix/internal/message"
+	"mix/internal/session"
+
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, db.SetupTestDatabase(conn))
+
+	queries := db.New(conn)
+	return &App{
+		Sessions: session.NewService(queries),
+		Messages: message.NewService(queries),
+	}
+}
+
+func TestDuplicateSession(t *testing.T) {
+	ctx := context.Background()
+	testApp := newTestApp(t)
+
+	source, err := testApp.Sessions.Create(ctx, "setup")
+	require.NoError(t, err)
+	_, err = testApp.Messages.Create(ctx, source.ID, message.CreateMessageParams{
+		Role:  message.User,
+		Parts: []message.ContentPart{message.TextContent{Text: "configure the project"}},
+	})
+	require.NoError(t, err)
+	reply, err := testApp.Messages.Create(ctx, source.ID, message.CreateMessageParams{
+		Role:  message.Assistant,
+		Parts: []message.ContentPart{message.TextContent{Text: "done"}},
+	})
+	require.NoError(t, err)
+	reply.AddFinish(message.FinishReasonEndTurn)
+	require.NoError(t, testApp.Messages.Update(ctx, reply))
+
+	source.PromptTokens, source.CompletionTokens, source.Cost = 100, 20, 0.5
+	source, err = testApp.Sessions.Save(ctx, source)
+	require.NoError(t, err)
+
+	duplicate, err := testApp.DuplicateSession(ctx, source.ID, "setup copy", false)
+	require.NoError(t, err)
+	assert.NotEqual(t, source.ID, duplicate.ID)
+	assert.Equal(t, "setup copy", duplicate.Title)
+	assert.Empty(t, duplicate.ParentSessionID)
+	assert.Equal(t, int64(2), duplicate.MessageCount)
+	assert.Zero(t, duplicate.Cost)
+
+	sourceMessages, err := testApp.Messages.List(ctx, source.ID)
+	require.NoError(t, err)
+	copiedMessages, err := testApp.Messages.List(ctx, duplicate.ID)
+	require.NoError(t, err)
+	require.Len(t, copiedMessages, 2)
+	for i := range sourceMessages {
+		assert.NotEqual(t, sourceMessages[i].ID, copiedMessages[i].ID)
+		assert.Equal(t, sourceMessages[i].Role, copiedMessages[i].Role)
+		assert.Equal(t, sourceMessages[i].Parts, copiedMessages[i].Parts)
+	}
+
+	// Editing the copy leaves the original untouched
+	edited := copiedMessages[1]
+	edited.Parts = []message.ContentPart{message.TextContent{Text: "changed"}}
+	require.NoError(t, testApp.Messages.Update(ctx, edited))
+	original, err := testApp.Messages.Get(ctx, sourceMessages[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "done", original.Content().String())
+
+	require.NoError(t, testApp.Messages.Delete(ctx, copiedMessages[0].ID))
+	sourceMessages, err = testApp.Messages.List(ctx, source.ID)
+	require.NoError(t, err)
+	assert.Len(t, sourceMessages, 2)
+
+	preserved, err := testApp.DuplicateSession(ctx, source.ID, "with usage", true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), preserved.PromptTokens)
+	assert.Equal(t, int64(20), preserved.CompletionTokens)
+	assert.Equal(t, 0.5, preserved.Cost)
+}
+
+func TestDuplicateSession_KeepsOrder(t *testing.T) {
+	ctx := context.Background()
+	testApp := newTestApp(t)
+
+	source, err := testApp.Sessions.Create(ctx, "long conversation")
+	require.NoError(t, err)
+	var texts []string
+	for i := 0; i < 6; i++ {
+		role := message.User
+		if i%2 == 1 {
+			role = message.Assistant
+		}
+		text := fmt.Sprintf("message %d", i)
+		texts = append(texts, text)
+		_, err := testApp.Messages.Create(ctx, source.ID, message.CreateMessageParams{
+			Role:  role,
+			Parts: []message.ContentPart{message.TextContent{Text: text}},
+		})
+		require.NoError(t, err)
+	}
+
+	// The copies are created within the same second, so only the insert order sorts them
+	duplicate, err := testApp.DuplicateSession(ctx, source.ID, "copy", false)
+	require.NoError(t, err)
+	copied, err := testApp.Messages.List(ctx, duplicate.ID)
+	require.NoError(t, err)
+	var copiedTexts []string
+	for _, msg := range copied {
+		copiedTexts = append(copiedTexts, msg.Content().String())
+	}
+	assert.Equal(t, texts, copiedTexts)
+}
+
+func TestRecentSessions(t *testing.T) {
+	sessions := []session.Session{
+		{ID: "old", MessageCount: 4, CreatedAt: 100, UpdatedAt: 200},
+		{ID: "empty", MessageCount: 0, CreatedAt: 500, UpdatedAt: 500},
+		{ID: "latest", MessageCount: 2, CreatedAt: 150, UpdatedAt: 900},
+		{ID: "child", ParentSessionID: "latest", MessageCount: 3, CreatedAt: 800, UpdatedAt: 950},
+		{ID: "tied-newer", MessageCount: 1, CreatedAt: 300, UpdatedAt: 400},
+		{ID: "tied-older", MessageCount: 1, CreatedAt: 250, UpdatedAt: 400},
+	}
+	ids := func(sessions []session.Session) []string {
+		var result []string
+		for _, sess := range sessions {
+			result = append(result, sess.ID)
+		}
+		return result
+	}
+
+	// Empty and child sessions are skipped, and ties go to the newer session
+	assert.Equal(t, []string{"latest", "tied-newer", "tied-older", "old"}, ids(recentSessions(sessions, 5)))
+	assert.Equal(t, []string{"latest", "tied-newer"}, ids(recentSessions(sessions, 2)))
+	assert.Empty(t, recentSessions(nil, 5))
+}
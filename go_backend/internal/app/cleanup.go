@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"mix/internal/config"
+	"mix/internal/logging"
+	"mix/internal/session"
+)
+
+// StartSessionCleanup deletes idle sessions as configured by config.SessionCleanup,
+// once now and then periodically until ctx is done. It does nothing unless enabled.
+func (a *App) StartSessionCleanup(ctx context.Context) {
+	cleanupCfg := config.Get().SessionCleanup
+	if !cleanupCfg.Enabled || cleanupCfg.MaxAgeHours <= 0 || cleanupCfg.IntervalMinutes <= 0 {
+		return
+	}
+
+	policy := session.CleanupPolicy{
+		MaxAge:      time.Duration(cleanupCfg.MaxAgeHours) * time.Hour,
+		MaxMessages: cleanupCfg.MaxMessages,
+	}
+	logging.Info("Session cleanup enabled", "max_age", policy.MaxAge, "max_messages", policy.MaxMessages)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cleanupCfg.IntervalMinutes) * time.Minute)
+		defer ticker.Stop()
+		for {
+			a.cleanupSessions(ctx, policy, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// cleanupSessions deletes idle sessions, never touching the current or a busy session
+func (a *App) cleanupSessions(ctx context.Context, policy session.CleanupPolicy, now time.Time) []session.Session {
+	deleted, err := session.DeleteIdle(ctx, a.Sessions, policy, now, func(s session.Session) bool {
+		return s.ID == a.GetCurrentSessionID() || a.IsSessionBusy(s.ID)
+	})
+	if err != nil {
+		logging.Error("Session cleanup failed", "error", err)
+	}
+	for _, s := range deleted {
+		logging.Info("Deleted idle session", "session_id", s.ID, "title", s.Title, "messages", s.MessageCount)
+	}
+	return deleted
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mix/internal/message"
+	"mix/internal/session"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanupSessions(t *testing.T) {
+	ctx := context.Background()
+	testApp := newTestApp(t)
+
+	create := func(title string, messages int) session.Session {
+		sess, err := testApp.Sessions.Create(ctx, title)
+		require.NoError(t, err)
+		for i := 0; i < messages; i++ {
+			_, err := testApp.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+				Role:  message.User,
+				Parts: []message.ContentPart{message.TextContent{Text: "hello"}},
+			})
+			require.NoError(t, err)
+		}
+		return sess
+	}
+	empty := create("empty", 0)
+	short := create("short", 1)
+	long := create("long", 5)
+	current := create("current", 0)
+	require.NoError(t, testApp.SetCurrentSession(current.ID))
+
+	policy := session.CleanupPolicy{MaxAge: 24 * time.Hour, MaxMessages: 1}
+
+	// Timestamps are set by the database, so move the clock forward instead of the sessions back
+	deleted := testApp.cleanupSessions(ctx, policy, time.Now())
+	assert.Empty(t, deleted, "recent sessions are kept")
+
+	deleted = testApp.cleanupSessions(ctx, policy, time.Now().Add(48*time.Hour))
+	var deletedIDs []string
+	for _, sess := range deleted {
+		deletedIDs = append(deletedIDs, sess.ID)
+	}
+	assert.ElementsMatch(t, []string{empty.ID, short.ID}, deletedIDs)
+
+	remaining, err := testApp.Sessions.List(ctx)
+	require.NoError(t, err)
+	var remainingIDs []string
+	for _, sess := range remaining {
+		remainingIDs = append(remainingIDs, sess.ID)
+	}
+	assert.ElementsMatch(t, []string{long.ID, current.ID}, remainingIDs)
+
+	messages, err := testApp.Messages.List(ctx, short.ID)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"mix/internal/config"
+	"mix/internal/llm/agent"
+)
+
+// AddMCPServer saves an MCP server to the config and connects the agent to it. The
+// server is saved even if it cannot be reached; the status says whether it connected.
+func (a *App) AddMCPServer(ctx context.Context, name string, server config.MCPServer) (agent.MCPServerStatus, error) {
+	if a.CoderAgent.IsBusy() {
+		return agent.MCPServerStatus{}, fmt.Errorf("cannot change MCP servers while processing requests")
+	}
+	if err := config.SetMCPServer(name, server); err != nil {
+		return agent.MCPServerStatus{}, err
+	}
+
+	status := agent.CheckMCPServer(ctx, name, config.Get().MCPServers[name], a.mcpManager())
+	return status, a.reloadMCPTools(ctx)
+}
+
+// RemoveMCPServer deletes an MCP server from the config and disconnects the agent from it
+func (a *App) RemoveMCPServer(ctx context.Context, name string) error {
+	if a.CoderAgent.IsBusy() {
+		return fmt.Errorf("cannot change MCP servers while processing requests")
+	}
+	if err := config.RemoveMCPServer(name); err != nil {
+		return err
+	}
+
+	a.mcpManager().CloseClient(name)
+	return a.reloadMCPTools(ctx)
+}
+
+// TestMCPServer reconnects to a configured MCP server and reports its status
+func (a *App) TestMCPServer(ctx context.Context, name string) (agent.MCPServerStatus, error) {
+	server, ok := config.Get().MCPServers[name]
+	if !ok {
+		return agent.MCPServerStatus{}, fmt.Errorf("MCP server %s not found", name)
+	}
+	return agent.CheckMCPServer(ctx, name, server, a.mcpManager()), nil
+}
+
+// reloadMCPTools gives every agent the tools of the configured MCP servers, reusing the
+// connections that are still healthy
+func (a *App) reloadMCPTools(ctx context.Context) error {
+	mcpTools := agent.GetMcpTools(ctx, a.Permissions, a.mcpManager())
+	if err := a.CoderAgent.SetMCPTools(mcpTools); err != nil {
+		return err
+	}
+
+	a.agentsMu.RLock()
+	defer a.agentsMu.RUnlock()
+	for id, isolated := range a.agents {
+		if err := isolated.SetMCPTools(mcpTools); err != nil {
+			return fmt.Errorf("agent %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// mcpManager returns the agent's MCP manager, creating one for apps built without New
+func (a *App) mcpManager() *agent.MCPClientManager {
+	if a.MCPManager == nil {
+		a.MCPManager = agent.NewMCPClientManager()
+	}
+	return a.MCPManager
+}
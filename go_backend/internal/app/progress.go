@@ -0,0 +1,113 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"mix/internal/llm/agent"
+)
+
+// statusRefreshInterval is how often the elapsed time is redrawn between agent events
+const statusRefreshInterval = time.Second
+
+// eventPhase describes what the agent is doing according to event, or returns "" if the
+// event doesn't say
+func eventPhase(event agent.AgentEvent) string {
+	switch event.Type {
+	case agent.AgentEventTypeResponse:
+		if event.Done {
+			return ""
+		}
+		if toolCalls := event.Message.ToolCalls(); len(toolCalls) > 0 {
+			return "Running tool: " + toolCalls[len(toolCalls)-1].Name
+		}
+		if event.Message.Content().Text != "" {
+			return "Writing response"
+		}
+		if event.Message.ReasoningContent().Thinking != "" {
+			return "Thinking"
+		}
+	case agent.AgentEventTypeToolProgress, agent.AgentEventTypeRetry:
+		return event.Progress
+	case agent.AgentEventTypeSummarize:
+		return "Summarizing"
+	}
+	return ""
+}
+
+// processingMessage is the status line for a request in phase that has run for elapsed
+func processingMessage(phase string, elapsed time.Duration) string {
+	if phase == "" {
+		phase = "Processing"
+	}
+	return fmt.Sprintf("%s... %s", phase, elapsed.Truncate(time.Second))
+}
+
+// processingStatus keeps a single status line with the phase and elapsed time of a
+// non-interactive run up to date. A nil status draws nothing.
+type processingStatus struct {
+	w       io.Writer
+	started time.Time
+	phase   string
+	// width is the length of the line last drawn, so a shorter one can blank it out
+	width int
+}
+
+func newProcessingStatus(w io.Writer) *processingStatus {
+	return &processingStatus{w: w, started: time.Now()}
+}
+
+// update takes the phase from event, if it has one, and redraws the line
+func (s *processingStatus) update(event agent.AgentEvent) {
+	if s == nil {
+		return
+	}
+	if phase := eventPhase(event); phase != "" {
+		s.phase = phase
+	}
+	s.draw()
+}
+
+func (s *processingStatus) draw() {
+	if s == nil {
+		return
+	}
+	line := processingMessage(s.phase, time.Since(s.started))
+	padding := max(s.width-len(line), 0)
+	fmt.Fprintf(s.w, "\r%s%s", line, strings.Repeat(" ", padding))
+	s.width = len(line)
+}
+
+// clear removes the status line
+func (s *processingStatus) clear() {
+	if s == nil || s.width == 0 {
+		return
+	}
+	fmt.Fprintf(s.w, "\r%s\r", strings.Repeat(" ", s.width))
+	s.width = 0
+}
+
+// waitForResult drains the events of a run, keeping status up to date, and returns the
+// final event
+func waitForResult(events <-chan agent.AgentEvent, status *processingStatus) agent.AgentEvent {
+	ticker := time.NewTicker(statusRefreshInterval)
+	defer ticker.Stop()
+	defer status.clear()
+
+	var result agent.AgentEvent
+	status.draw()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return result
+			}
+			result = event
+			status.update(event)
+		case <-ticker.C:
+			status.draw()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mix/internal/llm/agent"
+	"mix/internal/message"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func responseEvent(parts ...message.ContentPart) agent.AgentEvent {
+	return agent.AgentEvent{Type: agent.AgentEventTypeResponse, Message: message.Message{Role: message.Assistant, Parts: parts}}
+}
+
+func TestEventPhase(t *testing.T) {
+	tests := []struct {
+		name  string
+		event agent.AgentEvent
+		phase string
+	}{
+		{"thinking", responseEvent(message.ReasoningContent{Thinking: "Let me check"}), "Thinking"},
+		{"writing", responseEvent(message.ReasoningContent{Thinking: "Let me check"}, message.TextContent{Text: "The file"}), "Writing response"},
+		{"tool call", responseEvent(message.TextContent{Text: "I'll run it"}, message.ToolCall{ID: "1", Name: "bash"}), "Running tool: bash"},
+		{"tool progress", agent.AgentEvent{Type: agent.AgentEventTypeToolProgress, Progress: "Writing big.txt: 50%"}, "Writing big.txt: 50%"},
+		{"retry", agent.AgentEvent{Type: agent.AgentEventTypeRetry, Progress: "Rate limited, retrying in 2s (attempt 1 of 8)"}, "Rate limited, retrying in 2s (attempt 1 of 8)"},
+		{"summarize", agent.AgentEvent{Type: agent.AgentEventTypeSummarize}, "Summarizing"},
+		{"empty response", responseEvent(), ""},
+		{"tokens", agent.AgentEvent{Type: agent.AgentEventTypeTokens}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.phase, eventPhase(tt.event))
+		})
+	}
+}
+
+func TestProcessingMessage(t *testing.T) {
+	assert.Equal(t, "Processing... 0s", processingMessage("", 300*time.Millisecond))
+	assert.Equal(t, "Thinking... 1m5s", processingMessage("Thinking", 65*time.Second+400*time.Millisecond))
+}
+
+func TestWaitForResult(t *testing.T) {
+	events := make(chan agent.AgentEvent, 3)
+	events <- responseEvent(message.ReasoningContent{Thinking: "Hmm"})
+	events <- agent.AgentEvent{Type: agent.AgentEventTypeTokens}
+	events <- agent.AgentEvent{Type: agent.AgentEventTypeResponse, Done: true}
+	close(events)
+
+	var out strings.Builder
+	result := waitForResult(events, newProcessingStatus(&out))
+	assert.True(t, result.Done)
+	assert.Contains(t, out.String(), "\rThinking... 0s")
+	assert.True(t, strings.HasSuffix(out.String(), "\r"), "the status line is cleared")
+
+	// Quiet runs have no status
+	events = make(chan agent.AgentEvent, 1)
+	events <- agent.AgentEvent{Type: agent.AgentEventTypeResponse, Done: true}
+	close(events)
+	assert.True(t, waitForResult(events, nil).Done)
+}
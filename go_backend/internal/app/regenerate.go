@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"mix/internal/llm/agent"
+	"mix/internal/message"
+)
+
+var (
+	// ErrMessageNotFound is returned when a message is not in the given session
+	ErrMessageNotFound = errors.New("message not found in session")
+	// ErrNotAssistantMessage is returned when regenerating a message the model didn't write
+	ErrNotAssistantMessage = errors.New("only assistant messages can be regenerated")
+	// ErrNoPrompt is returned when regenerating a message with no user message before it
+	// that can be sent again, such as one that is part of the conversation summary
+	ErrNoPrompt = errors.New("no user message to answer again")
+)
+
+// RegenerateMessage answers again the user message that an assistant message replies
+// to. The user message, the assistant message and everything after them are deleted,
+// then the user message's text and attachments are sent to the agent as a new message.
+// It returns the agent's events and the ids of the deleted messages.
+func (a *App) RegenerateMessage(ctx context.Context, sessionID, messageID string) (<-chan agent.AgentEvent, []string, error) {
+	target, err := a.Messages.Get(ctx, messageID)
+	if err != nil || target.SessionID != sessionID {
+		return nil, nil, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+	}
+	if target.Role != message.Assistant {
+		return nil, nil, fmt.Errorf("%w: %s is a %s message", ErrNotAssistantMessage, messageID, target.Role)
+	}
+	// Held until the new run ends, so no other run starts while messages are deleted
+	release, err := a.ReserveSession(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	reserved := false
+	defer func() {
+		if !reserved {
+			release()
+		}
+	}()
+
+	sess, err := a.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	messages, err := a.Messages.List(ctx, sessionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+
+	// Messages up to and including the summary can't be regenerated
+	first := 0
+	for i, msg := range messages {
+		if msg.ID == sess.SummaryMessageID {
+			first = i + 1
+			break
+		}
+	}
+
+	// The turn starts at the last user message before the target
+	start := -1
+	for i, msg := range messages {
+		if msg.ID == messageID {
+			break
+		}
+		if msg.Role == message.User {
+			start = i
+		}
+	}
+	if start == -1 {
+		return nil, nil, fmt.Errorf("%w: %s comes before any user message", ErrNoPrompt, messageID)
+	}
+	if start < first {
+		return nil, nil, fmt.Errorf("%w: %s is part of the conversation summary", ErrNoPrompt, messageID)
+	}
+
+	prompt := messages[start]
+	var attachments []message.Attachment
+	for _, binary := range prompt.BinaryContent() {
+		attachments = append(attachments, message.Attachment{
+			FilePath: binary.Path,
+			FileName: filepath.Base(binary.Path),
+			MimeType: binary.MIMEType,
+			Content:  binary.Data,
+		})
+	}
+
+	var deleted []string
+	for _, msg := range messages[start:] {
+		if err := a.Messages.Delete(ctx, msg.ID); err != nil {
+			return nil, deleted, fmt.Errorf("failed to delete message %s: %w", msg.ID, err)
+		}
+		deleted = append(deleted, msg.ID)
+	}
+
+	events, err := a.CoderAgent.Run(ctx, sessionID, prompt.Content().Text, attachments...)
+	if err != nil {
+		return nil, deleted, fmt.Errorf("failed to run agent: %w", err)
+	}
+	reserved = true
+	return releaseWhenClosed(events, release), deleted, nil
+}
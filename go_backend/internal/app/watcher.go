@@ -0,0 +1,30 @@
+package app
+
+import (
+	"context"
+
+	"mix/internal/config"
+	"mix/internal/llm/tools"
+	"mix/internal/logging"
+)
+
+// StartFileWatcher watches the files the agent reads for external changes, as
+// configured by config.FileWatcher, until ctx is done. It does nothing unless enabled.
+func (a *App) StartFileWatcher(ctx context.Context) {
+	if !config.Get().FileWatcher.Enabled {
+		return
+	}
+
+	watcher, err := tools.StartFileWatcher()
+	if err != nil {
+		logging.Error("Failed to start file watcher", "error", err)
+		return
+	}
+	a.FileWatcher = watcher
+	logging.Info("File watcher enabled")
+
+	go func() {
+		<-ctx.Done()
+		watcher.Close()
+	}()
+}
@@ -4,26 +4,50 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"mix/internal/app"
 	"mix/internal/config"
+	"mix/internal/history"
 	"mix/internal/llm/agent"
+	"mix/internal/llm/models"
+	"mix/internal/llm/prompt"
+	"mix/internal/llm/provider"
 	"mix/internal/llm/tools"
+	"mix/internal/message"
 )
 
-// ContextResponse represents the JSON response for the /context command
+// ContextResponse represents the JSON response for the /context command. Estimated is
+// set when the counts are estimated because the provider has no tokenizer.
 type ContextResponse struct {
 	Model          string               `json:"model"`
 	MaxTokens      int64                `json:"maxTokens"`
 	TotalTokens    int64                `json:"totalTokens"`
 	UsagePercent   float64              `json:"usagePercent"`
+	Estimated      bool                 `json:"estimated"`
 	Components     []ComponentBreakdown `json:"components"`
 	WarningLevel   string               `json:"warningLevel,omitempty"`
 	WarningMessage string               `json:"warningMessage,omitempty"`
 }
 
+// StatsResponse represents the JSON response for the /stats command, describing the
+// last turn of the current session. Durations are in milliseconds.
+type StatsResponse struct {
+	Type               string  `json:"type"`
+	SessionID          string  `json:"sessionId"`
+	LatencyMs          int64   `json:"latencyMs"`
+	TimeToFirstTokenMs int64   `json:"timeToFirstTokenMs"`
+	GenerationMs       int64   `json:"generationMs"`
+	OutputTokens       int64   `json:"outputTokens"`
+	TokensPerSecond    float64 `json:"tokensPerSecond"`
+	Requests           int     `json:"requests"`
+}
+
 // ComponentBreakdown represents individual context component usage
 type ComponentBreakdown struct {
 	Name       string  `json:"name"`
@@ -73,12 +97,22 @@ type McpServer struct {
 	Connected bool      `json:"connected"`
 	ToolCount int       `json:"toolCount"`
 	Tools     []McpTool `json:"tools"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// McpStatusResponse represents the JSON response for /mcp add and /mcp test
+type McpStatusResponse struct {
+	Type   string    `json:"type"`
+	Action string    `json:"action"`
+	Server McpServer `json:"server"`
 }
 
 // McpTool represents a tool available from an MCP server
 type McpTool struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// ConflictsWith lists the other servers whose tool has the same prefixed name
+	ConflictsWith []string `json:"conflictsWith,omitempty"`
 }
 
 // SessionsResponse represents the JSON response for the /sessions command
@@ -101,6 +135,134 @@ type SessionSummary struct {
 	IsCurrent       bool    `json:"isCurrent"`
 }
 
+// WhoamiResponse represents the JSON response for the /whoami command
+type WhoamiResponse struct {
+	Type       string       `json:"type"`
+	Provider   string       `json:"provider"`
+	Model      string       `json:"model"`
+	AuthMethod string       `json:"authMethod"`
+	OAuth      *OAuthStatus `json:"oauth,omitempty"`
+}
+
+// AgentsResponse represents the JSON response for the /agents command
+type AgentsResponse struct {
+	Type   string         `json:"type"`
+	Agents []AgentSummary `json:"agents"`
+}
+
+// AgentSummary describes a configured agent and the model it runs on
+type AgentSummary struct {
+	Name            string `json:"name"`
+	Role            string `json:"role"`
+	Model           string `json:"model"`
+	Provider        string `json:"provider,omitempty"`
+	MaxTokens       int64  `json:"maxTokens,omitempty"`
+	ReasoningEffort string `json:"reasoningEffort,omitempty"`
+}
+
+// OAuthStatus describes the validity of the stored OAuth token
+type OAuthStatus struct {
+	ExpiresAt int64  `json:"expiresAt"`
+	Expired   bool   `json:"expired"`
+	Validity  string `json:"validity"`
+}
+
+// FilesResponse represents the JSON response for the /files command
+type FilesResponse struct {
+	Type      string        `json:"type"`
+	SessionID string        `json:"sessionId"`
+	Files     []FileSummary `json:"files"`
+}
+
+// FileSummary describes a file created or edited in the session, with net line
+// changes between its first and latest recorded versions
+type FileSummary struct {
+	Path      string `json:"path"`
+	Versions  int    `json:"versions"`
+	Additions int    `json:"additions"`
+	Removals  int    `json:"removals"`
+}
+
+// SearchResponse represents the JSON response for the /search command. Total counts
+// every match, of which at most maxSearchMatches are listed.
+type SearchResponse struct {
+	Type      string        `json:"type"`
+	SessionID string        `json:"sessionId"`
+	Query     string        `json:"query"`
+	Total     int           `json:"total"`
+	Matches   []SearchMatch `json:"matches"`
+}
+
+// SearchMatch is an occurrence of the query in a session message. Index is the position
+// of the message in the session and Offset the character position of the match in its
+// text, so clients can scroll to it.
+type SearchMatch struct {
+	MessageID string `json:"messageId"`
+	Index     int    `json:"index"`
+	Role      string `json:"role"`
+	Offset    int    `json:"offset"`
+	Snippet   string `json:"snippet"`
+}
+
+const (
+	// maxSearchMatches caps the matches listed by /search
+	maxSearchMatches = 50
+	// searchSnippetContext is the number of characters shown on each side of a match
+	searchSnippetContext = 40
+)
+
+// ExportContextResponse represents the JSON response for the /export-context command
+type ExportContextResponse struct {
+	Type         string `json:"type"`
+	Path         string `json:"path"`
+	SessionID    string `json:"sessionId"`
+	MessageCount int    `json:"messageCount"`
+}
+
+// ContextBundle is a portable snapshot of a session, written by /export-context, with
+// everything needed to replay it: the model, redacted config, and messages
+type ContextBundle struct {
+	Version    int             `json:"version"`
+	ExportedAt int64           `json:"exportedAt"`
+	SessionID  string          `json:"sessionId"`
+	Title      string          `json:"title"`
+	Model      string          `json:"model"`
+	Provider   string          `json:"provider"`
+	Config     *config.Config  `json:"config"`
+	Messages   []BundleMessage `json:"messages"`
+}
+
+// BundleMessage is a message in a context bundle. Parts are encoded as the message
+// store encodes them; decode them with message.UnmarshalParts.
+type BundleMessage struct {
+	ID        string          `json:"id"`
+	Role      string          `json:"role"`
+	Model     string          `json:"model,omitempty"`
+	CreatedAt int64           `json:"createdAt"`
+	Parts     json.RawMessage `json:"parts"`
+}
+
+// contextBundleVersion is the version of the ContextBundle format
+const contextBundleVersion = 1
+
+// PromptResponse is the JSON response for /prompt <name>. Prompt is the expanded
+// template, which clients send to the agent as the user's message.
+type PromptResponse struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Prompt string `json:"prompt"`
+}
+
+// PromptFromOutput returns the prompt to send to the agent when output is a /prompt
+// response
+func PromptFromOutput(output string) (string, bool) {
+	var response PromptResponse
+	if err := json.Unmarshal([]byte(output), &response); err != nil || response.Type != "prompt" {
+		return "", false
+	}
+	return response.Prompt, true
+}
+
 // ErrorResponse represents error responses from commands
 type ErrorResponse struct {
 	Type    string `json:"type"`
@@ -120,6 +282,8 @@ type BuiltinCommand struct {
 	name        string
 	description string
 	handler     func(ctx context.Context, args string) (string, error)
+	// destructive reports whether the arguments make the command destroy data
+	destructive func(args string) bool
 }
 
 func (c *BuiltinCommand) Name() string {
@@ -134,6 +298,15 @@ func (c *BuiltinCommand) Execute(ctx context.Context, args string) (string, erro
 	return c.handler(ctx, args)
 }
 
+func (c *BuiltinCommand) Destructive(args string) bool {
+	return c.destructive != nil && c.destructive(args)
+}
+
+// always marks a command destructive whatever its arguments
+func always(string) bool {
+	return true
+}
+
 // Helper functions for structured responses
 
 // returnError creates a structured error response
@@ -168,8 +341,15 @@ func GetBuiltinCommands(registry *Registry, app *app.App) map[string]Command {
 		},
 		"clear": &BuiltinCommand{
 			name:        "clear",
-			description: "Clear chat history",
-			handler:     createClearHandler(),
+			description: "Clear chat history (usage: /clear [--hard] to also delete the stored messages)",
+			handler:     createClearHandler(app),
+			destructive: func(args string) bool { return strings.TrimSpace(args) == "--hard" },
+		},
+		"rewind": &BuiltinCommand{
+			name:        "rewind",
+			description: "Drop the last turns from the conversation (usage: /rewind [N], default 1)",
+			handler:     createRewindHandler(app),
+			destructive: always,
 		},
 		"session": &BuiltinCommand{
 			name:        "session",
@@ -183,14 +363,54 @@ func GetBuiltinCommands(registry *Registry, app *app.App) map[string]Command {
 		},
 		"mcp": &BuiltinCommand{
 			name:        "mcp",
-			description: "List configured MCP servers",
-			handler:     createMcpHandler(),
+			description: "List, add, remove or test MCP servers (usage: /mcp [add <name> <command|url> [args...] | remove <name> | test <name>])",
+			handler:     createMcpHandler(app),
 		},
 		"context": &BuiltinCommand{
 			name:        "context",
 			description: "Show context usage breakdown with percentages",
 			handler:     createContextHandler(app),
 		},
+		"stats": &BuiltinCommand{
+			name:        "stats",
+			description: "Show the latency, time to first token and tokens per second of the last turn",
+			handler:     createStatsHandler(app),
+		},
+		"whoami": &BuiltinCommand{
+			name:        "whoami",
+			description: "Show the active provider, model, and authentication method",
+			handler:     createWhoamiHandler(app),
+		},
+		"agents": &BuiltinCommand{
+			name:        "agents",
+			description: "List configured agents and their models",
+			handler:     createAgentsHandler(),
+		},
+		"files": &BuiltinCommand{
+			name:        "files",
+			description: "List files created or edited in the current session",
+			handler:     createFilesHandler(app),
+		},
+		"export-context": &BuiltinCommand{
+			name:        "export-context",
+			description: "Export the session with its model and redacted config to a JSON file (usage: /export-context [path] [--inline])",
+			handler:     createExportContextHandler(app),
+		},
+		"search": &BuiltinCommand{
+			name:        "search",
+			description: "Search the current session's messages (usage: /search <query>)",
+			handler:     createSearchHandler(app),
+		},
+		"reasoning": &BuiltinCommand{
+			name:        "reasoning",
+			description: "Show or change the reasoning effort (usage: /reasoning [low|medium|high])",
+			handler:     createReasoningHandler(app),
+		},
+		"prompt": &BuiltinCommand{
+			name:        "prompt",
+			description: "Send a prompt template from .mix/prompts to the agent (usage: /prompt <name> [key=value ...])",
+			handler:     createPromptHandler(),
+		},
 	}
 }
 
@@ -230,10 +450,463 @@ func createHelpHandler(registry *Registry) func(ctx context.Context, args string
 	}
 }
 
-func createClearHandler() func(ctx context.Context, args string) (string, error) {
+func createPromptHandler() func(ctx context.Context, args string) (string, error) {
+	return func(ctx context.Context, args string) (string, error) {
+		name, templateArgs, _ := strings.Cut(strings.TrimSpace(args), " ")
+		if name == "" {
+			templates := prompt.ListTemplates()
+			if len(templates) == 0 {
+				return returnMessage("prompt", "No prompt templates found in .mix/prompts or ~/.mix/prompts")
+			}
+			sort.Strings(templates)
+			return returnMessage("prompt", "Available prompt templates: "+strings.Join(templates, ", "))
+		}
+
+		content, err := prompt.LoadTemplate(name, templateArgs)
+		if err != nil {
+			return returnError("prompt", err.Error())
+		}
+		jsonData, err := json.Marshal(PromptResponse{Type: "prompt", Name: name, Prompt: content})
+		if err != nil {
+			return returnError("prompt", fmt.Sprintf("Error marshaling prompt data: %v", err))
+		}
+		return string(jsonData), nil
+	}
+}
+
+func createReasoningHandler(app *app.App) func(ctx context.Context, args string) (string, error) {
+	return func(ctx context.Context, args string) (string, error) {
+		effort := strings.ToLower(strings.TrimSpace(args))
+		if effort == "" {
+			current := config.Get().Agents[config.AgentMain].ReasoningEffort
+			if current == "" {
+				return returnMessage("reasoning", "Reasoning effort is not set for the current model")
+			}
+			return returnMessage("reasoning", fmt.Sprintf("Reasoning effort is %s", current))
+		}
+
+		if app.CoderAgent == nil {
+			return returnError("reasoning", "Agent not available")
+		}
+		if err := app.CoderAgent.UpdateReasoningEffort(config.AgentMain, effort); err != nil {
+			return returnError("reasoning", err.Error())
+		}
+		return returnMessage("reasoning", fmt.Sprintf("Reasoning effort set to %s", effort))
+	}
+}
+
+func createWhoamiHandler(app *app.App) func(ctx context.Context, args string) (string, error) {
+	return func(ctx context.Context, args string) (string, error) {
+		model := app.CoderAgent.Model()
+		response := WhoamiResponse{
+			Type:       "whoami",
+			Provider:   string(model.Provider),
+			Model:      model.Name,
+			AuthMethod: "none",
+		}
+
+		providerCfg := config.Get().Providers[model.Provider]
+		switch model.Provider {
+		case models.ProviderBedrock:
+			response.AuthMethod = "aws-credentials"
+		case models.ProviderVertexAI:
+			response.AuthMethod = "vertex-ai-credentials"
+		case models.ProviderAnthropic:
+			// The Anthropic client prefers stored OAuth credentials over an API key
+			if storage, err := provider.NewCredentialStorage(); err == nil {
+				if creds, err := storage.GetOAuthCredentials("anthropic"); err == nil && creds != nil {
+					response.AuthMethod = "oauth"
+					response.OAuth = &OAuthStatus{
+						ExpiresAt: creds.ExpiresAt,
+						Expired:   creds.IsTokenExpired(),
+						Validity:  formatTokenValidity(creds.ExpiresAt, time.Now()),
+					}
+					break
+				}
+			}
+			if providerCfg.APIKey != "" {
+				response.AuthMethod = "api-key"
+			}
+		default:
+			if providerCfg.APIKey != "" {
+				response.AuthMethod = "api-key"
+			}
+		}
+
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			return returnError("whoami", fmt.Sprintf("Error marshaling auth status: %v", err))
+		}
+		return string(jsonData), nil
+	}
+}
+
+// formatTokenValidity describes how long a token expiring at expiresAt (unix seconds) remains valid
+func formatTokenValidity(expiresAt int64, now time.Time) string {
+	if expiresAt == 0 {
+		return "no expiry"
+	}
+	// Compare before truncating, so a token with seconds left isn't reported as expired
+	remaining := time.Unix(expiresAt, 0).Sub(now)
+	if remaining <= 0 {
+		return fmt.Sprintf("expired %s ago", formatDuration(-remaining.Truncate(time.Minute)))
+	}
+	if remaining < time.Minute {
+		return "expires in less than a minute"
+	}
+	return fmt.Sprintf("expires in %s", formatDuration(remaining.Truncate(time.Minute)))
+}
+
+// formatDuration renders a duration as hours and minutes, e.g. "2h 5m" or "45m"
+func formatDuration(d time.Duration) string {
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+func createClearHandler(app *app.App) func(ctx context.Context, args string) (string, error) {
+	return func(ctx context.Context, args string) (string, error) {
+		switch strings.TrimSpace(args) {
+		case "":
+			// Soft clear: the client resets its view, stored messages are kept
+			return "", nil
+		case "--hard":
+		default:
+			return returnError("clear", "Usage: /clear [--hard]")
+		}
+
+		sessionID := app.GetCurrentSessionID()
+		if sessionID == "" {
+			return returnMessage("clear", "No active session. Use /sessions to list available sessions.")
+		}
+		if app.IsSessionBusy(sessionID) {
+			return returnError("clear", "Cannot clear the session while it is processing")
+		}
+
+		sess, err := app.Sessions.Get(ctx, sessionID)
+		if err != nil {
+			return returnError("clear", fmt.Sprintf("Error getting session: %v", err))
+		}
+		messages, err := app.Messages.List(ctx, sessionID)
+		if err != nil {
+			return returnError("clear", fmt.Sprintf("Error listing session messages: %v", err))
+		}
+
+		// The summary and token counts describe the deleted messages. They are reset
+		// first, so a failed delete leaves an unsummarized session rather than a
+		// summary pointing at a deleted message.
+		sess.SummaryMessageID = ""
+		sess.PromptTokens = 0
+		sess.CompletionTokens = 0
+		if _, err := app.Sessions.Save(ctx, sess); err != nil {
+			return returnError("clear", fmt.Sprintf("Error resetting session: %v", err))
+		}
+		if err := app.Messages.DeleteSessionMessages(ctx, sessionID); err != nil {
+			return returnError("clear", fmt.Sprintf("Error deleting session messages: %v", err))
+		}
+		return returnMessage("clear", fmt.Sprintf("Deleted %d messages from the session", len(messages)))
+	}
+}
+
+func createRewindHandler(app *app.App) func(ctx context.Context, args string) (string, error) {
+	return func(ctx context.Context, args string) (string, error) {
+		turns := 1
+		if arg := strings.TrimSpace(args); arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 {
+				return returnError("rewind", "Usage: /rewind [N], where N is a positive number of turns")
+			}
+			turns = n
+		}
+
+		sessionID := app.GetCurrentSessionID()
+		if sessionID == "" {
+			return returnMessage("rewind", "No active session. Use /sessions to list available sessions.")
+		}
+		if app.IsSessionBusy(sessionID) {
+			return returnError("rewind", "Cannot rewind the session while it is processing")
+		}
+
+		sess, err := app.Sessions.Get(ctx, sessionID)
+		if err != nil {
+			return returnError("rewind", fmt.Sprintf("Error getting session: %v", err))
+		}
+		messages, err := app.Messages.List(ctx, sessionID)
+		if err != nil {
+			return returnError("rewind", fmt.Sprintf("Error listing session messages: %v", err))
+		}
+
+		// Messages up to and including the summary can't be rewound
+		start := 0
+		for i, msg := range messages {
+			if msg.ID == sess.SummaryMessageID {
+				start = i + 1
+				break
+			}
+		}
+
+		// A turn starts at a user message and runs until the next one
+		var turnStarts []int
+		for i := start; i < len(messages); i++ {
+			if messages[i].Role == message.User {
+				turnStarts = append(turnStarts, i)
+			}
+		}
+		if len(turnStarts) == 0 {
+			return returnMessage("rewind", "Nothing to rewind.")
+		}
+		if turns > len(turnStarts) {
+			if sess.SummaryMessageID != "" {
+				return returnError("rewind", fmt.Sprintf("Can only rewind %d turn(s), earlier turns are part of the conversation summary", len(turnStarts)))
+			}
+			return returnError("rewind", fmt.Sprintf("Can only rewind %d turn(s)", len(turnStarts)))
+		}
+
+		removed := messages[turnStarts[len(turnStarts)-turns]:]
+		for _, msg := range removed {
+			if err := app.Messages.Delete(ctx, msg.ID); err != nil {
+				return returnError("rewind", fmt.Sprintf("Error deleting message: %v", err))
+			}
+		}
+		return returnMessage("rewind", fmt.Sprintf("Rewound %d turn(s), deleted %d messages", turns, len(removed)))
+	}
+}
+
+func createFilesHandler(app *app.App) func(ctx context.Context, args string) (string, error) {
+	return func(ctx context.Context, args string) (string, error) {
+		sessionID := app.GetCurrentSessionID()
+		if sessionID == "" {
+			return returnMessage("files", "No active session. Use /sessions to list available sessions.")
+		}
+
+		files, err := app.History.ListBySession(ctx, sessionID)
+		if err != nil {
+			return returnError("files", fmt.Sprintf("Error listing session files: %v", err))
+		}
+
+		versionsByPath := make(map[string][]history.File)
+		for _, file := range files {
+			versionsByPath[file.Path] = append(versionsByPath[file.Path], file)
+		}
+
+		response := FilesResponse{
+			Type:      "files",
+			SessionID: sessionID,
+			Files:     []FileSummary{},
+		}
+		for path, versions := range versionsByPath {
+			history.SortVersions(versions)
+			additions, removals := tools.CountLineChanges(versions[0].Content, versions[len(versions)-1].Content)
+			response.Files = append(response.Files, FileSummary{
+				Path:      path,
+				Versions:  len(versions),
+				Additions: additions,
+				Removals:  removals,
+			})
+		}
+		sort.Slice(response.Files, func(i, j int) bool {
+			return response.Files[i].Path < response.Files[j].Path
+		})
+
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			return returnError("files", fmt.Sprintf("Error marshaling files data: %v", err))
+		}
+		return string(jsonData), nil
+	}
+}
+
+func createSearchHandler(app *app.App) func(ctx context.Context, args string) (string, error) {
 	return func(ctx context.Context, args string) (string, error) {
-		return "", nil
+		query := strings.TrimSpace(args)
+		if query == "" {
+			return returnError("search", "Usage: /search <query>")
+		}
+
+		sessionID := app.GetCurrentSessionID()
+		if sessionID == "" {
+			return returnMessage("search", "No active session. Use /sessions to list available sessions.")
+		}
+
+		messages, err := app.Messages.List(ctx, sessionID)
+		if err != nil {
+			return returnError("search", fmt.Sprintf("Error listing session messages: %v", err))
+		}
+
+		response := SearchResponse{
+			Type:      "search",
+			SessionID: sessionID,
+			Query:     query,
+			Matches:   []SearchMatch{},
+		}
+		for i, msg := range messages {
+			text := []rune(searchableText(msg))
+			for _, offset := range findFold(text, []rune(query)) {
+				response.Total++
+				if len(response.Matches) == maxSearchMatches {
+					continue
+				}
+				response.Matches = append(response.Matches, SearchMatch{
+					MessageID: msg.ID,
+					Index:     i,
+					Role:      string(msg.Role),
+					Offset:    offset,
+					Snippet:   searchSnippet(text, offset, len([]rune(query))),
+				})
+			}
+		}
+
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			return returnError("search", fmt.Sprintf("Error marshaling search results: %v", err))
+		}
+		return string(jsonData), nil
+	}
+}
+
+// searchableText is the text of a message that /search looks through: its content and
+// the output of any tools it holds results for
+func searchableText(msg message.Message) string {
+	var parts []string
+	if content := msg.Content().String(); content != "" {
+		parts = append(parts, content)
+	}
+	for _, result := range msg.ToolResults() {
+		parts = append(parts, result.Content)
 	}
+	return strings.Join(parts, "\n")
+}
+
+// findFold returns the offsets of the case-insensitive occurrences of query in text
+func findFold(text, query []rune) []int {
+	var offsets []int
+	for i := 0; i+len(query) <= len(text); i++ {
+		if strings.EqualFold(string(text[i:i+len(query)]), string(query)) {
+			offsets = append(offsets, i)
+			i += len(query) - 1
+		}
+	}
+	return offsets
+}
+
+// searchSnippet returns the match at offset with some surrounding text on one line
+func searchSnippet(text []rune, offset, length int) string {
+	start := max(offset-searchSnippetContext, 0)
+	end := min(offset+length+searchSnippetContext, len(text))
+	snippet := strings.Join(strings.Fields(string(text[start:end])), " ")
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(text) {
+		snippet += "..."
+	}
+	return snippet
+}
+
+func createExportContextHandler(app *app.App) func(ctx context.Context, args string) (string, error) {
+	return func(ctx context.Context, args string) (string, error) {
+		var path string
+		inline := false
+		for _, arg := range strings.Fields(args) {
+			switch {
+			case arg == "--inline":
+				inline = true
+			case path == "" && !strings.HasPrefix(arg, "-"):
+				path = arg
+			default:
+				return returnError("export-context", "Usage: /export-context [path] [--inline]")
+			}
+		}
+
+		sess, err := app.GetCurrentSession(ctx)
+		if err != nil {
+			return returnError("export-context", fmt.Sprintf("Error retrieving current session: %v", err))
+		}
+		if sess == nil {
+			return returnMessage("export-context", "No active session. Use /sessions to list available sessions.")
+		}
+		messages, err := app.Messages.List(ctx, sess.ID)
+		if err != nil {
+			return returnError("export-context", fmt.Sprintf("Error listing session messages: %v", err))
+		}
+
+		cfg := config.Get()
+		var model models.Model
+		if app.CoderAgent != nil {
+			model = app.CoderAgent.Model()
+		} else {
+			model = models.SupportedModels[cfg.Agents[config.AgentMain].Model]
+		}
+		bundle := ContextBundle{
+			Version:    contextBundleVersion,
+			ExportedAt: time.Now().Unix(),
+			SessionID:  sess.ID,
+			Title:      sess.Title,
+			Model:      string(model.ID),
+			Provider:   string(model.Provider),
+			Config:     cfg.Redacted(),
+			Messages:   make([]BundleMessage, 0, len(messages)),
+		}
+		for _, msg := range messages {
+			parts := msg.Parts
+			if !inline {
+				parts = referenceAttachments(parts)
+			}
+			partsJSON, err := message.MarshalParts(parts)
+			if err != nil {
+				return returnError("export-context", fmt.Sprintf("Error encoding message: %v", err))
+			}
+			bundle.Messages = append(bundle.Messages, BundleMessage{
+				ID:        msg.ID,
+				Role:      string(msg.Role),
+				Model:     string(msg.Model),
+				CreatedAt: msg.CreatedAt,
+				Parts:     partsJSON,
+			})
+		}
+
+		if path == "" {
+			path = fmt.Sprintf("mix-context-%s.json", sess.ID)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cfg.WorkingDir, path)
+		}
+		data, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			return returnError("export-context", fmt.Sprintf("Error marshaling context bundle: %v", err))
+		}
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return returnError("export-context", fmt.Sprintf("Error writing context bundle: %v", err))
+		}
+
+		jsonData, err := json.Marshal(ExportContextResponse{
+			Type:         "export_context",
+			Path:         path,
+			SessionID:    sess.ID,
+			MessageCount: len(bundle.Messages),
+		})
+		if err != nil {
+			return returnError("export-context", fmt.Sprintf("Error marshaling export result: %v", err))
+		}
+		return string(jsonData), nil
+	}
+}
+
+// referenceAttachments drops the data of attachments read from a file, keeping the path
+// to reference them by. Attachments without a path, such as pasted images, stay inline.
+func referenceAttachments(parts []message.ContentPart) []message.ContentPart {
+	referenced := make([]message.ContentPart, len(parts))
+	for i, part := range parts {
+		if binary, ok := part.(message.BinaryContent); ok && binary.Path != "" {
+			binary.Data = nil
+			part = binary
+		}
+		referenced[i] = part
+	}
+	return referenced
 }
 
 func createSessionHandler(app *app.App) func(ctx context.Context, args string) (string, error) {
@@ -323,96 +996,227 @@ func createSessionsHandler(app *app.App) func(ctx context.Context, args string)
 	}
 }
 
-func createMcpHandler() func(ctx context.Context, args string) (string, error) {
+// agentRoles describes what each configured agent is used for
+var agentRoles = map[config.AgentName]string{
+	config.AgentMain: "Handles the conversation and dispatches tasks to the sub agent",
+	config.AgentSub:  "Runs tasks dispatched with the agent tool, using read-only tools",
+}
+
+func createAgentsHandler() func(ctx context.Context, args string) (string, error) {
 	return func(ctx context.Context, args string) (string, error) {
 		cfg := config.Get()
+		if len(cfg.Agents) == 0 {
+			return returnMessage("agents", "No agents configured.\n\nAdd them to your configuration file under 'agents'.")
+		}
 
-		if len(cfg.MCPServers) == 0 {
-			return returnMessage("mcp", "No MCP servers configured.\n\nTo configure MCP servers, add them to your configuration file under 'mcpServers'.")
+		var names []string
+		for name := range cfg.Agents {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+
+		agents := make([]AgentSummary, 0, len(names))
+		for _, name := range names {
+			agentCfg := cfg.Agents[config.AgentName(name)]
+			summary := AgentSummary{
+				Name:            name,
+				Role:            agentRoles[config.AgentName(name)],
+				Model:           string(agentCfg.Model),
+				MaxTokens:       agentCfg.MaxTokens,
+				ReasoningEffort: agentCfg.ReasoningEffort,
+			}
+			if model, ok := models.SupportedModels[agentCfg.Model]; ok {
+				summary.Provider = string(model.Provider)
+			}
+			agents = append(agents, summary)
 		}
 
-		// Sort server names for consistent output
-		var serverNames []string
-		for name := range cfg.MCPServers {
-			serverNames = append(serverNames, name)
+		jsonData, err := json.Marshal(AgentsResponse{Type: "agents", Agents: agents})
+		if err != nil {
+			return returnError("agents", fmt.Sprintf("Error marshaling agents data: %v", err))
 		}
-		sort.Strings(serverNames)
+		return string(jsonData), nil
+	}
+}
 
-		// Get MCP tools to check connection status and group by server
-		// Create temporary manager for informational listing
-		tempManager := agent.NewMCPClientManager()
-		defer tempManager.Close()
-		mcpTools := agent.GetMcpTools(ctx, nil, tempManager)
+func createMcpHandler(app *app.App) func(ctx context.Context, args string) (string, error) {
+	return func(ctx context.Context, args string) (string, error) {
+		fields := strings.Fields(args)
+		if len(fields) == 0 {
+			return listMcpServers(ctx)
+		}
 
-		// Group tools by server name
-		serverTools := make(map[string][]tools.BaseTool)
-		for _, tool := range mcpTools {
-			if toolInfo := tool.Info(); strings.Contains(toolInfo.Name, "_") {
-				serverName := strings.Split(toolInfo.Name, "_")[0]
-				serverTools[serverName] = append(serverTools[serverName], tool)
+		const usage = "Usage: /mcp [add <name> <command|url> [args...] | remove <name> | test <name>]"
+		switch {
+		case fields[0] == "add" && len(fields) >= 3:
+			// A URL connects over SSE, anything else is a command run over stdio
+			server := config.MCPServer{Type: config.MCPStdio, Command: fields[2], Args: fields[3:]}
+			if strings.HasPrefix(fields[2], "http://") || strings.HasPrefix(fields[2], "https://") {
+				if len(fields) > 3 {
+					return returnError("mcp", usage)
+				}
+				server = config.MCPServer{Type: config.MCPSse, URL: fields[2]}
 			}
-		}
+			status, err := app.AddMCPServer(ctx, fields[1], server)
+			if err != nil {
+				return returnError("mcp", fmt.Sprintf("Error adding MCP server: %v", err))
+			}
+			return mcpStatusResponse("add", status)
 
-		// Build server data
-		var servers []McpServer
-		for _, name := range serverNames {
-			tools := serverTools[name]
+		case fields[0] == "remove" && len(fields) == 2:
+			if err := app.RemoveMCPServer(ctx, fields[1]); err != nil {
+				return returnError("mcp", fmt.Sprintf("Error removing MCP server: %v", err))
+			}
+			return returnMessage("mcp", fmt.Sprintf("Removed MCP server %s", fields[1]))
 
-			// Determine connection status
-			var statusText string
-			connected := len(tools) > 0
-			if connected {
-				statusText = "connected"
-			} else {
-				statusText = "failed"
+		case fields[0] == "test" && len(fields) == 2:
+			status, err := app.TestMCPServer(ctx, fields[1])
+			if err != nil {
+				return returnError("mcp", err.Error())
 			}
+			return mcpStatusResponse("test", status)
+		}
+		return returnError("mcp", usage)
+	}
+}
 
-			// Build tool list
-			var mcpTools []McpTool
-			if len(tools) > 0 {
-				// Sort tools by name for consistent output
-				sort.Slice(tools, func(i, j int) bool {
-					return tools[i].Info().Name < tools[j].Info().Name
-				})
+// mcpStatusResponse reports the connection status of a server that was added or tested
+func mcpStatusResponse(action string, status agent.MCPServerStatus) (string, error) {
+	server := McpServer{
+		Name:      status.Name,
+		Status:    "failed",
+		Connected: status.Connected,
+		ToolCount: len(status.Tools),
+		Tools:     []McpTool{},
+		Error:     status.Error,
+	}
+	if status.Connected {
+		server.Status = "connected"
+	}
+	for _, name := range status.Tools {
+		server.Tools = append(server.Tools, McpTool{Name: name})
+	}
 
-				for _, tool := range tools {
-					info := tool.Info()
-					// Remove server prefix from tool name for cleaner display
-					toolName := info.Name
-					if strings.Contains(toolName, "_") {
-						parts := strings.SplitN(toolName, "_", 2)
-						if len(parts) > 1 {
-							toolName = parts[1]
-						}
-					}
-					mcpTools = append(mcpTools, McpTool{
-						Name:        toolName,
-						Description: info.Description,
-					})
+	jsonData, err := json.Marshal(McpStatusResponse{Type: "mcp_status", Action: action, Server: server})
+	if err != nil {
+		return returnError("mcp", fmt.Sprintf("Error marshaling MCP data: %v", err))
+	}
+	return string(jsonData), nil
+}
+
+// listMcpServers connects to every configured MCP server and lists its tools
+func listMcpServers(ctx context.Context) (string, error) {
+	cfg := config.Get()
+
+	if len(cfg.MCPServers) == 0 {
+		return returnMessage("mcp", "No MCP servers configured.\n\nTo configure MCP servers, add them to your configuration file under 'mcpServers' or use /mcp add.")
+	}
+	if cfg.DisableMCP {
+		return returnMessage("mcp", "MCP is disabled, so no MCP tools are loaded.\n\nRemove --no-mcp or set 'disableMcp' to false in your configuration file to enable it.")
+	}
+
+	// Sort server names for consistent output
+	var serverNames []string
+	for name := range cfg.MCPServers {
+		serverNames = append(serverNames, name)
+	}
+	sort.Strings(serverNames)
+
+	// Get MCP tools to check connection status and group by server
+	// Create temporary manager for informational listing
+	tempManager := agent.NewMCPClientManager()
+	defer tempManager.Close()
+	serverTools := agent.GetMcpToolsByServer(ctx, nil, tempManager)
+	conflicts := agent.MCPToolConflicts(serverTools)
+
+	// Build server data
+	var servers []McpServer
+	for _, name := range serverNames {
+		tools := serverTools[name]
+
+		// Determine connection status
+		var statusText string
+		connected := len(tools) > 0
+		if connected {
+			statusText = "connected"
+		} else {
+			statusText = "failed"
+		}
+
+		// Build tool list, naming each tool as its server does
+		var mcpTools []McpTool
+		for _, tool := range tools {
+			info := tool.Info()
+			_, toolName, _ := agent.MCPToolName(tool)
+			var conflictsWith []string
+			for _, other := range conflicts[info.Name] {
+				if other != name {
+					conflictsWith = append(conflictsWith, other)
 				}
 			}
-
-			servers = append(servers, McpServer{
-				Name:      name,
-				Status:    statusText,
-				Connected: connected,
-				ToolCount: len(tools),
-				Tools:     mcpTools,
+			mcpTools = append(mcpTools, McpTool{
+				Name:          toolName,
+				Description:   info.Description,
+				ConflictsWith: conflictsWith,
 			})
 		}
+		// Sort tools by name for consistent output
+		sort.Slice(mcpTools, func(i, j int) bool {
+			return mcpTools[i].Name < mcpTools[j].Name
+		})
 
-		// Create structured response
-		response := McpResponse{
-			Type:    "mcp",
-			Servers: servers,
-		}
+		servers = append(servers, McpServer{
+			Name:      name,
+			Status:    statusText,
+			Connected: connected,
+			ToolCount: len(tools),
+			Tools:     mcpTools,
+		})
+	}
 
-		// Convert to JSON
-		jsonData, err := json.Marshal(response)
+	// Create structured response
+	response := McpResponse{
+		Type:    "mcp",
+		Servers: servers,
+	}
+
+	// Convert to JSON
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		return returnError("mcp", fmt.Sprintf("Error marshaling MCP data: %v", err))
+	}
+
+	return string(jsonData), nil
+}
+
+func createStatsHandler(app *app.App) func(ctx context.Context, args string) (string, error) {
+	return func(ctx context.Context, args string) (string, error) {
+		currentSession, err := app.GetCurrentSession(ctx)
 		if err != nil {
-			return returnError("mcp", fmt.Sprintf("Error marshaling MCP data: %v", err))
+			return returnError("stats", fmt.Sprintf("Error retrieving current session: %v", err))
+		}
+		if currentSession == nil {
+			return returnMessage("stats", "No active session. Use /sessions to list available sessions.")
+		}
+
+		stats, ok := app.CoderAgent.LastTurnStats(currentSession.ID)
+		if !ok {
+			return returnMessage("stats", "No turn has completed in this session yet.")
 		}
 
+		jsonData, err := json.Marshal(StatsResponse{
+			Type:               "stats",
+			SessionID:          currentSession.ID,
+			LatencyMs:          stats.Latency.Milliseconds(),
+			TimeToFirstTokenMs: stats.TimeToFirstToken.Milliseconds(),
+			GenerationMs:       stats.GenerationTime.Milliseconds(),
+			OutputTokens:       stats.OutputTokens,
+			TokensPerSecond:    stats.TokensPerSecond,
+			Requests:           stats.Requests,
+		})
+		if err != nil {
+			return returnError("stats", fmt.Sprintf("Error marshaling stats data: %v", err))
+		}
 		return string(jsonData), nil
 	}
 }
@@ -432,28 +1236,16 @@ func createContextHandler(app *app.App) func(ctx context.Context, args string) (
 		currentModel := app.CoderAgent.Model()
 		maxContextTokens := int64(currentModel.ContextWindow)
 
-		// System prompt estimation (rough approximation)
-		systemPromptTokens := int64(5000) // Typical system prompt size
-		systemPromptPercent := float64(systemPromptTokens) / float64(maxContextTokens) * 100
-
-		// Tool descriptions estimation
-		toolTokens := int64(15000) // Typical tool descriptions size
-		toolPercent := float64(toolTokens) / float64(maxContextTokens) * 100
-
-		// Calculate conversation tokens (excluding system overhead)
-		conversationTokens := currentSession.PromptTokens + currentSession.CompletionTokens
-
-		// User and assistant message breakdown
-		userTokens := currentSession.PromptTokens
-		userPercent := float64(userTokens) / float64(maxContextTokens) * 100
-
-		assistantTokens := currentSession.CompletionTokens
-		assistantPercent := float64(assistantTokens) / float64(maxContextTokens) * 100
+		tokens, err := app.CoderAgent.ContextTokens(ctx, currentSession.ID)
+		if err != nil {
+			return returnError("context", fmt.Sprintf("Error counting context tokens: %v", err))
+		}
+		percent := func(count int64) float64 {
+			return float64(count) / float64(maxContextTokens) * 100
+		}
 
-		// Calculate total tokens including baseline system context
-		baselineTokens := systemPromptTokens + toolTokens
-		totalTokens := baselineTokens + conversationTokens
-		contextUsagePercent := float64(totalTokens) / float64(maxContextTokens) * 100
+		totalTokens := tokens.SystemPrompt + tokens.Tools + tokens.UserMessages + tokens.AssistantMessages + tokens.ToolResults
+		contextUsagePercent := percent(totalTokens)
 
 		// Determine warning level
 		warningLevel := "none"
@@ -474,33 +1266,14 @@ func createContextHandler(app *app.App) func(ctx context.Context, args string) (
 			UsagePercent:   contextUsagePercent,
 			WarningLevel:   warningLevel,
 			WarningMessage: warningMessage,
+			Estimated:      tokens.Estimated,
 			Components: []ComponentBreakdown{
-				{
-					Name:       "System Prompt",
-					Tokens:     systemPromptTokens,
-					Percentage: systemPromptPercent,
-				},
-				{
-					Name:       "Tool Descriptions",
-					Tokens:     toolTokens,
-					Percentage: toolPercent,
-				},
-				{
-					Name:       "User Messages",
-					Tokens:     userTokens,
-					Percentage: userPercent,
-				},
-				{
-					Name:       "Assistant Responses",
-					Tokens:     assistantTokens,
-					Percentage: assistantPercent,
-				},
-				{
-					Name:       "Total",
-					Tokens:     totalTokens,
-					Percentage: contextUsagePercent,
-					IsTotal:    true,
-				},
+				{Name: "System Prompt", Tokens: tokens.SystemPrompt, Percentage: percent(tokens.SystemPrompt)},
+				{Name: "Tool Descriptions", Tokens: tokens.Tools, Percentage: percent(tokens.Tools)},
+				{Name: "User Messages", Tokens: tokens.UserMessages, Percentage: percent(tokens.UserMessages)},
+				{Name: "Assistant Responses", Tokens: tokens.AssistantMessages, Percentage: percent(tokens.AssistantMessages)},
+				{Name: "Tool Results", Tokens: tokens.ToolResults, Percentage: percent(tokens.ToolResults)},
+				{Name: "Total", Tokens: totalTokens, Percentage: contextUsagePercent, IsTotal: true},
 			},
 		}
 
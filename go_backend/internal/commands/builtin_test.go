@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mix/internal/config"
+	"mix/internal/llm/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatTokenValidity(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name      string
+		expiresAt int64
+		expected  string
+	}{
+		{"no expiry", 0, "no expiry"},
+		{"minutes remaining", now.Add(45 * time.Minute).Unix(), "expires in 45m"},
+		{"hours remaining", now.Add(7*time.Hour + 5*time.Minute + 30*time.Second).Unix(), "expires in 7h 5m"},
+		{"partial minute is rounded down", now.Add(90 * time.Second).Unix(), "expires in 1m"},
+		{"one second remaining", now.Add(time.Second).Unix(), "expires in less than a minute"},
+		{"59 seconds remaining", now.Add(59 * time.Second).Unix(), "expires in less than a minute"},
+		{"one minute remaining", now.Add(time.Minute).Unix(), "expires in 1m"},
+		{"already expired", now.Add(-2 * time.Hour).Unix(), "expired 2h 0m ago"},
+		{"expiring now", now.Unix(), "expired 0m ago"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, formatTokenValidity(tt.expiresAt, now))
+		})
+	}
+}
+
+func TestAgentsCommand(t *testing.T) {
+	cfg := config.Get()
+	original := cfg.Agents
+	t.Cleanup(func() { cfg.Agents = original })
+	handler := createAgentsHandler()
+
+	cfg.Agents = map[config.AgentName]config.Agent{}
+	output, err := handler(context.Background(), "")
+	require.NoError(t, err)
+	assert.Contains(t, output, "No agents configured")
+
+	cfg.Agents = map[config.AgentName]config.Agent{
+		config.AgentSub:  {Model: models.Claude35Haiku, MaxTokens: 4096},
+		config.AgentMain: {Model: models.O4Mini, MaxTokens: 8192, ReasoningEffort: "high"},
+	}
+	output, err = handler(context.Background(), "")
+	require.NoError(t, err)
+
+	var response AgentsResponse
+	require.NoError(t, json.Unmarshal([]byte(output), &response))
+	assert.Equal(t, "agents", response.Type)
+	require.Len(t, response.Agents, 2)
+	assert.Equal(t, AgentSummary{
+		Name:            "main",
+		Role:            agentRoles[config.AgentMain],
+		Model:           "o4-mini",
+		Provider:        "openai",
+		MaxTokens:       8192,
+		ReasoningEffort: "high",
+	}, response.Agents[0])
+	assert.Equal(t, "sub", response.Agents[1].Name)
+	assert.Equal(t, "anthropic", response.Agents[1].Provider)
+}
+
+func TestPromptCommand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	promptsDir := filepath.Join(home, ".mix", "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "review.md"), []byte("Review {{file}} carefully.\n"), 0o644))
+	handler := createPromptHandler()
+
+	t.Run("expands the template for the agent", func(t *testing.T) {
+		output, err := handler(context.Background(), "review file=agent.go")
+		require.NoError(t, err)
+
+		prompt, ok := PromptFromOutput(output)
+		require.True(t, ok)
+		assert.Equal(t, "Review agent.go carefully.", prompt)
+	})
+
+	t.Run("missing template", func(t *testing.T) {
+		output, err := handler(context.Background(), "does-not-exist")
+		require.NoError(t, err)
+		_, ok := PromptFromOutput(output)
+		assert.False(t, ok)
+		assert.Contains(t, output, `"type":"error"`)
+	})
+
+	t.Run("other command output", func(t *testing.T) {
+		_, ok := PromptFromOutput(`{"type":"message","message":"hello"}`)
+		assert.False(t, ok)
+		_, ok = PromptFromOutput("plain text")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"mix/internal/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClearCommand(t *testing.T) {
+	ctx := context.Background()
+	testApp := newTestApp(t)
+	handler := createClearHandler(testApp)
+
+	sess, err := testApp.Sessions.Create(ctx, "clear session")
+	require.NoError(t, err)
+	require.NoError(t, testApp.SetCurrentSession(sess.ID))
+	var created []message.Message
+	for _, text := range []string{"one", "two"} {
+		msg, err := testApp.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+			Role:  message.User,
+			Parts: []message.ContentPart{message.TextContent{Text: text}},
+		})
+		require.NoError(t, err)
+		created = append(created, msg)
+	}
+	sess, err = testApp.Sessions.Get(ctx, sess.ID)
+	require.NoError(t, err)
+	sess.SummaryMessageID = created[0].ID
+	sess.PromptTokens = 1200
+	sess.CompletionTokens = 300
+	sess.Cost = 0.5
+	_, err = testApp.Sessions.Save(ctx, sess)
+	require.NoError(t, err)
+
+	t.Run("soft clear keeps stored messages", func(t *testing.T) {
+		output, err := handler(ctx, "")
+		require.NoError(t, err)
+		assert.Empty(t, output)
+
+		messages, err := testApp.Messages.List(ctx, sess.ID)
+		require.NoError(t, err)
+		assert.Len(t, messages, 2)
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		output, err := handler(ctx, "--everything")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Usage: /clear [--hard]")
+	})
+
+	t.Run("hard clear deletes stored messages", func(t *testing.T) {
+		output, err := handler(ctx, "--hard")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Deleted 2 messages")
+
+		messages, err := testApp.Messages.List(ctx, sess.ID)
+		require.NoError(t, err)
+		assert.Empty(t, messages)
+
+		// The session itself is kept
+		kept, err := testApp.Sessions.Get(ctx, sess.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), kept.MessageCount)
+
+		// The summary and token counts went with the messages, the cost is kept
+		assert.Empty(t, kept.SummaryMessageID)
+		assert.Zero(t, kept.PromptTokens)
+		assert.Zero(t, kept.CompletionTokens)
+		assert.Equal(t, 0.5, kept.Cost)
+	})
+}
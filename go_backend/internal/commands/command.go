@@ -18,6 +18,25 @@ type Command interface {
 	Execute(ctx context.Context, args string) (string, error)
 }
 
+// DestructiveCommand is implemented by commands that destroy data when run with some
+// arguments. The registry only runs those with confirmation, see WithConfirmation.
+type DestructiveCommand interface {
+	Destructive(args string) bool
+}
+
+type confirmationContextKey struct{}
+
+// WithConfirmation returns a context in which destructive commands are confirmed by the
+// user and may run
+func WithConfirmation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, confirmationContextKey{}, true)
+}
+
+func confirmed(ctx context.Context) bool {
+	ok, _ := ctx.Value(confirmationContextKey{}).(bool)
+	return ok
+}
+
 // FileCommand represents a command loaded from a .md file
 type FileCommand struct {
 	name        string
@@ -32,6 +51,7 @@ type CommandMetadata struct {
 	Description  string   `yaml:"description"`
 	ArgumentHint string   `yaml:"argument-hint"`
 	AllowedTools []string `yaml:"allowed-tools"`
+	Aliases      []string `yaml:"aliases"`
 }
 
 // NewFileCommand creates a command from a markdown file
@@ -103,6 +123,11 @@ func (c *FileCommand) Description() string {
 	return c.description
 }
 
+// Aliases returns the alternative names declared in the command's frontmatter
+func (c *FileCommand) Aliases() []string {
+	return c.metadata.Aliases
+}
+
 func (c *FileCommand) Execute(ctx context.Context, args string) (string, error) {
 	// Substitute $ARGUMENTS placeholder
 	prompt := strings.ReplaceAll(c.content, "$ARGUMENTS", args)
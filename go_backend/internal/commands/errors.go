@@ -7,4 +7,6 @@ var (
 	ErrEmptyCommand    = errors.New("command cannot be empty")
 	ErrCommandNotFound = errors.New("command not found")
 	ErrCommandFailed   = errors.New("command execution failed")
+	// ErrConfirmationRequired is returned for a destructive command run without confirmation
+	ErrConfirmationRequired = errors.New("command requires confirmation")
 )
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mix/internal/config"
+	"mix/internal/llm/models"
+	"mix/internal/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportContextCommand(t *testing.T) {
+	cfg := config.Get()
+	originalAgents, originalProviders, originalWD := cfg.Agents, cfg.Providers, cfg.WorkingDir
+	t.Cleanup(func() {
+		cfg.Agents, cfg.Providers, cfg.WorkingDir = originalAgents, originalProviders, originalWD
+	})
+	cfg.Agents = map[config.AgentName]config.Agent{config.AgentMain: {Model: models.Claude4Sonnet}}
+	cfg.Providers = map[models.ModelProvider]config.Provider{models.ProviderAnthropic: {APIKey: "sk-ant-secret"}}
+	cfg.WorkingDir = t.TempDir()
+
+	ctx := context.Background()
+	testApp := newTestApp(t)
+	handler := createExportContextHandler(testApp)
+
+	output, err := handler(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, output, "No active session")
+
+	sess, err := testApp.Sessions.Create(ctx, "export session")
+	require.NoError(t, err)
+	require.NoError(t, testApp.SetCurrentSession(sess.ID))
+
+	image := message.BinaryContent{Path: "/project/diagram.png", MIMEType: "image/png", Data: []byte("png bytes")}
+	pasted := message.BinaryContent{MIMEType: "image/png", Data: []byte("pasted bytes")}
+	user, err := testApp.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+		Role:  message.User,
+		Parts: []message.ContentPart{message.TextContent{Text: "What does this show?"}, image, pasted},
+	})
+	require.NoError(t, err)
+	reply, err := testApp.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+		Role:  message.Assistant,
+		Model: models.Claude4Sonnet,
+		Parts: []message.ContentPart{
+			message.TextContent{Text: "Let me look."},
+			message.ToolCall{ID: "call-1", Name: "view", Input: `{"file_path":"/project/README.md"}`, Type: "tool_use", Finished: true},
+		},
+	})
+	require.NoError(t, err)
+
+	readBundle := func(t *testing.T, output string) ContextBundle {
+		var response ExportContextResponse
+		require.NoError(t, json.Unmarshal([]byte(output), &response), output)
+		assert.Equal(t, "export_context", response.Type)
+		assert.Equal(t, sess.ID, response.SessionID)
+		assert.Equal(t, 2, response.MessageCount)
+
+		data, err := os.ReadFile(response.Path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "sk-ant-secret")
+		var bundle ContextBundle
+		require.NoError(t, json.Unmarshal(data, &bundle))
+		return bundle
+	}
+
+	t.Run("attachments by reference", func(t *testing.T) {
+		output, err := handler(ctx, "")
+		require.NoError(t, err)
+		bundle := readBundle(t, output)
+		assert.Contains(t, output, filepath.Join(cfg.WorkingDir, "mix-context-"+sess.ID+".json"))
+
+		assert.Equal(t, contextBundleVersion, bundle.Version)
+		assert.Equal(t, "export session", bundle.Title)
+		assert.Equal(t, string(models.Claude4Sonnet), bundle.Model)
+		assert.Equal(t, string(models.ProviderAnthropic), bundle.Provider)
+		assert.Equal(t, "[redacted]", bundle.Config.Providers[models.ProviderAnthropic].APIKey)
+		assert.Equal(t, models.Claude4Sonnet, bundle.Config.Agents[config.AgentMain].Model)
+
+		require.Len(t, bundle.Messages, 2)
+		assert.Equal(t, user.ID, bundle.Messages[0].ID)
+		assert.Equal(t, "user", bundle.Messages[0].Role)
+		userParts, err := message.UnmarshalParts(bundle.Messages[0].Parts)
+		require.NoError(t, err)
+		decoded := message.Message{Parts: userParts}
+		assert.Equal(t, "What does this show?", decoded.Content().Text)
+		require.Len(t, decoded.BinaryContent(), 2)
+		assert.Equal(t, "/project/diagram.png", decoded.BinaryContent()[0].Path)
+		assert.Empty(t, decoded.BinaryContent()[0].Data)
+		assert.Equal(t, pasted.Data, decoded.BinaryContent()[1].Data)
+
+		assert.Equal(t, reply.ID, bundle.Messages[1].ID)
+		assert.Equal(t, string(models.Claude4Sonnet), bundle.Messages[1].Model)
+		replyParts, err := message.UnmarshalParts(bundle.Messages[1].Parts)
+		require.NoError(t, err)
+		assert.Equal(t, reply.Parts, replyParts)
+	})
+
+	t.Run("inline attachments to a given path", func(t *testing.T) {
+		output, err := handler(ctx, "bundle.json --inline")
+		require.NoError(t, err)
+		assert.Contains(t, output, filepath.Join(cfg.WorkingDir, "bundle.json"))
+		bundle := readBundle(t, output)
+
+		userParts, err := message.UnmarshalParts(bundle.Messages[0].Parts)
+		require.NoError(t, err)
+		assert.Equal(t, user.Parts, userParts)
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		output, err := handler(ctx, "one.json two.json")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Usage: /export-context")
+	})
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesCommand(t *testing.T) {
+	ctx := context.Background()
+	testApp := newTestApp(t)
+	handler := createFilesHandler(testApp)
+
+	output, err := handler(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, output, "No active session")
+
+	sess, err := testApp.Sessions.Create(ctx, "files session")
+	require.NoError(t, err)
+	require.NoError(t, testApp.SetCurrentSession(sess.ID))
+
+	// Record versions the way the edit tool does: original content, then each edit
+	mainPath := "/project/main.go"
+	readmePath := "/project/README.md"
+	for _, content := range []string{
+		"package main\n\nfunc main() {\n}\n",
+		"package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n",
+		"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n",
+	} {
+		_, err = testApp.History.CreateVersion(ctx, sess.ID, mainPath, content)
+		require.NoError(t, err)
+	}
+	_, err = testApp.History.Create(ctx, sess.ID, readmePath, "")
+	require.NoError(t, err)
+	_, err = testApp.History.CreateVersion(ctx, sess.ID, readmePath, "# Project\n\nNotes\n")
+	require.NoError(t, err)
+
+	output, err = handler(ctx, "")
+	require.NoError(t, err)
+
+	var response FilesResponse
+	require.NoError(t, json.Unmarshal([]byte(output), &response))
+	assert.Equal(t, "files", response.Type)
+	assert.Equal(t, sess.ID, response.SessionID)
+	assert.Equal(t, []FileSummary{
+		{Path: readmePath, Versions: 2, Additions: 3, Removals: 0},
+		{Path: mainPath, Versions: 3, Additions: 3, Removals: 0},
+	}, response.Files)
+}
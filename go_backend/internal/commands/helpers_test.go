@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mix/internal/app"
+	"mix/internal/config"
+	"mix/internal/db"
+	"mix/internal/history"
+	"mix/internal/message"
+	"mix/internal/session"
+
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestApp returns an app with sessions, messages and file history backed by a
+// fresh database
+func newTestApp(t *testing.T) *app.App {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, db.SetupTestDatabase(conn))
+
+	queries := db.New(conn)
+	return &app.App{
+		Sessions: session.NewService(queries),
+		Messages: message.NewService(queries),
+		History:  history.NewService(queries, conn),
+	}
+}
+
+// loadTestConfig loads the config from a .mix.json in a temporary home directory
+func loadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfgJSON := `{"agents": {"main": {"model": "claude-4-sonnet"}, "sub": {"model": "claude-4-sonnet"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".mix.json"), []byte(cfgJSON), 0o644))
+
+	cfg, err := config.Load(home, false, false)
+	require.NoError(t, err)
+	return cfg
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"mix/internal/app"
+	"mix/internal/config"
+	"mix/internal/llm/agent"
+	"mix/internal/llm/tools"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// idleAgent accepts MCP tool updates
+type idleAgent struct {
+	agent.Service
+}
+
+func (a *idleAgent) IsBusy() bool { return false }
+
+func (a *idleAgent) SetMCPTools(mcpTools []tools.BaseTool) error { return nil }
+
+func TestMcpCommand(t *testing.T) {
+	loadTestConfig(t)
+
+	ctx := context.Background()
+	handler := createMcpHandler(&app.App{CoderAgent: &idleAgent{}})
+
+	t.Run("add a URL as an SSE server", func(t *testing.T) {
+		output, err := handler(ctx, "add remote http://127.0.0.1:1/sse")
+		require.NoError(t, err)
+
+		var response McpStatusResponse
+		require.NoError(t, json.Unmarshal([]byte(output), &response))
+		assert.Equal(t, "add", response.Action)
+		assert.Equal(t, "remote", response.Server.Name)
+		assert.Equal(t, "failed", response.Server.Status)
+		assert.NotEmpty(t, response.Server.Error)
+		assert.Equal(t, config.MCPServer{Type: config.MCPSse, URL: "http://127.0.0.1:1/sse"}, config.Get().MCPServers["remote"])
+	})
+
+	t.Run("add a command as a stdio server", func(t *testing.T) {
+		_, err := handler(ctx, "add local mix-test-missing-mcp-server --port 0")
+		require.NoError(t, err)
+		assert.Equal(t, config.MCPServer{Type: config.MCPStdio, Command: "mix-test-missing-mcp-server", Args: []string{"--port", "0"}}, config.Get().MCPServers["local"])
+	})
+
+	t.Run("test", func(t *testing.T) {
+		output, err := handler(ctx, "test local")
+		require.NoError(t, err)
+		assert.Contains(t, output, `"action":"test"`)
+		assert.Contains(t, output, `"connected":false`)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		for _, name := range []string{"remote", "local"} {
+			output, err := handler(ctx, "remove "+name)
+			require.NoError(t, err)
+			assert.Contains(t, output, "Removed MCP server "+name)
+		}
+		assert.Empty(t, config.Get().MCPServers)
+
+		output, err := handler(ctx, "remove local")
+		require.NoError(t, err)
+		assert.Contains(t, output, "not found")
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		for _, args := range []string{"add only-name", "remove", "restart local"} {
+			output, err := handler(ctx, args)
+			require.NoError(t, err)
+			assert.Contains(t, output, "Usage: /mcp")
+		}
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"mix/internal/app"
 )
@@ -12,12 +14,14 @@ import (
 // Registry manages all available commands
 type Registry struct {
 	commands map[string]Command
+	aliases  map[string]string // alias -> canonical command name
 }
 
 // NewRegistry creates a new command registry
 func NewRegistry() *Registry {
 	return &Registry{
 		commands: make(map[string]Command),
+		aliases:  make(map[string]string),
 	}
 }
 
@@ -60,15 +64,46 @@ func (r *Registry) loadCommandsFromDir(dir, scope string) error {
 
 		// Also register without prefix for convenience (last one wins)
 		r.commands[name] = cmd
+
+		fileCmd, ok := cmd.(*FileCommand)
+		if !ok {
+			continue
+		}
+		for _, alias := range fileCmd.Aliases() {
+			if existing, exists := r.commands[alias]; exists {
+				if _, isBuiltin := existing.(*BuiltinCommand); isBuiltin {
+					return fmt.Errorf("alias %q of command %s conflicts with builtin command", alias, prefixedName)
+				}
+			}
+			r.aliases[alias] = name
+		}
 	}
 
 	return nil
 }
 
-// GetCommand retrieves a command by name
+// GetCommand retrieves a command by name or alias
 func (r *Registry) GetCommand(name string) (Command, bool) {
-	cmd, exists := r.commands[name]
-	return cmd, exists
+	if cmd, exists := r.commands[name]; exists {
+		return cmd, true
+	}
+	if canonical, isAlias := r.aliases[name]; isAlias {
+		cmd, exists := r.commands[canonical]
+		return cmd, exists
+	}
+	return nil, false
+}
+
+// GetAliases returns the sorted aliases that resolve to the named command
+func (r *Registry) GetAliases(name string) []string {
+	var aliases []string
+	for alias, canonical := range r.aliases {
+		if canonical == name {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
 }
 
 // GetAllCommands returns all registered commands
@@ -87,6 +122,10 @@ func (r *Registry) ExecuteCommand(ctx context.Context, name, args string) (strin
 		return "", fmt.Errorf("%w: %s", ErrCommandNotFound, name)
 	}
 
+	if destructive, ok := cmd.(DestructiveCommand); ok && destructive.Destructive(args) && !confirmed(ctx) {
+		return "", fmt.Errorf("%w: /%s deletes data and must be confirmed", ErrConfirmationRequired, strings.TrimSpace(name+" "+args))
+	}
+
 	result, err := cmd.Execute(ctx, args)
 	if err != nil {
 		return "", fmt.Errorf("%w: %v", ErrCommandFailed, err)
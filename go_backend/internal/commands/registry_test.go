@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCommandFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".md"), []byte(content), 0o644))
+}
+
+func newTestRegistry() *Registry {
+	r := NewRegistry()
+	r.commands["help"] = &BuiltinCommand{name: "help", description: "Show help"}
+	return r
+}
+
+func TestRegistry_Aliases(t *testing.T) {
+	dir := t.TempDir()
+	writeCommandFile(t, dir, "review", "---\ndescription: Review code\naliases: [rv, cr]\n---\nReview $ARGUMENTS")
+
+	r := newTestRegistry()
+	require.NoError(t, r.loadCommandsFromDir(dir, "project"))
+
+	cmd, ok := r.GetCommand("rv")
+	require.True(t, ok)
+	assert.Equal(t, "review", cmd.Name())
+
+	result, err := r.ExecuteCommand(context.Background(), "cr", "main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "Review main.go", result)
+
+	assert.Equal(t, []string{"cr", "rv"}, r.GetAliases("review"))
+	assert.NotContains(t, r.GetAllCommands(), "rv")
+
+	_, ok = r.GetCommand("unknown")
+	assert.False(t, ok)
+}
+
+func TestRegistry_AliasBuiltinCollision(t *testing.T) {
+	dir := t.TempDir()
+	writeCommandFile(t, dir, "assist", "---\naliases: [help]\n---\nAssist")
+
+	r := newTestRegistry()
+	err := r.loadCommandsFromDir(dir, "project")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `alias "help"`)
+
+	cmd, ok := r.GetCommand("help")
+	require.True(t, ok)
+	assert.IsType(t, &BuiltinCommand{}, cmd)
+}
+
+func TestRegistry_DestructiveCommandConfirmation(t *testing.T) {
+	var ran []string
+	r := newTestRegistry()
+	r.commands["clear"] = &BuiltinCommand{
+		name: "clear",
+		handler: func(ctx context.Context, args string) (string, error) {
+			ran = append(ran, args)
+			return "cleared", nil
+		},
+		destructive: func(args string) bool { return args == "--hard" },
+	}
+
+	_, err := r.ExecuteCommand(context.Background(), "clear", "--hard")
+	require.ErrorIs(t, err, ErrConfirmationRequired)
+	assert.Contains(t, err.Error(), "/clear --hard")
+	assert.Empty(t, ran, "an unconfirmed destructive command does not run")
+
+	result, err := r.ExecuteCommand(context.Background(), "clear", "")
+	require.NoError(t, err, "the command is only destructive with --hard")
+	assert.Equal(t, "cleared", result)
+
+	result, err = r.ExecuteCommand(WithConfirmation(context.Background()), "clear", "--hard")
+	require.NoError(t, err)
+	assert.Equal(t, "cleared", result)
+	assert.Equal(t, []string{"", "--hard"}, ran)
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"mix/internal/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewindCommand(t *testing.T) {
+	ctx := context.Background()
+	testApp := newTestApp(t)
+	handler := createRewindHandler(testApp)
+
+	sess, err := testApp.Sessions.Create(ctx, "rewind session")
+	require.NoError(t, err)
+	require.NoError(t, testApp.SetCurrentSession(sess.ID))
+	create := func(role message.MessageRole, text string) message.Message {
+		msg, err := testApp.Messages.Create(ctx, sess.ID, message.CreateMessageParams{
+			Role:  role,
+			Parts: []message.ContentPart{message.TextContent{Text: text}},
+		})
+		require.NoError(t, err)
+		return msg
+	}
+	remaining := func() []string {
+		messages, err := testApp.Messages.List(ctx, sess.ID)
+		require.NoError(t, err)
+		var texts []string
+		for _, msg := range messages {
+			texts = append(texts, msg.Content().Text)
+		}
+		return texts
+	}
+
+	create(message.User, "first question")
+	summary := create(message.Assistant, "summary of the first turn")
+	create(message.User, "second question")
+	create(message.Assistant, "second answer")
+	create(message.User, "third question")
+	create(message.Assistant, "calling a tool")
+	create(message.Tool, "tool result")
+	create(message.Assistant, "third answer")
+	create(message.User, "fourth question")
+	create(message.Assistant, "fourth answer")
+
+	t.Run("invalid count", func(t *testing.T) {
+		output, err := handler(ctx, "zero")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Usage: /rewind [N]")
+	})
+
+	t.Run("last turn by default", func(t *testing.T) {
+		output, err := handler(ctx, "")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Rewound 1 turn(s), deleted 2 messages")
+		assert.Equal(t, []string{
+			"first question", "summary of the first turn",
+			"second question", "second answer",
+			"third question", "calling a tool", "tool result", "third answer",
+		}, remaining())
+	})
+
+	t.Run("stops at the summary", func(t *testing.T) {
+		sess.SummaryMessageID = summary.ID
+		_, err := testApp.Sessions.Save(ctx, sess)
+		require.NoError(t, err)
+
+		output, err := handler(ctx, "3")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Can only rewind 2 turn(s)")
+		assert.Len(t, remaining(), 8)
+	})
+
+	t.Run("several turns", func(t *testing.T) {
+		output, err := handler(ctx, "2")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Rewound 2 turn(s), deleted 6 messages")
+		assert.Equal(t, []string{"first question", "summary of the first turn"}, remaining())
+
+		output, err = handler(ctx, "")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Nothing to rewind")
+	})
+}
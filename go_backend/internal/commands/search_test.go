@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"mix/internal/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchCommand(t *testing.T) {
+	ctx := context.Background()
+	testApp := newTestApp(t)
+	handler := createSearchHandler(testApp)
+
+	output, err := handler(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, output, "Usage: /search")
+
+	output, err = handler(ctx, "color")
+	require.NoError(t, err)
+	assert.Contains(t, output, "No active session")
+
+	sess, err := testApp.Sessions.Create(ctx, "search session")
+	require.NoError(t, err)
+	require.NoError(t, testApp.SetCurrentSession(sess.ID))
+
+	var ids []string
+	for _, params := range []message.CreateMessageParams{
+		{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: "Make the background color warmer"}}},
+		{Role: message.Assistant, Parts: []message.ContentPart{message.TextContent{Text: "I'll adjust the Color balance.\nThe color temperature is now 6500K."}}},
+		{Role: message.Tool, Parts: []message.ContentPart{message.ToolResult{ToolCallID: "call-1", Content: "layer: Background (color fill)"}}},
+		{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: "Thanks, now crop it"}}},
+	} {
+		msg, err := testApp.Messages.Create(ctx, sess.ID, params)
+		require.NoError(t, err)
+		ids = append(ids, msg.ID)
+	}
+
+	search := func(query string) SearchResponse {
+		t.Helper()
+		output, err := handler(ctx, query)
+		require.NoError(t, err)
+		var response SearchResponse
+		require.NoError(t, json.Unmarshal([]byte(output), &response))
+		return response
+	}
+
+	response := search("  COLOR ")
+	assert.Equal(t, "search", response.Type)
+	assert.Equal(t, sess.ID, response.SessionID)
+	assert.Equal(t, "COLOR", response.Query)
+	assert.Equal(t, 4, response.Total)
+	assert.Equal(t, []SearchMatch{
+		{MessageID: ids[0], Index: 0, Role: "user", Offset: 20, Snippet: "Make the background color warmer"},
+		{MessageID: ids[1], Index: 1, Role: "assistant", Offset: 16, Snippet: "I'll adjust the Color balance. The color temperature is now 6..."},
+		{MessageID: ids[1], Index: 1, Role: "assistant", Offset: 35, Snippet: "I'll adjust the Color balance. The color temperature is now 6500K."},
+		{MessageID: ids[2], Index: 2, Role: "tool", Offset: 19, Snippet: "layer: Background (color fill)"},
+	}, response.Matches)
+
+	assert.Empty(t, search("sepia").Matches)
+
+	// Long messages are shortened around the match
+	long := strings.Repeat("a", 100) + " needle " + strings.Repeat("b", 100)
+	_, err = testApp.Messages.Create(ctx, sess.ID, message.CreateMessageParams{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: long}}})
+	require.NoError(t, err)
+	response = search("needle")
+	require.Len(t, response.Matches, 1)
+	assert.Equal(t, "..."+strings.Repeat("a", 39)+" needle "+strings.Repeat("b", 39)+"...", response.Matches[0].Snippet)
+}
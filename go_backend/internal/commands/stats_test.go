@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"mix/internal/llm/agent"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statsAgent reports fixed stats for one session
+type statsAgent struct {
+	agent.Service
+	sessionID string
+	stats     agent.TurnStats
+}
+
+func (a *statsAgent) LastTurnStats(sessionID string) (agent.TurnStats, bool) {
+	return a.stats, sessionID == a.sessionID
+}
+
+func TestStatsCommand(t *testing.T) {
+	ctx := context.Background()
+	coder := &statsAgent{}
+	testApp := newTestApp(t)
+	testApp.CoderAgent = coder
+	handler := createStatsHandler(testApp)
+
+	output, err := handler(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, output, "No active session")
+
+	sess, err := testApp.Sessions.Create(ctx, "stats session")
+	require.NoError(t, err)
+	require.NoError(t, testApp.SetCurrentSession(sess.ID))
+
+	output, err = handler(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, output, "No turn has completed")
+
+	coder.sessionID = sess.ID
+	coder.stats = agent.TurnStats{
+		Latency:          4750 * time.Millisecond,
+		TimeToFirstToken: 400 * time.Millisecond,
+		GenerationTime:   2 * time.Second,
+		OutputTokens:     200,
+		TokensPerSecond:  100,
+		Requests:         2,
+	}
+	output, err = handler(ctx, "")
+	require.NoError(t, err)
+
+	var response StatsResponse
+	require.NoError(t, json.Unmarshal([]byte(output), &response))
+	assert.Equal(t, StatsResponse{
+		Type:               "stats",
+		SessionID:          sess.ID,
+		LatencyMs:          4750,
+		TimeToFirstTokenMs: 400,
+		GenerationMs:       2000,
+		OutputTokens:       200,
+		TokensPerSecond:    100,
+		Requests:           2,
+	}, response)
+}
@@ -3,12 +3,15 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"mix/internal/llm/models"
 	"mix/internal/logging"
@@ -45,16 +48,49 @@ const (
 )
 
 // Agent defines configuration for different LLM models and their token limits.
+// MaxContinuations enables auto-continue: when a response is cut off by the token
+// limit the agent asks the model to continue, up to this many times (0 disables it).
 type Agent struct {
-	Model           models.ModelID `json:"model"`
-	MaxTokens       int64          `json:"maxTokens"`
-	ReasoningEffort string         `json:"reasoningEffort"` // For openai models low,medium,heigh
+	Model            models.ModelID `json:"model"`
+	MaxTokens        int64          `json:"maxTokens"`
+	ReasoningEffort  string         `json:"reasoningEffort"` // For openai models low,medium,heigh
+	MaxContinuations int            `json:"maxContinuations,omitempty"`
+	// HistoryWindow sends only the last HistoryWindow turns of a session, after the
+	// summary if there is one. Zero sends the whole history.
+	HistoryWindow int `json:"historyWindow,omitempty"`
+	// RetryBudget caps the rate-limit retries of all the provider calls made while
+	// answering one message, so a turn with many tool calls can't retry each call in
+	// full. Zero uses the default budget and -1 removes the cap.
+	RetryBudget int `json:"retryBudget,omitempty"`
 }
 
 // Provider defines configuration for an LLM provider.
+// Endpoint, APIVersion and Deployments are used by Azure OpenAI, where Deployments
+// maps a model ID to the deployment serving it.
 type Provider struct {
-	APIKey   string `json:"apiKey"`
-	Disabled bool   `json:"disabled"`
+	APIKey      string                    `json:"apiKey"`
+	Disabled    bool                      `json:"disabled"`
+	Endpoint    string                    `json:"endpoint,omitempty"`
+	APIVersion  string                    `json:"apiVersion,omitempty"`
+	Deployments map[models.ModelID]string `json:"deployments,omitempty"`
+	// Project and Location select Vertex AI for Gemini models
+	Project  string `json:"project,omitempty"`
+	Location string `json:"location,omitempty"`
+	// Headers are sent with every request to the provider, e.g. for an auth proxy or gateway
+	Headers map[string]string `json:"headers,omitempty"`
+	// EmptyResponseRetries is how many times Gemini models retry an empty response
+	// before reporting an error. Unset uses the provider default of one retry.
+	EmptyResponseRetries *int `json:"emptyResponseRetries,omitempty"`
+}
+
+// PermissionConfig defines which tools are auto-approved without prompting.
+// Tools not listed in AllowedTools always go through the permission prompt.
+// AutoApproveWeb approves the read-only web tools such as fetch, which still refuse
+// hosts in DeniedDomains (or their subdomains) whether or not they are approved.
+type PermissionConfig struct {
+	AllowedTools   []string `json:"allowedTools,omitempty"`
+	AutoApproveWeb bool     `json:"autoApproveWeb,omitempty"`
+	DeniedDomains  []string `json:"deniedDomains,omitempty"`
 }
 
 // Data defines storage configuration.
@@ -65,9 +101,96 @@ type Data struct {
 // Removed LSP configs for embedded binary
 
 // ShellConfig defines the configuration for the shell used by the bash tool.
+// OutputHeadLines and OutputTailLines control how many lines of command output are
+// kept from the start and end when the output is truncated. DeniedCommands blocks
+// commands matching any of its patterns, such as "sudo" or "rm -rf", and when
+// AllowedCommands is set every command the bash tool runs must match one of its patterns.
 type ShellConfig struct {
-	Path string   `json:"path,omitempty"`
-	Args []string `json:"args,omitempty"`
+	Path            string   `json:"path,omitempty"`
+	Args            []string `json:"args,omitempty"`
+	OutputHeadLines int      `json:"outputHeadLines,omitempty"`
+	OutputTailLines int      `json:"outputTailLines,omitempty"`
+	AllowedCommands []string `json:"allowedCommands,omitempty"`
+	DeniedCommands  []string `json:"deniedCommands,omitempty"`
+}
+
+// SessionCleanupConfig controls the opt-in background deletion of idle sessions.
+// Sessions not updated for MaxAgeHours that hold at most MaxMessages messages are
+// deleted at startup and then every IntervalMinutes.
+type SessionCleanupConfig struct {
+	Enabled         bool  `json:"enabled,omitempty"`
+	MaxAgeHours     int   `json:"maxAgeHours,omitempty"`
+	MaxMessages     int64 `json:"maxMessages,omitempty"`
+	IntervalMinutes int   `json:"intervalMinutes,omitempty"`
+}
+
+// AuditLogConfig controls the opt-in JSONL log of every LLM request and response.
+// Path defaults to llm-audit.jsonl in the data directory; the file is rotated once it
+// reaches MaxSizeMB, keeping MaxFiles rotated files.
+type AuditLogConfig struct {
+	Enabled   bool   `json:"enabled,omitempty"`
+	Path      string `json:"path,omitempty"`
+	MaxSizeMB int    `json:"maxSizeMB,omitempty"`
+	MaxFiles  int    `json:"maxFiles,omitempty"`
+}
+
+// MessageRetryConfig controls the opt-in retry of HTTP-queued messages whose agent run
+// fails with a transient error such as a rate limit or dropped connection. A failed
+// message is retried up to MaxRetries times, waiting InitialDelayMs before the first
+// retry and doubling the wait after each one.
+type MessageRetryConfig struct {
+	MaxRetries     int `json:"maxRetries,omitempty"`
+	InitialDelayMs int `json:"initialDelayMs,omitempty"`
+}
+
+// MessageLimitConfig caps the length of a user message, in characters, before it is sent
+// to the model. A longer message is rejected, or cut to MaxLength when Policy is
+// "truncate". A MaxLength of zero removes the cap.
+type MessageLimitConfig struct {
+	MaxLength int    `json:"maxLength,omitempty"`
+	Policy    string `json:"policy,omitempty"`
+}
+
+// Message limit policies
+const (
+	MessageLimitReject   = "reject"
+	MessageLimitTruncate = "truncate"
+)
+
+// RunWatchdogConfig controls how long an agent run streamed over HTTP may go without
+// sending an event before it is cancelled and the client gets an error. StallTimeoutMs
+// applies while the model is answering and ToolTimeoutMs while tools run, since a tool
+// such as a long build can run for a while without reporting progress. Zero disables
+// the check.
+type RunWatchdogConfig struct {
+	StallTimeoutMs int `json:"stallTimeoutMs,omitempty"`
+	ToolTimeoutMs  int `json:"toolTimeoutMs,omitempty"`
+}
+
+// RedactionConfig controls the masking of secrets, such as API keys and bearer
+// tokens, in tool results before they are stored and sent to the model. Results of the
+// bash, fetch and python_execution tools are checked unless Tools lists others. Patterns
+// are regular expressions masked on top of the built-in formats; when a pattern has a
+// capture group only the group is masked, so `token=(\S+)` keeps the name.
+type RedactionConfig struct {
+	Disabled bool     `json:"disabled,omitempty"`
+	Tools    []string `json:"tools,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// FileHistoryConfig limits the versions of a file kept in a session's history to the
+// latest MaxVersions and the first, which holds the file as it was before the session
+// changed it. Older versions are deleted as new ones are created. Zero keeps them all.
+type FileHistoryConfig struct {
+	MaxVersions int `json:"maxVersions,omitempty"`
+}
+
+// FileWatcherConfig controls the opt-in watching of files the agent has read. A file
+// changed on disk by something else must be viewed again before it can be edited; with
+// NotifyClients set, streaming clients of the session also get a status event.
+type FileWatcherConfig struct {
+	Enabled       bool `json:"enabled,omitempty"`
+	NotifyClients bool `json:"notifyClients,omitempty"`
 }
 
 // Config is the simplified configuration structure for embedded binary.
@@ -75,11 +198,35 @@ type Config struct {
 	Data            Data                              `json:"data"`
 	WorkingDir      string                            `json:"wd,omitempty"`
 	MCPServers      map[string]MCPServer              `json:"mcpServers,omitempty"`
+	DisableMCP      bool                              `json:"disableMcp,omitempty"`
 	Providers       map[models.ModelProvider]Provider `json:"providers,omitempty"`
 	Agents          map[AgentName]Agent               `json:"agents,omitempty"`
 	Debug           bool                              `json:"debug,omitempty"`
 	Shell           ShellConfig                       `json:"shell,omitempty"`
 	SkipPermissions bool                              `json:"skipPermissions,omitempty"`
+	Permissions     PermissionConfig                  `json:"permissions,omitempty"`
+	SessionCleanup  SessionCleanupConfig              `json:"sessionCleanup,omitempty"`
+	AuditLog        AuditLogConfig                    `json:"auditLog,omitempty"`
+	MessageRetry    MessageRetryConfig                `json:"messageRetry,omitempty"`
+	MessageLimit    MessageLimitConfig                `json:"messageLimit,omitempty"`
+	FileWatcher     FileWatcherConfig                 `json:"fileWatcher,omitempty"`
+	FileHistory     FileHistoryConfig                 `json:"fileHistory,omitempty"`
+	RunWatchdog     RunWatchdogConfig                 `json:"runWatchdog,omitempty"`
+	Redaction       RedactionConfig                   `json:"redaction,omitempty"`
+	// TitleLanguage is the language generated session titles are written in, such as
+	// "German"; empty leaves it to the model
+	TitleLanguage string `json:"titleLanguage,omitempty"`
+	// SessionTitleFormat is the title of sessions created without one, until a title is
+	// generated from the first message. {{date}}, {{time}} and {{dir}} are replaced with
+	// the creation date, the time and the working directory's name.
+	SessionTitleFormat string `json:"sessionTitleFormat,omitempty"`
+	// Editors maps file extensions, without the dot, to the application open_in_editor
+	// opens them in, adding to the built-in routes or replacing them
+	Editors map[string]string `json:"editors,omitempty"`
+	// CacheBackgroundRequests lets title generation and summarization use prompt caching.
+	// They are one-off requests, so by default they don't pay to write cache entries that
+	// won't be read again.
+	CacheBackgroundRequests bool `json:"cacheBackgroundRequests,omitempty"`
 }
 
 // Application constants
@@ -89,16 +236,103 @@ const (
 	appName              = "mix"
 
 	MaxTokensFallbackDefault = 4096
+
+	defaultSessionMaxAgeHours    = 30 * 24
+	defaultSessionCleanupMinutes = 60
+
+	defaultAuditLogMaxSizeMB = 10
+	defaultAuditLogMaxFiles  = 3
+
+	defaultMessageRetryDelayMs = 2000
+
+	defaultMessageMaxLength = 200000
+
+	defaultFileHistoryMaxVersions = 50
+
+	defaultRunStallTimeoutMs = 5 * 60 * 1000
+	defaultRunToolTimeoutMs  = 30 * 60 * 1000
+
+	defaultSessionTitleFormat = "New Session"
 )
 
 // Removed default context paths for embedded binary
 
+// ErrNotLoaded is returned by operations that need the configuration set up by Load.
+var ErrNotLoaded = errors.New("config not loaded")
+
 // Global configuration instance
 var cfg *Config
 
+// defaultConfig is what Get returns before Load is called, so library users and
+// tests get usable values instead of a nil pointer. It is never written to disk.
+var defaultConfig = sync.OnceValue(func() *Config {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		workingDir = "."
+	}
+	return &Config{
+		Data:       Data{Directory: defaultDataDirectory},
+		WorkingDir: workingDir,
+		MCPServers: make(map[string]MCPServer),
+		Providers:  make(map[models.ModelProvider]Provider),
+		Agents:     make(map[AgentName]Agent),
+		Shell: ShellConfig{
+			Path:            defaultShellPath(),
+			Args:            []string{"-l"},
+			OutputHeadLines: 100,
+			OutputTailLines: 100,
+		},
+		SessionCleanup: SessionCleanupConfig{
+			MaxAgeHours:     defaultSessionMaxAgeHours,
+			IntervalMinutes: defaultSessionCleanupMinutes,
+		},
+		AuditLog: AuditLogConfig{
+			MaxSizeMB: defaultAuditLogMaxSizeMB,
+			MaxFiles:  defaultAuditLogMaxFiles,
+		},
+		MessageRetry: MessageRetryConfig{
+			InitialDelayMs: defaultMessageRetryDelayMs,
+		},
+		MessageLimit: MessageLimitConfig{
+			MaxLength: defaultMessageMaxLength,
+			Policy:    MessageLimitReject,
+		},
+		FileHistory: FileHistoryConfig{
+			MaxVersions: defaultFileHistoryMaxVersions,
+		},
+		RunWatchdog: RunWatchdogConfig{
+			StallTimeoutMs: defaultRunStallTimeoutMs,
+			ToolTimeoutMs:  defaultRunToolTimeoutMs,
+		},
+		SessionTitleFormat: defaultSessionTitleFormat,
+	}
+})
+
 // Mutex to protect concurrent access to cfg
 var cfgMutex sync.RWMutex
 
+// configFile is an explicit config file that replaces the search for .mix.json
+var configFile string
+
+// SetConfigFile makes Load read the given file instead of searching the home and
+// working directories for .mix.json. It returns an error if the file does not exist.
+func SetConfigFile(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("invalid config file path %s: %w", path, err)
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return fmt.Errorf("config file not found: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("config file %s is a directory", absPath)
+	}
+
+	configFile = absPath
+	return nil
+}
+
 // Load initializes the configuration from environment variables and config files.
 // If debug is true, debug mode is enabled and log level is set to debug.
 // If skipPermissions is true, all permission prompts will be bypassed.
@@ -123,8 +357,10 @@ func Load(workingDir string, debug bool, skipPermissions bool) (*Config, error)
 		return cfg, err
 	}
 
-	// Load and merge local config
-	mergeLocalConfig(workingDir)
+	// Load and merge local config, unless an explicit config file was given
+	if configFile == "" {
+		mergeLocalConfig(workingDir)
+	}
 
 	setProviderDefaults()
 
@@ -216,11 +452,15 @@ func Load(workingDir string, debug bool, skipPermissions bool) (*Config, error)
 
 // configureViper sets up viper's configuration paths and environment variables.
 func configureViper() {
-	viper.SetConfigName(fmt.Sprintf(".%s", appName))
 	viper.SetConfigType("json")
-	viper.AddConfigPath("$HOME")
-	viper.AddConfigPath(fmt.Sprintf("$XDG_CONFIG_HOME/%s", appName))
-	viper.AddConfigPath(fmt.Sprintf("$HOME/.config/%s", appName))
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		viper.SetConfigName(fmt.Sprintf(".%s", appName))
+		viper.AddConfigPath("$HOME")
+		viper.AddConfigPath(fmt.Sprintf("$XDG_CONFIG_HOME/%s", appName))
+		viper.AddConfigPath(fmt.Sprintf("$HOME/.config/%s", appName))
+	}
 	viper.SetEnvPrefix(strings.ToUpper(appName))
 	viper.AutomaticEnv()
 }
@@ -229,13 +469,28 @@ func configureViper() {
 func setDefaults(debug bool) {
 	viper.SetDefault("data.directory", defaultDataDirectory)
 
-	// Set default shell from environment or fallback to /bin/bash
-	shellPath := os.Getenv("SHELL")
-	if shellPath == "" {
-		shellPath = "/bin/bash"
-	}
-	viper.SetDefault("shell.path", shellPath)
+	viper.SetDefault("shell.path", defaultShellPath())
 	viper.SetDefault("shell.args", []string{"-l"})
+	viper.SetDefault("shell.outputHeadLines", 100)
+	viper.SetDefault("shell.outputTailLines", 100)
+
+	viper.SetDefault("sessionCleanup.maxAgeHours", defaultSessionMaxAgeHours)
+	viper.SetDefault("sessionCleanup.intervalMinutes", defaultSessionCleanupMinutes)
+
+	viper.SetDefault("auditLog.maxSizeMB", defaultAuditLogMaxSizeMB)
+	viper.SetDefault("auditLog.maxFiles", defaultAuditLogMaxFiles)
+
+	viper.SetDefault("messageRetry.initialDelayMs", defaultMessageRetryDelayMs)
+
+	viper.SetDefault("messageLimit.maxLength", defaultMessageMaxLength)
+	viper.SetDefault("messageLimit.policy", MessageLimitReject)
+
+	viper.SetDefault("fileHistory.maxVersions", defaultFileHistoryMaxVersions)
+
+	viper.SetDefault("runWatchdog.stallTimeoutMs", defaultRunStallTimeoutMs)
+	viper.SetDefault("runWatchdog.toolTimeoutMs", defaultRunToolTimeoutMs)
+
+	viper.SetDefault("sessionTitleFormat", defaultSessionTitleFormat)
 
 	if debug {
 		viper.SetDefault("debug", true)
@@ -246,6 +501,14 @@ func setDefaults(debug bool) {
 	}
 }
 
+// defaultShellPath returns the shell from the environment, falling back to /bin/bash.
+func defaultShellPath() string {
+	if shellPath := os.Getenv("SHELL"); shellPath != "" {
+		return shellPath
+	}
+	return "/bin/bash"
+}
+
 // setProviderDefaults configures LLM provider defaults for embedded binary.
 func setProviderDefaults() {
 
@@ -283,15 +546,21 @@ func hasAWSCredentials() bool {
 
 // hasVertexAICredentials checks if VertexAI credentials are available in the environment.
 func hasVertexAICredentials() bool {
-	// Check for explicit VertexAI parameters
+	project, location := VertexAIProjectAndLocation()
+	return project != "" && location != ""
+}
+
+// VertexAIProjectAndLocation returns the Google Cloud project and location for Vertex AI
+// from the environment, preferring the VERTEXAI_ variables over the GOOGLE_CLOUD_ ones.
+func VertexAIProjectAndLocation() (project, location string) {
 	if os.Getenv("VERTEXAI_PROJECT") != "" && os.Getenv("VERTEXAI_LOCATION") != "" {
-		return true
+		return os.Getenv("VERTEXAI_PROJECT"), os.Getenv("VERTEXAI_LOCATION")
 	}
-	// Check for Google Cloud project and location
-	if os.Getenv("GOOGLE_CLOUD_PROJECT") != "" && (os.Getenv("GOOGLE_CLOUD_REGION") != "" || os.Getenv("GOOGLE_CLOUD_LOCATION") != "") {
-		return true
+	location = os.Getenv("GOOGLE_CLOUD_REGION")
+	if location == "" {
+		location = os.Getenv("GOOGLE_CLOUD_LOCATION")
 	}
-	return false
+	return os.Getenv("GOOGLE_CLOUD_PROJECT"), location
 }
 
 // readConfig handles the result of reading a configuration file.
@@ -344,7 +613,15 @@ func validateAgent(cfg *Config, name AgentName, agent Agent) error {
 	provider := model.Provider
 	providerCfg, providerExists := cfg.Providers[provider]
 
-	if !providerExists {
+	if !providerExists && provider == models.ProviderGemini && getProviderAPIKey(provider) == "" && hasVertexAICredentials() {
+		// Without a Gemini API key, Gemini models run on Vertex AI with Google Cloud credentials
+		project, location := VertexAIProjectAndLocation()
+		cfg.Providers[provider] = Provider{
+			Project:  project,
+			Location: location,
+		}
+		logging.Info("added provider using Vertex AI credentials from environment", "provider", provider)
+	} else if !providerExists {
 		// Provider not configured, check if we have environment variables
 		apiKey := getProviderAPIKey(provider)
 		if apiKey == "" && provider != "anthropic" {
@@ -361,7 +638,7 @@ func validateAgent(cfg *Config, name AgentName, agent Agent) error {
 		}
 	} else if providerCfg.Disabled {
 		return fmt.Errorf("provider %s is disabled for agent %s (model %s)", provider, name, agent.Model)
-	} else if providerCfg.APIKey == "" && provider != "anthropic" {
+	} else if providerCfg.APIKey == "" && provider != "anthropic" && !(provider == models.ProviderGemini && providerCfg.Project != "") {
 		return fmt.Errorf("provider %s has no API key configured for agent %s (model %s)", provider, name, agent.Model)
 	}
 
@@ -461,25 +738,32 @@ func validateAgent(cfg *Config, name AgentName, agent Agent) error {
 
 // Validate checks if the configuration is valid and applies defaults where needed.
 func Validate() error {
-	if cfg == nil {
-		return fmt.Errorf("config not loaded")
+	current, err := Current()
+	if err != nil {
+		return err
 	}
 
 	// Validate agent models
-	for name, agent := range cfg.Agents {
-		if err := validateAgent(cfg, name, agent); err != nil {
+	for name, agent := range current.Agents {
+		if err := validateAgent(current, name, agent); err != nil {
 			return err
 		}
 	}
 
 	// Validate providers
-	for provider, providerCfg := range cfg.Providers {
+	for provider, providerCfg := range current.Providers {
 		// Skip API key validation for Anthropic (supports OAuth authentication)
 		if providerCfg.APIKey == "" && !providerCfg.Disabled && provider != "anthropic" {
 			fmt.Printf("provider has no API key, marking as disabled %s", provider)
 			logging.Warn("provider has no API key, marking as disabled", "provider", provider)
 			providerCfg.Disabled = true
-			cfg.Providers[provider] = providerCfg
+			current.Providers[provider] = providerCfg
+		}
+	}
+
+	for _, pattern := range current.Redaction.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
 		}
 	}
 
@@ -516,8 +800,8 @@ func getProviderAPIKey(provider models.ModelProvider) string {
 }
 
 func updateCfgFile(updateCfg func(config *Config)) error {
-	if cfg == nil {
-		return fmt.Errorf("config not loaded")
+	if _, err := Current(); err != nil {
+		return err
 	}
 
 	// Get the config file path
@@ -562,26 +846,99 @@ func updateCfgFile(updateCfg func(config *Config)) error {
 }
 
 // Get returns the current configuration.
-// It's safe to call this function multiple times.
+// It's safe to call this function multiple times. Before Load is called it returns
+// a default configuration rooted at the process working directory.
 func Get() *Config {
+	if cfg == nil {
+		return defaultConfig()
+	}
 	return cfg
 }
 
-// WorkingDirectory returns the current working directory from the configuration.
-func WorkingDirectory() string {
+// Current returns the configuration set up by Load, or ErrNotLoaded if Load
+// hasn't been called.
+func Current() (*Config, error) {
 	if cfg == nil {
-		panic("config not loaded")
+		return nil, ErrNotLoaded
+	}
+	return cfg, nil
+}
+
+// redactedValue replaces secrets in a redacted configuration
+const redactedValue = "[redacted]"
+
+// Redacted returns a copy of the configuration with provider API keys and headers and
+// MCP server environment values and headers replaced, so it can be shown to the user.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+
+	redacted.Providers = make(map[models.ModelProvider]Provider, len(c.Providers))
+	for name, provider := range c.Providers {
+		if provider.APIKey != "" {
+			provider.APIKey = redactedValue
+		}
+		provider.Headers = redactHeaders(provider.Headers)
+		redacted.Providers[name] = provider
+	}
+
+	redacted.MCPServers = make(map[string]MCPServer, len(c.MCPServers))
+	for name, server := range c.MCPServers {
+		if server.Env != nil {
+			env := make([]string, len(server.Env))
+			for i, variable := range server.Env {
+				key, _, _ := strings.Cut(variable, "=")
+				env[i] = key + "=" + redactedValue
+			}
+			server.Env = env
+		}
+		server.Headers = redactHeaders(server.Headers)
+		redacted.MCPServers[name] = server
+	}
+	return &redacted
+}
+
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(headers))
+	for key := range headers {
+		redacted[key] = redactedValue
+	}
+	return redacted
+}
+
+// DefaultSessionTitle returns the title of a session created at now without one,
+// following SessionTitleFormat
+func (c *Config) DefaultSessionTitle(now time.Time) string {
+	format := strings.TrimSpace(c.SessionTitleFormat)
+	if format == "" {
+		format = defaultSessionTitleFormat
+	}
+	dir := ""
+	if c.WorkingDir != "" {
+		dir = filepath.Base(c.WorkingDir)
 	}
-	return cfg.WorkingDir
+	return strings.NewReplacer(
+		"{{date}}", now.Format("2006-01-02"),
+		"{{time}}", now.Format("15:04"),
+		"{{dir}}", dir,
+	).Replace(format)
+}
+
+// WorkingDirectory returns the current working directory from the configuration.
+func WorkingDirectory() string {
+	return Get().WorkingDir
 }
 
 func UpdateAgentModel(agentName AgentName, modelID models.ModelID) error {
-	if cfg == nil {
-		panic("config not loaded")
+	current, err := Current()
+	if err != nil {
+		return err
 	}
 
 	cfgMutex.RLock()
-	existingAgentCfg := cfg.Agents[agentName]
+	existingAgentCfg := current.Agents[agentName]
 	cfgMutex.RUnlock()
 
 	model, ok := models.SupportedModels[modelID]
@@ -594,19 +951,17 @@ func UpdateAgentModel(agentName AgentName, modelID models.ModelID) error {
 		maxTokens = model.DefaultMaxTokens
 	}
 
-	newAgentCfg := Agent{
-		Model:           modelID,
-		MaxTokens:       maxTokens,
-		ReasoningEffort: existingAgentCfg.ReasoningEffort,
-	}
+	newAgentCfg := existingAgentCfg
+	newAgentCfg.Model = modelID
+	newAgentCfg.MaxTokens = maxTokens
 	cfgMutex.Lock()
-	cfg.Agents[agentName] = newAgentCfg
+	current.Agents[agentName] = newAgentCfg
 	cfgMutex.Unlock()
 
-	if err := validateAgent(cfg, agentName, newAgentCfg); err != nil {
+	if err := validateAgent(current, agentName, newAgentCfg); err != nil {
 		// revert config update on failure
 		cfgMutex.Lock()
-		cfg.Agents[agentName] = existingAgentCfg
+		current.Agents[agentName] = existingAgentCfg
 		cfgMutex.Unlock()
 		return fmt.Errorf("failed to update agent model: %w", err)
 	}
@@ -619,6 +974,109 @@ func UpdateAgentModel(agentName AgentName, modelID models.ModelID) error {
 	})
 }
 
+// UpdateAgentReasoningEffort sets an agent's reasoning effort (low, medium or high)
+// and persists it to the config file. The effort only applies to reasoning models
+// served through the OpenAI API (OpenAI, Azure OpenAI and local models).
+func UpdateAgentReasoningEffort(agentName AgentName, effort string) error {
+	current, err := Current()
+	if err != nil {
+		return err
+	}
+
+	effort = strings.ToLower(strings.TrimSpace(effort))
+	if effort != "low" && effort != "medium" && effort != "high" {
+		return fmt.Errorf("invalid reasoning effort %q: must be low, medium or high", effort)
+	}
+
+	cfgMutex.Lock()
+	agentCfg, ok := current.Agents[agentName]
+	if !ok {
+		cfgMutex.Unlock()
+		return fmt.Errorf("agent %s not found", agentName)
+	}
+	model, ok := models.SupportedModels[agentCfg.Model]
+	usesEffort := model.Provider == models.ProviderOpenAI || model.Provider == models.ProviderAzure || model.Provider == models.ProviderLocal
+	if !ok || !model.CanReason || !usesEffort {
+		cfgMutex.Unlock()
+		return fmt.Errorf("model %s does not support reasoning effort", agentCfg.Model)
+	}
+	agentCfg.ReasoningEffort = effort
+	current.Agents[agentName] = agentCfg
+	cfgMutex.Unlock()
+
+	return updateCfgFile(func(config *Config) {
+		if config.Agents == nil {
+			config.Agents = make(map[AgentName]Agent)
+		}
+		existing := config.Agents[agentName]
+		existing.Model = agentCfg.Model
+		existing.ReasoningEffort = effort
+		config.Agents[agentName] = existing
+	})
+}
+
+// SetMCPServer adds or replaces an MCP server and persists it to the config file.
+// Servers without a type run over stdio.
+func SetMCPServer(name string, server MCPServer) error {
+	current, err := Current()
+	if err != nil {
+		return err
+	}
+
+	if name == "" || strings.ContainsAny(name, "_ ") {
+		return fmt.Errorf("invalid MCP server name %q: must be non-empty without spaces or underscores", name)
+	}
+	if server.Type == "" {
+		server.Type = MCPStdio
+	}
+	switch server.Type {
+	case MCPStdio:
+		if server.Command == "" {
+			return fmt.Errorf("MCP server %s needs a command", name)
+		}
+	case MCPSse:
+		if server.URL == "" {
+			return fmt.Errorf("MCP server %s needs a URL", name)
+		}
+	default:
+		return fmt.Errorf("invalid MCP server type %q: must be stdio or sse", server.Type)
+	}
+
+	cfgMutex.Lock()
+	if current.MCPServers == nil {
+		current.MCPServers = make(map[string]MCPServer)
+	}
+	current.MCPServers[name] = server
+	cfgMutex.Unlock()
+
+	return updateCfgFile(func(config *Config) {
+		if config.MCPServers == nil {
+			config.MCPServers = make(map[string]MCPServer)
+		}
+		config.MCPServers[name] = server
+	})
+}
+
+// RemoveMCPServer removes an MCP server and persists the change to the config file
+func RemoveMCPServer(name string) error {
+	current, err := Current()
+	if err != nil {
+		return err
+	}
+
+	cfgMutex.Lock()
+	_, ok := current.MCPServers[name]
+	delete(current.MCPServers, name)
+	cfgMutex.Unlock()
+	if !ok {
+		return fmt.Errorf("MCP server %s not found", name)
+	}
+
+	return updateCfgFile(func(config *Config) {
+		delete(config.MCPServers, name)
+	})
+}
+
 // Removed UpdateTheme function for embedded binary
 
 // Removed GitHub token loading for embedded binary
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mix/internal/llm/models"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These run before any Load in this test binary, so cfg is still nil
+func TestGet_BeforeLoad(t *testing.T) {
+	require.Nil(t, cfg)
+
+	c := Get()
+	require.NotNil(t, c)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, wd, c.WorkingDir)
+	assert.Equal(t, defaultDataDirectory, c.Data.Directory)
+	assert.NotEmpty(t, c.Shell.Path)
+	assert.Equal(t, 100, c.Shell.OutputHeadLines)
+	assert.NotNil(t, c.Providers)
+	assert.Empty(t, c.Agents)
+	assert.Same(t, c, Get())
+
+	assert.Equal(t, wd, WorkingDirectory())
+
+	_, err = Current()
+	assert.ErrorIs(t, err, ErrNotLoaded)
+	assert.ErrorIs(t, UpdateAgentModel(AgentMain, "claude-4-sonnet"), ErrNotLoaded)
+	assert.ErrorIs(t, Validate(), ErrNotLoaded)
+	assert.ErrorIs(t, UpdateAgentReasoningEffort(AgentMain, "high"), ErrNotLoaded)
+	assert.ErrorIs(t, SetMCPServer("files", MCPServer{Command: "mcp-files"}), ErrNotLoaded)
+	assert.ErrorIs(t, RemoveMCPServer("files"), ErrNotLoaded)
+	_, err = ShouldShowInitDialog()
+	assert.ErrorIs(t, err, ErrNotLoaded)
+	assert.ErrorIs(t, MarkProjectInitialized(), ErrNotLoaded)
+
+	// The default is never promoted to the loaded config
+	assert.Nil(t, cfg)
+}
+
+// The defaults returned before Load must match what Load fills in from setDefaults
+func TestDefaultConfig_MatchesLoad(t *testing.T) {
+	t.Cleanup(func() {
+		cfg = nil
+		viper.Reset()
+	})
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configJSON := `{"agents": {"main": {"model": "claude-4-sonnet"}, "sub": {"model": "claude-4-sonnet"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".mix.json"), []byte(configJSON), 0o644))
+
+	loaded, err := Load(t.TempDir(), false, false)
+	require.NoError(t, err)
+
+	defaults := defaultConfig()
+	assert.Equal(t, defaults.Data, loaded.Data)
+	assert.Equal(t, defaults.Shell, loaded.Shell)
+	assert.Equal(t, defaults.SessionCleanup, loaded.SessionCleanup)
+	assert.Equal(t, defaults.AuditLog, loaded.AuditLog)
+	assert.Equal(t, defaults.MessageRetry, loaded.MessageRetry)
+	assert.Equal(t, defaults.MessageLimit, loaded.MessageLimit)
+	assert.Equal(t, defaults.FileHistory, loaded.FileHistory)
+	assert.Equal(t, defaults.RunWatchdog, loaded.RunWatchdog)
+	assert.Equal(t, defaults.SessionTitleFormat, loaded.SessionTitleFormat)
+}
+
+func TestLoad_ConfigFile(t *testing.T) {
+	t.Cleanup(func() {
+		cfg = nil
+		configFile = ""
+		viper.Reset()
+	})
+
+	// A config in the searched locations that the explicit file must win over
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	homeJSON := `{"agents": {"main": {"model": "claude-4-sonnet"}, "sub": {"model": "claude-4-sonnet"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".mix.json"), []byte(homeJSON), 0o644))
+
+	assert.Error(t, SetConfigFile(filepath.Join(home, "missing.json")))
+	assert.Error(t, SetConfigFile(home))
+
+	profile := filepath.Join(t.TempDir(), "profiles", "ci.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(profile), 0o755))
+	profileJSON := `{"agents": {"main": {"model": "claude-3.5-haiku", "maxTokens": 1000}, "sub": {"model": "claude-3.5-haiku", "maxTokens": 1000}}, "debug": true}`
+	require.NoError(t, os.WriteFile(profile, []byte(profileJSON), 0o644))
+	require.NoError(t, SetConfigFile(profile))
+
+	loaded, err := Load(home, false, false)
+	require.NoError(t, err)
+	assert.Equal(t, models.ModelID("claude-3.5-haiku"), loaded.Agents[AgentMain].Model)
+	assert.True(t, loaded.Debug)
+	assert.Equal(t, profile, viper.ConfigFileUsed())
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	t.Cleanup(func() {
+		cfg = nil
+		viper.Reset()
+	})
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-secret")
+	t.Setenv("MIX_DEBUG", "true")
+	configJSON := `{
+		"agents": {"main": {"model": "claude-4-sonnet"}, "sub": {"model": "claude-4-sonnet"}},
+		"providers": {"openai": {"apiKey": "sk-openai-secret", "headers": {"X-Gateway-Key": "gateway-secret"}}},
+		"mcpServers": {"remote": {"type": "sse", "url": "https://mcp.example.com", "env": ["TOKEN=mcp-secret"], "headers": {"Authorization": "Bearer mcp-secret"}}}
+	}`
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".mix.json"), []byte(configJSON), 0o644))
+
+	loaded, err := Load(t.TempDir(), false, false)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(loaded.Redacted())
+	require.NoError(t, err)
+	var printed Config
+	require.NoError(t, json.Unmarshal(data, &printed))
+
+	// The environment override is reflected
+	assert.True(t, printed.Debug)
+	assert.Equal(t, models.ModelID("claude-4-sonnet"), printed.Agents[AgentMain].Model)
+
+	assert.NotContains(t, string(data), "secret")
+	assert.Equal(t, redactedValue, printed.Providers[models.ProviderAnthropic].APIKey)
+	assert.Equal(t, map[string]string{"x-gateway-key": redactedValue}, printed.Providers[models.ProviderOpenAI].Headers)
+	assert.Equal(t, []string{"TOKEN=" + redactedValue}, printed.MCPServers["remote"].Env)
+	// Viper lowercases map keys
+	assert.Equal(t, map[string]string{"authorization": redactedValue}, printed.MCPServers["remote"].Headers)
+
+	// The loaded config keeps its secrets
+	assert.Equal(t, "sk-ant-secret", loaded.Providers[models.ProviderAnthropic].APIKey)
+	assert.Equal(t, []string{"TOKEN=mcp-secret"}, loaded.MCPServers["remote"].Env)
+}
+
+func TestConfig_DefaultSessionTitle(t *testing.T) {
+	now := time.Date(2025, 3, 9, 14, 5, 0, 0, time.UTC)
+
+	assert.Equal(t, "New Session", (&Config{}).DefaultSessionTitle(now))
+
+	c := &Config{WorkingDir: "/home/me/projects/mix", SessionTitleFormat: "{{dir}} {{date}} {{time}}"}
+	assert.Equal(t, "mix 2025-03-09 14:05", c.DefaultSessionTitle(now))
+
+	c.SessionTitleFormat = "Chat about {{topic}}"
+	assert.Equal(t, "Chat about {{topic}}", c.DefaultSessionTitle(now), "unknown placeholders are kept")
+}
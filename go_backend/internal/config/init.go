@@ -18,15 +18,16 @@ type ProjectInitFlag struct {
 
 // ShouldShowInitDialog checks if the initialization dialog should be shown for the current directory
 func ShouldShowInitDialog() (bool, error) {
-	if cfg == nil {
-		return false, fmt.Errorf("config not loaded")
+	current, err := Current()
+	if err != nil {
+		return false, err
 	}
 
 	// Create the flag file path
-	flagFilePath := filepath.Join(cfg.Data.Directory, InitFlagFilename)
+	flagFilePath := filepath.Join(current.Data.Directory, InitFlagFilename)
 
 	// Check if the flag file exists
-	_, err := os.Stat(flagFilePath)
+	_, err = os.Stat(flagFilePath)
 	if err == nil {
 		// File exists, don't show the dialog
 		return false, nil
@@ -43,11 +44,12 @@ func ShouldShowInitDialog() (bool, error) {
 
 // MarkProjectInitialized marks the current project as initialized
 func MarkProjectInitialized() error {
-	if cfg == nil {
-		return fmt.Errorf("config not loaded")
+	current, err := Current()
+	if err != nil {
+		return err
 	}
 	// Create the flag file path
-	flagFilePath := filepath.Join(cfg.Data.Directory, InitFlagFilename)
+	flagFilePath := filepath.Join(current.Data.Directory, InitFlagFilename)
 
 	// Create an empty file to mark the project as initialized
 	file, err := os.Create(flagFilePath)
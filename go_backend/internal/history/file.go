@@ -4,11 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"mix/internal/config"
 	"mix/internal/db"
+	"mix/internal/logging"
 	"mix/internal/pubsub"
 
 	"github.com/google/uuid"
@@ -71,8 +74,14 @@ func (s *service) CreateVersion(ctx context.Context, sessionID, path, content st
 		return s.Create(ctx, sessionID, path, content)
 	}
 
-	// Get the latest version
-	latestFile := files[0] // Files are ordered by created_at DESC
+	// Get the latest version. Timestamps have second granularity, so the order of
+	// versions created in the same second comes from their numbers.
+	versions := make([]File, len(files))
+	for i, file := range files {
+		versions[i] = s.fromDBItem(file)
+	}
+	SortVersions(versions)
+	latestFile := versions[len(versions)-1]
 	latestVersion := latestFile.Version
 
 	// Generate the next version
@@ -92,7 +101,44 @@ func (s *service) CreateVersion(ctx context.Context, sessionID, path, content st
 		nextVersion = fmt.Sprintf("v%d", latestFile.CreatedAt)
 	}
 
-	return s.createWithVersion(ctx, sessionID, path, content, nextVersion)
+	file, err := s.createWithVersion(ctx, sessionID, path, content, nextVersion)
+	if err != nil {
+		return File{}, err
+	}
+	if err := s.pruneVersions(ctx, sessionID, path, config.Get().FileHistory.MaxVersions); err != nil {
+		logging.Warn("Failed to prune file history", "path", path, "session_id", sessionID, "error", err)
+	}
+	return file, nil
+}
+
+// pruneVersions deletes the oldest versions of a file in a session beyond the latest
+// maxVersions, keeping the first version so the file can still be restored to how it
+// was before the session changed it
+func (s *service) pruneVersions(ctx context.Context, sessionID, path string, maxVersions int) error {
+	if maxVersions <= 0 {
+		return nil
+	}
+	files, err := s.ListBySession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	var versions []File
+	for _, file := range files {
+		if file.Path == path {
+			versions = append(versions, file)
+		}
+	}
+	if len(versions) <= maxVersions+1 {
+		return nil
+	}
+	SortVersions(versions)
+
+	for _, file := range versions[1 : len(versions)-maxVersions] {
+		if err := s.Delete(ctx, file.ID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *service) createWithVersion(ctx context.Context, sessionID, path, content, version string) (File, error) {
@@ -251,3 +297,22 @@ func (s *service) fromDBItem(item db.File) File {
 		UpdatedAt: item.UpdatedAt,
 	}
 }
+
+// SortVersions orders file versions oldest first. Timestamps have second granularity,
+// so ties are broken on the version number ("initial", then v1, v2, ...).
+func SortVersions(files []File) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].CreatedAt != files[j].CreatedAt {
+			return files[i].CreatedAt < files[j].CreatedAt
+		}
+		return versionNumber(files[i].Version) < versionNumber(files[j].Version)
+	})
+}
+
+func versionNumber(version string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return 0
+	}
+	return n
+}
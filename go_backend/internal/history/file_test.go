@@ -0,0 +1,87 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"mix/internal/config"
+	"mix/internal/db"
+	"mix/internal/session"
+
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_CreateVersion_Retention(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, db.SetupTestDatabase(conn))
+
+	cfg := config.Get()
+	original := cfg.FileHistory
+	t.Cleanup(func() { cfg.FileHistory = original })
+
+	ctx := context.Background()
+	queries := db.New(conn)
+	sessions := session.NewService(queries)
+	files := NewService(queries, conn)
+
+	versionsOf := func(t *testing.T, sessionID, path string) []string {
+		t.Helper()
+		all, err := files.ListBySession(ctx, sessionID)
+		require.NoError(t, err)
+		var versions []File
+		for _, file := range all {
+			if file.Path == path {
+				versions = append(versions, file)
+			}
+		}
+		SortVersions(versions)
+		var names []string
+		for _, file := range versions {
+			names = append(names, file.Version+":"+file.Content)
+		}
+		return names
+	}
+
+	edited, err := sessions.Create(ctx, "edits")
+	require.NoError(t, err)
+	other, err := sessions.Create(ctx, "other")
+	require.NoError(t, err)
+
+	cfg.FileHistory.MaxVersions = 0
+	_, err = files.Create(ctx, other.ID, "/work/poster.svg", "other original")
+	require.NoError(t, err)
+	for i := 1; i <= 4; i++ {
+		_, err = files.CreateVersion(ctx, other.ID, "/work/poster.svg", fmt.Sprintf("other edit %d", i))
+		require.NoError(t, err)
+	}
+	assert.Len(t, versionsOf(t, other.ID, "/work/poster.svg"), 5, "zero keeps every version")
+
+	cfg.FileHistory.MaxVersions = 3
+	_, err = files.Create(ctx, edited.ID, "/work/logo.svg", "original")
+	require.NoError(t, err)
+	for i := 1; i <= 6; i++ {
+		file, err := files.CreateVersion(ctx, edited.ID, "/work/logo.svg", fmt.Sprintf("edit %d", i))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("v%d", i), file.Version)
+	}
+
+	// The original stays so the file can be restored, with the latest three edits
+	assert.Equal(t, []string{"initial:original", "v4:edit 4", "v5:edit 5", "v6:edit 6"}, versionsOf(t, edited.ID, "/work/logo.svg"))
+
+	// Numbering carries on after pruning
+	file, err := files.CreateVersion(ctx, edited.ID, "/work/logo.svg", "edit 7")
+	require.NoError(t, err)
+	assert.Equal(t, "v7", file.Version)
+	assert.Equal(t, []string{"initial:original", "v5:edit 5", "v6:edit 6", "v7:edit 7"}, versionsOf(t, edited.ID, "/work/logo.svg"))
+
+	// Other sessions and files are left alone
+	assert.Len(t, versionsOf(t, other.ID, "/work/poster.svg"), 5)
+}
@@ -3,43 +3,105 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os/exec"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"mix/internal/api"
 	"mix/internal/commands"
+	"mix/internal/config"
 	"mix/internal/fileutil"
 	"mix/internal/llm/agent"
+	"mix/internal/llm/provider"
+	"mix/internal/llm/tools"
+	"mix/internal/logging"
+	"mix/internal/message"
+	"mix/internal/pubsub"
 )
 
-// Connection represents a single SSE connection
+// Connection represents a single SSE connection. Done is closed when it goes away;
+// Messages stays open so a late broadcast never sends on a closed channel.
 type Connection struct {
 	SessionID string
 	Messages  chan string
 	Done      chan struct{}
 }
 
+// Connection limits and how long a broadcast waits for a full connection queue
+const (
+	maxConnectionsPerSession = 5
+	maxConnections           = 100
+	broadcastTimeout         = 500 * time.Millisecond
+)
+
+var (
+	// ErrTooManyConnections is returned by Register when a connection limit is reached
+	ErrTooManyConnections = errors.New("too many connections")
+	// ErrQueueFull is returned by Broadcast when no connection accepted the message because
+	// their queues stayed full
+	ErrQueueFull = errors.New("message queue is full")
+	// ErrShuttingDown is returned by Register and Broadcast once the server is shutting down
+	ErrShuttingDown = errors.New("server is shutting down")
+)
+
 // ConnectionRegistry manages active SSE connections
 type ConnectionRegistry struct {
 	mu          sync.RWMutex
 	connections map[string][]*Connection
+	// paused holds the sessions whose messages are buffered; a session is paused while it has an entry
+	paused map[string]*pausedSession
+	// resumeMu keeps concurrent resumes of a session from delivering out of order
+	resumeMu sync.Mutex
+	// maxPerSession and maxTotal cap the number of registered connections
+	maxPerSession int
+	maxTotal      int
+	// closing is closed by Shutdown; active counts the connections it waits for
+	closing chan struct{}
+	active  sync.WaitGroup
 }
 
 // Global connection registry
-var registry = &ConnectionRegistry{
-	connections: make(map[string][]*Connection),
+var registry = newConnectionRegistry()
+
+func newConnectionRegistry() *ConnectionRegistry {
+	return &ConnectionRegistry{
+		connections:   make(map[string][]*Connection),
+		paused:        make(map[string]*pausedSession),
+		maxPerSession: maxConnectionsPerSession,
+		maxTotal:      maxConnections,
+		closing:       make(chan struct{}),
+	}
 }
 
-// Register adds a connection to the registry
-func (r *ConnectionRegistry) Register(sessionID string, conn *Connection) {
+// Register adds a connection to the registry. It returns ErrTooManyConnections if the
+// session or the server already has the maximum number of connections.
+func (r *ConnectionRegistry) Register(sessionID string, conn *Connection) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+
+	if r.isClosing() {
+		return ErrShuttingDown
+	}
+	if len(r.connections[sessionID]) >= r.maxPerSession {
+		return fmt.Errorf("%w: session %s already has %d connections", ErrTooManyConnections, sessionID, r.maxPerSession)
+	}
+	total := 0
+	for _, connections := range r.connections {
+		total += len(connections)
+	}
+	if total >= r.maxTotal {
+		return fmt.Errorf("%w: the server already has %d connections", ErrTooManyConnections, r.maxTotal)
+	}
+
 	r.connections[sessionID] = append(r.connections[sessionID], conn)
+	r.active.Add(1)
+	return nil
 }
 
 // Unregister removes a connection from the registry
@@ -52,6 +114,7 @@ func (r *ConnectionRegistry) Unregister(sessionID string, conn *Connection) {
 		if c == conn {
 			// Remove connection from slice
 			r.connections[sessionID] = append(connections[:i], connections[i+1:]...)
+			r.active.Done()
 			break
 		}
 	}
@@ -62,23 +125,179 @@ func (r *ConnectionRegistry) Unregister(sessionID string, conn *Connection) {
 	}
 }
 
-// Broadcast sends a message to all connections for a sessionID
-func (r *ConnectionRegistry) Broadcast(sessionID, message string) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+// pausedSession holds the messages buffered while a session is paused. Resume delivers
+// them without holding the registry lock, so the session stays paused, with resuming set,
+// until they are all delivered; new messages are buffered behind them meanwhile.
+type pausedSession struct {
+	pending  []string
+	resuming bool
+}
 
-	connections := r.connections[sessionID]
+// Delivery reports what happened to a broadcast message: it was buffered for a paused
+// session, or sent to the session's connections, some of which may have failed to take it
+type Delivery struct {
+	Buffered  bool
+	Delivered int
+	Failed    int
+}
+
+// Broadcast sends a message to all connections for a sessionID, or buffers it if the
+// session is paused. It returns ErrQueueFull if connections failed to take the message
+// and none took it, so the message can be sent again; when only some failed the message
+// is not retried and the failures are reported in the Delivery.
+func (r *ConnectionRegistry) Broadcast(sessionID, message string) (Delivery, error) {
+	r.mu.Lock()
+	if r.isClosing() {
+		r.mu.Unlock()
+		return Delivery{}, ErrShuttingDown
+	}
+	if paused, ok := r.paused[sessionID]; ok {
+		paused.pending = append(paused.pending, message)
+		r.mu.Unlock()
+		return Delivery{Buffered: true}, nil
+	}
+	connections := slices.Clone(r.connections[sessionID])
+	r.mu.Unlock()
+
+	delivery := deliver(connections, message)
+	if delivery.Failed > 0 && delivery.Delivered == 0 {
+		return delivery, fmt.Errorf("%w: %d connection(s) for session %s did not accept the message", ErrQueueFull, delivery.Failed, sessionID)
+	}
+	if delivery.Failed > 0 {
+		logging.Warn("Message not delivered to every connection", "sessionID", sessionID, "delivered", delivery.Delivered, "failed", delivery.Failed)
+	}
+	return delivery, nil
+}
+
+// deliver sends a message to connections, waiting up to broadcastTimeout for a full
+// queue. Closed connections count as neither delivered nor failed.
+func deliver(connections []*Connection, message string) Delivery {
+	var delivery Delivery
 	for _, conn := range connections {
 		select {
-		case conn.Messages <- message:
 		case <-conn.Done:
 			// Connection is closed, skip
+			continue
 		default:
-			// Channel full, drop message to prevent blocking
 		}
+
+		select {
+		case conn.Messages <- message:
+			delivery.Delivered++
+			continue
+		default:
+		}
+
+		timer := time.NewTimer(broadcastTimeout)
+		select {
+		case conn.Messages <- message:
+			delivery.Delivered++
+		case <-conn.Done:
+		case <-timer.C:
+			delivery.Failed++
+		}
+		timer.Stop()
+	}
+	return delivery
+}
+
+// Pause stops dispatching messages for a session; they are buffered until Resume. Pausing
+// a session that is being resumed stops the rest of its buffered messages from going out.
+func (r *ConnectionRegistry) Pause(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if paused, ok := r.paused[sessionID]; ok {
+		paused.resuming = false
+		return
+	}
+	r.paused[sessionID] = &pausedSession{}
+}
+
+// Resume unpauses a session and delivers its buffered messages in the order they
+// were sent. It returns the number of messages flushed.
+func (r *ConnectionRegistry) Resume(sessionID string) int {
+	r.resumeMu.Lock()
+	defer r.resumeMu.Unlock()
+
+	flushed := 0
+	r.mu.Lock()
+	paused, ok := r.paused[sessionID]
+	if ok {
+		paused.resuming = true
+	}
+	for ok && paused.resuming {
+		if len(paused.pending) == 0 {
+			delete(r.paused, sessionID)
+			break
+		}
+		batch := paused.pending
+		paused.pending = nil
+		connections := slices.Clone(r.connections[sessionID])
+		r.mu.Unlock()
+
+		for _, message := range batch {
+			if delivery := deliver(connections, message); delivery.Failed > 0 {
+				logging.Warn("Failed to deliver buffered message", "sessionID", sessionID, "delivered", delivery.Delivered, "failed", delivery.Failed)
+			}
+		}
+		flushed += len(batch)
+		r.mu.Lock()
+	}
+	r.mu.Unlock()
+	return flushed
+}
+
+// IsPaused reports whether messages for a session are being buffered
+func (r *ConnectionRegistry) IsPaused(sessionID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	paused, ok := r.paused[sessionID]
+	return ok && !paused.resuming
+}
+
+// Shutdown stops accepting connections and messages and tells the open streams to
+// finish, which they do after sending a final event. It waits until every stream has
+// closed or ctx is done.
+func (r *ConnectionRegistry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.isClosing() {
+		close(r.closing)
+	}
+	r.mu.Unlock()
+
+	closed := make(chan struct{})
+	go func() {
+		r.active.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
+// Closing returns a channel that is closed when the server starts shutting down
+func (r *ConnectionRegistry) Closing() <-chan struct{} {
+	return r.closing
+}
+
+func (r *ConnectionRegistry) isClosing() bool {
+	select {
+	case <-r.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown ends the open SSE and WebSocket streams before the server shuts down
+func Shutdown(ctx context.Context) error {
+	return registry.Shutdown(ctx)
+}
+
 // HandleSSEStream handles persistent Server-Sent Events streaming for agent responses
 func HandleSSEStream(ctx context.Context, handler *api.QueryHandler, w http.ResponseWriter, r *http.Request) {
 	// Set SSE headers
@@ -118,13 +337,19 @@ func HandleSSEStream(ctx context.Context, handler *api.QueryHandler, w http.Resp
 	}
 
 	// Register connection and ensure cleanup
-	registry.Register(sessionID, conn)
+	if err := registry.Register(sessionID, conn); err != nil {
+		WriteSSE(w, "error", ErrorEvent{Error: "Connection rejected: " + err.Error()})
+		return
+	}
 	defer func() {
-		close(conn.Done)
-		close(conn.Messages)
+		// Messages is never closed: a broadcast may still hold the connection after
+		// Unregister, and sees Done instead
 		registry.Unregister(sessionID, conn)
+		close(conn.Done)
 	}()
 
+	events := &sseWriter{w: w, flusher: flusher}
+
 	// Send connection confirmation
 	WriteSSE(w, "connected", ConnectedEvent{SessionID: sessionID})
 	flusher.Flush()
@@ -133,6 +358,12 @@ func HandleSSEStream(ctx context.Context, handler *api.QueryHandler, w http.Resp
 	heartbeat := time.NewTicker(45 * time.Second)
 	defer heartbeat.Stop()
 
+	fileChanges := subscribeFileChanges(r.Context(), handler)
+
+	// Turns run in the background so commands are answered while the agent works
+	stream := newStreamSession(ctx, handler, events, sessionID)
+	defer stream.close()
+
 	// Main event loop - simple and clean
 	for {
 		select {
@@ -142,27 +373,67 @@ func HandleSSEStream(ctx context.Context, handler *api.QueryHandler, w http.Resp
 			return
 
 		case <-heartbeat.C:
-			WriteSSE(w, "heartbeat", HeartbeatEvent{Type: "ping"})
-			flusher.Flush()
+			stream.events.WriteEvent("heartbeat", HeartbeatEvent{Type: "ping"})
+			stream.events.Flush()
 
-		case message, ok := <-conn.Messages:
+		case change, ok := <-fileChanges:
 			if !ok {
+				fileChanges = nil
+				continue
+			}
+			writeFileChange(stream.events, sessionID, change.Payload)
+
+		case err := <-stream.turnFinished():
+			if err := stream.finishTurn(err); err != nil {
 				return
 			}
 
-			if err := processMessage(ctx, handler, w, flusher, sessionID, message); err != nil {
+		case <-registry.Closing():
+			stream.shutdown(conn)
+			return
+
+		case message := <-conn.Messages:
+			if err := stream.handle(message); err != nil {
 				return
 			}
 		}
 	}
 }
 
+// subscribeFileChanges returns external changes to files the agent read, or nil (never
+// ready) unless the file watcher runs with client notifications enabled
+func subscribeFileChanges(ctx context.Context, handler *api.QueryHandler) <-chan pubsub.Event[tools.FileChangedEvent] {
+	watcher := handler.GetApp().FileWatcher
+	if watcher == nil || !config.Get().FileWatcher.NotifyClients {
+		return nil
+	}
+	return watcher.Subscribe(ctx)
+}
+
+// writeFileChange sends a status event if the changed file was read in this session
+func writeFileChange(events EventWriter, sessionID string, change tools.FileChangedEvent) error {
+	if change.SessionID != sessionID {
+		return nil
+	}
+	if err := events.WriteEvent("status", StatusEvent{
+		Type:    "file_changed",
+		Message: fmt.Sprintf("%s changed on disk and must be viewed again before editing", change.Path),
+		Path:    change.Path,
+	}); err != nil {
+		return err
+	}
+	events.Flush()
+	return nil
+}
+
 // MessageContent represents the JSON structure sent from frontend
 type MessageContent struct {
 	Text     string   `json:"text"`
 	Media    []string `json:"media,omitempty"`
 	Apps     []string `json:"apps,omitempty"`
 	PlanMode bool     `json:"plan_mode,omitempty"`
+	// Confirm lets a destructive slash command such as /clear --hard run
+	Confirm bool `json:"confirm,omitempty"`
 }
 
 // extractText parses JSON content to extract the actual text value
@@ -198,7 +469,7 @@ func quotePaths(text string, mediaPaths []string) string {
 }
 
 // handleShellCommand executes shell commands for ! prefixed messages
-func handleShellCommand(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, text string) error {
+func handleShellCommand(ctx context.Context, events EventWriter, text string) error {
 	command := strings.TrimSpace(strings.TrimPrefix(text, "!"))
 	if command == "" {
 		command = "echo 'No command specified'"
@@ -212,34 +483,128 @@ func handleShellCommand(ctx context.Context, w http.ResponseWriter, flusher http
 		result = fmt.Sprintf("Error: %v\n%s", err, result)
 	}
 
-	WriteSSE(w, "complete", CompleteEvent{Type: "complete", Content: result, Done: true})
-	flusher.Flush()
+	events.WriteEvent("complete", CompleteEvent{Type: "complete", Content: result, Done: true})
+	events.Flush()
 	return nil
 }
 
 // handleRegularMessage processes regular messages through the agent
-func handleRegularMessage(ctx context.Context, handler *api.QueryHandler, w http.ResponseWriter, flusher http.Flusher, sessionID, content string) error {
+func handleRegularMessage(ctx context.Context, handler *api.QueryHandler, events EventWriter, sessionID, content string) error {
 	msgContent, err := parseMessageContent(content)
 	if err != nil {
-		WriteSSE(w, "error", ErrorEvent{Error: fmt.Sprintf("Failed to parse message: %s", err.Error())})
-		flusher.Flush()
+		events.WriteEvent("error", ErrorEvent{Error: fmt.Sprintf("Failed to parse message: %s", err.Error())})
+		events.Flush()
 		return nil
 	}
-	
-	events, err := handler.GetApp().CoderAgent.RunWithPlanMode(ctx, sessionID, content, msgContent.PlanMode)
+
+	// The limit applies to the text, and a truncated message is wrapped again so the
+	// stored content stays valid JSON
+	text, err := agent.LimitMessageLength(msgContent.Text)
 	if err != nil {
-		WriteSSE(w, "error", ErrorEvent{Error: fmt.Sprintf("Failed to start agent: %s", err.Error())})
-		flusher.Flush()
+		events.WriteEvent("error", ErrorEvent{Error: err.Error()})
+		events.Flush()
 		return nil
 	}
+	if text != msgContent.Text {
+		msgContent.Text = text
+		data, err := json.Marshal(msgContent)
+		if err != nil {
+			return fmt.Errorf("failed to encode message content: %w", err)
+		}
+		content = string(data)
+	}
+
+	// Media paths and @ references that point to images are sent as attachments
+	references := append(msgContent.Media, message.FileReferences(msgContent.Text)...)
+	attachments, err := message.ImageAttachments(config.WorkingDirectory(), references)
+	if err != nil {
+		events.WriteEvent("error", ErrorEvent{Error: fmt.Sprintf("Failed to load attachments: %s", err.Error())})
+		events.Flush()
+		return nil
+	}
+
+	retry := config.Get().MessageRetry
+	delay := time.Duration(retry.InitialDelayMs) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		canRetry := attempt <= retry.MaxRetries
+		before, err := handler.GetApp().Messages.List(ctx, sessionID)
+		if err != nil {
+			canRetry = false
+		}
+
+		sendErr, err := streamAgentResponse(ctx, handler, events, sessionID, content, msgContent.PlanMode, attachments, canRetry)
+		if err != nil || sendErr == nil {
+			return err
+		}
+
+		// Drop what the failed attempt stored so the retry does not repeat the user message
+		discardMessagesAfter(handler, sessionID, len(before))
+
+		events.WriteEvent("status", StatusEvent{
+			Type:        "status",
+			Message:     fmt.Sprintf("Message failed (%s), retrying in %s (attempt %d of %d)", sendErr.Error(), delay, attempt, retry.MaxRetries),
+			Attempt:     attempt,
+			MaxAttempts: retry.MaxRetries,
+			DelayMs:     delay.Milliseconds(),
+		})
+		events.Flush()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// streamAgentResponse runs the agent on a message and streams its events. When canRetry
+// is set and the run fails with a retryable error, nothing is written and the error is
+// returned as sendErr so the caller can retry; err is only set if streaming itself fails.
+// A run that stops sending events is cancelled and reported as stalled.
+func streamAgentResponse(ctx context.Context, handler *api.QueryHandler, events EventWriter, sessionID, content string, planMode bool, attachments []message.Attachment, canRetry bool) (sendErr error, err error) {
+	agentEvents, err := handler.GetApp().RunReserved(sessionID, func() (<-chan agent.AgentEvent, error) {
+		return handler.GetApp().CoderAgent.RunWithPlanMode(ctx, sessionID, content, planMode, attachments...)
+	})
+	if err != nil {
+		events.WriteEvent("error", ErrorEvent{Error: fmt.Sprintf("Failed to start agent: %s", err.Error())})
+		events.Flush()
+		return nil, nil
+	}
+
+	// The session stays reserved until the run's events are read to the end. An
+	// abandoned run is drained in the background so it can still finish.
+	abandoned := false
+	defer func() {
+		if abandoned {
+			go drainAgentEvents(agentEvents)
+		} else {
+			drainAgentEvents(agentEvents)
+		}
+	}()
+
+	watchdog := newRunWatchdog(config.Get().RunWatchdog)
+	defer watchdog.stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			handler.GetApp().CoderAgent.Cancel(sessionID)
-			return ctx.Err()
+			abandoned = true
+			return nil, ctx.Err()
 
-		case event, ok := <-events:
+		case <-watchdog.expired():
+			// Don't wait for the run to finish, it may never send another event
+			logging.Error("Agent run stalled, cancelling it", "sessionID", sessionID)
+			handler.GetApp().CoderAgent.Cancel(sessionID)
+			// Keep reading so a run that wakes up can send its last events and finish,
+			// instead of blocking on a full channel with the session left reserved
+			abandoned = true
+			events.WriteEvent("error", ErrorEvent{Error: ErrRunStalled.Error(), Category: "stalled", Guidance: "The run was cancelled. Send the message again to retry."})
+			events.Flush()
+			return nil, nil
+
+		case event, ok := <-agentEvents:
 			if !ok {
 				var content, messageID, reasoning string
 				var reasoningDuration int64
@@ -253,28 +618,64 @@ func handleRegularMessage(ctx context.Context, handler *api.QueryHandler, w http
 						reasoningDuration = reasoningContent.Duration
 					}
 				}
-				WriteSSE(w, "complete", CompleteEvent{Type: "complete", Content: content, MessageID: messageID, Done: true, Reasoning: reasoning, ReasoningDuration: reasoningDuration})
-				flusher.Flush()
-				return nil
+				events.WriteEvent("complete", CompleteEvent{Type: "complete", Content: content, MessageID: messageID, Done: true, Reasoning: reasoning, ReasoningDuration: reasoningDuration})
+				events.Flush()
+				return nil, nil
 			}
 
-			if err := WriteAgentEventAsSSE(w, event); err != nil {
-				return err
+			watchdog.progress(event)
+
+			if event.Type == agent.AgentEventTypeError && canRetry && isRetryableSendError(event.Error) {
+				return event.Error, nil
 			}
-			flusher.Flush()
+
+			if err := WriteAgentEvent(events, event); err != nil {
+				return nil, err
+			}
+			events.Flush()
 
 			if event.Error != nil || event.Done {
-				return nil
+				return nil, nil
 			}
 		}
 	}
 }
 
+// drainAgentEvents discards the remaining events of a run nobody streams anymore
+func drainAgentEvents(agentEvents <-chan agent.AgentEvent) {
+	for range agentEvents {
+	}
+}
+
+// isRetryableSendError reports whether an agent run failed for a transient reason the
+// provider doesn't retry itself, such as a dropped connection or a server error. Rate
+// limits are not retried again: the provider has already backed off on them.
+func isRetryableSendError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, agent.ErrRequestCancelled) {
+		return false
+	}
+	return provider.ClassifyError(err) == provider.ErrorCategoryConnection
+}
+
+// discardMessagesAfter deletes a session's messages beyond the first keep
+func discardMessagesAfter(handler *api.QueryHandler, sessionID string, keep int) {
+	messages, err := handler.GetApp().Messages.List(context.Background(), sessionID)
+	if err != nil {
+		return
+	}
+	for _, msg := range messages[min(keep, len(messages)):] {
+		handler.GetApp().Messages.Delete(context.Background(), msg.ID)
+	}
+}
+
 // processMessage processes a single message and streams the response
-func processMessage(ctx context.Context, handler *api.QueryHandler, w http.ResponseWriter, flusher http.Flusher, sessionID, content string) error {
+func processMessage(ctx context.Context, handler *api.QueryHandler, events EventWriter, sessionID, content string) error {
 	msgContent, err := parseMessageContent(content)
 	if err != nil {
-		return err
+		// A malformed message is reported to the client without closing the stream
+		events.WriteEvent("error", ErrorEvent{Error: err.Error()})
+		events.Flush()
+		return nil
 	}
 
 	text := msgContent.Text
@@ -283,41 +684,61 @@ func processMessage(ctx context.Context, handler *api.QueryHandler, w http.Respo
 	case strings.HasPrefix(text, "/"):
 		// Quote paths in slash commands if they contain file references
 		quotedText := quotePaths(text, msgContent.Media)
-		return handleSlashCommandStreaming(ctx, handler, w, flusher, sessionID, quotedText)
+		if msgContent.Confirm {
+			ctx = commands.WithConfirmation(ctx)
+		}
+		return handleSlashCommandStreaming(ctx, handler, events, sessionID, quotedText, msgContent)
 	case strings.HasPrefix(text, "!"):
 		// Quote paths in shell commands
 		quotedText := quotePaths(text, msgContent.Media)
-		return handleShellCommand(ctx, w, flusher, quotedText)
+		return handleShellCommand(ctx, events, quotedText)
 	default:
-		return handleRegularMessage(ctx, handler, w, flusher, sessionID, content)
+		return handleRegularMessage(ctx, handler, events, sessionID, content)
 	}
 }
 
-// handleSlashCommandStreaming processes slash commands for persistent connections
-func handleSlashCommandStreaming(ctx context.Context, handler *api.QueryHandler, w http.ResponseWriter, flusher http.Flusher, sessionID, content string) error {
+// handleSlashCommandStreaming processes slash commands for persistent connections. A
+// prompt template expanded by /prompt is sent to the agent in place of msgContent's text.
+func handleSlashCommandStreaming(ctx context.Context, handler *api.QueryHandler, events EventWriter, sessionID, content string, msgContent MessageContent) error {
 	parsedCmd, err := commands.ParseCommand(content)
 	if err != nil {
-		WriteSSE(w, "error", ErrorEvent{Error: fmt.Sprintf("Invalid slash command: %s", err.Error())})
-		flusher.Flush()
+		events.WriteEvent("error", ErrorEvent{Error: fmt.Sprintf("Invalid slash command: %s", err.Error())})
+		events.Flush()
 		return nil
 	}
 
 	reg := commands.NewRegistry()
 	if err := reg.LoadCommands(handler.GetApp()); err != nil {
-		WriteSSE(w, "error", ErrorEvent{Error: fmt.Sprintf("Failed to load commands: %s", err.Error())})
-		flusher.Flush()
+		events.WriteEvent("error", ErrorEvent{Error: fmt.Sprintf("Failed to load commands: %s", err.Error())})
+		events.Flush()
 		return nil
 	}
 
 	result, err := reg.ExecuteCommand(ctx, parsedCmd.Name, parsedCmd.Arguments)
+	if errors.Is(err, commands.ErrConfirmationRequired) {
+		// Clients prompt the user and resend the message with confirm set
+		events.WriteEvent("error", ErrorEvent{Error: err.Error(), Category: "confirmation_required"})
+		events.Flush()
+		return nil
+	}
 	if err != nil {
-		WriteSSE(w, "error", ErrorEvent{Error: fmt.Sprintf("Command execution failed: %s", err.Error())})
-		flusher.Flush()
+		events.WriteEvent("error", ErrorEvent{Error: fmt.Sprintf("Command execution failed: %s", err.Error())})
+		events.Flush()
 		return nil
 	}
 
-	WriteSSE(w, "complete", CompleteEvent{Type: "complete", Content: result, Done: true})
-	flusher.Flush()
+	if prompt, ok := commands.PromptFromOutput(result); ok {
+		msgContent.Text = prompt
+		msgContent.Confirm = false
+		envelope, err := json.Marshal(msgContent)
+		if err != nil {
+			return err
+		}
+		return handleRegularMessage(ctx, handler, events, sessionID, string(envelope))
+	}
+
+	events.WriteEvent("complete", CompleteEvent{Type: "complete", Content: result, Done: true})
+	events.Flush()
 	return nil
 }
 
@@ -363,20 +784,98 @@ func HandleMessageQueue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Broadcast message to all active connections for this session
-	registry.Broadcast(sessionID, reqData.Content)
+	// Broadcast message to all active connections for this session. Only a message no
+	// connection took is refused; a partial delivery is reported but must not be resent.
+	delivery, err := registry.Broadcast(sessionID, reqData.Content)
+	if err != nil {
+		http.Error(w, "Message not delivered: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	status := "broadcasted"
+	switch {
+	case delivery.Buffered:
+		status = "buffered"
+	case delivery.Failed > 0:
+		status = "partial"
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
-		"status":    "broadcasted",
+		"status":    status,
 		"sessionId": sessionID,
 	}
+	if !delivery.Buffered {
+		response["delivered"] = delivery.Delivered
+		response["failed"] = delivery.Failed
+	}
 	json.NewEncoder(w).Encode(response)
 }
 
-// WriteAgentEventAsSSE converts an AgentEvent to SSE format using unified event types
-func WriteAgentEventAsSSE(w http.ResponseWriter, event agent.AgentEvent) error {
+// HandlePauseSession handles POST /stream/{sessionId}/pause. While paused, messages
+// posted to the session's queue are buffered instead of dispatched to the agent.
+func HandlePauseSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := sessionControlRequest(w, r)
+	if !ok {
+		return
+	}
+
+	registry.Pause(sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "paused",
+		"sessionId": sessionID,
+	})
+}
+
+// HandleResumeSession handles POST /stream/{sessionId}/resume, dispatching any
+// messages buffered while the session was paused in the order they were sent.
+func HandleResumeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := sessionControlRequest(w, r)
+	if !ok {
+		return
+	}
+
+	flushed := registry.Resume(sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "resumed",
+		"sessionId": sessionID,
+		"flushed":   flushed,
+	})
+}
+
+// sessionControlRequest validates a POST /stream/{sessionId}/... request and returns the
+// session ID. It writes the response itself and returns false if there is nothing more to do.
+func sessionControlRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return "", false
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Only POST method allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) < 3 || pathParts[0] != "stream" {
+		http.Error(w, "Invalid URL path", http.StatusBadRequest)
+		return "", false
+	}
+	return pathParts[1], true
+}
+
+// WriteAgentEvent converts an AgentEvent to the unified client event types
+func WriteAgentEvent(events EventWriter, event agent.AgentEvent) error {
 	switch event.Type {
 	case agent.AgentEventTypeResponse:
 		// Stream tool calls - detect new tool calls by checking completion status
@@ -394,16 +893,29 @@ func WriteAgentEventAsSSE(w http.ResponseWriter, event agent.AgentEvent) error {
 				}
 			}
 
-			if err := WriteSSE(w, "tool", ToolEvent{Type: "tool", Name: toolCall.Name, Input: toolCall.Input, ID: toolCall.ID, Status: status}); err != nil {
+			if err := events.WriteEvent("tool", ToolEvent{Type: "tool", Name: toolCall.Name, Input: toolCall.Input, ID: toolCall.ID, Status: status}); err != nil {
 				return err
 			}
 		}
 
 		// Send completion event only for final events, include final content
 		if event.Done {
+			if usage := event.Usage; usage != nil {
+				if err := events.WriteEvent("usage", UsageEvent{
+					Type:                "usage",
+					InputTokens:         usage.InputTokens,
+					OutputTokens:        usage.OutputTokens,
+					CacheCreationTokens: usage.CacheCreationTokens,
+					CacheReadTokens:     usage.CacheReadTokens,
+					ReasoningTokens:     usage.ReasoningTokens,
+					Cost:                usage.Cost,
+				}); err != nil {
+					return err
+				}
+			}
 			// Check if this is a permission denied error
 			if event.Message.FinishReason() == "permission_denied" {
-				if err := WriteSSE(w, "error", ErrorEvent{Error: "Permission denied"}); err != nil {
+				if err := events.WriteEvent("error", ErrorEvent{Error: "Permission denied"}); err != nil {
 					return err
 				}
 			} else {
@@ -411,19 +923,69 @@ func WriteAgentEventAsSSE(w http.ResponseWriter, event agent.AgentEvent) error {
 				reasoningContent := event.Message.ReasoningContent()
 				reasoning := reasoningContent.String()
 				reasoningDuration := reasoningContent.Duration
-				if err := WriteSSE(w, "complete", CompleteEvent{Type: "complete", Content: content, MessageID: event.Message.ID, Done: true, Reasoning: reasoning, ReasoningDuration: reasoningDuration}); err != nil {
+				if err := events.WriteEvent("complete", CompleteEvent{Type: "complete", Content: content, MessageID: event.Message.ID, Done: true, Reasoning: reasoning, ReasoningDuration: reasoningDuration}); err != nil {
 					return err
 				}
 			}
 		}
 
 	case agent.AgentEventTypeError:
-		if err := WriteSSE(w, "error", ErrorEvent{Error: event.Error.Error()}); err != nil {
+		// A cancelled response still completes, with whatever content was streamed
+		if errors.Is(event.Error, agent.ErrRequestCancelled) && event.Message.ID != "" {
+			reasoningContent := event.Message.ReasoningContent()
+			return events.WriteEvent("complete", CompleteEvent{
+				Type:              "complete",
+				Content:           event.Message.Content().String(),
+				MessageID:         event.Message.ID,
+				Done:              true,
+				Reasoning:         reasoningContent.String(),
+				ReasoningDuration: reasoningContent.Duration,
+				Canceled:          true,
+			})
+		}
+		errorEvent := ErrorEvent{Error: event.Error.Error()}
+		if !errors.Is(event.Error, agent.ErrRequestCancelled) {
+			category := provider.ClassifyError(event.Error)
+			errorEvent.Category = string(category)
+			errorEvent.Guidance = category.Guidance()
+		}
+		if err := events.WriteEvent("error", errorEvent); err != nil {
 			return err
 		}
 
 	case agent.AgentEventTypeSummarize:
-		if err := WriteSSE(w, "summarize", SummarizeEvent{Type: "summarize", Progress: event.Progress, Done: event.Done}); err != nil {
+		if err := events.WriteEvent("summarize", SummarizeEvent{Type: "summarize", Progress: event.Progress, Done: event.Done}); err != nil {
+			return err
+		}
+
+	case agent.AgentEventTypeRetry:
+		if err := events.WriteEvent("retry", RetryEvent{Type: "retry", Message: event.Progress, Attempt: event.Retry.Attempt, MaxAttempts: event.Retry.MaxAttempts, DelayMs: event.Retry.Delay.Milliseconds()}); err != nil {
+			return err
+		}
+
+	case agent.AgentEventTypeTokens:
+		message := fmt.Sprintf("%d output tokens", event.Tokens.OutputTokens)
+		if event.Tokens.Estimated {
+			message = "~" + message
+		}
+		if err := events.WriteEvent("status", StatusEvent{
+			Type:         "tokens",
+			Message:      message,
+			InputTokens:  event.Tokens.InputTokens,
+			OutputTokens: event.Tokens.OutputTokens,
+			Estimated:    event.Tokens.Estimated,
+		}); err != nil {
+			return err
+		}
+
+	case agent.AgentEventTypeToolProgress:
+		if err := events.WriteEvent("status", StatusEvent{
+			Type:       "tool_progress",
+			Message:    event.Progress,
+			ToolCallID: event.ToolProgress.ToolCallID,
+			Completed:  event.ToolProgress.Completed,
+			Total:      event.ToolProgress.Total,
+		}); err != nil {
 			return err
 		}
 	}
@@ -10,6 +10,12 @@ import (
 
 type ErrorEvent struct {
 	Error string `json:"error"`
+	// Category and Guidance tell the user what to do about a failed agent run. A
+	// confirmation_required category asks the client to confirm a destructive command,
+	// shutdown means the server is stopping and the stream is about to close, and
+	// stalled means the run stopped sending events and was cancelled.
+	Category string `json:"category,omitempty"`
+	Guidance string `json:"guidance,omitempty"`
 }
 
 type ConnectedEvent struct {
@@ -27,6 +33,8 @@ type CompleteEvent struct {
 	Done              bool   `json:"done"`
 	Reasoning         string `json:"reasoning,omitempty"`
 	ReasoningDuration int64  `json:"reasoningDuration,omitempty"`
+	// Canceled marks a response cut short by the user; Content holds what was streamed before
+	Canceled bool `json:"canceled,omitempty"`
 }
 
 type ToolEvent struct {
@@ -43,6 +51,65 @@ type SummarizeEvent struct {
 	Done     bool   `json:"done"`
 }
 
+type RetryEvent struct {
+	Type        string `json:"type"`
+	Message     string `json:"message"`
+	Attempt     int    `json:"attempt"`
+	MaxAttempts int    `json:"maxAttempts"`
+	DelayMs     int64  `json:"delayMs"`
+}
+
+// UsageEvent is the tokens and cost of a finished turn, sent before its complete event.
+// Cost is what the turn added, not the running total for the session.
+type UsageEvent struct {
+	Type                string  `json:"type"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	ReasoningTokens     int64   `json:"reasoningTokens"`
+	Cost                float64 `json:"cost"`
+}
+
+// StatusEvent reports that a failed message is being retried (type "status"), that
+// a file the session read changed on disk (type "file_changed"), the tokens of the
+// response being generated (type "tokens"), estimated until the response completes,
+// or the progress of a long-running tool call (type "tool_progress")
+type StatusEvent struct {
+	Type         string `json:"type"`
+	Message      string `json:"message"`
+	Attempt      int    `json:"attempt,omitempty"`
+	MaxAttempts  int    `json:"maxAttempts,omitempty"`
+	DelayMs      int64  `json:"delayMs,omitempty"`
+	Path         string `json:"path,omitempty"`
+	InputTokens  int64  `json:"inputTokens,omitempty"`
+	OutputTokens int64  `json:"outputTokens,omitempty"`
+	Estimated    bool   `json:"estimated,omitempty"`
+	ToolCallID   string `json:"toolCallId,omitempty"`
+	Completed    int64  `json:"completed,omitempty"`
+	Total        int64  `json:"total,omitempty"`
+}
+
+// EventWriter delivers named events to a streaming client (SSE or WebSocket)
+type EventWriter interface {
+	WriteEvent(eventType string, data interface{}) error
+	Flush()
+}
+
+// sseWriter writes events in Server-Sent Events format
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s *sseWriter) WriteEvent(eventType string, data interface{}) error {
+	return WriteSSE(s.w, eventType, data)
+}
+
+func (s *sseWriter) Flush() {
+	s.flusher.Flush()
+}
+
 // WriteSSE serializes and writes an SSE event to the response writer
 func WriteSSE(w http.ResponseWriter, eventType string, data interface{}) error {
 	jsonData, err := json.Marshal(data)
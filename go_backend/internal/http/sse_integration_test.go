@@ -47,8 +47,65 @@ type SSEEvent struct {
 	Data map[string]interface{} `json:"data"`
 }
 
+// modelStream is a scripted Anthropic response, as the data of its server-sent events
+type modelStream []string
+
+var (
+	textStream = modelStream{
+		`{"type": "message_start", "message": {"id": "msg_text", "type": "message", "role": "assistant", "model": "claude-sonnet-4", "content": [], "usage": {"input_tokens": 10, "output_tokens": 1}}}`,
+		`{"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}`,
+		`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Hello from the test model"}}`,
+		`{"type": "content_block_stop", "index": 0}`,
+		`{"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 5}}`,
+		`{"type": "message_stop"}`,
+	}
+	toolStream = modelStream{
+		`{"type": "message_start", "message": {"id": "msg_tool", "type": "message", "role": "assistant", "model": "claude-sonnet-4", "content": [], "usage": {"input_tokens": 10, "output_tokens": 1}}}`,
+		`{"type": "content_block_start", "index": 0, "content_block": {"type": "tool_use", "id": "toolu_pwd", "name": "bash", "input": {}}}`,
+		`{"type": "content_block_delta", "index": 0, "delta": {"type": "input_json_delta", "partial_json": "{\"command\": \"pwd\"}"}}`,
+		`{"type": "content_block_stop", "index": 0}`,
+		`{"type": "message_delta", "delta": {"stop_reason": "tool_use"}, "usage": {"output_tokens": 5}}`,
+		`{"type": "message_stop"}`,
+	}
+)
+
+// startFakeModel serves the Anthropic messages API so the tests don't depend on a real
+// provider. Asking for the working directory runs bash once; everything else gets text.
+func startFakeModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Messages []struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		stream := textStream
+		if n := len(request.Messages); n > 0 {
+			last := string(request.Messages[n-1].Content)
+			if strings.Contains(last, "Show me the current working directory") && !strings.Contains(last, "tool_result") {
+				stream = toolStream
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range stream {
+			var event struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(data), &event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	t.Setenv("ANTHROPIC_BASE_URL", server.URL)
+}
+
 // Test utilities
 func setupTestServer(t *testing.T) (*httptest.Server, *app.App, string) {
+	startFakeModel(t)
+
 	// Set up test configuration properly
 	testConfigDir := "/tmp/test-mix-" + t.Name()
 	testDataDir := "/tmp/test-mix-data-" + t.Name()
@@ -61,7 +118,7 @@ func setupTestServer(t *testing.T) (*httptest.Server, *app.App, string) {
 	os.MkdirAll(testDataDir, 0755)
 
 	// Initialize config for testing - this loads default config values
-	if _, err := config.Load(".", false); err != nil {
+	if _, err := config.Load("../..", false, false); err != nil {
 		t.Fatalf("Failed to load config: %v", err)
 	}
 
@@ -106,6 +163,10 @@ func setupTestServer(t *testing.T) (*httptest.Server, *app.App, string) {
 			http.NotFound(w, r)
 		}
 	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		t.Logf("WebSocket request received: %s %s", r.Method, r.URL.String())
+		HandleWebSocket(ctx, handler, w, r)
+	})
 	mux.HandleFunc("/rpc", func(w http.ResponseWriter, r *http.Request) {
 		// Basic JSON-RPC handler for session operations
 		w.Header().Set("Content-Type", "application/json")
@@ -210,7 +271,9 @@ func connectSSE(t *testing.T, serverURL, sessionID string) (*http.Response, cont
 func sendMessageToQueue(t *testing.T, serverURL, sessionID, content string) {
 	url := fmt.Sprintf("%s/stream/%s/message", serverURL, sessionID)
 
-	reqData := map[string]string{"content": content}
+	// The stream expects the content as a MessageContent envelope
+	envelope, _ := json.Marshal(MessageContent{Text: content})
+	reqData := map[string]string{"content": string(envelope)}
 	jsonData, _ := json.Marshal(reqData)
 
 	resp, err := http.Post(url, "application/json", strings.NewReader(string(jsonData)))
@@ -229,6 +292,27 @@ func sendMessageToQueue(t *testing.T, serverURL, sessionID, content string) {
 
 // Helper function to wait for and parse events from persistent connection
 func waitForEvents(t *testing.T, resp *http.Response, expectedMinEvents int, timeout time.Duration) []SSEEvent {
+	return waitForEventsUntil(t, resp, fmt.Sprintf("%d events", expectedMinEvents), func(events []SSEEvent) bool {
+		return len(events) >= expectedMinEvents
+	}, timeout)
+}
+
+// waitForCompleteEvents reads events until count complete events have arrived
+func waitForCompleteEvents(t *testing.T, resp *http.Response, count int, timeout time.Duration) []SSEEvent {
+	return waitForEventsUntil(t, resp, fmt.Sprintf("%d complete events", count), func(events []SSEEvent) bool {
+		completed := 0
+		for _, event := range events {
+			if event.Type == "complete" {
+				completed++
+			}
+		}
+		return completed >= count
+	}, timeout)
+}
+
+// waitForEventsUntil reads events from the persistent connection until done reports
+// that enough have arrived
+func waitForEventsUntil(t *testing.T, resp *http.Response, want string, done func([]SSEEvent) bool, timeout time.Duration) []SSEEvent {
 	var events []SSEEvent
 	eventChan := make(chan SSEEvent, 10)
 
@@ -278,28 +362,28 @@ func waitForEvents(t *testing.T, resp *http.Response, expectedMinEvents int, tim
 		case event, ok := <-eventChan:
 			if !ok {
 				// Channel closed
-				if len(events) >= expectedMinEvents {
+				if done(events) {
 					return events
 				}
-				t.Fatalf("Event stream closed, got %d events, expected at least %d", len(events), expectedMinEvents)
+				t.Fatalf("Event stream closed, got %d events, waiting for %s", len(events), want)
 				return events
 			}
 			events = append(events, event)
 
 			// Return early if we have enough events
-			if len(events) >= expectedMinEvents {
+			if done(events) {
 				return events
 			}
 
 		case <-ctx.Done():
-			t.Logf("Timeout reached, got %d events, expected at least %d", len(events), expectedMinEvents)
+			t.Logf("Timeout reached, got %d events, waiting for %s", len(events), want)
 			for i, event := range events {
 				t.Logf("Event %d: type=%s, data=%v", i, event.Type, event.Data)
 			}
-			if len(events) >= expectedMinEvents {
+			if done(events) {
 				return events
 			}
-			t.Fatalf("Timeout waiting for %d events after %v", expectedMinEvents, timeout)
+			t.Fatalf("Timeout waiting for %s after %v", want, timeout)
 			return events
 		}
 	}
@@ -408,7 +492,7 @@ func TestSSEToolExecution(t *testing.T) {
 	sendMessageToQueue(t, server.URL, sessionID, content)
 
 	// Wait for events (connected + tools + complete)
-	events := waitForEvents(t, resp, 3, 30*time.Second)
+	events := waitForCompleteEvents(t, resp, 1, 30*time.Second)
 
 	t.Logf("Tool execution test received %d events total", len(events))
 	for i, event := range events {
@@ -583,11 +667,11 @@ func TestSSESlashCommandHelp(t *testing.T) {
 	if !hasContent || content == "" {
 		t.Error("Complete event missing content field for slash command")
 	} else {
-		// Verify help content contains expected text
-		if !strings.Contains(content, "Available slash commands") {
+		// Verify help content is the command list
+		if !strings.Contains(content, `"type":"help"`) {
 			t.Errorf("Help content doesn't contain expected text, got: %s", content)
 		}
-		if !strings.Contains(content, "/help") {
+		if !strings.Contains(content, `"usage":"/help"`) {
 			t.Errorf("Help content doesn't list /help command, got: %s", content)
 		}
 	}
@@ -650,7 +734,7 @@ func TestMultipleMessages(t *testing.T) {
 	sendMessageToQueue(t, server.URL, sessionID, "Second message")
 
 	// Wait for all events (connected + 2 complete events)
-	allEvents := waitForEvents(t, resp, 3, 30*time.Second)
+	allEvents := waitForCompleteEvents(t, resp, 2, 30*time.Second)
 
 	if len(allEvents) < 3 {
 		t.Fatalf("Expected at least 3 events (connected + 2 complete), got %d", len(allEvents))
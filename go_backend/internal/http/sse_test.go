@@ -0,0 +1,844 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"mix/internal/api"
+	"mix/internal/app"
+	"mix/internal/config"
+	"mix/internal/db"
+	"mix/internal/llm/agent"
+	"mix/internal/llm/models"
+	"mix/internal/llm/provider"
+	"mix/internal/message"
+	"mix/internal/session"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestApp returns an app with sessions and messages backed by a fresh database
+func newTestApp(t *testing.T) *app.App {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, db.SetupTestDatabase(conn))
+
+	queries := db.New(conn)
+	return &app.App{
+		Sessions: session.NewService(queries),
+		Messages: message.NewService(queries),
+	}
+}
+
+func newTestConnection(sessionID string) *Connection {
+	return &Connection{
+		SessionID: sessionID,
+		Messages:  make(chan string, 100),
+		Done:      make(chan struct{}),
+	}
+}
+
+func TestConnectionRegistry_PauseResume(t *testing.T) {
+	r := newConnectionRegistry()
+	conn := newTestConnection("session")
+	require.NoError(t, r.Register("session", conn))
+	broadcast := func(sessionID, message string) bool {
+		delivery, err := r.Broadcast(sessionID, message)
+		require.NoError(t, err)
+		return delivery.Buffered
+	}
+
+	assert.False(t, broadcast("session", "before pause"))
+	assert.Equal(t, []string{"before pause"}, drainMessages(conn))
+
+	r.Pause("session")
+	r.Pause("session") // pausing twice keeps the buffer
+	assert.True(t, r.IsPaused("session"))
+	assert.True(t, broadcast("session", "first"))
+	assert.True(t, broadcast("session", "second"))
+	assert.Empty(t, drainMessages(conn), "messages must not be delivered while paused")
+
+	// Other sessions are unaffected
+	other := newTestConnection("other")
+	require.NoError(t, r.Register("other", other))
+	assert.False(t, broadcast("other", "hello"))
+	assert.Equal(t, []string{"hello"}, drainMessages(other))
+
+	assert.Equal(t, 2, r.Resume("session"))
+	assert.False(t, r.IsPaused("session"))
+	assert.Equal(t, []string{"first", "second"}, drainMessages(conn))
+
+	assert.False(t, broadcast("session", "after resume"))
+	assert.Equal(t, []string{"after resume"}, drainMessages(conn))
+	assert.Equal(t, 0, r.Resume("session"))
+}
+
+func TestConnectionRegistry_PartialDelivery(t *testing.T) {
+	r := newConnectionRegistry()
+	reading := newTestConnection("session")
+	// Nothing reads this queue, so every message waits out broadcastTimeout
+	stuck := &Connection{SessionID: "session", Messages: make(chan string), Done: make(chan struct{})}
+	require.NoError(t, r.Register("session", reading))
+	require.NoError(t, r.Register("session", stuck))
+	other := newTestConnection("other")
+	require.NoError(t, r.Register("other", other))
+
+	type result struct {
+		delivery Delivery
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		delivery, err := r.Broadcast("session", "hello")
+		done <- result{delivery, err}
+	}()
+
+	// The registry isn't locked while the broadcast waits for the stuck connection
+	require.Eventually(t, func() bool { return len(reading.Messages) == 1 }, time.Second, time.Millisecond)
+	_, err := r.Broadcast("other", "meanwhile")
+	require.NoError(t, err)
+	r.Pause("session")
+	assert.True(t, r.IsPaused("session"))
+	select {
+	case <-done:
+		t.Fatal("the broadcast should still be waiting for the stuck connection")
+	default:
+	}
+	assert.Equal(t, []string{"meanwhile"}, drainMessages(other))
+
+	// Delivered to one connection, so it is not reported as failed and must not be resent
+	res := <-done
+	require.NoError(t, res.err)
+	assert.Equal(t, Delivery{Delivered: 1, Failed: 1}, res.delivery)
+	assert.Equal(t, []string{"hello"}, drainMessages(reading))
+
+	// Resuming doesn't hold the lock while buffered messages wait either
+	_, err = r.Broadcast("session", "buffered")
+	require.NoError(t, err)
+	flushed := make(chan int, 1)
+	go func() { flushed <- r.Resume("session") }()
+	require.Eventually(t, func() bool { return len(reading.Messages) == 1 }, time.Second, time.Millisecond)
+	delivery, err := r.Broadcast("session", "during resume")
+	require.NoError(t, err)
+	assert.True(t, delivery.Buffered, "messages sent while resuming queue behind the buffered ones")
+	_, err = r.Broadcast("other", "meanwhile")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"meanwhile"}, drainMessages(other))
+
+	assert.Equal(t, 2, <-flushed)
+	assert.False(t, r.IsPaused("session"))
+	assert.Equal(t, []string{"buffered", "during resume"}, drainMessages(reading))
+}
+
+func TestConnectionRegistry_BroadcastDuringDisconnect(t *testing.T) {
+	r := newConnectionRegistry()
+	// Nothing reads this queue, so the broadcast is still waiting when it disconnects
+	conn := &Connection{SessionID: "session", Messages: make(chan string), Done: make(chan struct{})}
+	require.NoError(t, r.Register("session", conn))
+
+	type result struct {
+		delivery Delivery
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		delivery, err := r.Broadcast("session", "hello")
+		done <- result{delivery, err}
+	}()
+
+	// Tear down like the stream handlers do while the broadcast holds the connection
+	time.Sleep(10 * time.Millisecond)
+	r.Unregister("session", conn)
+	close(conn.Done)
+
+	res := <-done
+	require.NoError(t, res.err)
+	assert.Equal(t, Delivery{}, res.delivery)
+
+	// Later broadcasts find no connection
+	delivery, err := r.Broadcast("session", "after")
+	require.NoError(t, err)
+	assert.Equal(t, Delivery{}, delivery)
+}
+
+func TestHandlePauseResumeSession(t *testing.T) {
+	sessionID := "pause-resume-session"
+	conn := newTestConnection(sessionID)
+	require.NoError(t, registry.Register(sessionID, conn))
+	defer registry.Unregister(sessionID, conn)
+
+	post := func(handler http.HandlerFunc, path, body string) map[string]interface{} {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		return response
+	}
+
+	response := post(HandlePauseSession, "/stream/"+sessionID+"/pause", "")
+	assert.Equal(t, "paused", response["status"])
+
+	response = post(HandleMessageQueue, "/stream/"+sessionID+"/message", `{"content": "queued while paused"}`)
+	assert.Equal(t, "buffered", response["status"])
+	assert.Empty(t, drainMessages(conn))
+
+	response = post(HandleResumeSession, "/stream/"+sessionID+"/resume", "")
+	assert.Equal(t, "resumed", response["status"])
+	assert.Equal(t, float64(1), response["flushed"])
+	assert.Equal(t, []string{"queued while paused"}, drainMessages(conn))
+
+	response = post(HandleMessageQueue, "/stream/"+sessionID+"/message", `{"content": "live"}`)
+	assert.Equal(t, "broadcasted", response["status"])
+	assert.Equal(t, []string{"live"}, drainMessages(conn))
+}
+
+func TestConnectionRegistry_Limits(t *testing.T) {
+	r := newConnectionRegistry()
+	r.maxPerSession = 2
+	r.maxTotal = 3
+
+	first := newTestConnection("a")
+	require.NoError(t, r.Register("a", first))
+	require.NoError(t, r.Register("a", newTestConnection("a")))
+	assert.ErrorIs(t, r.Register("a", newTestConnection("a")), ErrTooManyConnections)
+
+	require.NoError(t, r.Register("b", newTestConnection("b")))
+	assert.ErrorIs(t, r.Register("c", newTestConnection("c")), ErrTooManyConnections)
+
+	// Closing a connection frees its slot
+	r.Unregister("a", first)
+	assert.NoError(t, r.Register("c", newTestConnection("c")))
+}
+
+func TestHandleMessageQueue_FullQueue(t *testing.T) {
+	sessionID := "full-queue-session"
+	conn := &Connection{SessionID: sessionID, Messages: make(chan string, 1), Done: make(chan struct{})}
+	require.NoError(t, registry.Register(sessionID, conn))
+	defer registry.Unregister(sessionID, conn)
+
+	post := func(content string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		body := strings.NewReader(`{"content": "` + content + `"}`)
+		HandleMessageQueue(recorder, httptest.NewRequest(http.MethodPost, "/stream/"+sessionID+"/message", body))
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, post("first").Code)
+
+	// Nothing reads the queue, so the second message cannot be delivered
+	recorder := post("second")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrQueueFull.Error())
+	assert.Equal(t, []string{"first"}, drainMessages(conn))
+
+	assert.Equal(t, http.StatusOK, post("third").Code)
+	assert.Equal(t, []string{"third"}, drainMessages(conn))
+}
+
+// recordingWriter keeps the events written to it
+type recordingWriter struct {
+	types  []string
+	events []interface{}
+}
+
+func (w *recordingWriter) WriteEvent(eventType string, data interface{}) error {
+	w.types = append(w.types, eventType)
+	w.events = append(w.events, data)
+	return nil
+}
+
+func (w *recordingWriter) Flush() {}
+
+func TestWriteAgentEvent_Cancelled(t *testing.T) {
+	partial := message.Message{
+		ID:    "msg-1",
+		Role:  message.Assistant,
+		Parts: []message.ContentPart{message.TextContent{Text: "Half an answer"}},
+	}
+
+	t.Run("with partial content", func(t *testing.T) {
+		w := &recordingWriter{}
+		require.NoError(t, WriteAgentEvent(w, agent.AgentEvent{
+			Type:    agent.AgentEventTypeError,
+			Error:   agent.ErrRequestCancelled,
+			Message: partial,
+			Done:    true,
+		}))
+		assert.Equal(t, []string{"complete"}, w.types)
+		assert.Equal(t, CompleteEvent{Type: "complete", Content: "Half an answer", MessageID: "msg-1", Done: true, Canceled: true}, w.events[0])
+	})
+
+	t.Run("before any message", func(t *testing.T) {
+		w := &recordingWriter{}
+		require.NoError(t, WriteAgentEvent(w, agent.AgentEvent{Type: agent.AgentEventTypeError, Error: agent.ErrRequestCancelled}))
+		assert.Equal(t, []string{"error"}, w.types)
+	})
+}
+
+func TestWriteAgentEvent_ErrorGuidance(t *testing.T) {
+	w := &recordingWriter{}
+	require.NoError(t, WriteAgentEvent(w, agent.AgentEvent{
+		Type:  agent.AgentEventTypeError,
+		Error: errors.New("maximum retry attempts reached for rate limit: 9 retries"),
+	}))
+	require.Equal(t, []string{"error"}, w.types)
+	event := w.events[0].(ErrorEvent)
+	assert.Equal(t, "rate_limit", event.Category)
+	assert.Equal(t, provider.ErrorCategoryRateLimit.Guidance(), event.Guidance)
+}
+
+// flakyAgent fails its first runs with the given errors, then answers "done"
+type flakyAgent struct {
+	agent.Service
+	messages message.Service
+	failures []error
+	runs     int
+}
+
+func (a *flakyAgent) RunWithPlanMode(ctx context.Context, sessionID string, content string, planMode bool, attachments ...message.Attachment) (<-chan agent.AgentEvent, error) {
+	a.runs++
+	if _, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: content}}}); err != nil {
+		return nil, err
+	}
+
+	events := make(chan agent.AgentEvent, 1)
+	if a.runs <= len(a.failures) {
+		events <- agent.AgentEvent{Type: agent.AgentEventTypeError, Error: a.failures[a.runs-1], SessionID: sessionID, Done: true}
+	} else {
+		reply, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{Role: message.Assistant, Parts: []message.ContentPart{message.TextContent{Text: "done"}}})
+		if err != nil {
+			return nil, err
+		}
+		events <- agent.AgentEvent{Type: agent.AgentEventTypeResponse, Message: reply, SessionID: sessionID, Done: true}
+	}
+	close(events)
+	return events, nil
+}
+
+func (a *flakyAgent) IsSessionBusy(sessionID string) bool { return false }
+
+func (a *flakyAgent) Cancel(sessionID string) {}
+
+func TestHandleRegularMessage_Retry(t *testing.T) {
+	cfg := config.Get()
+	original := cfg.MessageRetry
+	cfg.MessageRetry = config.MessageRetryConfig{MaxRetries: 2, InitialDelayMs: 1}
+	t.Cleanup(func() { cfg.MessageRetry = original })
+
+	setup := func(t *testing.T, failures ...error) (*api.QueryHandler, *flakyAgent, string) {
+		testApp := newTestApp(t)
+		flaky := &flakyAgent{messages: testApp.Messages, failures: failures}
+		testApp.CoderAgent = flaky
+		sess, err := testApp.Sessions.Create(context.Background(), "retry")
+		require.NoError(t, err)
+		return api.NewQueryHandler(testApp), flaky, sess.ID
+	}
+
+	t.Run("transient failure then success", func(t *testing.T) {
+		dropped := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+		handler, flaky, sessionID := setup(t, fmt.Errorf("failed to process events: %w", dropped))
+		w := &recordingWriter{}
+		require.NoError(t, handleRegularMessage(context.Background(), handler, w, sessionID, `{"text": "hello"}`))
+
+		assert.Equal(t, 2, flaky.runs)
+		assert.Equal(t, []string{"status", "complete"}, w.types)
+		status := w.events[0].(StatusEvent)
+		assert.Equal(t, 1, status.Attempt)
+		assert.Equal(t, 2, status.MaxAttempts)
+		assert.Equal(t, "done", w.events[1].(CompleteEvent).Content)
+
+		// The failed attempt's user message is dropped before the retry
+		stored, err := handler.GetApp().Messages.List(context.Background(), sessionID)
+		require.NoError(t, err)
+		require.Len(t, stored, 2)
+		assert.Equal(t, message.User, stored[0].Role)
+		assert.Equal(t, message.Assistant, stored[1].Role)
+	})
+
+	t.Run("non-retryable failure", func(t *testing.T) {
+		handler, flaky, sessionID := setup(t, errors.New("invalid request: unknown model"))
+		w := &recordingWriter{}
+		require.NoError(t, handleRegularMessage(context.Background(), handler, w, sessionID, `{"text": "hello"}`))
+
+		assert.Equal(t, 1, flaky.runs)
+		assert.Equal(t, []string{"error"}, w.types)
+	})
+
+	t.Run("rate limit the provider already retried", func(t *testing.T) {
+		handler, flaky, sessionID := setup(t, fmt.Errorf("failed to process events: %w: 8 retries", provider.ErrMaxRetries))
+		w := &recordingWriter{}
+		require.NoError(t, handleRegularMessage(context.Background(), handler, w, sessionID, `{"text": "hello"}`))
+
+		assert.Equal(t, 1, flaky.runs)
+		assert.Equal(t, []string{"error"}, w.types)
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		unavailable := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		handler, flaky, sessionID := setup(t, unavailable, unavailable, unavailable)
+		w := &recordingWriter{}
+		require.NoError(t, handleRegularMessage(context.Background(), handler, w, sessionID, `{"text": "hello"}`))
+
+		assert.Equal(t, 3, flaky.runs)
+		assert.Equal(t, []string{"status", "status", "error"}, w.types)
+	})
+}
+
+func TestHandleRegularMessage_MessageLimit(t *testing.T) {
+	cfg := config.Get()
+	original := cfg.MessageLimit
+	t.Cleanup(func() { cfg.MessageLimit = original })
+
+	testApp := newTestApp(t)
+	flaky := &flakyAgent{messages: testApp.Messages}
+	testApp.CoderAgent = flaky
+	sess, err := testApp.Sessions.Create(context.Background(), "limit")
+	require.NoError(t, err)
+	handler := api.NewQueryHandler(testApp)
+
+	content := `{"text": "this message is too long", "plan_mode": true}`
+
+	t.Run("reject", func(t *testing.T) {
+		cfg.MessageLimit = config.MessageLimitConfig{MaxLength: 10, Policy: config.MessageLimitReject}
+		w := &recordingWriter{}
+		require.NoError(t, handleRegularMessage(context.Background(), handler, w, sess.ID, content))
+
+		assert.Equal(t, 0, flaky.runs)
+		require.Equal(t, []string{"error"}, w.types)
+		assert.Contains(t, w.events[0].(ErrorEvent).Error, "24 characters, the maximum is 10")
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		cfg.MessageLimit = config.MessageLimitConfig{MaxLength: 10, Policy: config.MessageLimitTruncate}
+		w := &recordingWriter{}
+		require.NoError(t, handleRegularMessage(context.Background(), handler, w, sess.ID, content))
+		assert.Equal(t, []string{"complete"}, w.types)
+
+		// The stored message is still an envelope clients can parse
+		stored, err := testApp.Messages.List(context.Background(), sess.ID)
+		require.NoError(t, err)
+		require.NotEmpty(t, stored)
+		var envelope MessageContent
+		require.NoError(t, json.Unmarshal([]byte(stored[0].Content().Text), &envelope))
+		assert.Equal(t, MessageContent{Text: "this messa", PlanMode: true}, envelope)
+	})
+}
+
+func TestProcessMessage_PromptTemplate(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	promptsDir := filepath.Join(home, ".mix", "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "review.md"), []byte("Review {{file}} carefully.\n"), 0o644))
+
+	testApp := newTestApp(t)
+	flaky := &flakyAgent{messages: testApp.Messages}
+	testApp.CoderAgent = flaky
+	sess, err := testApp.Sessions.Create(context.Background(), "prompt")
+	require.NoError(t, err)
+
+	w := &recordingWriter{}
+	require.NoError(t, processMessage(context.Background(), api.NewQueryHandler(testApp), w, sess.ID, `{"text": "/prompt review file=agent.go"}`))
+	assert.Equal(t, []string{"complete"}, w.types)
+
+	// The expanded template is sent to the agent as the user's message
+	assert.Equal(t, 1, flaky.runs)
+	stored, err := testApp.Messages.List(context.Background(), sess.ID)
+	require.NoError(t, err)
+	require.NotEmpty(t, stored)
+	assert.Equal(t, "Review agent.go carefully.", extractText(stored[0].Content().Text))
+}
+
+func TestProcessMessage_MalformedContent(t *testing.T) {
+	testApp := newTestApp(t)
+
+	// The client gets an error event and the stream stays open for its next message
+	w := &recordingWriter{}
+	require.NoError(t, processMessage(context.Background(), api.NewQueryHandler(testApp), w, "session", "not json"))
+	require.Equal(t, []string{"error"}, w.types)
+	assert.Contains(t, w.events[0].(ErrorEvent).Error, "failed to parse message content")
+}
+
+// stallingAgent sends its events, each after its delay. With stall set it then hangs
+// like a deadlocked run, ignoring Cancel.
+type stallingAgent struct {
+	agent.Service
+	events    []agent.AgentEvent
+	delays    []time.Duration
+	stall     bool
+	cancelled chan struct{}
+}
+
+func (a *stallingAgent) RunWithPlanMode(ctx context.Context, sessionID string, content string, planMode bool, attachments ...message.Attachment) (<-chan agent.AgentEvent, error) {
+	events := make(chan agent.AgentEvent)
+	go func() {
+		for i, event := range a.events {
+			if i < len(a.delays) {
+				time.Sleep(a.delays[i])
+			}
+			events <- event
+		}
+		if !a.stall {
+			close(events)
+		}
+	}()
+	return events, nil
+}
+
+func (a *stallingAgent) IsSessionBusy(sessionID string) bool { return false }
+
+func (a *stallingAgent) Cancel(sessionID string) { close(a.cancelled) }
+
+func TestStreamAgentResponse_Watchdog(t *testing.T) {
+	cfg := config.Get()
+	original := cfg.RunWatchdog
+	cfg.RunWatchdog = config.RunWatchdogConfig{StallTimeoutMs: 100, ToolTimeoutMs: 2000}
+	t.Cleanup(func() { cfg.RunWatchdog = original })
+
+	run := func(t *testing.T, coder *stallingAgent) *recordingWriter {
+		coder.cancelled = make(chan struct{})
+		testApp := newTestApp(t)
+		testApp.CoderAgent = coder
+		handler := api.NewQueryHandler(testApp)
+		w := &recordingWriter{}
+		done := make(chan error, 1)
+		go func() {
+			_, err := streamAgentResponse(context.Background(), handler, w, "session-1", "hello", false, nil, false)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the stream should not hang")
+		}
+		return w
+	}
+
+	t.Run("stalled run", func(t *testing.T) {
+		coder := &stallingAgent{
+			events: []agent.AgentEvent{{Type: agent.AgentEventTypeTokens, Tokens: &agent.TokenCount{OutputTokens: 12, Estimated: true}}},
+			stall:  true,
+		}
+		w := run(t, coder)
+
+		assert.Equal(t, []string{"status", "error"}, w.types)
+		event := w.events[1].(ErrorEvent)
+		assert.Equal(t, ErrRunStalled.Error(), event.Error)
+		assert.Equal(t, "stalled", event.Category)
+		select {
+		case <-coder.cancelled:
+		default:
+			t.Error("the stalled run should be cancelled")
+		}
+	})
+
+	t.Run("slow tool", func(t *testing.T) {
+		toolCall := message.Message{ID: "msg-1", Role: message.Assistant, Parts: []message.ContentPart{
+			message.ToolCall{ID: "call-1", Name: "bash", Input: `{"command": "make"}`, Finished: true},
+		}}
+		reply := message.Message{ID: "msg-2", Role: message.Assistant, Parts: []message.ContentPart{message.TextContent{Text: "Built"}}}
+		// The tool result comes after longer than the stall timeout
+		coder := &stallingAgent{
+			events: []agent.AgentEvent{
+				{Type: agent.AgentEventTypeResponse, Message: toolCall},
+				{Type: agent.AgentEventTypeTokens, Tokens: &agent.TokenCount{InputTokens: 900, OutputTokens: 40}},
+				{Type: agent.AgentEventTypeResponse, Message: toolCall},
+				{Type: agent.AgentEventTypeResponse, Message: reply, Done: true},
+			},
+			delays: []time.Duration{0, 0, 300 * time.Millisecond},
+		}
+		w := run(t, coder)
+
+		assert.Equal(t, []string{"tool", "status", "tool", "complete"}, w.types)
+		select {
+		case <-coder.cancelled:
+			t.Error("a run waiting for a tool should not be cancelled")
+		default:
+		}
+	})
+}
+
+// backloggedAgent stalls until it is cancelled, then sends more events than its channel
+// buffers before finishing the run, like the agent's event forwarder
+type backloggedAgent struct {
+	agent.Service
+	busy      atomic.Bool
+	cancelled chan struct{}
+}
+
+func (a *backloggedAgent) RunWithPlanMode(ctx context.Context, sessionID string, content string, planMode bool, attachments ...message.Attachment) (<-chan agent.AgentEvent, error) {
+	a.busy.Store(true)
+	events := make(chan agent.AgentEvent, 10)
+	go func() {
+		defer a.busy.Store(false)
+		defer close(events)
+		<-a.cancelled
+		for i := 0; i < 20; i++ {
+			events <- agent.AgentEvent{Type: agent.AgentEventTypeTokens, Tokens: &agent.TokenCount{OutputTokens: int64(i)}}
+		}
+		events <- agent.AgentEvent{Type: agent.AgentEventTypeError, Error: agent.ErrRequestCancelled, Done: true}
+	}()
+	return events, nil
+}
+
+func (a *backloggedAgent) IsSessionBusy(sessionID string) bool { return a.busy.Load() }
+
+func (a *backloggedAgent) Cancel(sessionID string) { close(a.cancelled) }
+
+func TestStreamAgentResponse_StalledRunFinishes(t *testing.T) {
+	cfg := config.Get()
+	original := cfg.RunWatchdog
+	cfg.RunWatchdog = config.RunWatchdogConfig{StallTimeoutMs: 50, ToolTimeoutMs: 2000}
+	t.Cleanup(func() { cfg.RunWatchdog = original })
+
+	coder := &backloggedAgent{cancelled: make(chan struct{})}
+	testApp := newTestApp(t)
+	testApp.CoderAgent = coder
+	w := &recordingWriter{}
+	_, err := streamAgentResponse(context.Background(), api.NewQueryHandler(testApp), w, "session-1", "hello", false, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"error"}, w.types)
+
+	// The run's events after the stall are drained, so it ends and frees the session
+	assert.Eventually(t, func() bool { return !testApp.IsSessionBusy("session-1") }, 2*time.Second, 10*time.Millisecond)
+}
+
+// blockingAgent runs turns that last until release is closed or the turn is cancelled
+type blockingAgent struct {
+	agent.Service
+	started   chan struct{}
+	release   chan struct{}
+	cancelled chan struct{}
+	cancel    sync.Once
+	runs      int
+}
+
+func newBlockingAgent() *blockingAgent {
+	return &blockingAgent{started: make(chan struct{}, 2), release: make(chan struct{}), cancelled: make(chan struct{})}
+}
+
+func (a *blockingAgent) RunWithPlanMode(ctx context.Context, sessionID string, content string, planMode bool, attachments ...message.Attachment) (<-chan agent.AgentEvent, error) {
+	a.runs++
+	events := make(chan agent.AgentEvent)
+	go func() {
+		defer close(events)
+		a.started <- struct{}{}
+		select {
+		case <-a.release:
+		case <-ctx.Done():
+		case <-a.cancelled:
+			partial := message.Message{ID: "partial", Role: message.Assistant, Parts: []message.ContentPart{message.TextContent{Text: "half an answer"}}}
+			events <- agent.AgentEvent{Type: agent.AgentEventTypeError, Error: agent.ErrRequestCancelled, Message: partial, SessionID: sessionID, Done: true}
+		}
+	}()
+	return events, nil
+}
+
+// IsSessionBusy is false: the session is reserved by the app while the turn runs
+func (a *blockingAgent) IsSessionBusy(sessionID string) bool { return false }
+
+func (a *blockingAgent) Cancel(sessionID string) {
+	a.cancel.Do(func() { close(a.cancelled) })
+}
+
+func (a *blockingAgent) Model() models.Model {
+	return models.Model{ID: "test", Name: "Test Model", ContextWindow: 200000}
+}
+
+func (a *blockingAgent) ContextTokens(ctx context.Context, sessionID string) (agent.ContextTokens, error) {
+	return agent.ContextTokens{SystemPrompt: 1000, Estimated: true}, nil
+}
+
+func TestStreamSession_CommandDuringTurn(t *testing.T) {
+	blocking := newBlockingAgent()
+	testApp := newTestApp(t)
+	testApp.CoderAgent = blocking
+	sess, err := testApp.Sessions.Create(context.Background(), "busy")
+	require.NoError(t, err)
+	require.NoError(t, testApp.SetCurrentSession(sess.ID))
+
+	w := &recordingWriter{}
+	stream := newStreamSession(context.Background(), api.NewQueryHandler(testApp), w, sess.ID)
+	t.Cleanup(stream.close)
+
+	require.NoError(t, stream.handle(`{"text": "hello"}`))
+	<-blocking.started
+
+	// The command is answered while the turn is still running
+	require.NoError(t, stream.handle(`{"text": "/context"}`))
+	require.Equal(t, []string{"complete"}, w.types)
+	assert.Contains(t, w.events[0].(CompleteEvent).Content, "Test Model")
+
+	// A second agent message and a shell command wait for the turn
+	require.NoError(t, stream.handle(`{"text": "again"}`))
+	require.NoError(t, stream.handle(`{"text": "!echo queued"}`))
+	assert.Equal(t, 1, blocking.runs)
+	assert.Len(t, w.types, 1)
+
+	close(blocking.release)
+	require.NoError(t, stream.finishTurn(<-stream.turnFinished()))
+	<-blocking.started
+	require.NoError(t, stream.finishTurn(<-stream.turnFinished()))
+	require.NoError(t, stream.finishTurn(<-stream.turnFinished()))
+
+	assert.Equal(t, 2, blocking.runs)
+	assert.Equal(t, []string{"complete", "complete", "complete", "complete"}, w.types)
+	assert.Equal(t, "queued\n", w.events[3].(CompleteEvent).Content)
+	assert.Nil(t, stream.turnFinished())
+}
+
+func TestRunsDuringTurn(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected bool
+	}{
+		{"/help", true},
+		{"/", true},
+		{"/context", true},
+		{"/stats", true},
+		{"/whoami", true},
+		{"/files", true},
+		{"/session 1234", false},
+		{"/clear --hard", false},
+		{"/reasoning high", false},
+		{"/mcp", false},
+		{"/agents", false},
+		{"!ls", false},
+		{"hello", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			content, err := json.Marshal(MessageContent{Text: tt.text})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, runsDuringTurn(string(content)))
+		})
+	}
+}
+
+func TestWriteAgentEvent_Usage(t *testing.T) {
+	reply := message.Message{
+		ID:    "msg-1",
+		Role:  message.Assistant,
+		Parts: []message.ContentPart{message.TextContent{Text: "done"}, message.Finish{Reason: message.FinishReasonEndTurn}},
+	}
+	w := &recordingWriter{}
+	require.NoError(t, WriteAgentEvent(w, agent.AgentEvent{
+		Type:    agent.AgentEventTypeResponse,
+		Message: reply,
+		Done:    true,
+		Usage:   &agent.TurnUsage{InputTokens: 1200, OutputTokens: 300, CacheCreationTokens: 40, CacheReadTokens: 800, ReasoningTokens: 25, Cost: 0.0123},
+	}))
+
+	require.Equal(t, []string{"usage", "complete"}, w.types)
+	assert.Equal(t, UsageEvent{
+		Type:                "usage",
+		InputTokens:         1200,
+		OutputTokens:        300,
+		CacheCreationTokens: 40,
+		CacheReadTokens:     800,
+		ReasoningTokens:     25,
+		Cost:                0.0123,
+	}, w.events[0])
+
+	// Intermediate events carry no usage
+	w = &recordingWriter{}
+	require.NoError(t, WriteAgentEvent(w, agent.AgentEvent{Type: agent.AgentEventTypeResponse, Message: reply}))
+	assert.NotContains(t, w.types, "usage")
+}
+
+func TestHandleSSEStream_Shutdown(t *testing.T) {
+	original := registry
+	registry = newConnectionRegistry()
+	t.Cleanup(func() { registry = original })
+
+	blocking := newBlockingAgent()
+	testApp := newTestApp(t)
+	testApp.CoderAgent = blocking
+	sess, err := testApp.Sessions.Create(context.Background(), "shutdown")
+	require.NoError(t, err)
+	handler := api.NewQueryHandler(testApp)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleSSEStream(context.Background(), handler, w, r)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream?sessionId=" + sess.ID)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// readEvent returns the next event name and data on the stream
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() (string, string) {
+		var name, data string
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			case line == "" && name != "":
+				return name, data
+			}
+		}
+	}
+	name, _ := readEvent()
+	require.Equal(t, "connected", name)
+
+	// One message runs, the other waits in the queue
+	_, err = registry.Broadcast(sess.ID, `{"text": "first"}`)
+	require.NoError(t, err)
+	<-blocking.started
+	_, err = registry.Broadcast(sess.ID, `{"text": "second"}`)
+	require.NoError(t, err)
+
+	require.NoError(t, registry.Shutdown(context.Background()))
+
+	// The running turn completes with its partial response, then the stream ends with an error
+	name, data := readEvent()
+	require.Equal(t, "complete", name)
+	var complete CompleteEvent
+	require.NoError(t, json.Unmarshal([]byte(data), &complete))
+	assert.True(t, complete.Canceled)
+	assert.Equal(t, "half an answer", complete.Content)
+
+	name, data = readEvent()
+	require.Equal(t, "error", name)
+	var shutdown ErrorEvent
+	require.NoError(t, json.Unmarshal([]byte(data), &shutdown))
+	assert.Equal(t, "shutdown", shutdown.Category)
+	assert.Equal(t, "Server is shutting down; 1 queued message(s) were not processed", shutdown.Error)
+
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF, "the stream is closed")
+	assert.Equal(t, 1, blocking.runs)
+
+	// New connections and messages are refused
+	assert.ErrorIs(t, registry.Register(sess.ID, newTestConnection(sess.ID)), ErrShuttingDown)
+	_, err = registry.Broadcast(sess.ID, `{"text": "third"}`)
+	assert.ErrorIs(t, err, ErrShuttingDown)
+}
@@ -0,0 +1,164 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"mix/internal/api"
+	"mix/internal/commands"
+)
+
+// shutdownTurnTimeout is how long a shutdown waits for a cancelled turn to finish
+const shutdownTurnTimeout = 5 * time.Second
+
+// lockedWriter serializes writes from the turn goroutine and the connection loop
+type lockedWriter struct {
+	mu     sync.Mutex
+	events EventWriter
+}
+
+func (l *lockedWriter) WriteEvent(eventType string, data interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.events.WriteEvent(eventType, data)
+}
+
+func (l *lockedWriter) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events.Flush()
+}
+
+// streamSession runs agent turns for one stream connection in the background, so slash
+// and shell commands can be answered while a turn is in progress. Agent messages that
+// arrive during a turn wait for it to finish and run in order.
+type streamSession struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	handler   *api.QueryHandler
+	events    EventWriter
+	sessionID string
+
+	pending  []string
+	turnDone chan error // nil while no turn is running
+	wg       sync.WaitGroup
+}
+
+func newStreamSession(ctx context.Context, handler *api.QueryHandler, events EventWriter, sessionID string) *streamSession {
+	ctx, cancel := context.WithCancel(ctx)
+	return &streamSession{
+		ctx:       ctx,
+		cancel:    cancel,
+		handler:   handler,
+		events:    &lockedWriter{events: events},
+		sessionID: sessionID,
+	}
+}
+
+// handle answers read-only commands right away and queues everything else behind the
+// running turn
+func (s *streamSession) handle(content string) error {
+	if runsDuringTurn(content) {
+		return processMessage(s.ctx, s.handler, s.events, s.sessionID, content)
+	}
+	s.pending = append(s.pending, content)
+	if s.turnDone == nil {
+		s.startTurn()
+	}
+	return nil
+}
+
+// turnFinished returns the running turn's result channel, or nil (never ready) when idle
+func (s *streamSession) turnFinished() <-chan error {
+	return s.turnDone
+}
+
+// finishTurn records the end of a turn and starts the next queued message
+func (s *streamSession) finishTurn(err error) error {
+	s.turnDone = nil
+	if err != nil {
+		return err
+	}
+	if len(s.pending) > 0 {
+		s.startTurn()
+	}
+	return nil
+}
+
+func (s *streamSession) startTurn() {
+	content := s.pending[0]
+	s.pending = s.pending[1:]
+
+	done := make(chan error, 1)
+	s.turnDone = done
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		done <- processMessage(s.ctx, s.handler, s.events, s.sessionID, content)
+	}()
+}
+
+// shutdown ends the session because the server is shutting down. The running turn is
+// cancelled so it can send its partial response, then the client is told how many
+// queued messages were dropped.
+func (s *streamSession) shutdown(conn *Connection) {
+	if s.turnDone != nil {
+		s.handler.GetApp().CoderAgent.Cancel(s.sessionID)
+		select {
+		case <-s.turnDone:
+		case <-time.After(shutdownTurnTimeout):
+		}
+		s.turnDone = nil
+	}
+
+	dropped := len(s.pending) + len(drainMessages(conn))
+	s.pending = nil
+	message := "Server is shutting down"
+	if dropped > 0 {
+		message += fmt.Sprintf("; %d queued message(s) were not processed", dropped)
+	}
+	s.events.WriteEvent("error", ErrorEvent{Error: message, Category: "shutdown"})
+	s.events.Flush()
+}
+
+// close stops the running turn and waits for it to return
+func (s *streamSession) close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// readOnlyCommands only report on the session, so they can run alongside a turn. The
+// empty name is a bare /, which lists the commands like /help.
+var readOnlyCommands = []string{"", "help", "context", "stats", "whoami", "files"}
+
+// runsDuringTurn reports whether content can be answered while a turn is running.
+// Other commands change the session, its settings or the files the agent works on, and
+// shell commands can do anything, so they wait for the turn like agent messages.
+func runsDuringTurn(content string) bool {
+	msgContent, err := parseMessageContent(content)
+	if err != nil {
+		// Answered right away with an error event for the parse failure
+		return true
+	}
+	parsed, err := commands.ParseCommand(msgContent.Text)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(readOnlyCommands, parsed.Name)
+}
+
+// drainMessages empties a connection's queue without blocking
+func drainMessages(conn *Connection) []string {
+	var messages []string
+	for {
+		select {
+		case message := <-conn.Messages:
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"errors"
+	"time"
+
+	"mix/internal/config"
+	"mix/internal/llm/agent"
+)
+
+// ErrRunStalled is reported to clients when an agent run stops sending events
+var ErrRunStalled = errors.New("agent stopped responding")
+
+// runWatchdog expires when an agent run goes too long without an event. While tools run
+// the longer tool timeout applies: the run is treated as running tools from a response
+// whose tool calls have all streamed until the model streams again.
+type runWatchdog struct {
+	stall        time.Duration
+	tool         time.Duration
+	runningTools bool
+	timer        *time.Timer
+}
+
+func newRunWatchdog(cfg config.RunWatchdogConfig) *runWatchdog {
+	w := &runWatchdog{
+		stall: time.Duration(cfg.StallTimeoutMs) * time.Millisecond,
+		tool:  time.Duration(cfg.ToolTimeoutMs) * time.Millisecond,
+	}
+	w.reset(w.stall)
+	return w
+}
+
+// expired is ready once the run has stalled, and never while the check is disabled
+func (w *runWatchdog) expired() <-chan time.Time {
+	if w.timer == nil {
+		return nil
+	}
+	return w.timer.C
+}
+
+// progress restarts the wait after an event from the run
+func (w *runWatchdog) progress(event agent.AgentEvent) {
+	switch event.Type {
+	case agent.AgentEventTypeResponse:
+		toolCalls := event.Message.ToolCalls()
+		w.runningTools = len(toolCalls) > 0
+		for _, toolCall := range toolCalls {
+			if !toolCall.Finished {
+				w.runningTools = false
+			}
+		}
+	case agent.AgentEventTypeTokens:
+		// Estimates are only sent while a response streams
+		if event.Tokens != nil && event.Tokens.Estimated {
+			w.runningTools = false
+		}
+	case agent.AgentEventTypeRetry:
+		w.runningTools = false
+		if event.Retry != nil && w.stall > 0 {
+			w.reset(w.stall + event.Retry.Delay)
+			return
+		}
+	case agent.AgentEventTypeSummarize:
+		w.runningTools = false
+	}
+
+	if w.runningTools {
+		w.reset(w.tool)
+	} else {
+		w.reset(w.stall)
+	}
+}
+
+func (w *runWatchdog) reset(timeout time.Duration) {
+	w.stop()
+	if timeout > 0 {
+		w.timer = time.NewTimer(timeout)
+	}
+}
+
+func (w *runWatchdog) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"mix/internal/api"
+	"mix/internal/logging"
+
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	// Same open CORS policy as the SSE endpoint
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WebSocketEvent is the frame sent to WebSocket clients, mirroring an SSE event
+type WebSocketEvent struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// wsWriter writes events as JSON frames on a WebSocket connection
+type wsWriter struct {
+	conn *websocket.Conn
+}
+
+func (ws *wsWriter) WriteEvent(eventType string, data interface{}) error {
+	return ws.conn.WriteJSON(WebSocketEvent{Event: eventType, Data: data})
+}
+
+func (ws *wsWriter) Flush() {}
+
+// HandleWebSocket streams agent events over a WebSocket for clients behind proxies that break SSE.
+// Inbound text frames carry the same message content as POST /stream/{sessionId}/message.
+func HandleWebSocket(ctx context.Context, handler *api.QueryHandler, w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		http.Error(w, "Missing sessionId parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Register connection so messages posted over HTTP reach this socket too
+	conn := &Connection{
+		SessionID: sessionID,
+		Messages:  make(chan string, 100),
+		Done:      make(chan struct{}),
+	}
+	if err := registry.Register(sessionID, conn); err != nil {
+		http.Error(w, "Connection rejected: "+err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer func() {
+		// Messages is never closed: a broadcast may still hold the connection after
+		// Unregister, and sees Done instead
+		registry.Unregister(sessionID, conn)
+		close(conn.Done)
+	}()
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logging.Error("WebSocket upgrade failed", "error", err)
+		return
+	}
+	defer ws.Close()
+
+	events := &wsWriter{conn: ws}
+
+	if err := handler.GetApp().SetCurrentSession(sessionID); err != nil {
+		events.WriteEvent("error", ErrorEvent{Error: "Failed to set session: " + err.Error()})
+		return
+	}
+
+	// Read inbound frames on a separate goroutine; writes go through the stream's locked writer
+	inbound := make(chan string)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case inbound <- string(data):
+			case <-conn.Done:
+				return
+			}
+		}
+	}()
+
+	events.WriteEvent("connected", ConnectedEvent{SessionID: sessionID})
+
+	// Heartbeat to keep proxies from closing idle connections
+	heartbeat := time.NewTicker(45 * time.Second)
+	defer heartbeat.Stop()
+
+	fileChanges := subscribeFileChanges(r.Context(), handler)
+
+	// Turns run in the background so commands are answered while the agent works
+	stream := newStreamSession(ctx, handler, events, sessionID)
+	defer stream.close()
+
+	for {
+		var message string
+		select {
+		case <-readDone:
+			// Client disconnected
+			handler.GetApp().CoderAgent.Cancel(sessionID)
+			return
+
+		case <-heartbeat.C:
+			if err := stream.events.WriteEvent("heartbeat", HeartbeatEvent{Type: "ping"}); err != nil {
+				return
+			}
+			continue
+
+		case change, ok := <-fileChanges:
+			if !ok {
+				fileChanges = nil
+			} else if err := writeFileChange(stream.events, sessionID, change.Payload); err != nil {
+				return
+			}
+			continue
+
+		case err := <-stream.turnFinished():
+			if err := stream.finishTurn(err); err != nil {
+				return
+			}
+			continue
+
+		case <-registry.Closing():
+			stream.shutdown(conn)
+			return
+
+		case message = <-inbound:
+		case message = <-conn.Messages:
+		}
+
+		if err := stream.handle(message); err != nil {
+			return
+		}
+	}
+}
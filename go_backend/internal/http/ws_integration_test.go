@@ -0,0 +1,111 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// connectWebSocket opens a WebSocket connection for the session
+func connectWebSocket(t *testing.T, serverURL, sessionID string) *websocket.Conn {
+	url := fmt.Sprintf("ws%s/ws?sessionId=%s", strings.TrimPrefix(serverURL, "http"), sessionID)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to WebSocket: %v", err)
+	}
+	return conn
+}
+
+// readWebSocketEvent reads the next event frame, failing the test on timeout
+func readWebSocketEvent(t *testing.T, conn *websocket.Conn, timeout time.Duration) SSEEvent {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var frame struct {
+		Event string                 `json:"event"`
+		Data  map[string]interface{} `json:"data"`
+	}
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("Failed to read WebSocket event: %v", err)
+	}
+	return SSEEvent{Type: frame.Event, Data: frame.Data}
+}
+
+// waitForWebSocketEvent reads events until one of the given type arrives
+func waitForWebSocketEvent(t *testing.T, conn *websocket.Conn, eventType string, timeout time.Duration) SSEEvent {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		event := readWebSocketEvent(t, conn, time.Until(deadline))
+		t.Logf("WebSocket event: type=%s, data=%v", event.Type, event.Data)
+		if event.Type == eventType {
+			return event
+		}
+	}
+	t.Fatalf("Timeout waiting for %s event", eventType)
+	return SSEEvent{}
+}
+
+func messageContent(text string) string {
+	data, _ := json.Marshal(MessageContent{Text: text})
+	return string(data)
+}
+
+func TestWebSocketConnection(t *testing.T) {
+	server, _, sessionID := setupTestServer(t)
+	defer server.Close()
+
+	conn := connectWebSocket(t, server.URL, sessionID)
+	defer conn.Close()
+
+	event := readWebSocketEvent(t, conn, 5*time.Second)
+	if event.Type != "connected" {
+		t.Fatalf("Expected first event to be 'connected', got '%s'", event.Type)
+	}
+	if id, ok := event.Data["sessionId"].(string); !ok || id != sessionID {
+		t.Errorf("Expected sessionId '%s' in connected event, got '%v'", sessionID, event.Data["sessionId"])
+	}
+}
+
+func TestWebSocketSlashCommandHelp(t *testing.T) {
+	server, _, sessionID := setupTestServer(t)
+	defer server.Close()
+
+	conn := connectWebSocket(t, server.URL, sessionID)
+	defer conn.Close()
+	waitForWebSocketEvent(t, conn, "connected", 5*time.Second)
+
+	// Messages are sent inbound on the same socket
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(messageContent("/help"))); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	event := waitForWebSocketEvent(t, conn, "complete", 10*time.Second)
+	if done, ok := event.Data["done"].(bool); !ok || !done {
+		t.Error("Complete event missing or false 'done' field")
+	}
+	content, _ := event.Data["content"].(string)
+	if !strings.Contains(content, `"type":"help"`) {
+		t.Errorf("Expected help response, got: %s", content)
+	}
+}
+
+func TestWebSocketReceivesQueuedMessages(t *testing.T) {
+	server, _, sessionID := setupTestServer(t)
+	defer server.Close()
+
+	conn := connectWebSocket(t, server.URL, sessionID)
+	defer conn.Close()
+	waitForWebSocketEvent(t, conn, "connected", 5*time.Second)
+
+	// Messages posted to the HTTP queue are broadcast to WebSocket clients too
+	sendMessageToQueue(t, server.URL, sessionID, "!echo queued")
+
+	event := waitForWebSocketEvent(t, conn, "complete", 10*time.Second)
+	content, _ := event.Data["content"].(string)
+	if !strings.Contains(content, "queued") {
+		t.Errorf("Expected shell output in complete event, got: %s", content)
+	}
+}
@@ -14,6 +14,8 @@ import (
 type agentTool struct {
 	sessions session.Service
 	messages message.Service
+	// newSubAgent creates the agent that runs a dispatched task
+	newSubAgent func() (Service, error)
 }
 
 const (
@@ -27,7 +29,7 @@ type AgentParams struct {
 func (b *agentTool) Info() tools.ToolInfo {
 	return tools.ToolInfo{
 		Name:        AgentToolName,
-		Description: tools.LoadToolDescription("agent_tool"),
+		Description: tools.LoadToolDescription("sub_agent"),
 		Parameters: map[string]any{
 			"prompt": map[string]any{
 				"type":        "string",
@@ -52,12 +54,13 @@ func (b *agentTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolRes
 		return tools.ToolResponse{}, fmt.Errorf("session_id and message_id are required")
 	}
 
-	agent, err := NewAgent(config.AgentSub, b.sessions, b.messages, TaskAgentTools())
+	agent, err := b.newSubAgent()
 	if err != nil {
 		return tools.ToolResponse{}, fmt.Errorf("error creating agent: %s", err)
 	}
 
-	session, err := b.sessions.Create(ctx, "New Agent Session")
+	// The sub-agent's session is a child of the caller's, so it shows up as a dispatched task
+	session, err := b.sessions.CreateChild(ctx, sessionID, "Sub-agent task")
 	if err != nil {
 		return tools.ToolResponse{}, fmt.Errorf("error creating session: %s", err)
 	}
@@ -132,5 +135,8 @@ func NewAgentTool(
 	return &agentTool{
 		sessions: Sessions,
 		messages: Messages,
+		newSubAgent: func() (Service, error) {
+			return NewAgent(config.AgentSub, Sessions, Messages, TaskAgentTools())
+		},
 	}
 }
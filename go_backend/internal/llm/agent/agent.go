@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -24,14 +25,24 @@ import (
 var (
 	ErrRequestCancelled = errors.New("request cancelled by user")
 	ErrSessionBusy      = errors.New("session is currently processing another request")
+	// ErrRetryBudgetExhausted fails a turn whose provider calls were rate limited more
+	// often than the agent's retry budget allows
+	ErrRetryBudgetExhausted = errors.New("retry budget for the turn was used up by rate limits")
 )
 
+// defaultRetryBudget is how many rate-limit retries a turn may make across all of its
+// provider calls when the agent doesn't configure a budget
+const defaultRetryBudget = 16
+
 type AgentEventType string
 
 const (
-	AgentEventTypeError     AgentEventType = "error"
-	AgentEventTypeResponse  AgentEventType = "response"
-	AgentEventTypeSummarize AgentEventType = "summarize"
+	AgentEventTypeError        AgentEventType = "error"
+	AgentEventTypeResponse     AgentEventType = "response"
+	AgentEventTypeSummarize    AgentEventType = "summarize"
+	AgentEventTypeRetry        AgentEventType = "retry"
+	AgentEventTypeTokens       AgentEventType = "tokens"
+	AgentEventTypeToolProgress AgentEventType = "tool_progress"
 )
 
 type AgentEvent struct {
@@ -39,10 +50,22 @@ type AgentEvent struct {
 	Message message.Message
 	Error   error
 
-	// When summarizing
+	// The session the event belongs to, set on every event so subscribers can route it
 	SessionID string
 	Progress  string
 	Done      bool
+
+	// When a rate-limited provider call is being retried
+	Retry *provider.RetryInfo
+
+	// The estimated or, once the response completes, exact tokens of the response
+	Tokens *TokenCount
+
+	// The progress of a long-running tool call, such as writing a large file
+	ToolProgress *tools.ToolProgress
+
+	// The tokens and cost of the whole turn, set on the final response
+	Usage *TurnUsage
 }
 
 type Service interface {
@@ -54,22 +77,49 @@ type Service interface {
 	IsSessionBusy(sessionID string) bool
 	IsBusy() bool
 	Update(agentName config.AgentName, modelID models.ModelID) (models.Model, error)
+	UpdateReasoningEffort(agentName config.AgentName, effort string) error
 	Summarize(ctx context.Context, sessionID string) error
+	ToolMetrics(sessionID string) map[string]ToolMetrics
+	SetMCPTools(mcpTools []tools.BaseTool) error
+	Tools() []tools.BaseTool
+	ContextTokens(ctx context.Context, sessionID string) (ContextTokens, error)
+	LastTurnStats(sessionID string) (TurnStats, bool)
 }
 
 type agent struct {
 	*pubsub.Broker[AgentEvent]
+	name config.AgentName
+	// overrides are applied to the configuration whenever a provider is built, and
+	// isolated keeps model changes out of the configuration file
+	overrides AgentOverrides
+	isolated  bool
+
 	sessions session.Service
 	messages message.Service
 
+	// toolsMu guards tools, which SetMCPTools replaces while other requests read them
+	toolsMu  sync.RWMutex
 	tools    []tools.BaseTool
 	provider provider.Provider
 
 	titleProvider     provider.Provider
 	summarizeProvider provider.Provider
 
-	activeRequests    sync.Map
+	activeRequests      sync.Map
 	reasoningStartTimes sync.Map // Maps message ID to reasoning start time
+	tokenEstimates      sync.Map // Maps message ID to the running token estimate of its response
+	turnUsage           sync.Map // Maps session ID to the usage of its running turn
+	turnTimers          sync.Map // Maps session ID to the timings of its running turn
+	lastTurnStats       sync.Map // Maps session ID to the TurnStats of its last completed turn
+
+	toolMetrics *toolMetricsRecorder
+
+	// maxContinuations is how many times a response cut off by max_tokens is auto-continued
+	maxContinuations int
+	// historyWindow is how many of the latest turns are sent, or 0 for the whole history
+	historyWindow int
+	// retryBudget is how many rate-limit retries a turn may make, or 0 for no limit
+	retryBudget int
 }
 
 func NewAgent(
@@ -78,21 +128,62 @@ func NewAgent(
 	messages message.Service,
 	agentTools []tools.BaseTool,
 ) (Service, error) {
-	agentProvider, err := createAgentProvider(agentName)
+	a, err := newAgent(agentName, AgentOverrides{}, false, sessions, messages, agentTools)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// AgentOverrides replace parts of the configuration an agent's providers are built
+// from. Empty fields keep the configured value.
+type AgentOverrides struct {
+	Model           models.ModelID
+	APIKey          string
+	ReasoningEffort string
+}
+
+// NewIsolatedAgent creates an agent whose providers are built from the configuration
+// with the overrides applied, so it can use a different model or key from other agents
+// at the same time. Changing its model or reasoning effort only affects this agent and
+// is never written to the configuration file.
+func NewIsolatedAgent(
+	agentName config.AgentName,
+	overrides AgentOverrides,
+	sessions session.Service,
+	messages message.Service,
+	agentTools []tools.BaseTool,
+) (Service, error) {
+	a, err := newAgent(agentName, overrides, true, sessions, messages, agentTools)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func newAgent(
+	agentName config.AgentName,
+	overrides AgentOverrides,
+	isolated bool,
+	sessions session.Service,
+	messages message.Service,
+	agentTools []tools.BaseTool,
+) (*agent, error) {
+	agentProvider, err := createAgentProvider(agentName, overrides)
 	if err != nil {
 		return nil, err
 	}
 	var titleProvider provider.Provider
 	// Only generate titles for the main agent
 	if agentName == config.AgentMain {
-		titleProvider, err = createAgentProvider(config.AgentMain)
+		titleProvider, err = createAgentProvider(config.AgentMain, overrides)
 		if err != nil {
 			return nil, err
 		}
 	}
 	var summarizeProvider provider.Provider
 	if agentName == config.AgentMain {
-		summarizeProvider, err = createAgentProvider(config.AgentMain)
+		summarizeProvider, err = createAgentProvider(config.AgentMain, overrides)
 		if err != nil {
 			return nil, err
 		}
@@ -100,6 +191,9 @@ func NewAgent(
 
 	agent := &agent{
 		Broker:            pubsub.NewBroker[AgentEvent](),
+		name:              agentName,
+		overrides:         overrides,
+		isolated:          isolated,
 		provider:          agentProvider,
 		messages:          messages,
 		sessions:          sessions,
@@ -107,6 +201,10 @@ func NewAgent(
 		titleProvider:     titleProvider,
 		summarizeProvider: summarizeProvider,
 		activeRequests:    sync.Map{},
+		toolMetrics:       newToolMetricsRecorder(),
+		maxContinuations:  config.Get().Agents[agentName].MaxContinuations,
+		historyWindow:     config.Get().Agents[agentName].HistoryWindow,
+		retryBudget:       turnRetryBudget(config.Get().Agents[agentName].RetryBudget),
 	}
 
 	return agent, nil
@@ -164,7 +262,10 @@ func (a *agent) generateTitle(ctx context.Context, sessionID string, content str
 	if err != nil {
 		return err
 	}
-	ctx = context.WithValue(ctx, tools.SessionIDContextKey, sessionID)
+	ctx = backgroundRequestContext(context.WithValue(ctx, tools.SessionIDContextKey, sessionID))
+	if language := strings.TrimSpace(config.Get().TitleLanguage); language != "" {
+		content += fmt.Sprintf("\n\n<system-reminder>\nWrite the title in %s, whatever language the message is in.\n</system-reminder>", language)
+	}
 	parts := []message.ContentPart{message.TextContent{Text: content}}
 	response, err := a.titleProvider.SendMessages(
 		ctx,
@@ -190,10 +291,20 @@ func (a *agent) generateTitle(ctx context.Context, sessionID string, content str
 	return err
 }
 
-func (a *agent) err(err error) AgentEvent {
+// backgroundRequestContext prepares the context of a request made for the agent's own
+// bookkeeping, such as a title or summary, rather than for the conversation
+func backgroundRequestContext(ctx context.Context) context.Context {
+	if config.Get().CacheBackgroundRequests {
+		return ctx
+	}
+	return provider.WithoutPromptCache(ctx)
+}
+
+func (a *agent) err(sessionID string, err error) AgentEvent {
 	return AgentEvent{
-		Type:  AgentEventTypeError,
-		Error: err,
+		Type:      AgentEventTypeError,
+		SessionID: sessionID,
+		Error:     err,
 	}
 }
 
@@ -202,9 +313,11 @@ func (a *agent) Run(ctx context.Context, sessionID string, content string, attac
 }
 
 func (a *agent) RunWithPlanMode(ctx context.Context, sessionID string, content string, planMode bool, attachments ...message.Attachment) (<-chan AgentEvent, error) {
-	if !a.provider.Model().SupportsAttachments && attachments != nil {
+	if !a.provider.Capabilities().Attachments && len(attachments) > 0 {
+		logging.Warn("Model does not support attachments, sending message without them", "model", a.provider.Model().ID, "attachments", len(attachments))
 		attachments = nil
 	}
+	attachments = withMimeTypes(attachments)
 	events := make(chan AgentEvent, 10) // Buffered channel for better streaming
 
 	genCtx, cancel := context.WithCancel(ctx)
@@ -221,17 +334,28 @@ func (a *agent) RunWithPlanMode(ctx context.Context, sessionID string, content s
 	// Subscribe to agent events for real-time streaming
 	subscription := a.Subscribe(genCtx)
 
+	// generationDone stops the forwarding goroutine once the request finishes, so it
+	// doesn't linger until the caller's context ends
+	generationDone := make(chan struct{})
+	var forwarding sync.WaitGroup
+	forwarding.Add(1)
+	stopForwarding := sync.OnceFunc(func() {
+		close(generationDone)
+		forwarding.Wait()
+	})
+
 	go func() {
 		defer func() {
 			logging.Debug("Request completed", "sessionID", sessionID)
 			a.activeRequests.Delete(sessionID)
+			stopForwarding()
 			cancel()
 			close(events)
 		}()
 
 		logging.Debug("Request started", "sessionID", sessionID, "planMode", planMode)
 		defer logging.RecoverPanic("agent.Run", func() {
-			events <- a.err(fmt.Errorf("panic while running the agent"))
+			events <- a.err(sessionID, fmt.Errorf("panic while running the agent"))
 		})
 
 		var attachmentParts []message.ContentPart
@@ -243,29 +367,49 @@ func (a *agent) RunWithPlanMode(ctx context.Context, sessionID string, content s
 		if result.Error != nil && !errors.Is(result.Error, ErrRequestCancelled) && !errors.Is(result.Error, context.Canceled) {
 			logging.Error(result.Error.Error())
 		}
+		// Flush intermediate events first so the final result is the last one sent
+		stopForwarding()
 		// Always send the final result directly to ensure CLI mode receives it
 		events <- result
 	}()
 
 	// Forward intermediate events from subscription to the events channel
 	go func() {
+		defer forwarding.Done()
 		defer logging.RecoverPanic("agent.Run-subscription", nil)
+
+		forward := func(event pubsub.Event[AgentEvent]) bool {
+			// Only forward intermediate events for this specific session (not final completion events)
+			if (event.Payload.SessionID == sessionID || event.Payload.Message.SessionID == sessionID) && !event.Payload.Done {
+				select {
+				case events <- event.Payload:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case event, ok := <-subscription:
-				if !ok {
-					return
-				}
-				// Only forward intermediate events for this specific session (not final completion events)
-				if (event.Payload.SessionID == sessionID || event.Payload.Message.SessionID == sessionID) && !event.Payload.Done {
+			case <-generationDone:
+				// Deliver events already published before the generation finished
+				for {
 					select {
-					case events <- event.Payload:
-					case <-ctx.Done():
+					case event, ok := <-subscription:
+						if !ok || !forward(event) {
+							return
+						}
+					default:
 						return
 					}
 				}
+			case event, ok := <-subscription:
+				if !ok || !forward(event) {
+					return
+				}
 			}
 		}
 	}()
@@ -274,12 +418,13 @@ func (a *agent) RunWithPlanMode(ctx context.Context, sessionID string, content s
 }
 
 func (a *agent) processGeneration(ctx context.Context, sessionID, content string, attachmentParts []message.ContentPart) AgentEvent {
+	turnStarted := time.Now()
 	logging.Info("[Agent] Starting message processing for session", "sessionID", sessionID, "contentPreview", fmt.Sprintf("%.100s...", content))
 	_ = config.Get()
 	// List existing messages; if none, start title generation asynchronously.
 	msgs, err := a.messages.List(ctx, sessionID)
 	if err != nil {
-		return a.err(fmt.Errorf("failed to list messages: %w", err))
+		return a.err(sessionID, fmt.Errorf("failed to list messages: %w", err))
 	}
 	if len(msgs) == 0 {
 		go func() {
@@ -294,8 +439,9 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 	}
 	session, err := a.sessions.Get(ctx, sessionID)
 	if err != nil {
-		return a.err(fmt.Errorf("failed to get session: %w", err))
+		return a.err(sessionID, fmt.Errorf("failed to get session: %w", err))
 	}
+	summarized := false
 	if session.SummaryMessageID != "" {
 		summaryMsgInex := -1
 		for i, msg := range msgs {
@@ -307,21 +453,34 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 		if summaryMsgInex != -1 {
 			msgs = msgs[summaryMsgInex:]
 			msgs[0].Role = message.User
+			summarized = true
 		}
 	}
 
 	userMsg, err := a.createUserMessage(ctx, sessionID, content, attachmentParts)
 	if err != nil {
-		return a.err(fmt.Errorf("failed to create user message: %w", err))
+		return a.err(sessionID, fmt.Errorf("failed to create user message: %w", err))
 	}
 	// Append the new user message to the conversation history.
 	msgHistory := append(msgs, userMsg)
+	if a.historyWindow > 0 {
+		msgHistory = windowHistory(msgHistory, a.historyWindow, summarized)
+	}
 
+	a.turnUsage.Store(sessionID, &TurnUsage{})
+	defer a.turnUsage.Delete(sessionID)
+	timer := newTurnTimer(turnStarted)
+	a.turnTimers.Store(sessionID, timer)
+	defer a.turnTimers.Delete(sessionID)
+
+	continuations := 0
+	// truncated is the assistant message being auto-continued, if any
+	var truncated *message.Message
 	for {
 		// Check for cancellation before each iteration
 		select {
 		case <-ctx.Done():
-			return a.err(ctx.Err())
+			return a.err(sessionID, ctx.Err())
 		default:
 			// Continue processing
 		}
@@ -331,11 +490,32 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 			if errors.Is(err, context.Canceled) {
 				agentMessage.AddFinish(message.FinishReasonCanceled)
 				a.messages.Update(context.Background(), agentMessage)
-				return a.err(ErrRequestCancelled)
+				// Carry the partial response so clients can show what was streamed so far
+				return AgentEvent{
+					Type:      AgentEventTypeError,
+					Message:   agentMessage,
+					Error:     ErrRequestCancelled,
+					SessionID: sessionID,
+					Done:      true,
+				}
 			}
-			return a.err(fmt.Errorf("failed to process events: %w", err))
+			return a.err(sessionID, fmt.Errorf("failed to process events: %w", err))
 		}
 
+		// A requested tool choice applies to the first request only, so follow-up
+		// requests can answer tool results instead of calling the forced tool again
+		ctx = provider.WithToolChoice(ctx, provider.ToolChoice{Mode: provider.ToolChoiceAuto})
+
+		if truncated != nil && toolResults == nil {
+			// Drop the truncated message and continue prompt; the stitched message replaces them
+			msgHistory = msgHistory[:len(msgHistory)-2]
+			agentMessage, err = a.stitchContinuation(ctx, *truncated, agentMessage)
+			if err != nil {
+				return a.err(sessionID, fmt.Errorf("failed to stitch continuation: %w", err))
+			}
+		}
+		truncated = nil
+
 		// Enhanced tool results logging for debugging
 		if toolResults != nil {
 			for i, result := range toolResults.ToolCalls() {
@@ -347,13 +527,22 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 			msgHistory = append(msgHistory, agentMessage, *toolResults)
 			continue
 		}
+		if agentMessage.FinishReason() == message.FinishReasonMaxTokens && continuations < a.maxContinuations {
+			continuations++
+			logging.Info("[Agent] Response hit max tokens, continuing", "sessionID", sessionID, "continuation", continuations, "maxContinuations", a.maxContinuations)
+			msgHistory = append(msgHistory, agentMessage, continuationPrompt(sessionID))
+			truncated = &agentMessage
+			continue
+		}
 		// Publish final completion event
+		a.lastTurnStats.Store(sessionID, timer.stats(time.Now()))
 
 		finalEvent := AgentEvent{
 			Type:      AgentEventTypeResponse,
 			Message:   agentMessage,
 			SessionID: sessionID,
 			Done:      true,
+			Usage:     a.currentTurnUsage(sessionID),
 		}
 		a.Publish(pubsub.CreatedEvent, finalEvent)
 		return finalEvent
@@ -367,7 +556,7 @@ func (a *agent) createUserMessage(ctx context.Context, sessionID, content string
 		planModeContent := prompt.LoadPrompt("plan_mode")
 		messageContent = content + "\n\n<system-reminder>\n" + planModeContent + "\n</system-reminder>"
 	}
-	
+
 	parts := []message.ContentPart{message.TextContent{Text: messageContent}}
 	parts = append(parts, attachmentParts...)
 	return a.messages.Create(ctx, sessionID, message.CreateMessageParams{
@@ -378,14 +567,21 @@ func (a *agent) createUserMessage(ctx context.Context, sessionID, content string
 
 func (a *agent) streamAndHandleEvents(ctx context.Context, sessionID string, msgHistory []message.Message) (message.Message, *message.Message, error) {
 	ctx = context.WithValue(ctx, tools.SessionIDContextKey, sessionID)
-	
+
 	// Filter tools based on plan mode
-	availableTools := a.tools
+	agentTools := a.Tools()
+	availableTools := agentTools
 	if ctx.Value("plan_mode") != nil {
-		availableTools = filterToolsForPlanMode(a.tools)
+		availableTools = filterToolsForPlanMode(agentTools)
+	}
+	capabilities := a.provider.Capabilities()
+	if !capabilities.Tools && len(availableTools) > 0 {
+		logging.Warn("Model does not support tools, sending request without them", "model", a.provider.Model().ID, "tools", len(availableTools))
+		availableTools = nil
+	}
+	if !capabilities.Attachments {
+		availableTools = withoutImageTools(availableTools)
 	}
-	
-	eventChan := a.provider.StreamResponse(ctx, msgHistory, availableTools)
 
 	assistantMsg, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{
 		Role:  message.Assistant,
@@ -396,13 +592,23 @@ func (a *agent) streamAndHandleEvents(ctx context.Context, sessionID string, msg
 		return assistantMsg, nil, fmt.Errorf("failed to create assistant message: %w", err)
 	}
 
-	// Add the session and message ID into the context if needed by tools.
+	// Add the session and message ID into the context if needed by tools and the audit log.
 	ctx = context.WithValue(ctx, tools.MessageIDContextKey, assistantMsg.ID)
+	defer a.tokenEstimates.Delete(assistantMsg.ID)
+
+	a.timeTurn(sessionID, func(t *turnTimer) { t.requestStart(time.Now()) })
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	defer cancelStream()
+	eventChan := a.provider.StreamResponse(streamCtx, msgHistory, availableTools)
 
 	// Process each event in the stream.
 	for event := range eventChan {
 		if processErr := a.processEvent(ctx, sessionID, &assistantMsg, event); processErr != nil {
 			a.finishMessage(ctx, &assistantMsg, message.FinishReasonCanceled)
+			// Stop the provider, such as while it waits to retry, and let it finish
+			cancelStream()
+			for range eventChan {
+			}
 			return assistantMsg, nil, processErr
 		}
 		if ctx.Err() != nil {
@@ -413,6 +619,8 @@ func (a *agent) streamAndHandleEvents(ctx context.Context, sessionID string, msg
 
 	toolResults := make([]message.ToolResult, len(assistantMsg.ToolCalls()))
 	toolCalls := assistantMsg.ToolCalls()
+	// Images returned by tools follow the results in the tool message
+	var toolImages []message.ContentPart
 
 	for i, toolCall := range toolCalls {
 		select {
@@ -430,7 +638,7 @@ func (a *agent) streamAndHandleEvents(ctx context.Context, sessionID string, msg
 		default:
 			// Continue processing
 			var tool tools.BaseTool
-			for _, availableTool := range a.tools {
+			for _, availableTool := range agentTools {
 				if availableTool.Info().Name == toolCall.Name {
 					tool = availableTool
 					break
@@ -446,7 +654,7 @@ func (a *agent) streamAndHandleEvents(ctx context.Context, sessionID string, msg
 				}
 				continue
 			}
-			
+
 			// Check if tool is available in plan mode
 			if ctx.Value("plan_mode") != nil && !isToolAllowedInPlanMode(tool) {
 				toolResults[i] = message.ToolResult{
@@ -458,13 +666,11 @@ func (a *agent) streamAndHandleEvents(ctx context.Context, sessionID string, msg
 			}
 			logging.Info("[Agent] Executing tool", "toolName", toolCall.Name, "sessionID", sessionID, "toolCallID", toolCall.ID, "inputSize", len(toolCall.Input), "inputContent", toolCall.Input)
 
-			toolStartTime := time.Now()
-			toolResult, toolErr := tool.Run(ctx, tools.ToolCall{
+			toolResult, toolDuration, toolErr := a.runTool(ctx, sessionID, tool, tools.ToolCall{
 				ID:    toolCall.ID,
 				Name:  toolCall.Name,
 				Input: toolCall.Input,
 			})
-			toolDuration := time.Since(toolStartTime)
 
 			logging.Info("[Agent] Tool execution result", "toolName", toolCall.Name, "sessionID", sessionID, "toolCallID", toolCall.ID, "duration", toolDuration, "error", toolErr, "resultLength", len(toolResult.Content), "resultContent", toolResult.Content, "resultIsError", toolResult.IsError)
 
@@ -503,6 +709,9 @@ func (a *agent) streamAndHandleEvents(ctx context.Context, sessionID string, msg
 				Metadata:   toolResult.Metadata,
 				IsError:    toolResult.IsError,
 			}
+			if toolResult.Image != nil && capabilities.Attachments {
+				toolImages = append(toolImages, *toolResult.Image)
+			}
 
 			// Publish tool result event for real-time streaming
 			a.Publish(pubsub.CreatedEvent, AgentEvent{
@@ -520,6 +729,7 @@ out:
 	for _, tr := range toolResults {
 		parts = append(parts, tr)
 	}
+	parts = append(parts, toolImages...)
 	msg, err := a.messages.Create(context.Background(), assistantMsg.SessionID, message.CreateMessageParams{
 		Role:  message.Tool,
 		Parts: parts,
@@ -544,6 +754,15 @@ func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg
 		// Continue processing.
 	}
 
+	switch event.Type {
+	case provider.EventThinkingDelta, provider.EventContentDelta, provider.EventToolUseStart, provider.EventToolUseDelta:
+		a.timeTurn(sessionID, func(t *turnTimer) { t.token(time.Now()) })
+	case provider.EventComplete:
+		a.timeTurn(sessionID, func(t *turnTimer) {
+			t.requestComplete(time.Now(), event.Response.Usage.OutputTokens+event.Response.Usage.ReasoningTokens)
+		})
+	}
+
 	switch event.Type {
 	case provider.EventThinkingDelta:
 		// Track reasoning start time on first thinking delta
@@ -551,6 +770,7 @@ func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg
 			a.reasoningStartTimes.Store(assistantMsg.ID, time.Now())
 		}
 		assistantMsg.AppendReasoningContent(event.Thinking)
+		a.estimateTokens(sessionID, assistantMsg.ID, event.Thinking)
 		// Publish thinking event for real-time streaming
 		a.Publish(pubsub.CreatedEvent, AgentEvent{
 			Type:      AgentEventTypeResponse,
@@ -560,6 +780,7 @@ func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg
 		return a.messages.Update(ctx, *assistantMsg)
 	case provider.EventContentDelta:
 		assistantMsg.AppendContent(event.Content)
+		a.estimateTokens(sessionID, assistantMsg.ID, event.Content)
 		// Content delta streaming removed - only final content will be sent
 		return a.messages.Update(ctx, *assistantMsg)
 	case provider.EventToolUseStart:
@@ -580,6 +801,9 @@ func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg
 	// 		assistantMsg.UpdatedAt = time.Now().Unix()
 	// 		return err
 	// 	}
+	case provider.EventToolUseDelta:
+		a.estimateTokens(sessionID, assistantMsg.ID, event.ToolCall.Input)
+		return nil
 	case provider.EventToolUseStop:
 		assistantMsg.FinishToolCall(event.ToolCall.ID)
 		// Publish tool completion event for real-time streaming
@@ -589,6 +813,17 @@ func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg
 			SessionID: sessionID,
 		})
 		return a.messages.Update(ctx, *assistantMsg)
+	case provider.EventRetry:
+		if retries, ok := a.addTurnRetry(sessionID); ok && a.retryBudget > 0 && retries > a.retryBudget {
+			return fmt.Errorf("%w (%d retries)", ErrRetryBudgetExhausted, a.retryBudget)
+		}
+		a.Publish(pubsub.CreatedEvent, AgentEvent{
+			Type:      AgentEventTypeRetry,
+			SessionID: sessionID,
+			Progress:  event.Retry.String(),
+			Retry:     event.Retry,
+		})
+		return nil
 	case provider.EventError:
 		if errors.Is(event.Error, context.Canceled) {
 			logging.Info("Event processing canceled for session", "sessionID", sessionID)
@@ -606,12 +841,14 @@ func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg
 				}
 			}
 		}
-		
+
 		assistantMsg.SetToolCalls(event.Response.ToolCalls)
 		assistantMsg.AddFinish(event.Response.FinishReason)
 		if err := a.messages.Update(ctx, *assistantMsg); err != nil {
 			return fmt.Errorf("failed to update message: %w", err)
 		}
+		a.publishTokenUsage(sessionID, assistantMsg.ID, event.Response.Usage)
+		a.addTurnUsage(sessionID, event.Response.Usage, a.provider.Model())
 		return a.TrackUsage(ctx, sessionID, a.provider.Model(), event.Response.Usage)
 	}
 
@@ -624,13 +861,8 @@ func (a *agent) TrackUsage(ctx context.Context, sessionID string, model models.M
 		return fmt.Errorf("failed to get session: %w", err)
 	}
 
-	cost := model.CostPer1MInCached/1e6*float64(usage.CacheCreationTokens) +
-		model.CostPer1MOutCached/1e6*float64(usage.CacheReadTokens) +
-		model.CostPer1MIn/1e6*float64(usage.InputTokens) +
-		model.CostPer1MOut/1e6*float64(usage.OutputTokens)
-
-	sess.Cost += cost
-	sess.CompletionTokens = usage.OutputTokens + usage.CacheReadTokens
+	sess.Cost += usage.Cost(model)
+	sess.CompletionTokens = usage.OutputTokens + usage.ReasoningTokens + usage.CacheReadTokens
 	sess.PromptTokens = usage.InputTokens + usage.CacheCreationTokens
 
 	_, err = a.sessions.Save(ctx, sess)
@@ -645,20 +877,73 @@ func (a *agent) Update(agentName config.AgentName, modelID models.ModelID) (mode
 		return models.Model{}, fmt.Errorf("cannot change model while processing requests")
 	}
 
-	if err := config.UpdateAgentModel(agentName, modelID); err != nil {
+	overrides := a.overrides
+	if a.isolated {
+		overrides.Model = modelID
+	} else if err := config.UpdateAgentModel(agentName, modelID); err != nil {
 		return models.Model{}, fmt.Errorf("failed to update config: %w", err)
 	}
 
-	provider, err := createAgentProvider(agentName)
+	provider, err := createAgentProvider(agentName, overrides)
 	if err != nil {
 		return models.Model{}, fmt.Errorf("failed to create provider for model %s: %w", modelID, err)
 	}
 
 	a.provider = provider
+	a.overrides = overrides
 
 	return a.provider.Model(), nil
 }
 
+// SetMCPTools replaces the agent's MCP tools, such as after an MCP server is added or removed
+func (a *agent) SetMCPTools(mcpTools []tools.BaseTool) error {
+	if a.IsBusy() {
+		return fmt.Errorf("cannot change MCP tools while processing requests")
+	}
+
+	a.toolsMu.Lock()
+	defer a.toolsMu.Unlock()
+
+	agentTools := make([]tools.BaseTool, 0, len(a.tools)+len(mcpTools))
+	for _, tool := range a.tools {
+		if _, ok := tool.(*mcpTool); !ok {
+			agentTools = append(agentTools, tool)
+		}
+	}
+	a.tools = append(agentTools, mcpTools...)
+	return nil
+}
+
+// Tools returns the tools the agent offers its model, including MCP tools
+func (a *agent) Tools() []tools.BaseTool {
+	a.toolsMu.RLock()
+	defer a.toolsMu.RUnlock()
+	return slices.Clone(a.tools)
+}
+
+func (a *agent) UpdateReasoningEffort(agentName config.AgentName, effort string) error {
+	if a.IsBusy() {
+		return fmt.Errorf("cannot change reasoning effort while processing requests")
+	}
+
+	overrides := a.overrides
+	if a.isolated {
+		overrides.ReasoningEffort = effort
+	} else if err := config.UpdateAgentReasoningEffort(agentName, effort); err != nil {
+		return fmt.Errorf("failed to update config: %w", err)
+	}
+
+	provider, err := createAgentProvider(agentName, overrides)
+	if err != nil {
+		return fmt.Errorf("failed to create provider: %w", err)
+	}
+
+	a.provider = provider
+	a.overrides = overrides
+
+	return nil
+}
+
 func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 	if a.summarizeProvider == nil {
 		return fmt.Errorf("summarize provider not available")
@@ -677,8 +962,9 @@ func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 		defer a.activeRequests.Delete(sessionID + "-summarize")
 		defer cancel()
 		event := AgentEvent{
-			Type:     AgentEventTypeSummarize,
-			Progress: "Starting summarization...",
+			Type:      AgentEventTypeSummarize,
+			SessionID: sessionID,
+			Progress:  "Starting summarization...",
 		}
 
 		a.Publish(pubsub.CreatedEvent, event)
@@ -686,28 +972,31 @@ func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 		msgs, err := a.messages.List(summarizeCtx, sessionID)
 		if err != nil {
 			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to list messages: %w", err),
-				Done:  true,
+				Type:      AgentEventTypeError,
+				SessionID: sessionID,
+				Error:     fmt.Errorf("failed to list messages: %w", err),
+				Done:      true,
 			}
 			a.Publish(pubsub.CreatedEvent, event)
 			return
 		}
-		summarizeCtx = context.WithValue(summarizeCtx, tools.SessionIDContextKey, sessionID)
+		summarizeCtx = backgroundRequestContext(context.WithValue(summarizeCtx, tools.SessionIDContextKey, sessionID))
 
 		if len(msgs) == 0 {
 			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("no messages to summarize"),
-				Done:  true,
+				Type:      AgentEventTypeError,
+				SessionID: sessionID,
+				Error:     fmt.Errorf("no messages to summarize"),
+				Done:      true,
 			}
 			a.Publish(pubsub.CreatedEvent, event)
 			return
 		}
 
 		event = AgentEvent{
-			Type:     AgentEventTypeSummarize,
-			Progress: "Analyzing conversation...",
+			Type:      AgentEventTypeSummarize,
+			SessionID: sessionID,
+			Progress:  "Analyzing conversation...",
 		}
 		a.Publish(pubsub.CreatedEvent, event)
 
@@ -724,8 +1013,9 @@ func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 		msgsWithPrompt := append(msgs, promptMsg)
 
 		event = AgentEvent{
-			Type:     AgentEventTypeSummarize,
-			Progress: "Generating summary...",
+			Type:      AgentEventTypeSummarize,
+			SessionID: sessionID,
+			Progress:  "Generating summary...",
 		}
 
 		a.Publish(pubsub.CreatedEvent, event)
@@ -738,9 +1028,10 @@ func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 		)
 		if err != nil {
 			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to summarize: %w", err),
-				Done:  true,
+				Type:      AgentEventTypeError,
+				SessionID: sessionID,
+				Error:     fmt.Errorf("failed to summarize: %w", err),
+				Done:      true,
 			}
 			a.Publish(pubsub.CreatedEvent, event)
 			return
@@ -749,25 +1040,28 @@ func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 		summary := strings.TrimSpace(response.Content)
 		if summary == "" {
 			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("empty summary returned"),
-				Done:  true,
+				Type:      AgentEventTypeError,
+				SessionID: sessionID,
+				Error:     fmt.Errorf("empty summary returned"),
+				Done:      true,
 			}
 			a.Publish(pubsub.CreatedEvent, event)
 			return
 		}
 		event = AgentEvent{
-			Type:     AgentEventTypeSummarize,
-			Progress: "Creating new session...",
+			Type:      AgentEventTypeSummarize,
+			SessionID: sessionID,
+			Progress:  "Creating new session...",
 		}
 
 		a.Publish(pubsub.CreatedEvent, event)
 		oldSession, err := a.sessions.Get(summarizeCtx, sessionID)
 		if err != nil {
 			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to get session: %w", err),
-				Done:  true,
+				Type:      AgentEventTypeError,
+				SessionID: sessionID,
+				Error:     fmt.Errorf("failed to get session: %w", err),
+				Done:      true,
 			}
 
 			a.Publish(pubsub.CreatedEvent, event)
@@ -787,37 +1081,33 @@ func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 		})
 		if err != nil {
 			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to create summary message: %w", err),
-				Done:  true,
+				Type:      AgentEventTypeError,
+				SessionID: sessionID,
+				Error:     fmt.Errorf("failed to create summary message: %w", err),
+				Done:      true,
 			}
 
 			a.Publish(pubsub.CreatedEvent, event)
 			return
 		}
 		oldSession.SummaryMessageID = msg.ID
-		oldSession.CompletionTokens = response.Usage.OutputTokens
+		oldSession.CompletionTokens = response.Usage.OutputTokens + response.Usage.ReasoningTokens
 		oldSession.PromptTokens = 0
-		model := a.summarizeProvider.Model()
-		usage := response.Usage
-		cost := model.CostPer1MInCached/1e6*float64(usage.CacheCreationTokens) +
-			model.CostPer1MOutCached/1e6*float64(usage.CacheReadTokens) +
-			model.CostPer1MIn/1e6*float64(usage.InputTokens) +
-			model.CostPer1MOut/1e6*float64(usage.OutputTokens)
-		oldSession.Cost += cost
+		oldSession.Cost += response.Usage.Cost(a.summarizeProvider.Model())
 		_, err = a.sessions.Save(summarizeCtx, oldSession)
 		if err != nil {
 			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to save session: %w", err),
-				Done:  true,
+				Type:      AgentEventTypeError,
+				SessionID: sessionID,
+				Error:     fmt.Errorf("failed to save session: %w", err),
+				Done:      true,
 			}
 			a.Publish(pubsub.CreatedEvent, event)
 		}
 
 		event = AgentEvent{
 			Type:      AgentEventTypeSummarize,
-			SessionID: oldSession.ID,
+			SessionID: sessionID,
 			Progress:  "Summary complete",
 			Done:      true,
 		}
@@ -839,10 +1129,38 @@ func filterToolsForPlanMode(allTools []tools.BaseTool) []tools.BaseTool {
 	return planModeTools
 }
 
+// withMimeTypes infers the MIME type of attachments sent without one. Attachments whose
+// type cannot be inferred are dropped, since providers reject them.
+func withMimeTypes(attachments []message.Attachment) []message.Attachment {
+	typed := make([]message.Attachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		if attachment.MimeType == "" {
+			attachment.MimeType = message.InferMimeType(attachment)
+			if attachment.MimeType == "" {
+				logging.Warn("Could not infer the MIME type of an attachment, sending message without it", "path", attachment.FilePath, "name", attachment.FileName)
+				continue
+			}
+		}
+		typed = append(typed, attachment)
+	}
+	return typed
+}
+
+// withoutImageTools drops the tools that return images, for models that cannot read them
+func withoutImageTools(allTools []tools.BaseTool) []tools.BaseTool {
+	var textTools []tools.BaseTool
+	for _, tool := range allTools {
+		if !tools.ReturnsImages(tool) {
+			textTools = append(textTools, tool)
+		}
+	}
+	return textTools
+}
+
 // isToolAllowedInPlanMode checks if a tool is allowed in plan mode
 func isToolAllowedInPlanMode(tool tools.BaseTool) bool {
 	toolName := tool.Info().Name
-	
+
 	// Allow read-only and planning tools
 	allowedTools := map[string]bool{
 		"view":           true,
@@ -853,16 +1171,47 @@ func isToolAllowedInPlanMode(tool tools.BaseTool) bool {
 		"exit_plan_mode": true,
 		"fetch":          true,
 	}
-	
+
 	return allowedTools[toolName]
 }
 
-func createAgentProvider(agentName config.AgentName) (provider.Provider, error) {
+// vertexAIBackend reports whether Gemini models should go through Vertex AI, and in which
+// project and location. The vertexai provider always does; the gemini provider does when a
+// project is configured, or when it has no API key and the environment names a project.
+func vertexAIBackend(providerName models.ModelProvider, providerCfg config.Provider) (project, location string, ok bool) {
+	if providerName != models.ProviderGemini && providerName != models.ProviderVertexAI {
+		return "", "", false
+	}
+	envProject, envLocation := config.VertexAIProjectAndLocation()
+	project, location = providerCfg.Project, providerCfg.Location
+	if project == "" {
+		project = envProject
+	}
+	if location == "" {
+		location = envLocation
+	}
+
+	switch {
+	case providerName == models.ProviderVertexAI, providerCfg.Project != "":
+		return project, location, true
+	case providerCfg.APIKey == "" && project != "" && location != "":
+		return project, location, true
+	}
+	return "", "", false
+}
+
+func createAgentProvider(agentName config.AgentName, overrides AgentOverrides) (provider.Provider, error) {
 	cfg := config.Get()
 	agentConfig, ok := cfg.Agents[agentName]
 	if !ok {
 		return nil, fmt.Errorf("agent %s not found", agentName)
 	}
+	if overrides.Model != "" {
+		agentConfig.Model = overrides.Model
+	}
+	if overrides.ReasoningEffort != "" {
+		agentConfig.ReasoningEffort = overrides.ReasoningEffort
+	}
 	model, ok := models.SupportedModels[agentConfig.Model]
 	if !ok {
 		return nil, fmt.Errorf("model %s not supported", agentConfig.Model)
@@ -875,6 +1224,9 @@ func createAgentProvider(agentName config.AgentName) (provider.Provider, error)
 	if providerCfg.Disabled {
 		return nil, fmt.Errorf("provider %s is not enabled", model.Provider)
 	}
+	if overrides.APIKey != "" {
+		providerCfg.APIKey = overrides.APIKey
+	}
 	// Note: API key validation removed - let provider client handle authentication
 	// This allows providers to support multiple authentication methods (OAuth, API key, etc.)
 	maxTokens := model.DefaultMaxTokens
@@ -887,15 +1239,36 @@ func createAgentProvider(agentName config.AgentName) (provider.Provider, error)
 		provider.WithModel(model),
 		provider.WithSystemMessage(systemPrompt),
 		provider.WithMaxTokens(maxTokens),
+		provider.WithHeaders(providerCfg.Headers),
+	}
+	if model.Provider == models.ProviderAzure {
+		opts = append(
+			opts,
+			provider.WithAzureOptions(
+				provider.WithAzureEndpoint(providerCfg.Endpoint, providerCfg.APIVersion),
+				provider.WithAzureDeployment(providerCfg.Deployments[model.ID]),
+			),
+		)
+	}
+	var geminiOpts []provider.GeminiOption
+	if project, location, ok := vertexAIBackend(model.Provider, providerCfg); ok {
+		geminiOpts = append(geminiOpts, provider.WithGeminiVertexAI(project, location))
+	}
+	if providerCfg.EmptyResponseRetries != nil {
+		geminiOpts = append(geminiOpts, provider.WithGeminiEmptyResponseRetries(*providerCfg.EmptyResponseRetries))
+	}
+	if len(geminiOpts) > 0 {
+		opts = append(opts, provider.WithGeminiOptions(geminiOpts...))
 	}
-	if model.Provider == models.ProviderOpenAI || model.Provider == models.ProviderLocal && model.CanReason {
+	capabilities := provider.ModelCapabilities(model)
+	if model.Provider == models.ProviderOpenAI || model.Provider == models.ProviderAzure || model.Provider == models.ProviderLocal && capabilities.Reasoning {
 		opts = append(
 			opts,
 			provider.WithOpenAIOptions(
 				provider.WithReasoningEffort(agentConfig.ReasoningEffort),
 			),
 		)
-	} else if model.Provider == models.ProviderAnthropic && model.CanReason && agentName == config.AgentMain {
+	} else if model.Provider == models.ProviderAnthropic && capabilities.Reasoning && agentName == config.AgentMain {
 		opts = append(
 			opts,
 			provider.WithAnthropicOptions(
@@ -0,0 +1,586 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mix/internal/config"
+	"mix/internal/llm/models"
+	"mix/internal/llm/provider"
+	"mix/internal/llm/tools"
+	"mix/internal/message"
+	"mix/internal/pubsub"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_ProcessRetryEvent(t *testing.T) {
+	a := &agent{Broker: pubsub.NewBroker[AgentEvent]()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := a.Subscribe(ctx)
+
+	retry := &provider.RetryInfo{Attempt: 2, MaxAttempts: 8, Delay: 4800 * time.Millisecond}
+	assistantMsg := message.Message{ID: "msg", SessionID: "session"}
+	err := a.processEvent(ctx, "session", &assistantMsg, provider.ProviderEvent{Type: provider.EventRetry, Retry: retry})
+	require.NoError(t, err)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, AgentEventTypeRetry, event.Payload.Type)
+		assert.Equal(t, "session", event.Payload.SessionID)
+		assert.Equal(t, retry, event.Payload.Retry)
+		assert.Equal(t, "Rate limited, retrying in 5s (attempt 2 of 8)", event.Payload.Progress)
+		assert.False(t, event.Payload.Done)
+	case <-time.After(time.Second):
+		t.Fatal("expected a retry event")
+	}
+}
+
+// fakeTool is a tool with a fixed delay and outcome for exercising tool execution
+type fakeTool struct {
+	name  string
+	delay time.Duration
+	fail  bool
+	err   error
+}
+
+func (f *fakeTool) Info() tools.ToolInfo {
+	return tools.ToolInfo{Name: f.name}
+}
+
+func (f *fakeTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+	time.Sleep(f.delay)
+	if f.err != nil {
+		return tools.ToolResponse{}, f.err
+	}
+	if f.fail {
+		return tools.NewTextErrorResponse("failed"), nil
+	}
+	return tools.NewTextResponse("ok"), nil
+}
+
+func TestAgent_ToolMetrics(t *testing.T) {
+	a := &agent{toolMetrics: newToolMetricsRecorder()}
+	ctx := context.Background()
+	fast := &fakeTool{name: "fast"}
+	slow := &fakeTool{name: "slow", delay: 20 * time.Millisecond}
+	flaky := &fakeTool{name: "flaky", fail: true}
+
+	run := func(sessionID string, tool *fakeTool) {
+		_, _, err := a.runTool(ctx, sessionID, tool, tools.ToolCall{Name: tool.name})
+		require.NoError(t, err)
+	}
+
+	// Run concurrently to exercise the recorder's locking
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run("session-a", fast)
+		}()
+	}
+	wg.Wait()
+	run("session-a", slow)
+	run("session-b", slow)
+	run("session-b", flaky)
+
+	all := a.ToolMetrics("")
+	assert.Equal(t, int64(10), all["fast"].Calls)
+	assert.Equal(t, int64(0), all["fast"].Errors)
+	assert.Equal(t, int64(2), all["slow"].Calls)
+	assert.GreaterOrEqual(t, all["slow"].TotalDurationMs, int64(40))
+	assert.GreaterOrEqual(t, all["slow"].AvgDurationMs, int64(20))
+	assert.Equal(t, int64(1), all["flaky"].Errors)
+
+	sessionB := a.ToolMetrics("session-b")
+	assert.Len(t, sessionB, 2)
+	assert.Equal(t, int64(1), sessionB["slow"].Calls)
+	assert.Equal(t, int64(1), sessionB["flaky"].Calls)
+	assert.NotContains(t, sessionB, "fast")
+
+	assert.Empty(t, a.ToolMetrics("unknown"))
+}
+
+func TestAgent_ToolMetricsCountsRunErrors(t *testing.T) {
+	a := &agent{toolMetrics: newToolMetricsRecorder()}
+	broken := &fakeTool{name: "broken", err: errors.New("boom")}
+	_, _, err := a.runTool(context.Background(), "session", broken, tools.ToolCall{Name: "broken"})
+	require.Error(t, err)
+
+	metrics := a.ToolMetrics("session")["broken"]
+	assert.Equal(t, int64(1), metrics.Calls)
+	assert.Equal(t, int64(1), metrics.Errors)
+}
+
+func TestAgent_RunDoesNotLeakGoroutines(t *testing.T) {
+	p := &scriptedProvider{responses: []provider.ProviderResponse{
+		{Content: "done", FinishReason: message.FinishReasonEndTurn},
+	}}
+	a, sessionID := newTestAgent(t, p, 0)
+
+	run := func() {
+		// A long-lived parent context, like the HTTP server's
+		events, err := a.Run(context.Background(), sessionID, "hello")
+		require.NoError(t, err)
+		var last AgentEvent
+		for event := range events {
+			last = event
+		}
+		require.NoError(t, last.Error)
+		require.True(t, last.Done)
+	}
+
+	run()
+	baseline := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		run()
+	}
+
+	// Poll by hand; assert.Eventually runs its condition on extra goroutines
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), baseline)
+	assert.Equal(t, 0, a.GetSubscriberCount())
+}
+
+// stallingProvider streams content and then waits for the request to be cancelled
+type stallingProvider struct {
+	content  string
+	streamed chan struct{}
+}
+
+func (p *stallingProvider) SendMessages(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*provider.ProviderResponse, error) {
+	panic("not used")
+}
+
+func (p *stallingProvider) StreamResponse(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan provider.ProviderEvent {
+	events := make(chan provider.ProviderEvent)
+	go func() {
+		defer close(events)
+		events <- provider.ProviderEvent{Type: provider.EventContentDelta, Content: p.content}
+		close(p.streamed)
+		<-ctx.Done()
+		events <- provider.ProviderEvent{Type: provider.EventError, Error: ctx.Err()}
+	}()
+	return events
+}
+
+func (p *stallingProvider) Model() models.Model {
+	return models.Model{ID: "stalling"}
+}
+
+func (p *stallingProvider) Capabilities() provider.Capabilities {
+	return provider.ModelCapabilities(p.Model())
+}
+
+func TestAgent_CancelKeepsPartialResponse(t *testing.T) {
+	p := &stallingProvider{content: "The answer so far", streamed: make(chan struct{})}
+	a, sessionID := newTestAgent(t, p, 0)
+
+	events, err := a.Run(context.Background(), sessionID, "hello")
+	require.NoError(t, err)
+	select {
+	case <-p.streamed:
+	case <-time.After(time.Second):
+		t.Fatal("provider never streamed")
+	}
+	// Wait for the agent to store the delta before cancelling
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		stored, err := a.messages.List(context.Background(), sessionID)
+		require.NoError(t, err)
+		if len(stored) == 2 && stored[1].Content().Text != "" {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	a.Cancel(sessionID)
+
+	var last AgentEvent
+	for event := range events {
+		last = event
+	}
+	assert.ErrorIs(t, last.Error, ErrRequestCancelled)
+	assert.True(t, last.Done)
+	assert.Equal(t, sessionID, last.SessionID)
+	assert.Equal(t, "The answer so far", last.Message.Content().Text)
+	assert.Equal(t, message.FinishReasonCanceled, last.Message.FinishReason())
+
+	stored, err := a.messages.Get(context.Background(), last.Message.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "The answer so far", stored.Content().Text)
+}
+
+func TestAgent_GenerateTitleLanguage(t *testing.T) {
+	cfg := config.Get()
+	original := cfg.TitleLanguage
+	t.Cleanup(func() { cfg.TitleLanguage = original })
+
+	titleRequest := func(t *testing.T) string {
+		p := &scriptedProvider{responses: []provider.ProviderResponse{{Content: "Ein Titel"}}}
+		a, sessionID := newTestAgent(t, p, 0)
+		a.titleProvider = p
+		require.NoError(t, a.generateTitle(context.Background(), sessionID, "How do I rename a branch?"))
+
+		sess, err := a.sessions.Get(context.Background(), sessionID)
+		require.NoError(t, err)
+		assert.Equal(t, "Ein Titel", sess.Title)
+		require.Len(t, p.requests, 1)
+		return p.requests[0][0].Content().Text
+	}
+
+	t.Run("configured language", func(t *testing.T) {
+		cfg.TitleLanguage = "German"
+		request := titleRequest(t)
+		assert.True(t, strings.HasPrefix(request, "How do I rename a branch?"))
+		assert.Contains(t, request, "Write the title in German")
+	})
+
+	t.Run("no language configured", func(t *testing.T) {
+		cfg.TitleLanguage = ""
+		assert.Equal(t, "How do I rename a branch?", titleRequest(t))
+	})
+}
+
+func TestAgent_StreamingTokenEstimate(t *testing.T) {
+	p := &scriptedProvider{responses: []provider.ProviderResponse{{
+		Content:      "The answer is forty-two.",
+		FinishReason: message.FinishReasonEndTurn,
+		Usage:        provider.TokenUsage{InputTokens: 120, CacheReadTokens: 30, OutputTokens: 7},
+	}}}
+	a, sessionID := newTestAgent(t, p, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := a.Subscribe(ctx)
+
+	result := a.processGeneration(ctx, sessionID, "What is the answer?", nil)
+	require.NoError(t, result.Error)
+
+	var counts []TokenCount
+	for len(events) > 0 {
+		event := <-events
+		if event.Payload.Type == AgentEventTypeTokens {
+			assert.Equal(t, sessionID, event.Payload.SessionID)
+			counts = append(counts, *event.Payload.Tokens)
+		}
+	}
+
+	// The estimate from the streamed text is replaced by the exact usage
+	require.Len(t, counts, 2)
+	assert.Equal(t, TokenCount{OutputTokens: 6, Estimated: true}, counts[0])
+	assert.Equal(t, TokenCount{InputTokens: 150, OutputTokens: 7}, counts[1])
+
+	_, pending := a.tokenEstimates.Load(result.Message.ID)
+	assert.False(t, pending)
+}
+
+func TestLimitMessageLength(t *testing.T) {
+	cfg := config.Get()
+	original := cfg.MessageLimit
+	t.Cleanup(func() { cfg.MessageLimit = original })
+
+	t.Run("reject", func(t *testing.T) {
+		cfg.MessageLimit = config.MessageLimitConfig{MaxLength: 10, Policy: config.MessageLimitReject}
+		_, err := LimitMessageLength("this message is too long")
+		require.ErrorIs(t, err, ErrMessageTooLong)
+		assert.Contains(t, err.Error(), "24 characters, the maximum is 10")
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		cfg.MessageLimit = config.MessageLimitConfig{MaxLength: 10, Policy: config.MessageLimitTruncate}
+		content, err := LimitMessageLength("héllo wörld, and more")
+		require.NoError(t, err)
+		assert.Equal(t, "héllo wörl", content, "characters, not bytes, are counted")
+	})
+
+	t.Run("within the limit", func(t *testing.T) {
+		cfg.MessageLimit = config.MessageLimitConfig{MaxLength: 10, Policy: config.MessageLimitReject}
+		content, err := LimitMessageLength("short")
+		require.NoError(t, err)
+		assert.Equal(t, "short", content)
+	})
+}
+
+func TestAgent_ProviderCapabilities(t *testing.T) {
+	image := message.Attachment{FilePath: "canvas.png", MimeType: "image/png", Content: []byte("png")}
+	run := func(t *testing.T, capabilities provider.Capabilities) *scriptedProvider {
+		t.Helper()
+		p := &scriptedProvider{
+			responses:    []provider.ProviderResponse{{Content: "done", FinishReason: message.FinishReasonEndTurn}},
+			capabilities: &capabilities,
+		}
+		a, sessionID := newTestAgent(t, p, 0)
+		a.tools = []tools.BaseTool{tools.NewLsTool(), tools.NewPixelmatorThumbnailTool(nil)}
+
+		events, err := a.Run(context.Background(), sessionID, "What is on the canvas?", image)
+		require.NoError(t, err)
+		for range events {
+		}
+		require.Len(t, p.requests, 1)
+		return p
+	}
+	toolNames := func(offered []tools.BaseTool) []string {
+		var names []string
+		for _, tool := range offered {
+			names = append(names, tool.Info().Name)
+		}
+		return names
+	}
+
+	t.Run("attachments and tools", func(t *testing.T) {
+		p := run(t, provider.Capabilities{Tools: true, Attachments: true})
+		assert.Len(t, p.requests[0][0].BinaryContent(), 1)
+		assert.Equal(t, []string{tools.LSToolName, tools.PixelmatorThumbnailToolName}, toolNames(p.toolSets[0]))
+	})
+
+	t.Run("no attachments", func(t *testing.T) {
+		p := run(t, provider.Capabilities{Tools: true})
+		assert.Empty(t, p.requests[0][0].BinaryContent(), "attachments are dropped")
+		assert.Equal(t, []string{tools.LSToolName}, toolNames(p.toolSets[0]), "tools returning images are dropped")
+	})
+
+	t.Run("no tools", func(t *testing.T) {
+		p := run(t, provider.Capabilities{Attachments: true})
+		assert.Empty(t, p.toolSets[0])
+	})
+}
+
+func TestAgent_AttachmentMimeType(t *testing.T) {
+	p := &scriptedProvider{
+		responses:    []provider.ProviderResponse{{Content: "done", FinishReason: message.FinishReasonEndTurn}},
+		capabilities: &provider.Capabilities{Attachments: true},
+	}
+	a, sessionID := newTestAgent(t, p, 0)
+
+	untyped := message.Attachment{FilePath: "/uploads/canvas", Content: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")}
+	unknown := message.Attachment{FilePath: "/uploads/blob", Content: []byte{0x00, 0x01}}
+	events, err := a.Run(context.Background(), sessionID, "What is this?", untyped, unknown)
+	require.NoError(t, err)
+	for range events {
+	}
+
+	require.Len(t, p.requests, 1)
+	attachments := p.requests[0][0].BinaryContent()
+	require.Len(t, attachments, 1, "an attachment of unknown type is dropped")
+	assert.Equal(t, "image/png", attachments[0].MIMEType)
+	assert.Equal(t, "/uploads/canvas", attachments[0].Path)
+}
+
+// eventProvider streams a fixed sequence of provider events for each request
+type eventProvider struct {
+	scriptedProvider
+	streams [][]provider.ProviderEvent
+}
+
+func (p *eventProvider) StreamResponse(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan provider.ProviderEvent {
+	stream := p.streams[len(p.requests)%len(p.streams)]
+	p.requests = append(p.requests, messages)
+
+	events := make(chan provider.ProviderEvent, len(stream))
+	for _, event := range stream {
+		events <- event
+	}
+	close(events)
+	return events
+}
+
+func TestAgent_EventsCarrySessionID(t *testing.T) {
+	toolCall := message.ToolCall{ID: "call-1", Name: "view", Input: "{}", Finished: true}
+	p := &eventProvider{streams: [][]provider.ProviderEvent{
+		{
+			{Type: provider.EventThinkingDelta, Thinking: "Let me look at the file."},
+			{Type: provider.EventToolUseStart, ToolCall: &message.ToolCall{ID: "call-1", Name: "view"}},
+			{Type: provider.EventToolUseStop, ToolCall: &message.ToolCall{ID: "call-1"}},
+			{Type: provider.EventComplete, Response: &provider.ProviderResponse{ToolCalls: []message.ToolCall{toolCall}, FinishReason: message.FinishReasonToolUse}},
+		},
+		{
+			{Type: provider.EventRetry, Retry: &provider.RetryInfo{Attempt: 1, MaxAttempts: 3}},
+			{Type: provider.EventContentDelta, Content: "The file is empty."},
+			{Type: provider.EventComplete, Response: &provider.ProviderResponse{Content: "The file is empty.", FinishReason: message.FinishReasonEndTurn}},
+		},
+	}}
+	a, sessionID := newTestAgent(t, p, 0)
+	a.tools = []tools.BaseTool{&fakeTool{name: "view"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	published := a.Subscribe(ctx)
+
+	events, err := a.Run(context.Background(), sessionID, "What is in the file?")
+	require.NoError(t, err)
+	var received []AgentEvent
+	for event := range events {
+		received = append(received, event)
+	}
+	require.NotEmpty(t, received)
+	require.NoError(t, received[len(received)-1].Error)
+
+	var intermediate int
+	for len(published) > 0 {
+		event := <-published
+		assert.Equal(t, sessionID, event.Payload.SessionID, "published %s event", event.Payload.Type)
+		if !event.Payload.Done {
+			intermediate++
+		}
+	}
+	// Every intermediate event is forwarded, followed by the final result
+	assert.Len(t, received, intermediate+1)
+	for _, event := range received {
+		assert.Equal(t, sessionID, event.SessionID, "forwarded %s event", event.Type)
+	}
+
+	t.Run("summarize", func(t *testing.T) {
+		a, sessionID := newTestAgent(t, p, 0)
+		a.summarizeProvider = p
+		events := a.Subscribe(ctx)
+
+		require.NoError(t, a.Summarize(context.Background(), sessionID))
+		select {
+		case event := <-events:
+			assert.Equal(t, AgentEventTypeSummarize, event.Payload.Type)
+			assert.Equal(t, sessionID, event.Payload.SessionID)
+		case <-time.After(time.Second):
+			t.Fatal("no summarize event")
+		}
+		select {
+		case event := <-events:
+			assert.Equal(t, AgentEventTypeError, event.Payload.Type)
+			assert.Equal(t, sessionID, event.Payload.SessionID)
+		case <-time.After(time.Second):
+			t.Fatal("no error event")
+		}
+	})
+}
+
+func TestAgent_TitleGenerationPromptCache(t *testing.T) {
+	cfg := config.Get()
+	original := cfg.CacheBackgroundRequests
+	t.Cleanup(func() { cfg.CacheBackgroundRequests = original })
+
+	// No stored OAuth credentials, so Anthropic uses the API key
+	t.Setenv("HOME", t.TempDir())
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		body = string(raw)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet-4", "content": [{"type": "text", "text": "Renaming a branch"}], "stop_reason": "end_turn", "usage": {"input_tokens": 5, "output_tokens": 3}}`)
+	}))
+	defer server.Close()
+	t.Setenv("ANTHROPIC_BASE_URL", server.URL)
+
+	titleRequest := func(t *testing.T) string {
+		titleProvider, err := provider.NewProvider(models.ProviderAnthropic,
+			provider.WithAPIKey("test-key"),
+			provider.WithModel(models.SupportedModels[models.Claude4Sonnet]),
+			provider.WithSystemMessage("Write a short title"),
+			provider.WithMaxTokens(80),
+		)
+		require.NoError(t, err)
+		a, sessionID := newTestAgent(t, &scriptedProvider{}, 0)
+		a.titleProvider = titleProvider
+
+		require.NoError(t, a.generateTitle(context.Background(), sessionID, "How do I rename a branch?"))
+		return body
+	}
+
+	t.Run("off by default", func(t *testing.T) {
+		cfg.CacheBackgroundRequests = false
+		assert.NotContains(t, titleRequest(t), "cache_control")
+	})
+
+	t.Run("configured on", func(t *testing.T) {
+		cfg.CacheBackgroundRequests = true
+		assert.Contains(t, titleRequest(t), "cache_control")
+	})
+}
+
+func TestAgent_TurnUsage(t *testing.T) {
+	p := &scriptedProvider{responses: []provider.ProviderResponse{
+		{Content: "The first half, ", FinishReason: message.FinishReasonMaxTokens, Usage: provider.TokenUsage{InputTokens: 100, OutputTokens: 50, CacheReadTokens: 10}},
+		{Content: "and the second half.", FinishReason: message.FinishReasonEndTurn, Usage: provider.TokenUsage{InputTokens: 160, OutputTokens: 20, CacheCreationTokens: 5, ReasoningTokens: 7}},
+	}}
+	a, sessionID := newTestAgent(t, p, 1)
+
+	// Both calls of the continued response count towards the turn
+	result := a.processGeneration(context.Background(), sessionID, "write something long", nil)
+	require.NoError(t, result.Error)
+	require.NotNil(t, result.Usage)
+	assert.Equal(t, TurnUsage{InputTokens: 260, OutputTokens: 70, CacheCreationTokens: 5, CacheReadTokens: 10, ReasoningTokens: 7}, *result.Usage)
+
+	// The next turn starts from zero
+	p.responses = []provider.ProviderResponse{{Content: "short", FinishReason: message.FinishReasonEndTurn, Usage: provider.TokenUsage{InputTokens: 300, OutputTokens: 3}}}
+	result = a.processGeneration(context.Background(), sessionID, "and now briefly", nil)
+	require.NoError(t, result.Error)
+	require.NotNil(t, result.Usage)
+	assert.Equal(t, TurnUsage{InputTokens: 300, OutputTokens: 3}, *result.Usage)
+}
+
+func TestAgent_ContextTokens(t *testing.T) {
+	// The system prompt includes tool descriptions read from the source tree
+	cfg := config.Get()
+	originalWD := cfg.WorkingDir
+	t.Cleanup(func() { cfg.WorkingDir = originalWD })
+	root, err := filepath.Abs("../../..")
+	require.NoError(t, err)
+	cfg.WorkingDir = root
+
+	a, sessionID := newTestAgent(t, &scriptedProvider{}, 0)
+	a.tools = []tools.BaseTool{&fakeTool{name: "view"}}
+	ctx := context.Background()
+
+	_, err = a.messages.Create(ctx, sessionID, message.CreateMessageParams{
+		Role:  message.User,
+		Parts: []message.ContentPart{message.TextContent{Text: "12345678"}},
+	})
+	require.NoError(t, err)
+	reply, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{
+		Role: message.Assistant,
+		Parts: []message.ContentPart{
+			message.TextContent{Text: "abcd"},
+			message.ToolCall{ID: "call-1", Name: "view", Input: `{"a":1}`, Finished: true},
+		},
+	})
+	require.NoError(t, err)
+	_, err = a.messages.Create(ctx, sessionID, message.CreateMessageParams{
+		Role:  message.Tool,
+		Parts: []message.ContentPart{message.ToolResult{ToolCallID: "call-1", Content: "123456789012"}},
+	})
+	require.NoError(t, err)
+
+	// The scripted provider has no tokenizer, so every count is estimated
+	counts, err := a.ContextTokens(ctx, sessionID)
+	require.NoError(t, err)
+	assert.True(t, counts.Estimated)
+	assert.Positive(t, counts.SystemPrompt)
+	assert.Equal(t, int64(3), counts.Tools)
+	assert.Equal(t, int64(2), counts.UserMessages)
+	assert.Equal(t, int64(4), counts.AssistantMessages)
+	assert.Equal(t, int64(3), counts.ToolResults)
+
+	// After a summary only the summary and later messages count, the summary as user input
+	sess, err := a.sessions.Get(ctx, sessionID)
+	require.NoError(t, err)
+	sess.SummaryMessageID = reply.ID
+	_, err = a.sessions.Save(ctx, sess)
+	require.NoError(t, err)
+	counts, err = a.ContextTokens(ctx, sessionID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counts.UserMessages)
+	assert.Zero(t, counts.AssistantMessages)
+	assert.Equal(t, int64(3), counts.ToolResults)
+}
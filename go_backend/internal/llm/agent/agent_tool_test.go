@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"mix/internal/llm/provider"
+	"mix/internal/llm/tools"
+	"mix/internal/message"
+	"mix/internal/pubsub"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentTool_DispatchesToSubAgent(t *testing.T) {
+	main, parentID := newTestAgent(t, &scriptedProvider{}, 0)
+	subProvider := &scriptedProvider{responses: []provider.ProviderResponse{
+		{Content: "The logger is configured in internal/logging/logger.go", FinishReason: message.FinishReasonEndTurn},
+	}}
+	sub := &agent{
+		Broker:      pubsub.NewBroker[AgentEvent](),
+		sessions:    main.sessions,
+		messages:    main.messages,
+		provider:    subProvider,
+		toolMetrics: newToolMetricsRecorder(),
+	}
+	tool := &agentTool{
+		sessions:    main.sessions,
+		messages:    main.messages,
+		newSubAgent: func() (Service, error) { return sub, nil },
+	}
+
+	input, err := json.Marshal(AgentParams{Prompt: "Find where the logger is configured"})
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tools.SessionIDContextKey, parentID)
+	ctx = context.WithValue(ctx, tools.MessageIDContextKey, "parent-message")
+
+	response, err := tool.Run(ctx, tools.ToolCall{Name: AgentToolName, Input: string(input)})
+	require.NoError(t, err)
+	require.False(t, response.IsError, response.Content)
+	assert.Equal(t, "The logger is configured in internal/logging/logger.go", response.Content)
+
+	// The sub-agent got the focused prompt in a child session of the caller's
+	require.Len(t, subProvider.requests, 1)
+	assert.Equal(t, "Find where the logger is configured", subProvider.requests[0][0].Content().Text)
+
+	child, err := main.sessions.Get(context.Background(), subProvider.requests[0][0].SessionID)
+	require.NoError(t, err)
+	assert.Equal(t, parentID, child.ParentSessionID)
+
+	// Task sessions stay out of the top-level session list
+	sessions, err := main.sessions.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, parentID, sessions[0].ID)
+}
+
+func TestAgentTool_RequiresPrompt(t *testing.T) {
+	tool := NewAgentTool(nil, nil)
+	response, err := tool.Run(context.Background(), tools.ToolCall{Name: AgentToolName, Input: `{}`})
+	require.NoError(t, err)
+	assert.True(t, response.IsError)
+	assert.NotEqual(t, "Tool description not available", tool.Info().Description)
+}
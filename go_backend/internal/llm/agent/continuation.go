@@ -0,0 +1,34 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"mix/internal/message"
+)
+
+const continuationText = "Your previous response was cut off by the output token limit. Continue exactly where you left off, without repeating anything."
+
+// continuationPrompt is the follow-up sent when a response stops at max_tokens.
+// It only lives in the in-memory history for the next request and is never stored.
+func continuationPrompt(sessionID string) message.Message {
+	return message.Message{
+		Role:      message.User,
+		SessionID: sessionID,
+		Parts:     []message.ContentPart{message.TextContent{Text: continuationText}},
+	}
+}
+
+// stitchContinuation appends the text of a continuation response to the truncated
+// message it continues, so the turn ends with a single assistant message.
+func (a *agent) stitchContinuation(ctx context.Context, truncated, continuation message.Message) (message.Message, error) {
+	truncated.AppendContent(continuation.Content().Text)
+	truncated.AddFinish(continuation.FinishReason())
+	if err := a.messages.Update(ctx, truncated); err != nil {
+		return continuation, fmt.Errorf("failed to update truncated message: %w", err)
+	}
+	if err := a.messages.Delete(ctx, continuation.ID); err != nil {
+		return truncated, fmt.Errorf("failed to delete continuation message: %w", err)
+	}
+	return truncated, nil
+}
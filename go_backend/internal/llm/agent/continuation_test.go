@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"mix/internal/db"
+	"mix/internal/llm/models"
+	"mix/internal/llm/provider"
+	"mix/internal/llm/tools"
+	"mix/internal/message"
+	"mix/internal/pubsub"
+	"mix/internal/session"
+
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedProvider streams a fixed sequence of responses, one per request, cycling when exhausted
+type scriptedProvider struct {
+	responses []provider.ProviderResponse
+	requests  [][]message.Message
+	toolSets  [][]tools.BaseTool
+	// toolChoices holds the tool choice each request was made with
+	toolChoices []provider.ToolChoice
+	noTools     bool
+	// capabilities overrides the capabilities derived from the model
+	capabilities *provider.Capabilities
+}
+
+func (p *scriptedProvider) SendMessages(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*provider.ProviderResponse, error) {
+	response := p.responses[len(p.requests)%len(p.responses)]
+	p.requests = append(p.requests, messages)
+	p.toolSets = append(p.toolSets, tools)
+	return &response, nil
+}
+
+func (p *scriptedProvider) StreamResponse(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan provider.ProviderEvent {
+	response := p.responses[len(p.requests)%len(p.responses)]
+	p.requests = append(p.requests, messages)
+	p.toolSets = append(p.toolSets, tools)
+	p.toolChoices = append(p.toolChoices, provider.ToolChoiceFromContext(ctx))
+
+	events := make(chan provider.ProviderEvent, 2)
+	events <- provider.ProviderEvent{Type: provider.EventContentDelta, Content: response.Content}
+	events <- provider.ProviderEvent{Type: provider.EventComplete, Response: &response}
+	close(events)
+	return events
+}
+
+func (p *scriptedProvider) Model() models.Model {
+	return models.Model{ID: "scripted", SupportsTools: !p.noTools}
+}
+
+func (p *scriptedProvider) Capabilities() provider.Capabilities {
+	if p.capabilities != nil {
+		return *p.capabilities
+	}
+	return provider.ModelCapabilities(p.Model())
+}
+
+func newTestAgent(t *testing.T, p provider.Provider, maxContinuations int) (*agent, string) {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, db.SetupTestDatabase(conn))
+
+	queries := db.New(conn)
+	a := &agent{
+		Broker:           pubsub.NewBroker[AgentEvent](),
+		sessions:         session.NewService(queries),
+		messages:         message.NewService(queries),
+		provider:         p,
+		toolMetrics:      newToolMetricsRecorder(),
+		maxContinuations: maxContinuations,
+	}
+	sess, err := a.sessions.Create(context.Background(), "test session")
+	require.NoError(t, err)
+	return a, sess.ID
+}
+
+func TestAgent_AutoContinueOnMaxTokens(t *testing.T) {
+	p := &scriptedProvider{responses: []provider.ProviderResponse{
+		{Content: "The first half, ", FinishReason: message.FinishReasonMaxTokens},
+		{Content: "and the second half.", FinishReason: message.FinishReasonEndTurn},
+	}}
+	a, sessionID := newTestAgent(t, p, 2)
+	ctx := context.Background()
+
+	result := a.processGeneration(ctx, sessionID, "write something long", nil)
+	require.NoError(t, result.Error)
+	assert.Equal(t, "The first half, and the second half.", result.Message.Content().Text)
+	assert.Equal(t, message.FinishReasonEndTurn, result.Message.FinishReason())
+
+	// The continuation request carries the truncated response and a continue prompt
+	require.Len(t, p.requests, 2)
+	second := p.requests[1]
+	require.Len(t, second, 3)
+	assert.Equal(t, message.Assistant, second[1].Role)
+	assert.Equal(t, message.User, second[2].Role)
+	assert.Equal(t, continuationText, second[2].Content().Text)
+
+	// Only the user message and the stitched assistant message are stored
+	stored, err := a.messages.List(ctx, sessionID)
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	assert.Equal(t, result.Message.ID, stored[1].ID)
+	assert.Equal(t, "The first half, and the second half.", stored[1].Content().Text)
+}
+
+func TestAgent_AutoContinueLimit(t *testing.T) {
+	p := &scriptedProvider{responses: []provider.ProviderResponse{
+		{Content: "one ", FinishReason: message.FinishReasonMaxTokens},
+		{Content: "two ", FinishReason: message.FinishReasonMaxTokens},
+		{Content: "three", FinishReason: message.FinishReasonMaxTokens},
+	}}
+	a, sessionID := newTestAgent(t, p, 1)
+
+	result := a.processGeneration(context.Background(), sessionID, "write something long", nil)
+	require.NoError(t, result.Error)
+	assert.Len(t, p.requests, 2)
+	assert.Equal(t, "one two ", result.Message.Content().Text)
+	assert.Equal(t, message.FinishReasonMaxTokens, result.Message.FinishReason())
+}
+
+func TestAgent_AutoContinueDisabled(t *testing.T) {
+	p := &scriptedProvider{responses: []provider.ProviderResponse{
+		{Content: "cut off", FinishReason: message.FinishReasonMaxTokens},
+	}}
+	a, sessionID := newTestAgent(t, p, 0)
+
+	result := a.processGeneration(context.Background(), sessionID, "write something long", nil)
+	require.NoError(t, result.Error)
+	assert.Len(t, p.requests, 1)
+	assert.Equal(t, "cut off", result.Message.Content().Text)
+}
+
+func TestAgent_SkipsToolsForModelsWithoutToolSupport(t *testing.T) {
+	response := provider.ProviderResponse{Content: "plain text answer", FinishReason: message.FinishReasonEndTurn}
+	for _, supportsTools := range []bool{true, false} {
+		p := &scriptedProvider{responses: []provider.ProviderResponse{response}, noTools: !supportsTools}
+		a, sessionID := newTestAgent(t, p, 0)
+		a.tools = []tools.BaseTool{&fakeTool{name: "view"}}
+
+		result := a.processGeneration(context.Background(), sessionID, "hello", nil)
+		require.NoError(t, result.Error)
+		assert.Equal(t, "plain text answer", result.Message.Content().Text)
+		require.Len(t, p.toolSets, 1)
+		if supportsTools {
+			assert.Len(t, p.toolSets[0], 1)
+		} else {
+			assert.Empty(t, p.toolSets[0])
+		}
+	}
+}
+
+func TestAgent_ToolChoiceAppliesToFirstRequest(t *testing.T) {
+	p := &scriptedProvider{responses: []provider.ProviderResponse{
+		{Content: "The first half, ", FinishReason: message.FinishReasonMaxTokens},
+		{Content: "and the second half.", FinishReason: message.FinishReasonEndTurn},
+	}}
+	a, sessionID := newTestAgent(t, p, 1)
+	forced := provider.ToolChoice{Mode: provider.ToolChoiceTool, ToolName: "view"}
+	ctx := provider.WithToolChoice(context.Background(), forced)
+
+	result := a.processGeneration(ctx, sessionID, "read the file", nil)
+	require.NoError(t, result.Error)
+	assert.Equal(t, []provider.ToolChoice{forced, {Mode: provider.ToolChoiceAuto}}, p.toolChoices)
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -110,6 +111,15 @@ func (m *MCPClientManager) GetClient(ctx context.Context, serverName string, mcp
 		return nil, fmt.Errorf("failed to create mcp client: %w", err)
 	}
 
+	// SSE clients open their event stream on Start; it lives until the client is closed,
+	// so it must not use the caller's (often short) context
+	if mcpConfig.Type == config.MCPSse {
+		if err := newClient.Start(context.Background()); err != nil {
+			newClient.Close()
+			return nil, fmt.Errorf("failed to start mcp client: %w", err)
+		}
+	}
+
 	// Initialize the client
 	initRequest := mcp.InitializeRequest{}
 	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
@@ -175,7 +185,16 @@ func (b *mcpTool) Info() tools.ToolInfo {
 	}
 }
 
-func runTool(ctx context.Context, c *client.Client, toolName string, input string) (tools.ToolResponse, error) {
+// mcpToolTimeout caps how long an MCP tool call may run
+const mcpToolTimeout = 30 * time.Second
+
+// mcpCallResult is the outcome of an MCP tool call
+type mcpCallResult struct {
+	result *mcp.CallToolResult
+	err    error
+}
+
+func runTool(ctx context.Context, c MCPClient, toolName string, input string) (tools.ToolResponse, error) {
 	// Client is already initialized by the manager, just call the tool
 	toolRequest := mcp.CallToolRequest{}
 	toolRequest.Params.Name = toolName
@@ -184,15 +203,32 @@ func runTool(ctx context.Context, c *client.Client, toolName string, input strin
 		return tools.NewTextErrorResponse(fmt.Sprintf("error parsing parameters: %s", err)), nil
 	}
 	toolRequest.Params.Arguments = args
-	callCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	callCtx, cancel := context.WithTimeout(ctx, mcpToolTimeout)
 	defer cancel()
-	result, err := c.CallTool(callCtx, toolRequest)
-	if err != nil {
-		return tools.NewTextErrorResponse(err.Error()), nil
+
+	// The call runs on its own so cancelling returns at once, even when the client or
+	// server doesn't give up on the request; cancel aborts the in-flight request
+	done := make(chan mcpCallResult, 1)
+	go func() {
+		result, err := c.CallTool(callCtx, toolRequest)
+		done <- mcpCallResult{result: result, err: err}
+	}()
+
+	var call mcpCallResult
+	select {
+	case <-callCtx.Done():
+		if ctx.Err() != nil {
+			return tools.NewTextErrorResponse("Tool execution canceled by user"), ctx.Err()
+		}
+		return tools.NewTextErrorResponse(fmt.Sprintf("MCP tool %s timed out after %s", toolName, mcpToolTimeout)), nil
+	case call = <-done:
+	}
+	if call.err != nil {
+		return tools.NewTextErrorResponse(call.err.Error()), nil
 	}
 
 	output := ""
-	for _, v := range result.Content {
+	for _, v := range call.result.Content {
 		if v, ok := v.(mcp.TextContent); ok {
 			output = v.Text
 		} else {
@@ -267,45 +303,154 @@ func shouldIncludeTool(toolName string, allowedTools []string, deniedTools []str
 	return true
 }
 
-func getTools(ctx context.Context, name string, m config.MCPServer, permissions permission.Service, manager *MCPClientManager) []tools.BaseTool {
-	var mcpTools []tools.BaseTool
-
+// listServerTools connects to an MCP server through the manager and returns the tools
+// its allow and deny lists let through
+func listServerTools(ctx context.Context, name string, m config.MCPServer, manager *MCPClientManager) ([]mcp.Tool, error) {
 	// Get client from manager (this will handle creation and initialization)
 	c, err := manager.GetClient(ctx, name, m)
 	if err != nil {
-		logging.Error("error getting mcp client", "server", name, "error", err)
-		return mcpTools
+		return nil, err
 	}
 
 	// List tools from the initialized client
 	toolsRequest := mcp.ListToolsRequest{}
 	listCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
-	tools, err := c.ListTools(listCtx, toolsRequest)
+	listed, err := c.ListTools(listCtx, toolsRequest)
 	if err != nil {
-		logging.Error("error listing tools", "server", name, "error", err)
-		return mcpTools
+		return nil, fmt.Errorf("failed to list tools: %w", err)
 	}
 
-	// Create tool instances with the manager, applying filtering if configured
-	for _, t := range tools.Tools {
-		toolName := t.Name
-
-		// Apply tool filtering based on configuration
-		if shouldIncludeTool(toolName, m.AllowedTools, m.DeniedTools) {
-			mcpTools = append(mcpTools, NewMcpTool(name, t, permissions, m, manager))
+	// Apply tool filtering based on configuration
+	var serverTools []mcp.Tool
+	for _, t := range listed.Tools {
+		if shouldIncludeTool(t.Name, m.AllowedTools, m.DeniedTools) {
+			serverTools = append(serverTools, t)
 		}
 	}
+	return serverTools, nil
+}
+
+func getTools(ctx context.Context, name string, m config.MCPServer, permissions permission.Service, manager *MCPClientManager) []tools.BaseTool {
+	var mcpTools []tools.BaseTool
+
+	serverTools, err := listServerTools(ctx, name, m, manager)
+	if err != nil {
+		logging.Error("error getting mcp tools", "server", name, "error", err)
+		return mcpTools
+	}
+
+	// Create tool instances with the manager
+	for _, t := range serverTools {
+		mcpTools = append(mcpTools, NewMcpTool(name, t, permissions, m, manager))
+	}
 
 	return mcpTools
 }
 
-func GetMcpTools(ctx context.Context, permissions permission.Service, manager *MCPClientManager) []tools.BaseTool {
-	var allTools []tools.BaseTool
+// MCPServerStatus is the result of connecting to an MCP server
+type MCPServerStatus struct {
+	Name      string   `json:"name"`
+	Connected bool     `json:"connected"`
+	Tools     []string `json:"tools"`
+	Error     string   `json:"error,omitempty"`
+}
 
+// CheckMCPServer connects to an MCP server, reconnecting if the manager already has a
+// client for it, and reports the tools it offers
+func CheckMCPServer(ctx context.Context, name string, m config.MCPServer, manager *MCPClientManager) MCPServerStatus {
+	manager.CloseClient(name)
+	status := MCPServerStatus{Name: name, Tools: []string{}}
+	serverTools, err := listServerTools(ctx, name, m, manager)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Connected = true
+	for _, t := range serverTools {
+		status.Tools = append(status.Tools, t.Name)
+	}
+	sort.Strings(status.Tools)
+	return status
+}
+
+// GetMcpToolsByServer connects to the configured MCP servers and returns their tools
+// keyed by server name. A server that fails to connect has no entry.
+// It returns nothing without connecting when MCP is disabled.
+func GetMcpToolsByServer(ctx context.Context, permissions permission.Service, manager *MCPClientManager) map[string][]tools.BaseTool {
+	if config.Get().DisableMCP {
+		return nil
+	}
+
+	byServer := make(map[string][]tools.BaseTool)
 	for name, m := range config.Get().MCPServers {
-		allTools = append(allTools, getTools(ctx, name, m, permissions, manager)...)
+		if serverTools := getTools(ctx, name, m, permissions, manager); len(serverTools) > 0 {
+			byServer[name] = serverTools
+		}
+	}
+	return byServer
+}
+
+// GetMcpTools connects to the configured MCP servers and returns their tools.
+// Tool names are prefixed with the server name, so different servers can still end up
+// with the same name, such as server "a_b" with tool "c" and server "a" with tool "b_c".
+// Only the tool of the server first in name order is kept; the others are skipped with
+// a warning. It returns nothing without connecting when MCP is disabled.
+func GetMcpTools(ctx context.Context, permissions permission.Service, manager *MCPClientManager) []tools.BaseTool {
+	byServer := GetMcpToolsByServer(ctx, permissions, manager)
+
+	var allTools []tools.BaseTool
+	owners := make(map[string]string)
+	for _, server := range sortedServers(byServer) {
+		for _, tool := range byServer[server] {
+			name := tool.Info().Name
+			if owner, taken := owners[name]; taken {
+				logging.Warn("skipping mcp tool whose name is already used by another server", "tool", name, "server", server, "kept", owner)
+				continue
+			}
+			owners[name] = server
+			allTools = append(allTools, tool)
+		}
 	}
 
 	return allTools
 }
+
+// MCPToolName returns the server an MCP tool comes from and the tool's name on that
+// server, without the prefix. ok is false when the tool is not an MCP tool.
+func MCPToolName(tool tools.BaseTool) (server, name string, ok bool) {
+	t, ok := tool.(*mcpTool)
+	if !ok {
+		return "", "", false
+	}
+	return t.mcpName, t.tool.Name, true
+}
+
+// MCPToolConflicts returns the prefixed tool names that more than one server offers,
+// each with the servers offering it in name order
+func MCPToolConflicts(byServer map[string][]tools.BaseTool) map[string][]string {
+	servers := make(map[string][]string)
+	for _, server := range sortedServers(byServer) {
+		for _, tool := range byServer[server] {
+			name := tool.Info().Name
+			servers[name] = append(servers[name], server)
+		}
+	}
+
+	conflicts := make(map[string][]string)
+	for name, offering := range servers {
+		if len(offering) > 1 {
+			conflicts[name] = offering
+		}
+	}
+	return conflicts
+}
+
+func sortedServers(byServer map[string][]tools.BaseTool) []string {
+	servers := make([]string, 0, len(byServer))
+	for server := range byServer {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	return servers
+}
@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"mix/internal/config"
+	"mix/internal/llm/tools"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMcpTools_Disabled(t *testing.T) {
+	cfg := config.Get()
+	cfg.MCPServers = map[string]config.MCPServer{
+		"broken": {Type: config.MCPStdio, Command: "mix-test-missing-mcp-server"},
+	}
+	cfg.DisableMCP = true
+	t.Cleanup(func() {
+		cfg.MCPServers = make(map[string]config.MCPServer)
+		cfg.DisableMCP = false
+	})
+
+	manager := NewMCPClientManager()
+	defer manager.Close()
+	assert.Empty(t, GetMcpTools(context.Background(), nil, manager))
+	assert.Empty(t, manager.clients, "no server should be started")
+
+	for _, tool := range CoderAgentTools(nil, nil, nil, nil, manager) {
+		assert.NotContains(t, tool.Info().Name, "broken_")
+	}
+}
+
+// blockingMCPClient is an MCP client whose tool calls block until released, honouring
+// the request context only when honourContext is set
+type blockingMCPClient struct {
+	MCPClient
+	honourContext bool
+	started       chan struct{}
+	release       chan struct{}
+}
+
+func (c *blockingMCPClient) CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	close(c.started)
+	if c.honourContext {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.release:
+		}
+	} else {
+		<-c.release
+	}
+	return mcp.NewToolResultText("finished"), nil
+}
+
+func TestRunTool_Cancel(t *testing.T) {
+	for _, honourContext := range []bool{true, false} {
+		t.Run(fmt.Sprintf("client honours context: %v", honourContext), func(t *testing.T) {
+			c := &blockingMCPClient{honourContext: honourContext, started: make(chan struct{}), release: make(chan struct{})}
+			t.Cleanup(func() { close(c.release) })
+
+			ctx, cancel := context.WithCancel(context.Background())
+			type runResult struct {
+				response tools.ToolResponse
+				err      error
+			}
+			done := make(chan runResult, 1)
+			go func() {
+				response, err := runTool(ctx, c, "render", `{"scene": "intro"}`)
+				done <- runResult{response, err}
+			}()
+
+			<-c.started
+			cancel()
+			select {
+			case result := <-done:
+				assert.ErrorIs(t, result.err, context.Canceled)
+				assert.True(t, result.response.IsError)
+				assert.Equal(t, "Tool execution canceled by user", result.response.Content)
+			case <-time.After(time.Second):
+				t.Fatal("the MCP tool call was not aborted")
+			}
+		})
+	}
+}
+
+func TestRunTool_Result(t *testing.T) {
+	c := &blockingMCPClient{honourContext: true, started: make(chan struct{}), release: make(chan struct{})}
+	close(c.release)
+	response, err := runTool(context.Background(), c, "render", `{"scene": "intro"}`)
+	require.NoError(t, err)
+	assert.False(t, response.IsError)
+	assert.Equal(t, "finished", response.Content)
+}
+
+// newTestMCPServer serves an MCP server over SSE with the named tools
+func newTestMCPServer(t *testing.T, toolNames ...string) config.MCPServer {
+	t.Helper()
+	s := server.NewMCPServer("test", "1.0.0")
+	for _, name := range toolNames {
+		s.AddTool(mcp.NewTool(name, mcp.WithDescription("test tool "+name)), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("ok"), nil
+		})
+	}
+	testServer := server.NewTestServer(s)
+	t.Cleanup(func() {
+		// The SSE stream stays open, so drop it rather than waiting for it on Close
+		testServer.CloseClientConnections()
+		testServer.Close()
+	})
+	return config.MCPServer{Type: config.MCPSse, URL: testServer.URL + "/sse"}
+}
+
+func TestCheckMCPServer(t *testing.T) {
+	ctx := context.Background()
+	manager := NewMCPClientManager()
+	defer manager.Close()
+
+	t.Run("connected", func(t *testing.T) {
+		serverConfig := newTestMCPServer(t, "search", "fetch", "delete")
+		serverConfig.DeniedTools = []string{"delete"}
+
+		status := CheckMCPServer(ctx, "docs", serverConfig, manager)
+		assert.True(t, status.Connected)
+		assert.Empty(t, status.Error)
+		assert.Equal(t, []string{"fetch", "search"}, status.Tools)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		status := CheckMCPServer(ctx, "broken", config.MCPServer{Type: config.MCPStdio, Command: "mix-test-missing-mcp-server"}, manager)
+		assert.False(t, status.Connected)
+		assert.NotEmpty(t, status.Error)
+		assert.Empty(t, status.Tools)
+	})
+}
+
+func TestGetMcpTools_UnderscoreNames(t *testing.T) {
+	cfg := config.Get()
+	cfg.MCPServers = map[string]config.MCPServer{
+		"a":   newTestMCPServer(t, "b_c", "read_file"),
+		"a_b": newTestMCPServer(t, "c"),
+	}
+	t.Cleanup(func() { cfg.MCPServers = make(map[string]config.MCPServer) })
+
+	ctx := context.Background()
+	manager := NewMCPClientManager()
+	defer manager.Close()
+
+	byServer := GetMcpToolsByServer(ctx, nil, manager)
+	require.Len(t, byServer, 2)
+	names := func(serverTools []tools.BaseTool) []string {
+		var names []string
+		for _, tool := range serverTools {
+			server, name, ok := MCPToolName(tool)
+			require.True(t, ok)
+			names = append(names, server+":"+name)
+		}
+		return names
+	}
+	assert.ElementsMatch(t, []string{"a:b_c", "a:read_file"}, names(byServer["a"]))
+	assert.Equal(t, []string{"a_b:c"}, names(byServer["a_b"]))
+
+	assert.Equal(t, map[string][]string{"a_b_c": {"a", "a_b"}}, MCPToolConflicts(byServer))
+
+	// The colliding name is loaded once, from the server first in name order
+	loaded := GetMcpTools(ctx, nil, manager)
+	assert.ElementsMatch(t, []string{"a:b_c", "a:read_file"}, names(loaded))
+
+	_, _, ok := MCPToolName(&fakeTool{name: "view"})
+	assert.False(t, ok)
+}
+
+func TestAgent_SetMCPTools(t *testing.T) {
+	builtin := &fakeTool{name: "view"}
+	a := &agent{tools: []tools.BaseTool{builtin, &mcpTool{mcpName: "old", tool: mcp.NewTool("search")}}}
+
+	replacement := &mcpTool{mcpName: "docs", tool: mcp.NewTool("fetch")}
+	require.NoError(t, a.SetMCPTools([]tools.BaseTool{replacement}))
+	assert.Equal(t, []tools.BaseTool{builtin, replacement}, a.tools)
+
+	require.NoError(t, a.SetMCPTools(nil))
+	assert.Equal(t, []tools.BaseTool{builtin}, a.tools)
+
+	a.activeRequests.Store("session", context.CancelFunc(func() {}))
+	assert.Error(t, a.SetMCPTools([]tools.BaseTool{replacement}))
+	assert.Equal(t, []tools.BaseTool{builtin}, a.tools)
+}
+
+// Run with -race: the tools are read while SetMCPTools replaces them
+func TestAgent_SetMCPTools_ConcurrentReads(t *testing.T) {
+	builtin := &fakeTool{name: "view"}
+	a := &agent{tools: []tools.BaseTool{builtin}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			assert.Contains(t, a.Tools(), tools.BaseTool(builtin))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, a.SetMCPTools([]tools.BaseTool{&mcpTool{mcpName: "docs", tool: mcp.NewTool(fmt.Sprintf("fetch%d", i))}}))
+	}
+	<-done
+	assert.Len(t, a.Tools(), 2)
+}
@@ -0,0 +1,30 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"mix/internal/config"
+	"mix/internal/logging"
+)
+
+// ErrMessageTooLong is returned for a user message over the configured maximum length
+var ErrMessageTooLong = errors.New("message is too long")
+
+// LimitMessageLength applies the configured message limit to the text of a user message.
+// Messages over the limit are cut to it under the truncate policy and rejected otherwise.
+// Callers apply it to the text before wrapping it, so a truncated message stays valid.
+func LimitMessageLength(content string) (string, error) {
+	limit := config.Get().MessageLimit
+	length := utf8.RuneCountInString(content)
+	if limit.MaxLength <= 0 || length <= limit.MaxLength {
+		return content, nil
+	}
+
+	if limit.Policy != config.MessageLimitTruncate {
+		return "", fmt.Errorf("%w: %d characters, the maximum is %d", ErrMessageTooLong, length, limit.MaxLength)
+	}
+	logging.Warn("Truncating message over the maximum length", "length", length, "maxLength", limit.MaxLength)
+	return string([]rune(content)[:limit.MaxLength]), nil
+}
@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"mix/internal/llm/tools"
+	"mix/internal/pubsub"
+)
+
+// ToolMetrics aggregates execution statistics for a single tool
+type ToolMetrics struct {
+	Calls           int64 `json:"calls"`
+	Errors          int64 `json:"errors"`
+	TotalDurationMs int64 `json:"totalDurationMs"`
+	AvgDurationMs   int64 `json:"avgDurationMs"`
+}
+
+// toolMetricsRecorder tracks per-tool metrics globally and per session
+type toolMetricsRecorder struct {
+	mu       sync.Mutex
+	global   map[string]*ToolMetrics
+	sessions map[string]map[string]*ToolMetrics
+}
+
+func newToolMetricsRecorder() *toolMetricsRecorder {
+	return &toolMetricsRecorder{
+		global:   make(map[string]*ToolMetrics),
+		sessions: make(map[string]map[string]*ToolMetrics),
+	}
+}
+
+func (r *toolMetricsRecorder) record(sessionID, toolName string, duration time.Duration, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sessions[sessionID] == nil {
+		r.sessions[sessionID] = make(map[string]*ToolMetrics)
+	}
+	for _, byTool := range []map[string]*ToolMetrics{r.global, r.sessions[sessionID]} {
+		metrics, ok := byTool[toolName]
+		if !ok {
+			metrics = &ToolMetrics{}
+			byTool[toolName] = metrics
+		}
+		metrics.Calls++
+		if failed {
+			metrics.Errors++
+		}
+		metrics.TotalDurationMs += duration.Milliseconds()
+		metrics.AvgDurationMs = metrics.TotalDurationMs / metrics.Calls
+	}
+}
+
+// snapshot returns a copy of the metrics for a session, or for all sessions if sessionID is empty
+func (r *toolMetricsRecorder) snapshot(sessionID string) map[string]ToolMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byTool := r.global
+	if sessionID != "" {
+		byTool = r.sessions[sessionID]
+	}
+
+	result := make(map[string]ToolMetrics, len(byTool))
+	for name, metrics := range byTool {
+		result[name] = *metrics
+	}
+	return result
+}
+
+func (a *agent) ToolMetrics(sessionID string) map[string]ToolMetrics {
+	return a.toolMetrics.snapshot(sessionID)
+}
+
+// runTool executes a tool call, masks secrets in its result and records its duration
+// and outcome
+func (a *agent) runTool(ctx context.Context, sessionID string, tool tools.BaseTool, call tools.ToolCall) (tools.ToolResponse, time.Duration, error) {
+	ctx = tools.WithProgress(ctx, func(progress tools.ToolProgress) {
+		progress.ToolCallID = call.ID
+		a.Publish(pubsub.CreatedEvent, AgentEvent{
+			Type:         AgentEventTypeToolProgress,
+			SessionID:    sessionID,
+			Progress:     progress.Message,
+			ToolProgress: &progress,
+		})
+	})
+
+	startTime := time.Now()
+	result, err := tool.Run(ctx, call)
+	duration := time.Since(startTime)
+	result.Content = tools.RedactToolResult(call.Name, result.Content)
+
+	a.toolMetrics.record(sessionID, call.Name, duration, err != nil || result.IsError)
+	return result, duration, err
+}
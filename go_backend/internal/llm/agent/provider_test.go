@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mix/internal/config"
+	"mix/internal/llm/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVertexAIBackend(t *testing.T) {
+	for _, key := range []string{"VERTEXAI_PROJECT", "VERTEXAI_LOCATION", "GOOGLE_CLOUD_PROJECT", "GOOGLE_CLOUD_REGION", "GOOGLE_CLOUD_LOCATION"} {
+		t.Setenv(key, "")
+	}
+
+	t.Run("gemini with an API key", func(t *testing.T) {
+		_, _, ok := vertexAIBackend(models.ProviderGemini, config.Provider{APIKey: "key"})
+		assert.False(t, ok)
+	})
+
+	t.Run("gemini with a configured project", func(t *testing.T) {
+		project, location, ok := vertexAIBackend(models.ProviderGemini, config.Provider{Project: "my-project", Location: "europe-west4"})
+		assert.True(t, ok)
+		assert.Equal(t, "my-project", project)
+		assert.Equal(t, "europe-west4", location)
+	})
+
+	t.Run("gemini without an API key uses the environment", func(t *testing.T) {
+		t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+		t.Setenv("GOOGLE_CLOUD_REGION", "us-east1")
+		project, location, ok := vertexAIBackend(models.ProviderGemini, config.Provider{})
+		assert.True(t, ok)
+		assert.Equal(t, "env-project", project)
+		assert.Equal(t, "us-east1", location)
+	})
+
+	t.Run("vertexai provider", func(t *testing.T) {
+		t.Setenv("VERTEXAI_PROJECT", "vertex-project")
+		t.Setenv("VERTEXAI_LOCATION", "us-central1")
+		project, location, ok := vertexAIBackend(models.ProviderVertexAI, config.Provider{APIKey: "vertex-ai-credentials-available"})
+		assert.True(t, ok)
+		assert.Equal(t, "vertex-project", project)
+		assert.Equal(t, "us-central1", location)
+	})
+
+	t.Run("other providers", func(t *testing.T) {
+		_, _, ok := vertexAIBackend(models.ProviderOpenAI, config.Provider{Project: "my-project"})
+		assert.False(t, ok)
+	})
+}
+
+func TestAgent_UpdateReasoningEffort(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	cfgJSON := `{"providers": {"openai": {"apiKey": "test-key"}}, "agents": {"main": {"model": "o4-mini", "reasoningEffort": "low"}, "sub": {"model": "o4-mini"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".mix.json"), []byte(cfgJSON), 0o644))
+	cfg, err := config.Load(tmpDir, false, false)
+	require.NoError(t, err)
+	// The system prompt is loaded from the module root
+	cfg.WorkingDir, err = filepath.Abs("../../..")
+	require.NoError(t, err)
+	t.Cleanup(func() { cfg.WorkingDir = tmpDir })
+	require.Equal(t, "low", cfg.Agents[config.AgentMain].ReasoningEffort)
+
+	scripted := &scriptedProvider{}
+	a, _ := newTestAgent(t, scripted, 0)
+
+	t.Run("refused while busy", func(t *testing.T) {
+		a.activeRequests.Store("session", context.CancelFunc(func() {}))
+		defer a.activeRequests.Delete("session")
+
+		require.Error(t, a.UpdateReasoningEffort(config.AgentMain, "high"))
+		assert.Same(t, scripted, a.provider)
+		assert.Equal(t, "low", cfg.Agents[config.AgentMain].ReasoningEffort)
+	})
+
+	t.Run("invalid effort", func(t *testing.T) {
+		require.Error(t, a.UpdateReasoningEffort(config.AgentMain, "extreme"))
+		assert.Same(t, scripted, a.provider)
+	})
+
+	t.Run("provider is rebuilt with the new effort", func(t *testing.T) {
+		require.NoError(t, a.UpdateReasoningEffort(config.AgentMain, "HIGH"))
+		assert.NotSame(t, scripted, a.provider)
+		assert.Equal(t, models.O4Mini, a.provider.Model().ID)
+		assert.Equal(t, "high", cfg.Agents[config.AgentMain].ReasoningEffort)
+
+		saved, err := os.ReadFile(filepath.Join(tmpDir, ".mix.json"))
+		require.NoError(t, err)
+		assert.Contains(t, string(saved), `"reasoningEffort": "high"`)
+	})
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mix/internal/llm/provider"
+	"mix/internal/llm/tools"
+	"mix/internal/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rateLimitedProvider is rate limited on every call. Each call retries until it is
+// cancelled, except that the first call answers with a tool call after firstRetries.
+type rateLimitedProvider struct {
+	scriptedProvider
+	firstRetries int
+	retries      int
+}
+
+func (p *rateLimitedProvider) StreamResponse(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan provider.ProviderEvent {
+	first := len(p.requests) == 0
+	p.requests = append(p.requests, messages)
+
+	events := make(chan provider.ProviderEvent)
+	go func() {
+		defer close(events)
+		for attempt := 1; ; attempt++ {
+			if first && attempt > p.firstRetries {
+				toolCall := message.ToolCall{ID: "call-1", Name: "view", Input: "{}", Finished: true}
+				events <- provider.ProviderEvent{Type: provider.EventComplete, Response: &provider.ProviderResponse{
+					ToolCalls:    []message.ToolCall{toolCall},
+					FinishReason: message.FinishReasonToolUse,
+				}}
+				return
+			}
+			select {
+			case events <- provider.ProviderEvent{Type: provider.EventRetry, Retry: &provider.RetryInfo{Attempt: attempt, MaxAttempts: 8, Delay: time.Millisecond}}:
+				p.retries++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+
+func TestAgent_RetryBudget(t *testing.T) {
+	p := &rateLimitedProvider{firstRetries: 3}
+	a, sessionID := newTestAgent(t, p, 0)
+	a.tools = []tools.BaseTool{&fakeTool{name: "view"}}
+	a.retryBudget = 5
+
+	done := make(chan AgentEvent, 1)
+	go func() { done <- a.processGeneration(context.Background(), sessionID, "What is in the file?", nil) }()
+
+	var result AgentEvent
+	select {
+	case result = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the turn should fail once its retry budget is used up")
+	}
+	require.ErrorIs(t, result.Error, ErrRetryBudgetExhausted)
+	assert.Equal(t, provider.ErrorCategoryRateLimit, provider.ClassifyError(result.Error))
+
+	// The budget is shared: three retries for the tool call, then three for the answer,
+	// the last of which is one more than the budget allows
+	assert.Len(t, p.requests, 2)
+	assert.Equal(t, 6, p.retries)
+}
+
+func TestTurnRetryBudget(t *testing.T) {
+	assert.Equal(t, defaultRetryBudget, turnRetryBudget(0))
+	assert.Equal(t, 3, turnRetryBudget(3))
+	assert.Zero(t, turnRetryBudget(-1), "a negative budget removes the limit")
+}
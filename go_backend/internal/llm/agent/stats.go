@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"sync"
+	"time"
+)
+
+// TurnStats is how fast a turn was answered. Latency and TimeToFirstToken are measured
+// from when the message was sent. A turn can make several provider requests for tool
+// results and continuations; TokensPerSecond divides the output tokens of all of them
+// by the time spent streaming them, so time spent running tools is left out.
+type TurnStats struct {
+	Latency          time.Duration
+	TimeToFirstToken time.Duration
+	GenerationTime   time.Duration
+	OutputTokens     int64
+	TokensPerSecond  float64
+	Requests         int
+}
+
+// turnTimer records when a turn's provider requests start, stream their first token
+// and complete
+type turnTimer struct {
+	mu             sync.Mutex
+	started        time.Time
+	requests       int
+	requestStarted time.Time
+	firstToken     time.Time // zero until the running request streams a token
+	turnFirstToken time.Time
+	generation     time.Duration
+	outputTokens   int64
+}
+
+func newTurnTimer(started time.Time) *turnTimer {
+	return &turnTimer{started: started}
+}
+
+func (t *turnTimer) requestStart(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests++
+	t.requestStarted = now
+	t.firstToken = time.Time{}
+}
+
+// token records a streamed token; only the first of each request matters
+func (t *turnTimer) token(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.firstToken.IsZero() {
+		return
+	}
+	t.firstToken = now
+	if t.turnFirstToken.IsZero() {
+		t.turnFirstToken = now
+	}
+}
+
+func (t *turnTimer) requestComplete(now time.Time, outputTokens int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// A response with nothing streamed was generated between the request and its end
+	streamStart := t.firstToken
+	if streamStart.IsZero() {
+		streamStart = t.requestStarted
+	}
+	t.generation += now.Sub(streamStart)
+	t.outputTokens += outputTokens
+}
+
+// stats returns the stats of the turn ending at end
+func (t *turnTimer) stats(end time.Time) TurnStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := TurnStats{
+		Latency:        end.Sub(t.started),
+		GenerationTime: t.generation,
+		OutputTokens:   t.outputTokens,
+		Requests:       t.requests,
+	}
+	if !t.turnFirstToken.IsZero() {
+		stats.TimeToFirstToken = t.turnFirstToken.Sub(t.started)
+	}
+	if t.generation > 0 {
+		stats.TokensPerSecond = float64(t.outputTokens) / t.generation.Seconds()
+	}
+	return stats
+}
+
+// timeTurn records timings in the session's running turn, if there is one
+func (a *agent) timeTurn(sessionID string, record func(*turnTimer)) {
+	if value, ok := a.turnTimers.Load(sessionID); ok {
+		record(value.(*turnTimer))
+	}
+}
+
+// LastTurnStats returns the stats of the last turn answered for a session, and false
+// when no turn has completed since the agent started
+func (a *agent) LastTurnStats(sessionID string) (TurnStats, bool) {
+	value, ok := a.lastTurnStats.Load(sessionID)
+	if !ok {
+		return TurnStats{}, false
+	}
+	return value.(TurnStats), true
+}
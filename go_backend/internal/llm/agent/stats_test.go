@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mix/internal/llm/provider"
+	"mix/internal/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTurnTimer_Stats(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	t.Run("tool call and answer", func(t *testing.T) {
+		timer := newTurnTimer(start)
+		// The first request streams a tool call from 400ms to 900ms
+		timer.requestStart(at(50))
+		timer.token(at(400))
+		timer.token(at(600))
+		timer.requestComplete(at(900), 40)
+		// The tool runs for 2s, which doesn't count towards generation time
+		timer.requestStart(at(2900))
+		timer.token(at(3200))
+		timer.requestComplete(at(4700), 160)
+
+		stats := timer.stats(at(4750))
+		assert.Equal(t, TurnStats{
+			Latency:          4750 * time.Millisecond,
+			TimeToFirstToken: 400 * time.Millisecond,
+			GenerationTime:   2 * time.Second,
+			OutputTokens:     200,
+			TokensPerSecond:  100,
+			Requests:         2,
+		}, stats)
+	})
+
+	t.Run("nothing streamed", func(t *testing.T) {
+		timer := newTurnTimer(start)
+		timer.requestStart(at(100))
+		timer.requestComplete(at(600), 25)
+
+		stats := timer.stats(at(600))
+		assert.Zero(t, stats.TimeToFirstToken)
+		assert.Equal(t, 500*time.Millisecond, stats.GenerationTime)
+		assert.Equal(t, 50.0, stats.TokensPerSecond)
+	})
+
+	t.Run("no requests", func(t *testing.T) {
+		stats := newTurnTimer(start).stats(at(10))
+		assert.Equal(t, TurnStats{Latency: 10 * time.Millisecond}, stats)
+	})
+}
+
+func TestAgent_LastTurnStats(t *testing.T) {
+	p := &scriptedProvider{responses: []provider.ProviderResponse{
+		{Content: "The first half, ", FinishReason: message.FinishReasonMaxTokens, Usage: provider.TokenUsage{OutputTokens: 50}},
+		{Content: "and the second half.", FinishReason: message.FinishReasonEndTurn, Usage: provider.TokenUsage{OutputTokens: 20, ReasoningTokens: 5}},
+	}}
+	a, sessionID := newTestAgent(t, p, 1)
+
+	_, ok := a.LastTurnStats(sessionID)
+	assert.False(t, ok, "no turn has completed yet")
+
+	result := a.processGeneration(context.Background(), sessionID, "write something long", nil)
+	require.NoError(t, result.Error)
+
+	stats, ok := a.LastTurnStats(sessionID)
+	require.True(t, ok)
+	assert.Equal(t, 2, stats.Requests)
+	assert.Equal(t, int64(75), stats.OutputTokens)
+	assert.Positive(t, stats.Latency)
+	assert.LessOrEqual(t, stats.TimeToFirstToken, stats.Latency)
+	assert.LessOrEqual(t, stats.GenerationTime, stats.Latency)
+}
@@ -0,0 +1,210 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"mix/internal/llm/models"
+	"mix/internal/llm/prompt"
+	"mix/internal/llm/provider"
+	"mix/internal/message"
+	"mix/internal/pubsub"
+)
+
+// charsPerToken is the rough number of characters per token used to estimate the size
+// of a response while it streams
+const charsPerToken = 4
+
+// tokenEstimateInterval is how often the running estimate is published while streaming
+const tokenEstimateInterval = 500 * time.Millisecond
+
+// TokenCount is the size of the response being generated. While it streams,
+// OutputTokens is estimated from the streamed text and Estimated is set; the count
+// published when the response completes holds the exact usage from the provider.
+type TokenCount struct {
+	InputTokens  int64
+	OutputTokens int64
+	Estimated    bool
+}
+
+// tokenEstimate accumulates the text streamed for a response
+type tokenEstimate struct {
+	chars     int
+	published time.Time
+}
+
+func (e *tokenEstimate) tokens() int64 {
+	return int64((e.chars + charsPerToken - 1) / charsPerToken)
+}
+
+// estimateTokens adds streamed text to the estimate for a response and publishes it,
+// at most once per tokenEstimateInterval
+func (a *agent) estimateTokens(sessionID, messageID, text string) {
+	value, _ := a.tokenEstimates.LoadOrStore(messageID, &tokenEstimate{})
+	estimate := value.(*tokenEstimate)
+	estimate.chars += utf8.RuneCountInString(text)
+	if time.Since(estimate.published) < tokenEstimateInterval {
+		return
+	}
+	estimate.published = time.Now()
+
+	a.Publish(pubsub.CreatedEvent, AgentEvent{
+		Type:      AgentEventTypeTokens,
+		SessionID: sessionID,
+		Tokens:    &TokenCount{OutputTokens: estimate.tokens(), Estimated: true},
+	})
+}
+
+// publishTokenUsage replaces the estimate for a response with the usage the provider reported
+func (a *agent) publishTokenUsage(sessionID, messageID string, usage provider.TokenUsage) {
+	a.tokenEstimates.Delete(messageID)
+	a.Publish(pubsub.CreatedEvent, AgentEvent{
+		Type:      AgentEventTypeTokens,
+		SessionID: sessionID,
+		Tokens: &TokenCount{
+			InputTokens:  usage.InputTokens + usage.CacheCreationTokens + usage.CacheReadTokens,
+			OutputTokens: usage.OutputTokens + usage.ReasoningTokens,
+		},
+	})
+}
+
+// TurnUsage is the tokens and cost of every provider call made while answering one
+// message, including the follow-up calls for tool results and continuations
+type TurnUsage struct {
+	InputTokens         int64
+	OutputTokens        int64
+	CacheCreationTokens int64
+	CacheReadTokens     int64
+	ReasoningTokens     int64
+	Cost                float64
+	// Retries is how many times the turn's provider calls were retried after a rate limit
+	Retries int
+}
+
+// addTurnUsage adds a completed provider call to the usage of the session's running turn
+func (a *agent) addTurnUsage(sessionID string, usage provider.TokenUsage, model models.Model) {
+	value, ok := a.turnUsage.Load(sessionID)
+	if !ok {
+		return
+	}
+	turn := value.(*TurnUsage)
+	turn.InputTokens += usage.InputTokens
+	turn.OutputTokens += usage.OutputTokens
+	turn.CacheCreationTokens += usage.CacheCreationTokens
+	turn.CacheReadTokens += usage.CacheReadTokens
+	turn.ReasoningTokens += usage.ReasoningTokens
+	turn.Cost += usage.Cost(model)
+}
+
+// addTurnRetry counts a rate-limit retry in the session's running turn and returns the
+// turn's retries so far, or false when no turn is running
+func (a *agent) addTurnRetry(sessionID string) (int, bool) {
+	value, ok := a.turnUsage.Load(sessionID)
+	if !ok {
+		return 0, false
+	}
+	turn := value.(*TurnUsage)
+	turn.Retries++
+	return turn.Retries, true
+}
+
+// turnRetryBudget returns the retry budget for a configured value: the default for zero
+// and no limit (0) for a negative value
+func turnRetryBudget(configured int) int {
+	switch {
+	case configured == 0:
+		return defaultRetryBudget
+	case configured < 0:
+		return 0
+	}
+	return configured
+}
+
+// currentTurnUsage returns a copy of the usage of the session's running turn, or nil
+func (a *agent) currentTurnUsage(sessionID string) *TurnUsage {
+	value, ok := a.turnUsage.Load(sessionID)
+	if !ok {
+		return nil
+	}
+	usage := *value.(*TurnUsage)
+	return &usage
+}
+
+// ContextTokens is the size of what the agent sends its provider for a session. The
+// counts come from the provider's tokenizer, or are estimated from the length of the
+// text when Estimated is set.
+type ContextTokens struct {
+	SystemPrompt      int64
+	Tools             int64
+	UserMessages      int64
+	AssistantMessages int64
+	ToolResults       int64
+	Estimated         bool
+}
+
+// ContextTokens counts the tokens of the system prompt, tool descriptions and the
+// messages that the next request for the session would send, starting from the
+// summary when the session has been summarized and limited to the history window
+func (a *agent) ContextTokens(ctx context.Context, sessionID string) (ContextTokens, error) {
+	model := a.provider.Model()
+	tokenizer, ok := provider.TokenizerFor(model)
+	counts := ContextTokens{
+		SystemPrompt: tokenizer.CountTokens(prompt.GetAgentPrompt(a.name, model.Provider)),
+		Estimated:    !ok,
+	}
+
+	for _, tool := range a.Tools() {
+		info := tool.Info()
+		parameters, err := json.Marshal(info.Parameters)
+		if err != nil {
+			return ContextTokens{}, fmt.Errorf("failed to encode parameters of tool %s: %w", info.Name, err)
+		}
+		counts.Tools += tokenizer.CountTokens(info.Name + "\n" + info.Description + "\n" + string(parameters))
+	}
+
+	msgs, err := a.messages.List(ctx, sessionID)
+	if err != nil {
+		return ContextTokens{}, fmt.Errorf("failed to list messages: %w", err)
+	}
+	session, err := a.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return ContextTokens{}, fmt.Errorf("failed to get session: %w", err)
+	}
+	summarized := false
+	if session.SummaryMessageID != "" {
+		for i, msg := range msgs {
+			if msg.ID == session.SummaryMessageID {
+				// The summary is sent as a user message, as in Run
+				msgs = msgs[i:]
+				msgs[0].Role = message.User
+				summarized = true
+				break
+			}
+		}
+	}
+	if a.historyWindow > 0 {
+		// The next message starts a turn of its own
+		msgs = windowHistory(msgs, a.historyWindow-1, summarized)
+	}
+
+	for _, msg := range msgs {
+		switch msg.Role {
+		case message.Assistant:
+			tokens := tokenizer.CountTokens(msg.Content().Text)
+			for _, call := range msg.ToolCalls() {
+				tokens += tokenizer.CountTokens(call.Name + call.Input)
+			}
+			counts.AssistantMessages += tokens
+		case message.Tool:
+			for _, result := range msg.ToolResults() {
+				counts.ToolResults += tokenizer.CountTokens(result.Content)
+			}
+		default:
+			counts.UserMessages += tokenizer.CountTokens(msg.Content().Text)
+		}
+	}
+	return counts, nil
+}
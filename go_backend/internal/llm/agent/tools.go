@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"runtime"
 	"time"
 
 	"mix/internal/history"
@@ -22,24 +23,28 @@ func CoderAgentTools(
 	defer cancel()
 	otherTools := GetMcpTools(ctx, permissions, manager)
 	bashTool := tools.NewBashTool(permissions)
-	return append(
-		[]tools.BaseTool{
-			bashTool,
-			tools.NewEditTool(permissions, history),
-			tools.NewFetchTool(permissions),
-			tools.NewGlobTool(),
-			tools.NewGrepTool(),
-			tools.NewLsTool(),
-			tools.NewViewTool(),
-			tools.NewWriteTool(permissions, history),
-			tools.NewPythonExecutionTool(permissions),
-			tools.NewTodoWriteTool(),
-			tools.NewExitPlanModeTool(),
-			// tools.NewPixelmatorTool(permissions, bashTool),
-			// tools.NewNotesTool(permissions, bashTool),
-			NewAgentTool(sessions, messages),
-		}, otherTools...,
-	)
+	coderTools := []tools.BaseTool{
+		bashTool,
+		tools.NewEditTool(permissions, history),
+		tools.NewPatchTool(permissions, history),
+		tools.NewFetchTool(permissions),
+		tools.NewGlobTool(),
+		tools.NewGrepTool(),
+		tools.NewLsTool(),
+		tools.NewViewTool(history),
+		tools.NewWriteTool(permissions, history),
+		tools.NewPythonExecutionTool(permissions),
+		tools.NewTodoWriteTool(),
+		tools.NewExitPlanModeTool(),
+		// tools.NewPixelmatorTool(permissions, bashTool),
+		// tools.NewNotesTool(permissions, bashTool),
+		NewAgentTool(sessions, messages),
+	}
+	// Pixelmator Pro and the editors are scripted with AppleScript, so they are only available on macOS
+	if runtime.GOOS == "darwin" {
+		coderTools = append(coderTools, tools.NewPixelmatorThumbnailTool(permissions), tools.NewOpenInEditorTool(permissions))
+	}
+	return append(coderTools, otherTools...)
 }
 
 func TaskAgentTools() []tools.BaseTool {
@@ -47,6 +52,6 @@ func TaskAgentTools() []tools.BaseTool {
 		tools.NewGlobTool(),
 		tools.NewGrepTool(),
 		tools.NewLsTool(),
-		tools.NewViewTool(),
+		tools.NewViewTool(nil),
 	}
 }
@@ -0,0 +1,30 @@
+package agent
+
+import (
+	"mix/internal/message"
+)
+
+// windowHistory keeps the summary, when the history starts with one, and the last turns
+// of the history. A turn starts at a user message and holds the responses, tool calls
+// and tool results that follow it, so the window never separates a tool result from
+// the call it answers.
+func windowHistory(history []message.Message, turns int, summarized bool) []message.Message {
+	var summary []message.Message
+	if summarized && len(history) > 0 {
+		summary, history = history[:1], history[1:]
+	}
+
+	start := len(history)
+	for i := len(history) - 1; i >= 0 && turns > 0; i-- {
+		if history[i].Role == message.User {
+			start = i
+			turns--
+		}
+	}
+	if start == 0 {
+		return append(summary, history...)
+	}
+	windowed := make([]message.Message, 0, len(summary)+len(history)-start)
+	windowed = append(windowed, summary...)
+	return append(windowed, history[start:]...)
+}
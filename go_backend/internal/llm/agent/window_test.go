@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"mix/internal/llm/provider"
+	"mix/internal/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowHistory(t *testing.T) {
+	msg := func(role message.MessageRole, id string) message.Message {
+		return message.Message{ID: id, Role: role}
+	}
+	history := []message.Message{
+		msg(message.User, "summary"),
+		msg(message.User, "u1"), msg(message.Assistant, "a1"),
+		msg(message.User, "u2"), msg(message.Assistant, "a2-call"), msg(message.Tool, "t2"), msg(message.Assistant, "a2"),
+		msg(message.User, "u3"), msg(message.Assistant, "a3"),
+	}
+	ids := func(history []message.Message) []string {
+		var result []string
+		for _, msg := range history {
+			result = append(result, msg.ID)
+		}
+		return result
+	}
+
+	t.Run("keeps whole turns", func(t *testing.T) {
+		assert.Equal(t, []string{"u2", "a2-call", "t2", "a2", "u3", "a3"}, ids(windowHistory(history[1:], 2, false)))
+	})
+
+	t.Run("keeps the summary ahead of the window", func(t *testing.T) {
+		assert.Equal(t, []string{"summary", "u3", "a3"}, ids(windowHistory(history, 1, true)))
+	})
+
+	t.Run("a window larger than the history keeps everything", func(t *testing.T) {
+		assert.Equal(t, ids(history), ids(windowHistory(history, 10, true)))
+		assert.Equal(t, ids(history[1:]), ids(windowHistory(history[1:], 10, false)))
+	})
+
+	t.Run("leading tool results without their call are dropped", func(t *testing.T) {
+		assert.Equal(t, []string{"u3", "a3"}, ids(windowHistory(history[5:], 1, false)))
+	})
+}
+
+func TestAgent_HistoryWindow(t *testing.T) {
+	p := &scriptedProvider{responses: []provider.ProviderResponse{{Content: "ok", FinishReason: message.FinishReasonEndTurn}}}
+	a, sessionID := newTestAgent(t, p, 0)
+	a.historyWindow = 2
+	ctx := context.Background()
+
+	create := func(role message.MessageRole, parts ...message.ContentPart) {
+		_, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{Role: role, Parts: parts})
+		require.NoError(t, err)
+	}
+	create(message.User, message.TextContent{Text: "first question"})
+	create(message.Assistant, message.TextContent{Text: "first answer"})
+	create(message.User, message.TextContent{Text: "list the files"})
+	create(message.Assistant, message.ToolCall{ID: "call-1", Name: "ls", Input: "{}", Finished: true}, message.Finish{Reason: message.FinishReasonToolUse})
+	create(message.Tool, message.ToolResult{ToolCallID: "call-1", Content: "main.go"})
+	create(message.Assistant, message.TextContent{Text: "there is main.go"})
+
+	result := a.processGeneration(ctx, sessionID, "and now?", nil)
+	require.NoError(t, result.Error)
+
+	// Only the last turn before the new message is sent, with its tool call and result
+	require.Len(t, p.requests, 1)
+	var sent []string
+	for _, msg := range p.requests[0] {
+		sent = append(sent, string(msg.Role)+": "+msg.Content().Text)
+	}
+	assert.Equal(t, []string{
+		"user: list the files",
+		"assistant: ",
+		"tool: ",
+		"assistant: there is main.go",
+		"user: and now?",
+	}, sent)
+}
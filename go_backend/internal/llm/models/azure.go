@@ -29,6 +29,7 @@ var AzureModels = map[ModelID]Model{
 		ContextWindow:       OpenAIModels[GPT41].ContextWindow,
 		DefaultMaxTokens:    OpenAIModels[GPT41].DefaultMaxTokens,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	AzureGPT41Mini: {
 		ID:                  AzureGPT41Mini,
@@ -42,6 +43,7 @@ var AzureModels = map[ModelID]Model{
 		ContextWindow:       OpenAIModels[GPT41Mini].ContextWindow,
 		DefaultMaxTokens:    OpenAIModels[GPT41Mini].DefaultMaxTokens,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	AzureGPT41Nano: {
 		ID:                  AzureGPT41Nano,
@@ -55,6 +57,7 @@ var AzureModels = map[ModelID]Model{
 		ContextWindow:       OpenAIModels[GPT41Nano].ContextWindow,
 		DefaultMaxTokens:    OpenAIModels[GPT41Nano].DefaultMaxTokens,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	AzureGPT45Preview: {
 		ID:                  AzureGPT45Preview,
@@ -68,6 +71,7 @@ var AzureModels = map[ModelID]Model{
 		ContextWindow:       OpenAIModels[GPT45Preview].ContextWindow,
 		DefaultMaxTokens:    OpenAIModels[GPT45Preview].DefaultMaxTokens,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	AzureGPT4o: {
 		ID:                  AzureGPT4o,
@@ -81,6 +85,7 @@ var AzureModels = map[ModelID]Model{
 		ContextWindow:       OpenAIModels[GPT4o].ContextWindow,
 		DefaultMaxTokens:    OpenAIModels[GPT4o].DefaultMaxTokens,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	AzureGPT4oMini: {
 		ID:                  AzureGPT4oMini,
@@ -94,6 +99,7 @@ var AzureModels = map[ModelID]Model{
 		ContextWindow:       OpenAIModels[GPT4oMini].ContextWindow,
 		DefaultMaxTokens:    OpenAIModels[GPT4oMini].DefaultMaxTokens,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	AzureO1: {
 		ID:                  AzureO1,
@@ -108,6 +114,7 @@ var AzureModels = map[ModelID]Model{
 		DefaultMaxTokens:    OpenAIModels[O1].DefaultMaxTokens,
 		CanReason:           OpenAIModels[O1].CanReason,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	AzureO1Mini: {
 		ID:                  AzureO1Mini,
@@ -122,6 +129,7 @@ var AzureModels = map[ModelID]Model{
 		DefaultMaxTokens:    OpenAIModels[O1Mini].DefaultMaxTokens,
 		CanReason:           OpenAIModels[O1Mini].CanReason,
 		SupportsAttachments: true,
+		SupportsTools:       OpenAIModels[O1Mini].SupportsTools,
 	},
 	AzureO3: {
 		ID:                  AzureO3,
@@ -136,6 +144,7 @@ var AzureModels = map[ModelID]Model{
 		DefaultMaxTokens:    OpenAIModels[O3].DefaultMaxTokens,
 		CanReason:           OpenAIModels[O3].CanReason,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	AzureO3Mini: {
 		ID:                  AzureO3Mini,
@@ -150,6 +159,7 @@ var AzureModels = map[ModelID]Model{
 		DefaultMaxTokens:    OpenAIModels[O3Mini].DefaultMaxTokens,
 		CanReason:           OpenAIModels[O3Mini].CanReason,
 		SupportsAttachments: false,
+		SupportsTools:       true,
 	},
 	AzureO4Mini: {
 		ID:                  AzureO4Mini,
@@ -164,5 +174,6 @@ var AzureModels = map[ModelID]Model{
 		DefaultMaxTokens:    OpenAIModels[O4Mini].DefaultMaxTokens,
 		CanReason:           OpenAIModels[O4Mini].CanReason,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 }
@@ -21,6 +21,7 @@ var GeminiModels = map[ModelID]Model{
 		ContextWindow:       1000000,
 		DefaultMaxTokens:    50000,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	Gemini25: {
 		ID:                  Gemini25,
@@ -34,5 +35,6 @@ var GeminiModels = map[ModelID]Model{
 		ContextWindow:       1000000,
 		DefaultMaxTokens:    50000,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 }
@@ -30,6 +30,7 @@ var GroqModels = map[ModelID]Model{
 		// for some reason, the groq api doesn't like the reasoningEffort parameter
 		CanReason:           false,
 		SupportsAttachments: false,
+		SupportsTools:       true,
 	},
 
 	Llama4Scout: {
@@ -43,6 +44,7 @@ var GroqModels = map[ModelID]Model{
 		CostPer1MOut:        0.34,
 		ContextWindow:       128_000, // 10M when?
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 
 	Llama4Maverick: {
@@ -56,6 +58,7 @@ var GroqModels = map[ModelID]Model{
 		CostPer1MOut:        0.20,
 		ContextWindow:       128_000,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 
 	Llama3_3_70BVersatile: {
@@ -69,6 +72,7 @@ var GroqModels = map[ModelID]Model{
 		CostPer1MOut:        0.79,
 		ContextWindow:       128_000,
 		SupportsAttachments: false,
+		SupportsTools:       true,
 	},
 
 	DeepseekR1DistillLlama70b: {
@@ -83,5 +87,6 @@ var GroqModels = map[ModelID]Model{
 		ContextWindow:       128_000,
 		CanReason:           true,
 		SupportsAttachments: false,
+		SupportsTools:       true,
 	},
 }
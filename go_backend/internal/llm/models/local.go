@@ -148,6 +148,7 @@ func convertLocalModel(model localModel) Model {
 		DefaultMaxTokens:    cmp.Or(model.LoadedContextLength, 4096),
 		CanReason:           true,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	}
 }
 
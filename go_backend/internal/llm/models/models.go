@@ -20,6 +20,7 @@ type Model struct {
 	DefaultMaxTokens    int64         `json:"default_max_tokens"`
 	CanReason           bool          `json:"can_reason"`
 	SupportsAttachments bool          `json:"supports_attachments"`
+	SupportsTools       bool          `json:"supports_tools"`
 }
 
 // Model IDs
@@ -81,6 +82,7 @@ var SupportedModels = map[ModelID]Model{
 		CostPer1MInCached:  3.75,
 		CostPer1MOutCached: 0.30,
 		CostPer1MOut:       15.0,
+		SupportsTools:      true,
 	},
 }
 
@@ -30,6 +30,7 @@ var OpenAIModels = map[ModelID]Model{
 		ContextWindow:       1_047_576,
 		DefaultMaxTokens:    20000,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	GPT41Mini: {
 		ID:                  GPT41Mini,
@@ -43,6 +44,7 @@ var OpenAIModels = map[ModelID]Model{
 		ContextWindow:       200_000,
 		DefaultMaxTokens:    20000,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	GPT41Nano: {
 		ID:                  GPT41Nano,
@@ -56,6 +58,7 @@ var OpenAIModels = map[ModelID]Model{
 		ContextWindow:       1_047_576,
 		DefaultMaxTokens:    20000,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	GPT45Preview: {
 		ID:                  GPT45Preview,
@@ -69,6 +72,7 @@ var OpenAIModels = map[ModelID]Model{
 		ContextWindow:       128_000,
 		DefaultMaxTokens:    15000,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	GPT4o: {
 		ID:                  GPT4o,
@@ -82,6 +86,7 @@ var OpenAIModels = map[ModelID]Model{
 		ContextWindow:       128_000,
 		DefaultMaxTokens:    4096,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	GPT4oMini: {
 		ID:                  GPT4oMini,
@@ -94,6 +99,7 @@ var OpenAIModels = map[ModelID]Model{
 		CostPer1MOut:        0.60,
 		ContextWindow:       128_000,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	O1: {
 		ID:                  O1,
@@ -108,6 +114,7 @@ var OpenAIModels = map[ModelID]Model{
 		DefaultMaxTokens:    50000,
 		CanReason:           true,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	O1Pro: {
 		ID:                  O1Pro,
@@ -122,6 +129,7 @@ var OpenAIModels = map[ModelID]Model{
 		DefaultMaxTokens:    50000,
 		CanReason:           true,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	O1Mini: {
 		ID:                  O1Mini,
@@ -136,6 +144,7 @@ var OpenAIModels = map[ModelID]Model{
 		DefaultMaxTokens:    50000,
 		CanReason:           true,
 		SupportsAttachments: true,
+		SupportsTools:       false,
 	},
 	O3: {
 		ID:                  O3,
@@ -149,6 +158,7 @@ var OpenAIModels = map[ModelID]Model{
 		ContextWindow:       200_000,
 		CanReason:           true,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	O3Mini: {
 		ID:                  O3Mini,
@@ -163,6 +173,7 @@ var OpenAIModels = map[ModelID]Model{
 		DefaultMaxTokens:    50000,
 		CanReason:           true,
 		SupportsAttachments: false,
+		SupportsTools:       true,
 	},
 	O4Mini: {
 		ID:                  O4Mini,
@@ -177,5 +188,6 @@ var OpenAIModels = map[ModelID]Model{
 		DefaultMaxTokens:    50000,
 		CanReason:           true,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 }
@@ -37,6 +37,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: OpenAIModels[GPT41].CostPer1MOutCached,
 		ContextWindow:      OpenAIModels[GPT41].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[GPT41].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 	OpenRouterGPT41Mini: {
 		ID:                 OpenRouterGPT41Mini,
@@ -49,6 +50,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: OpenAIModels[GPT41Mini].CostPer1MOutCached,
 		ContextWindow:      OpenAIModels[GPT41Mini].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[GPT41Mini].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 	OpenRouterGPT41Nano: {
 		ID:                 OpenRouterGPT41Nano,
@@ -61,6 +63,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: OpenAIModels[GPT41Nano].CostPer1MOutCached,
 		ContextWindow:      OpenAIModels[GPT41Nano].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[GPT41Nano].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 	OpenRouterGPT45Preview: {
 		ID:                 OpenRouterGPT45Preview,
@@ -73,6 +76,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: OpenAIModels[GPT45Preview].CostPer1MOutCached,
 		ContextWindow:      OpenAIModels[GPT45Preview].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[GPT45Preview].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 	OpenRouterGPT4o: {
 		ID:                 OpenRouterGPT4o,
@@ -85,6 +89,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: OpenAIModels[GPT4o].CostPer1MOutCached,
 		ContextWindow:      OpenAIModels[GPT4o].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[GPT4o].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 	OpenRouterGPT4oMini: {
 		ID:                 OpenRouterGPT4oMini,
@@ -96,6 +101,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOut:       OpenAIModels[GPT4oMini].CostPer1MOut,
 		CostPer1MOutCached: OpenAIModels[GPT4oMini].CostPer1MOutCached,
 		ContextWindow:      OpenAIModels[GPT4oMini].ContextWindow,
+		SupportsTools:      true,
 	},
 	OpenRouterO1: {
 		ID:                 OpenRouterO1,
@@ -109,6 +115,7 @@ var OpenRouterModels = map[ModelID]Model{
 		ContextWindow:      OpenAIModels[O1].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[O1].DefaultMaxTokens,
 		CanReason:          OpenAIModels[O1].CanReason,
+		SupportsTools:      true,
 	},
 	OpenRouterO1Pro: {
 		ID:                 OpenRouterO1Pro,
@@ -122,6 +129,7 @@ var OpenRouterModels = map[ModelID]Model{
 		ContextWindow:      OpenAIModels[O1Pro].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[O1Pro].DefaultMaxTokens,
 		CanReason:          OpenAIModels[O1Pro].CanReason,
+		SupportsTools:      true,
 	},
 	OpenRouterO1Mini: {
 		ID:                 OpenRouterO1Mini,
@@ -135,6 +143,7 @@ var OpenRouterModels = map[ModelID]Model{
 		ContextWindow:      OpenAIModels[O1Mini].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[O1Mini].DefaultMaxTokens,
 		CanReason:          OpenAIModels[O1Mini].CanReason,
+		SupportsTools:      OpenAIModels[O1Mini].SupportsTools,
 	},
 	OpenRouterO3: {
 		ID:                 OpenRouterO3,
@@ -148,6 +157,7 @@ var OpenRouterModels = map[ModelID]Model{
 		ContextWindow:      OpenAIModels[O3].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[O3].DefaultMaxTokens,
 		CanReason:          OpenAIModels[O3].CanReason,
+		SupportsTools:      true,
 	},
 	OpenRouterO3Mini: {
 		ID:                 OpenRouterO3Mini,
@@ -161,6 +171,7 @@ var OpenRouterModels = map[ModelID]Model{
 		ContextWindow:      OpenAIModels[O3Mini].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[O3Mini].DefaultMaxTokens,
 		CanReason:          OpenAIModels[O3Mini].CanReason,
+		SupportsTools:      true,
 	},
 	OpenRouterO4Mini: {
 		ID:                 OpenRouterO4Mini,
@@ -174,6 +185,7 @@ var OpenRouterModels = map[ModelID]Model{
 		ContextWindow:      OpenAIModels[O4Mini].ContextWindow,
 		DefaultMaxTokens:   OpenAIModels[O4Mini].DefaultMaxTokens,
 		CanReason:          OpenAIModels[O4Mini].CanReason,
+		SupportsTools:      true,
 	},
 	OpenRouterGemini25Flash: {
 		ID:                 OpenRouterGemini25Flash,
@@ -186,6 +198,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: GeminiModels[Gemini25Flash].CostPer1MOutCached,
 		ContextWindow:      GeminiModels[Gemini25Flash].ContextWindow,
 		DefaultMaxTokens:   GeminiModels[Gemini25Flash].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 	OpenRouterGemini25: {
 		ID:                 OpenRouterGemini25,
@@ -198,6 +211,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: GeminiModels[Gemini25].CostPer1MOutCached,
 		ContextWindow:      GeminiModels[Gemini25].ContextWindow,
 		DefaultMaxTokens:   GeminiModels[Gemini25].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 	OpenRouterClaude35Sonnet: {
 		ID:                 OpenRouterClaude35Sonnet,
@@ -210,6 +224,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: AnthropicModels[Claude35Sonnet].CostPer1MOutCached,
 		ContextWindow:      AnthropicModels[Claude35Sonnet].ContextWindow,
 		DefaultMaxTokens:   AnthropicModels[Claude35Sonnet].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 	OpenRouterClaude3Haiku: {
 		ID:                 OpenRouterClaude3Haiku,
@@ -222,6 +237,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: AnthropicModels[Claude3Haiku].CostPer1MOutCached,
 		ContextWindow:      AnthropicModels[Claude3Haiku].ContextWindow,
 		DefaultMaxTokens:   AnthropicModels[Claude3Haiku].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 	OpenRouterClaude37Sonnet: {
 		ID:                 OpenRouterClaude37Sonnet,
@@ -235,6 +251,7 @@ var OpenRouterModels = map[ModelID]Model{
 		ContextWindow:      AnthropicModels[Claude37Sonnet].ContextWindow,
 		DefaultMaxTokens:   AnthropicModels[Claude37Sonnet].DefaultMaxTokens,
 		CanReason:          AnthropicModels[Claude37Sonnet].CanReason,
+		SupportsTools:      true,
 	},
 	OpenRouterClaude35Haiku: {
 		ID:                 OpenRouterClaude35Haiku,
@@ -247,6 +264,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: AnthropicModels[Claude35Haiku].CostPer1MOutCached,
 		ContextWindow:      AnthropicModels[Claude35Haiku].ContextWindow,
 		DefaultMaxTokens:   AnthropicModels[Claude35Haiku].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 	OpenRouterClaude3Opus: {
 		ID:                 OpenRouterClaude3Opus,
@@ -259,6 +277,7 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: AnthropicModels[Claude3Opus].CostPer1MOutCached,
 		ContextWindow:      AnthropicModels[Claude3Opus].ContextWindow,
 		DefaultMaxTokens:   AnthropicModels[Claude3Opus].DefaultMaxTokens,
+		SupportsTools:      true,
 	},
 
 	OpenRouterDeepSeekR1Free: {
@@ -272,5 +291,6 @@ var OpenRouterModels = map[ModelID]Model{
 		CostPer1MOutCached: 0,
 		ContextWindow:      163_840,
 		DefaultMaxTokens:   10000,
+		SupportsTools:      false,
 	},
 }
@@ -21,6 +21,7 @@ var VertexAIGeminiModels = map[ModelID]Model{
 		ContextWindow:       GeminiModels[Gemini25Flash].ContextWindow,
 		DefaultMaxTokens:    GeminiModels[Gemini25Flash].DefaultMaxTokens,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 	VertexAIGemini25: {
 		ID:                  VertexAIGemini25,
@@ -34,5 +35,6 @@ var VertexAIGeminiModels = map[ModelID]Model{
 		ContextWindow:       GeminiModels[Gemini25].ContextWindow,
 		DefaultMaxTokens:    GeminiModels[Gemini25].DefaultMaxTokens,
 		SupportsAttachments: true,
+		SupportsTools:       true,
 	},
 }
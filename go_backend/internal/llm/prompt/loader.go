@@ -3,8 +3,8 @@ package prompt
 import (
 	"context"
 	"embed"
+	"io/fs"
 	"os"
-	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -17,6 +17,19 @@ import (
 //go:embed prompts/*.md
 var promptFiles embed.FS
 
+// embeddedPrompts holds the prompts built into the binary
+var embeddedPrompts, _ = fs.Sub(promptFiles, "prompts")
+
+// readPrompt reads the named markdown prompt from fsys. Names that aren't valid paths
+// within fsys, such as ones containing "..", are rejected.
+func readPrompt(fsys fs.FS, name string) (string, error) {
+	content, err := fs.ReadFile(fsys, name+".md")
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
 // LoadPrompt loads a prompt from embedded markdown files
 func LoadPrompt(name string) string {
 	return LoadPromptWithVars(name, nil)
@@ -24,14 +37,12 @@ func LoadPrompt(name string) string {
 
 // LoadPromptWithVars loads a prompt from embedded markdown files and replaces $<name> placeholders
 func LoadPromptWithVars(name string, vars map[string]string) string {
-	content, err := promptFiles.ReadFile(path.Join("prompts", name+".md"))
+	result, err := readPrompt(embeddedPrompts, name)
 	if err != nil {
 		// This should not happen with embedded files, but provide minimal fallback
 		return "Error loading prompt: " + name
 	}
 
-	result := string(content)
-
 	// Replace $<name> placeholders with values
 	if vars != nil {
 		for key, value := range vars {
@@ -6,8 +6,6 @@ import (
 	"path/filepath"
 	"testing"
 
-	"mix/internal/config"
-
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -16,13 +14,9 @@ func TestGetContextFromPaths(t *testing.T) {
 	t.Parallel()
 
 	tmpDir := t.TempDir()
-	_, err := config.Load(tmpDir, false)
-	if err != nil {
-		t.Fatalf("Failed to load config: %v", err)
-	}
-	cfg := config.Get()
-	cfg.WorkingDir = tmpDir
-	cfg.ContextPaths = []string{
+	// The config no longer has context paths, so the test passes them to the function
+	// getContextFromPaths uses
+	contextPaths := []string{
 		"file.txt",
 		"directory/",
 	}
@@ -35,7 +29,7 @@ func TestGetContextFromPaths(t *testing.T) {
 
 	createTestFiles(t, tmpDir, testFiles)
 
-	context := getContextFromPaths()
+	context := processContextPaths(tmpDir, contextPaths)
 	expectedContext := fmt.Sprintf("# From:%s/file.txt\nfile.txt: test content\n# From:%s/directory/file_a.txt\ndirectory/file_a.txt: test content\n# From:%s/directory/file_b.txt\ndirectory/file_b.txt: test content\n# From:%s/directory/file_c.txt\ndirectory/file_c.txt: test content", tmpDir, tmpDir, tmpDir, tmpDir)
 	assert.Equal(t, expectedContext, context)
 }
@@ -0,0 +1,101 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mix/internal/config"
+)
+
+// ErrTemplateNotFound is returned when no prompt template with the given name exists
+var ErrTemplateNotFound = errors.New("prompt template not found")
+
+// templateArgRegex matches {{name}} placeholders in prompt templates
+var templateArgRegex = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_-]+)\s*\}\}`)
+
+// TemplateDirs returns the directories searched for prompt templates, highest priority first:
+// project templates in .mix/prompts, then user templates in ~/.mix/prompts
+func TemplateDirs() []string {
+	dirs := []string{filepath.Join(config.WorkingDirectory(), ".mix", "prompts")}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(homeDir, ".mix", "prompts"))
+	}
+	return dirs
+}
+
+// LoadTemplate loads the named prompt template from the template directories and
+// substitutes {{name}} placeholders from args. Arguments of the form key=value fill
+// {{key}}, and {{args}} receives the full argument string.
+func LoadTemplate(name, args string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("%w: empty name", ErrTemplateNotFound)
+	}
+
+	for _, dir := range TemplateDirs() {
+		content, err := readPrompt(os.DirFS(dir), name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if errors.Is(err, fs.ErrInvalid) {
+			return "", fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt template %s: %w", name, err)
+		}
+		return ExpandTemplate(content, args)
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+}
+
+// ExpandTemplate replaces {{name}} placeholders in content with values parsed from args
+func ExpandTemplate(content, args string) (string, error) {
+	vars := map[string]string{"args": strings.TrimSpace(args)}
+	for _, field := range strings.Fields(args) {
+		if key, value, ok := strings.Cut(field, "="); ok && key != "" {
+			vars[key] = value
+		}
+	}
+
+	var missing []string
+	result := templateArgRegex.ReplaceAllStringFunc(content, func(match string) string {
+		key := templateArgRegex.FindStringSubmatch(match)[1]
+		value, ok := vars[key]
+		if !ok {
+			missing = append(missing, key)
+			return match
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing template arguments: %s", strings.Join(missing, ", "))
+	}
+
+	return strings.TrimSpace(result), nil
+}
+
+// ListTemplates returns the names of all available prompt templates
+func ListTemplates() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, dir := range TemplateDirs() {
+		matches, err := fs.Glob(os.DirFS(dir), "*.md")
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			name := strings.TrimSuffix(match, ".md")
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
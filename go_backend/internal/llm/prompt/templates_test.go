@@ -0,0 +1,76 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mix/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	t.Run("substitutes named arguments", func(t *testing.T) {
+		result, err := ExpandTemplate("Review {{file}} for {{ focus }}.", "file=main.go focus=performance")
+		require.NoError(t, err)
+		assert.Equal(t, "Review main.go for performance.", result)
+	})
+
+	t.Run("args receives the full argument string", func(t *testing.T) {
+		result, err := ExpandTemplate("Summarize: {{args}}", "  the last three commits ")
+		require.NoError(t, err)
+		assert.Equal(t, "Summarize: the last three commits", result)
+	})
+
+	t.Run("missing arguments are reported", func(t *testing.T) {
+		_, err := ExpandTemplate("Translate {{text}} to {{language}}", "text=hello")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "language")
+	})
+}
+
+// loadTestConfig loads the config from a .mix.json in a temporary home directory
+func loadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfgJSON := `{"agents": {"main": {"model": "claude-4-sonnet"}, "sub": {"model": "claude-4-sonnet"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".mix.json"), []byte(cfgJSON), 0o644))
+
+	cfg, err := config.Load(home, false, false)
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestLoadTemplate(t *testing.T) {
+	cfg := loadTestConfig(t)
+	tmpDir := os.Getenv("HOME")
+	cfg.WorkingDir = tmpDir
+
+	promptsDir := filepath.Join(tmpDir, ".mix", "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "review.md"), []byte("Review {{file}} carefully.\n"), 0o644))
+
+	t.Run("loads and expands a template", func(t *testing.T) {
+		result, err := LoadTemplate("review", "file=agent.go")
+		require.NoError(t, err)
+		assert.Equal(t, "Review agent.go carefully.", result)
+	})
+
+	t.Run("missing template", func(t *testing.T) {
+		_, err := LoadTemplate("does-not-exist", "")
+		assert.ErrorIs(t, err, ErrTemplateNotFound)
+	})
+
+	t.Run("names can't leave the template directories", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "secret.md"), []byte("outside"), 0o644))
+		_, err := LoadTemplate("../../secret", "")
+		assert.ErrorIs(t, err, ErrTemplateNotFound)
+	})
+
+	t.Run("lists available templates", func(t *testing.T) {
+		assert.Equal(t, []string{"review"}, ListTemplates())
+	})
+}
@@ -21,15 +21,37 @@ import (
 )
 
 type anthropicOptions struct {
-	useBedrock   bool
-	disableCache bool
-	shouldThink  func(userMessage string) bool
-	useOAuth     bool
-	oauthCreds   *OAuthCredentials
+	useBedrock       bool
+	disableCache     bool
+	shouldThink      func(userMessage string) bool
+	useOAuth         bool
+	oauthCreds       *OAuthCredentials
+	assistantPrefill string
+	cacheConfig      AnthropicCacheConfig
 }
 
 type AnthropicOption func(*anthropicOptions)
 
+// ErrIncompleteToolCall is returned when a response stream ends before the input of a tool
+// call is complete
+var ErrIncompleteToolCall = errors.New("the response ended before the tool call input was complete")
+
+// maxCacheBreakpoints is the most cache_control markers Anthropic accepts per request
+const maxCacheBreakpoints = 4
+
+// AnthropicCacheConfig controls where prompt caching breakpoints are placed. Message
+// breakpoints are limited to what is left of Anthropic's 4 after the system prompt and tools.
+type AnthropicCacheConfig struct {
+	System   bool // Cache the system prompt
+	Tools    bool // Cache the tool definitions
+	Messages int  // Cache the last N messages
+}
+
+// DefaultAnthropicCacheConfig caches the system prompt, tools, and the last two messages
+func DefaultAnthropicCacheConfig() AnthropicCacheConfig {
+	return AnthropicCacheConfig{System: true, Tools: true, Messages: 2}
+}
+
 type anthropicClient struct {
 	providerOptions   providerClientOptions
 	options           anthropicOptions
@@ -40,7 +62,7 @@ type anthropicClient struct {
 type AnthropicClient ProviderClient
 
 func newAnthropicClient(opts providerClientOptions) AnthropicClient {
-	anthropicOpts := anthropicOptions{}
+	anthropicOpts := anthropicOptions{cacheConfig: DefaultAnthropicCacheConfig()}
 	for _, o := range opts.anthropicOptions {
 		o(&anthropicOpts)
 	}
@@ -86,10 +108,7 @@ func newAnthropicClient(opts providerClientOptions) AnthropicClient {
 		anthropicOpts.useOAuth = true
 		anthropicOpts.oauthCreds = oauthCreds
 		// Use WithAuthToken for OAuth (sets Authorization: Bearer header)
-		anthropicClientOptions = append(anthropicClientOptions,
-			option.WithAuthToken(oauthCreds.AccessToken),
-			option.WithHeader("anthropic-beta", "oauth-2025-04-20"),
-		)
+		anthropicClientOptions = append(anthropicClientOptions, option.WithAuthToken(oauthCreds.AccessToken))
 		logging.Info("Initialized Anthropic client with OAuth authentication via SDK")
 	} else if opts.apiKey != "" {
 		// Use WithAPIKey for API key authentication (sets x-api-key header)
@@ -99,6 +118,12 @@ func newAnthropicClient(opts providerClientOptions) AnthropicClient {
 		logging.Warn("No authentication method available - neither OAuth nor API key")
 	}
 
+	var betas []string
+	if anthropicOpts.useOAuth {
+		betas = append(betas, anthropicOAuthBeta)
+	}
+	anthropicClientOptions = append(anthropicClientOptions, anthropicHeaderOptions(opts.headers, betas...)...)
+
 	if anthropicOpts.useBedrock {
 		anthropicClientOptions = append(anthropicClientOptions, bedrock.WithLoadDefaultConfig(context.Background()))
 	}
@@ -115,20 +140,38 @@ func newAnthropicClient(opts providerClientOptions) AnthropicClient {
 	}
 }
 
-func (a *anthropicClient) convertMessages(messages []message.Message) (anthropicMessages []anthropic.MessageParam) {
-	for i, msg := range messages {
-		cache := false
-		if i > len(messages)-3 {
-			cache = true
+// anthropicOAuthBeta is the beta the API requires for OAuth authentication
+const anthropicOAuthBeta = "oauth-2025-04-20"
+
+// anthropicHeaderOptions sends the configured headers. A configured anthropic-beta
+// header is merged with the betas the client needs itself instead of replacing them.
+func anthropicHeaderOptions(headers map[string]string, betas ...string) []option.RequestOption {
+	var opts []option.RequestOption
+	for key, value := range headers {
+		if strings.EqualFold(key, "anthropic-beta") {
+			betas = append(betas, value)
+			continue
 		}
+		opts = append(opts, option.WithHeader(key, value))
+	}
+	if len(betas) > 0 {
+		opts = append(opts, option.WithHeader("anthropic-beta", strings.Join(betas, ",")))
+	}
+	return opts
+}
+
+// oauthClientOptions are the request options for a client authenticated with an OAuth access token
+func (a *anthropicClient) oauthClientOptions(accessToken string) []option.RequestOption {
+	opts := []option.RequestOption{option.WithAuthToken(accessToken)}
+	opts = append(opts, anthropicHeaderOptions(a.providerOptions.headers, anthropicOAuthBeta)...)
+	return append(opts, option.WithRequestTimeout(60*time.Second))
+}
+
+func (a *anthropicClient) convertMessages(messages []message.Message) (anthropicMessages []anthropic.MessageParam) {
+	for _, msg := range messages {
 		switch msg.Role {
 		case message.User:
 			content := anthropic.NewTextBlock(msg.Content().String())
-			if cache && !a.options.disableCache {
-				content.OfText.CacheControl = anthropic.CacheControlEphemeralParam{
-					Type: "ephemeral",
-				}
-			}
 			var contentBlocks []anthropic.ContentBlockParamUnion
 			contentBlocks = append(contentBlocks, content)
 			for _, binaryContent := range msg.BinaryContent() {
@@ -141,13 +184,7 @@ func (a *anthropicClient) convertMessages(messages []message.Message) (anthropic
 		case message.Assistant:
 			blocks := []anthropic.ContentBlockParamUnion{}
 			if msg.Content().String() != "" {
-				content := anthropic.NewTextBlock(msg.Content().String())
-				if cache && !a.options.disableCache {
-					content.OfText.CacheControl = anthropic.CacheControlEphemeralParam{
-						Type: "ephemeral",
-					}
-				}
-				blocks = append(blocks, content)
+				blocks = append(blocks, anthropic.NewTextBlock(msg.Content().String()))
 			}
 
 			for _, toolCall := range msg.ToolCalls() {
@@ -169,6 +206,10 @@ func (a *anthropicClient) convertMessages(messages []message.Message) (anthropic
 			for i, toolResult := range msg.ToolResults() {
 				results[i] = anthropic.NewToolResultBlock(toolResult.ToolCallID, toolResult.Content, toolResult.IsError)
 			}
+			// Images returned by tools, such as thumbnails, follow the results
+			for _, binaryContent := range msg.BinaryContent() {
+				results = append(results, anthropic.NewImageBlockBase64(binaryContent.MIMEType, binaryContent.String(models.ProviderAnthropic)))
+			}
 			anthropicMessages = append(anthropicMessages, anthropic.NewUserMessage(results...))
 		}
 	}
@@ -189,18 +230,24 @@ func (a *anthropicClient) convertTools(tools []toolsPkg.BaseTool) []anthropic.To
 			},
 		}
 
-		if i == len(tools)-1 && !a.options.disableCache {
-			toolParam.CacheControl = anthropic.CacheControlEphemeralParam{
-				Type: "ephemeral",
-			}
-		}
-
 		anthropicTools[i] = anthropic.ToolUnionParam{OfTool: &toolParam}
 	}
 
 	return anthropicTools
 }
 
+// responseContent joins the text blocks of a response. The response continues the
+// assistant prefill, if any, so the prefill is included at the start.
+func (a *anthropicClient) responseContent(prefill string, msg anthropic.Message) string {
+	content := prefill
+	for _, block := range msg.Content {
+		if text, ok := block.AsAny().(anthropic.TextBlock); ok {
+			content += text.Text
+		}
+	}
+	return content
+}
+
 func (a *anthropicClient) finishReason(reason string) message.FinishReason {
 	switch reason {
 	case "end_turn":
@@ -216,13 +263,25 @@ func (a *anthropicClient) finishReason(reason string) message.FinishReason {
 	}
 }
 
-func (a *anthropicClient) preparedMessages(messages []anthropic.MessageParam, tools []anthropic.ToolUnionParam) anthropic.MessageNewParams {
+// assistantPrefill returns the text to seed the assistant turn with, or "" when no prefill
+// is configured or the conversation doesn't end on a user turn
+func (a *anthropicClient) assistantPrefill(messages []anthropic.MessageParam) string {
+	if len(messages) == 0 || messages[len(messages)-1].Role != anthropic.MessageParamRoleUser {
+		return ""
+	}
+	// The API rejects a final assistant message ending in whitespace
+	return strings.TrimRight(a.options.assistantPrefill, " \t\r\n")
+}
+
+func (a *anthropicClient) preparedMessages(ctx context.Context, messages []anthropic.MessageParam, tools []anthropic.ToolUnionParam) anthropic.MessageNewParams {
 	var thinkingParam anthropic.ThinkingConfigParamUnion
 	lastMessage := messages[len(messages)-1]
 	isUser := lastMessage.Role == anthropic.MessageParamRoleUser
 	messageContent := ""
 	temperature := anthropic.Float(0)
-	if isUser {
+	prefill := a.assistantPrefill(messages)
+	// Extended thinking can't be combined with a prefilled assistant turn
+	if isUser && prefill == "" {
 		for _, m := range lastMessage.Content {
 			if m.OfText != nil && m.OfText.Text != "" {
 				messageContent = m.OfText.Text
@@ -260,6 +319,16 @@ func (a *anthropicClient) preparedMessages(messages []anthropic.MessageParam, to
 		}
 	}
 
+	system := anthropic.TextBlockParam{Text: systemMessage}
+	if !PromptCacheDisabled(ctx) {
+		a.applyCacheControl(&system, tools, messages)
+	}
+
+	// Added after cache breakpoints are placed; the partial turn isn't worth caching
+	if prefill != "" {
+		messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(prefill)))
+	}
+
 	return anthropic.MessageNewParams{
 		Model:       anthropic.Model(a.providerOptions.model.APIModel),
 		MaxTokens:   a.providerOptions.maxTokens,
@@ -267,14 +336,63 @@ func (a *anthropicClient) preparedMessages(messages []anthropic.MessageParam, to
 		Messages:    messages,
 		Tools:       tools,
 		Thinking:    thinkingParam,
-		System: []anthropic.TextBlockParam{
-			{
-				Text: systemMessage,
-				CacheControl: anthropic.CacheControlEphemeralParam{
-					Type: "ephemeral",
-				},
-			},
-		},
+		System:      []anthropic.TextBlockParam{system},
+	}
+}
+
+// applyToolChoice sets the requested tool choice on a request that offers tools. Forcing
+// a tool is incompatible with extended thinking, so thinking is turned off for it.
+func (a *anthropicClient) applyToolChoice(params *anthropic.MessageNewParams, choice ToolChoice) {
+	if len(params.Tools) == 0 {
+		return
+	}
+	switch choice.Mode {
+	case ToolChoiceNone:
+		params.ToolChoice = anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}
+	case ToolChoiceRequired:
+		params.ToolChoice = anthropic.ToolChoiceUnionParam{OfAny: &anthropic.ToolChoiceAnyParam{}}
+	case ToolChoiceTool:
+		params.ToolChoice = anthropic.ToolChoiceParamOfTool(choice.ToolName)
+	default:
+		return
+	}
+	if choice.forced() && params.Thinking.OfEnabled != nil {
+		params.Thinking = anthropic.ThinkingConfigParamUnion{}
+		params.Temperature = anthropic.Float(0)
+	}
+}
+
+// applyCacheControl places prompt caching breakpoints on the system prompt, the last
+// tool, and the last block of the most recent messages, within Anthropic's limit
+func (a *anthropicClient) applyCacheControl(system *anthropic.TextBlockParam, tools []anthropic.ToolUnionParam, messages []anthropic.MessageParam) {
+	if a.options.disableCache {
+		return
+	}
+	cacheCfg := a.options.cacheConfig
+	ephemeral := anthropic.NewCacheControlEphemeralParam()
+
+	breakpoints := 0
+	if cacheCfg.System {
+		system.CacheControl = ephemeral
+		breakpoints++
+	}
+	if cacheCfg.Tools && len(tools) > 0 {
+		if cacheControl := tools[len(tools)-1].GetCacheControl(); cacheControl != nil {
+			*cacheControl = ephemeral
+			breakpoints++
+		}
+	}
+
+	remaining := min(cacheCfg.Messages, maxCacheBreakpoints-breakpoints)
+	for i := len(messages) - 1; i >= 0 && remaining > 0; i-- {
+		blocks := messages[i].Content
+		if len(blocks) == 0 {
+			continue
+		}
+		if cacheControl := blocks[len(blocks)-1].GetCacheControl(); cacheControl != nil {
+			*cacheControl = ephemeral
+		}
+		remaining--
 	}
 }
 
@@ -296,18 +414,17 @@ func (a *anthropicClient) send(ctx context.Context, messages []message.Message,
 				a.options.oauthCreds = refreshedCreds
 
 				// Update client with new token
-				a.client = anthropic.NewClient(
-					option.WithAuthToken(refreshedCreds.AccessToken),
-					option.WithHeader("anthropic-beta", "oauth-2025-04-20"),
-					option.WithRequestTimeout(60*time.Second),
-				)
+				a.client = anthropic.NewClient(a.oauthClientOptions(refreshedCreds.AccessToken)...)
 				logging.Info("Refreshed OAuth token proactively")
 			}
 		}
 	}
 
 	// Use SDK for both OAuth and API key authentication
-	preparedMessages := a.preparedMessages(a.convertMessages(messages), a.convertTools(tools))
+	anthropicMessages := a.convertMessages(messages)
+	prefill := a.assistantPrefill(anthropicMessages)
+	preparedMessages := a.preparedMessages(ctx, anthropicMessages, a.convertTools(tools))
+	a.applyToolChoice(&preparedMessages, ToolChoiceFromContext(ctx))
 	cfg := config.Get()
 	if cfg.Debug {
 		jsonData, _ := json.Marshal(preparedMessages)
@@ -341,11 +458,7 @@ func (a *anthropicClient) send(ctx context.Context, messages []message.Message,
 					a.options.oauthCreds = refreshedCreds
 
 					// Update client with new token and retry
-					a.client = anthropic.NewClient(
-						option.WithAuthToken(refreshedCreds.AccessToken),
-						option.WithHeader("anthropic-beta", "oauth-2025-04-20"),
-						option.WithRequestTimeout(60*time.Second),
-					)
+					a.client = anthropic.NewClient(a.oauthClientOptions(refreshedCreds.AccessToken)...)
 					logging.Info("Refreshed OAuth token and retrying request")
 					continue
 				}
@@ -367,15 +480,8 @@ func (a *anthropicClient) send(ctx context.Context, messages []message.Message,
 			return nil, retryErr
 		}
 
-		content := ""
-		for _, block := range anthropicResponse.Content {
-			if text, ok := block.AsAny().(anthropic.TextBlock); ok {
-				content += text.Text
-			}
-		}
-
 		return &ProviderResponse{
-			Content:   content,
+			Content:   a.responseContent(prefill, *anthropicResponse),
 			ToolCalls: a.toolCalls(*anthropicResponse),
 			Usage:     a.usage(*anthropicResponse),
 		}, nil
@@ -402,18 +508,17 @@ func (a *anthropicClient) stream(ctx context.Context, messages []message.Message
 				a.options.oauthCreds = refreshedCreds
 
 				// Update client with new token
-				a.client = anthropic.NewClient(
-					option.WithAuthToken(refreshedCreds.AccessToken),
-					option.WithHeader("anthropic-beta", "oauth-2025-04-20"),
-					option.WithRequestTimeout(60*time.Second),
-				)
+				a.client = anthropic.NewClient(a.oauthClientOptions(refreshedCreds.AccessToken)...)
 				logging.Info("Refreshed OAuth token proactively for streaming")
 			}
 		}
 	}
 
 	// Use SDK for both OAuth and API key authentication
-	preparedMessages := a.preparedMessages(a.convertMessages(messages), a.convertTools(tools))
+	anthropicMessages := a.convertMessages(messages)
+	prefill := a.assistantPrefill(anthropicMessages)
+	preparedMessages := a.preparedMessages(ctx, anthropicMessages, a.convertTools(tools))
+	a.applyToolChoice(&preparedMessages, ToolChoiceFromContext(ctx))
 	cfg := config.Get()
 
 	if cfg.Debug {
@@ -422,6 +527,7 @@ func (a *anthropicClient) stream(ctx context.Context, messages []message.Message
 	}
 	attempts := 0
 	go func() {
+		prefillSent := false
 		for {
 			attempts++
 			anthropicStream := a.client.Messages.NewStreaming(
@@ -432,6 +538,12 @@ func (a *anthropicClient) stream(ctx context.Context, messages []message.Message
 
 			currentToolCallID := ""
 			for anthropicStream.Next() {
+				// The response continues the prefill, so stream it first (once, even across retries)
+				if prefill != "" && !prefillSent {
+					prefillSent = true
+					eventChan <- ProviderEvent{Type: EventContentDelta, Content: prefill}
+				}
+
 				event := anthropicStream.Current()
 				err := accumulatedMessage.Accumulate(event)
 				if err != nil {
@@ -492,17 +604,10 @@ func (a *anthropicClient) stream(ctx context.Context, messages []message.Message
 					}
 
 				case anthropic.MessageStopEvent:
-					content := ""
-					for _, block := range accumulatedMessage.Content {
-						if text, ok := block.AsAny().(anthropic.TextBlock); ok {
-							content += text.Text
-						}
-					}
-
 					eventChan <- ProviderEvent{
 						Type: EventComplete,
 						Response: &ProviderResponse{
-							Content:      content,
+							Content:      a.responseContent(prefill, accumulatedMessage),
 							ToolCalls:    a.toolCalls(accumulatedMessage),
 							Usage:        a.usage(accumulatedMessage),
 							FinishReason: a.finishReason(string(accumulatedMessage.StopReason)),
@@ -513,6 +618,10 @@ func (a *anthropicClient) stream(ctx context.Context, messages []message.Message
 
 			err := anthropicStream.Err()
 			if err == nil || errors.Is(err, io.EOF) {
+				// The stream ended inside a tool use block, without the events that finish it
+				if currentToolCallID != "" {
+					a.finishIncompleteToolCall(eventChan, prefill, accumulatedMessage, currentToolCallID)
+				}
 				close(eventChan)
 				return
 			}
@@ -533,11 +642,7 @@ func (a *anthropicClient) stream(ctx context.Context, messages []message.Message
 					a.options.oauthCreds = refreshedCreds
 
 					// Update client with new token and retry
-					a.client = anthropic.NewClient(
-						option.WithAuthToken(refreshedCreds.AccessToken),
-						option.WithHeader("anthropic-beta", "oauth-2025-04-20"),
-						option.WithRequestTimeout(60*time.Second),
-					)
+					a.client = anthropic.NewClient(a.oauthClientOptions(refreshedCreds.AccessToken)...)
 					logging.Info("Refreshed OAuth token and retrying streaming request")
 					continue
 				}
@@ -552,6 +657,7 @@ func (a *anthropicClient) stream(ctx context.Context, messages []message.Message
 			}
 			if retry {
 				logging.Warn(fmt.Sprintf("Retrying due to rate limit... attempt %d of %d", attempts, maxRetries))
+				eventChan <- retryEvent(attempts, after)
 				select {
 				case <-ctx.Done():
 					// context cancelled
@@ -586,7 +692,7 @@ func (a *anthropicClient) shouldRetry(attempts int, err error) (bool, int64, err
 	}
 
 	if attempts > maxRetries {
-		return false, 0, fmt.Errorf("maximum retry attempts reached for rate limit: %d retries", maxRetries)
+		return false, 0, fmt.Errorf("%w: %d retries", ErrMaxRetries, maxRetries)
 	}
 
 	retryMs := 0
@@ -603,6 +709,45 @@ func (a *anthropicClient) shouldRetry(attempts int, err error) (bool, int64, err
 	return true, int64(retryMs), nil
 }
 
+// finishIncompleteToolCall completes a stream that ended in the middle of a tool call. If the
+// input received so far is complete JSON the tool call is finished with it; otherwise the
+// stream ends with ErrIncompleteToolCall rather than a tool call with truncated input.
+func (a *anthropicClient) finishIncompleteToolCall(eventChan chan<- ProviderEvent, prefill string, msg anthropic.Message, toolCallID string) {
+	// The accumulator only updates a tool use block's parsed input when the block stops, so
+	// take the input streamed so far from the raw block instead
+	var toolName, input string
+	for _, block := range msg.Content {
+		if block.ID == toolCallID {
+			toolName, input = block.Name, string(block.Input)
+		}
+	}
+	if !json.Valid([]byte(input)) {
+		logging.Warn("Stream ended during a tool call", "tool", toolName, "input", input)
+		eventChan <- ProviderEvent{
+			Type:  EventError,
+			Error: fmt.Errorf("%w: %s", ErrIncompleteToolCall, toolName),
+		}
+		return
+	}
+
+	toolCalls := a.toolCalls(msg)
+	for i := range toolCalls {
+		if toolCalls[i].ID == toolCallID {
+			toolCalls[i].Input = input
+		}
+	}
+	eventChan <- ProviderEvent{Type: EventToolUseStop, ToolCall: &message.ToolCall{ID: toolCallID}}
+	eventChan <- ProviderEvent{
+		Type: EventComplete,
+		Response: &ProviderResponse{
+			Content:      a.responseContent(prefill, msg),
+			ToolCalls:    toolCalls,
+			Usage:        a.usage(msg),
+			FinishReason: message.FinishReasonToolUse,
+		},
+	}
+}
+
 func (a *anthropicClient) toolCalls(msg anthropic.Message) []message.ToolCall {
 	var toolCalls []message.ToolCall
 
@@ -638,12 +783,27 @@ func WithAnthropicBedrock(useBedrock bool) AnthropicOption {
 	}
 }
 
+// WithAnthropicCacheConfig sets where prompt caching breakpoints are placed
+func WithAnthropicCacheConfig(cacheConfig AnthropicCacheConfig) AnthropicOption {
+	return func(options *anthropicOptions) {
+		options.cacheConfig = cacheConfig
+	}
+}
+
 func WithAnthropicDisableCache() AnthropicOption {
 	return func(options *anthropicOptions) {
 		options.disableCache = true
 	}
 }
 
+// WithAssistantPrefill seeds each assistant turn with the given text to steer the
+// output format, e.g. "{" for JSON. The prefill is included in the response content.
+func WithAssistantPrefill(prefill string) AnthropicOption {
+	return func(options *anthropicOptions) {
+		options.assistantPrefill = prefill
+	}
+}
+
 func DefaultShouldThinkFn(s string) bool {
 	return strings.Contains(strings.ToLower(s), "think")
 }
@@ -0,0 +1,327 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mix/internal/llm/models"
+	"mix/internal/llm/tools"
+	"mix/internal/message"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAnthropicClient(opts ...AnthropicOption) *anthropicClient {
+	anthropicOpts := anthropicOptions{cacheConfig: DefaultAnthropicCacheConfig()}
+	for _, o := range opts {
+		o(&anthropicOpts)
+	}
+	return &anthropicClient{
+		providerOptions: providerClientOptions{
+			model:         models.SupportedModels[models.Claude4Sonnet],
+			maxTokens:     1024,
+			systemMessage: "You are a helpful assistant.",
+		},
+		options: anthropicOpts,
+	}
+}
+
+func userMessage(text string) message.Message {
+	return message.Message{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: text}}}
+}
+
+func TestAnthropicClient_AssistantPrefill(t *testing.T) {
+	client := newTestAnthropicClient(
+		WithAssistantPrefill("{\"answer\": \n"),
+		WithAnthropicShouldThinkFn(func(string) bool { return true }),
+	)
+	anthropicMessages := client.convertMessages([]message.Message{userMessage("Reply in JSON")})
+	prefill := client.assistantPrefill(anthropicMessages)
+	assert.Equal(t, "{\"answer\":", prefill, "trailing whitespace is trimmed")
+
+	params := client.preparedMessages(context.Background(), anthropicMessages, nil)
+	require.Len(t, params.Messages, 2)
+	last := params.Messages[1]
+	assert.Equal(t, anthropic.MessageParamRoleAssistant, last.Role)
+	require.Len(t, last.Content, 1)
+	assert.Equal(t, prefill, last.Content[0].OfText.Text)
+	assert.Nil(t, params.Thinking.OfEnabled, "thinking is disabled with a prefill")
+
+	var response anthropic.Message
+	require.NoError(t, json.Unmarshal([]byte(`{"role": "assistant", "content": [{"type": "text", "text": " 42}"}]}`), &response))
+	assert.Equal(t, "{\"answer\": 42}", client.responseContent(prefill, response))
+}
+
+func TestAnthropicClient_NoPrefill(t *testing.T) {
+	client := newTestAnthropicClient()
+	anthropicMessages := client.convertMessages([]message.Message{userMessage("Hello")})
+	assert.Empty(t, client.assistantPrefill(anthropicMessages))
+
+	params := client.preparedMessages(context.Background(), anthropicMessages, nil)
+	require.Len(t, params.Messages, 1)
+	assert.Equal(t, anthropic.MessageParamRoleUser, params.Messages[0].Role)
+
+	// A conversation ending on an assistant turn is never prefilled
+	prefilled := newTestAnthropicClient(WithAssistantPrefill("{"))
+	assistantLast := prefilled.convertMessages([]message.Message{
+		userMessage("Hello"),
+		{Role: message.Assistant, Parts: []message.ContentPart{message.TextContent{Text: "Hi"}}},
+	})
+	assert.Empty(t, prefilled.assistantPrefill(assistantLast))
+}
+
+// stubTool is a tool definition for building requests; it is never run
+type stubTool struct{ name string }
+
+func (s stubTool) Info() tools.ToolInfo {
+	return tools.ToolInfo{Name: s.name, Parameters: map[string]any{}}
+}
+
+func (s stubTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+	return tools.ToolResponse{}, nil
+}
+
+func conversation(turns int) []message.Message {
+	var messages []message.Message
+	for i := 0; i < turns; i++ {
+		messages = append(messages,
+			userMessage("question"),
+			message.Message{Role: message.Assistant, Parts: []message.ContentPart{message.TextContent{Text: "answer"}}},
+		)
+	}
+	return append(messages, userMessage("last question"))
+}
+
+// cachedMessageIndexes returns the indexes of messages whose last block has a cache breakpoint
+func cachedMessageIndexes(params anthropic.MessageNewParams) []int {
+	var indexes []int
+	for i, msg := range params.Messages {
+		for _, block := range msg.Content {
+			if cacheControl := block.GetCacheControl(); cacheControl != nil && cacheControl.Type != "" {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return indexes
+}
+
+func TestAnthropicClient_CacheControl(t *testing.T) {
+	toolDefs := []tools.BaseTool{stubTool{name: "view"}, stubTool{name: "edit"}}
+
+	tests := []struct {
+		name           string
+		opts           []AnthropicOption
+		tools          []tools.BaseTool
+		system         bool
+		toolCached     bool
+		cachedMessages []int
+	}{
+		{"default", nil, toolDefs, true, true, []int{5, 6}},
+		{"no tools leaves room for messages", []AnthropicOption{WithAnthropicCacheConfig(AnthropicCacheConfig{System: true, Tools: true, Messages: 3})}, nil, true, false, []int{4, 5, 6}},
+		{"message window capped at the breakpoint limit", []AnthropicOption{WithAnthropicCacheConfig(AnthropicCacheConfig{System: true, Tools: true, Messages: 10})}, toolDefs, true, true, []int{5, 6}},
+		{"messages only", []AnthropicOption{WithAnthropicCacheConfig(AnthropicCacheConfig{Messages: 4})}, toolDefs, false, false, []int{3, 4, 5, 6}},
+		{"disabled", []AnthropicOption{WithAnthropicDisableCache()}, toolDefs, false, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestAnthropicClient(tt.opts...)
+			params := client.preparedMessages(context.Background(), client.convertMessages(conversation(3)), client.convertTools(tt.tools))
+
+			require.Len(t, params.System, 1)
+			assert.Equal(t, tt.system, params.System[0].CacheControl.Type != "")
+			if len(params.Tools) > 0 {
+				assert.Equal(t, tt.toolCached, params.Tools[len(params.Tools)-1].OfTool.CacheControl.Type != "")
+				assert.Empty(t, params.Tools[0].OfTool.CacheControl.Type)
+			}
+			assert.Equal(t, tt.cachedMessages, cachedMessageIndexes(params))
+
+			data, err := json.Marshal(params)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, strings.Count(string(data), `"cache_control"`), maxCacheBreakpoints)
+		})
+	}
+}
+
+func TestAnthropicClient_ToolChoice(t *testing.T) {
+	client := newTestAnthropicClient(WithAnthropicShouldThinkFn(func(string) bool { return true }))
+	request := func(choice ToolChoice, offered ...tools.BaseTool) map[string]json.RawMessage {
+		params := client.preparedMessages(context.Background(), client.convertMessages([]message.Message{userMessage("think, then read")}), client.convertTools(offered))
+		client.applyToolChoice(&params, choice)
+		raw, err := json.Marshal(params)
+		require.NoError(t, err)
+		var body map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(raw, &body))
+		return body
+	}
+	view := stubTool{name: "view"}
+
+	body := request(ToolChoice{Mode: ToolChoiceAuto}, view)
+	assert.NotContains(t, body, "tool_choice")
+	assert.Contains(t, body, "thinking")
+
+	body = request(ToolChoice{Mode: ToolChoiceNone}, view)
+	assert.JSONEq(t, `{"type": "none"}`, string(body["tool_choice"]))
+	assert.Contains(t, body, "thinking", "thinking is kept when no tool is forced")
+
+	body = request(ToolChoice{Mode: ToolChoiceRequired}, view)
+	assert.JSONEq(t, `{"type": "any"}`, string(body["tool_choice"]))
+	assert.NotContains(t, body, "thinking", "forcing a tool turns extended thinking off")
+
+	body = request(ToolChoice{Mode: ToolChoiceTool, ToolName: "view"}, view)
+	assert.JSONEq(t, `{"type": "tool", "name": "view"}`, string(body["tool_choice"]))
+
+	body = request(ToolChoice{Mode: ToolChoiceRequired})
+	assert.NotContains(t, body, "tool_choice", "no tool choice without tools")
+}
+
+func TestAnthropicClient_ToolImages(t *testing.T) {
+	client := newTestAnthropicClient()
+	anthropicMessages := client.convertMessages([]message.Message{
+		userMessage("How does the canvas look?"),
+		{Role: message.Assistant, Parts: []message.ContentPart{message.ToolCall{ID: "call-1", Name: "pixelmator_thumbnail", Input: "{}", Finished: true}}},
+		{Role: message.Tool, Parts: []message.ContentPart{
+			message.ToolResult{ToolCallID: "call-1", Content: "Thumbnail of the current document"},
+			message.BinaryContent{MIMEType: "image/jpeg", Data: []byte("jpeg")},
+		}},
+	})
+
+	require.Len(t, anthropicMessages, 3)
+	blocks := anthropicMessages[2].Content
+	require.Len(t, blocks, 2)
+	assert.Equal(t, "call-1", blocks[0].OfToolResult.ToolUseID)
+	require.NotNil(t, blocks[1].OfImage)
+	assert.Equal(t, "anBlZw==", blocks[1].OfImage.Source.OfBase64.Data)
+}
+
+// streamServer answers every request with the given server-sent events, then ends the stream
+func streamServer(t *testing.T, events ...string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var payload struct {
+				Type string `json:"type"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(event), &payload))
+			io.WriteString(w, "event: "+payload.Type+"\ndata: "+event+"\n\n")
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAnthropicClient_TruncatedToolUse(t *testing.T) {
+	start := []string{
+		`{"type": "message_start", "message": {"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet-4", "content": [], "usage": {"input_tokens": 10, "output_tokens": 1}}}`,
+		`{"type": "content_block_start", "index": 0, "content_block": {"type": "tool_use", "id": "toolu_1", "name": "write", "input": {}}}`,
+		`{"type": "content_block_delta", "index": 0, "delta": {"type": "input_json_delta", "partial_json": "{\"file_path\": \"notes.md\","}}`,
+	}
+
+	collect := func(t *testing.T, events ...string) []ProviderEvent {
+		client := newTestAnthropicClient()
+		client.client = anthropic.NewClient(option.WithBaseURL(streamServer(t, events...).URL), option.WithAPIKey("test-key"))
+		var received []ProviderEvent
+		for event := range client.stream(context.Background(), []message.Message{userMessage("Write some notes")}, nil) {
+			received = append(received, event)
+		}
+		return received
+	}
+
+	t.Run("incomplete input ends with an error", func(t *testing.T) {
+		events := collect(t, start...)
+		last := events[len(events)-1]
+		assert.Equal(t, EventError, last.Type)
+		assert.ErrorIs(t, last.Error, ErrIncompleteToolCall)
+		for _, event := range events {
+			assert.NotEqual(t, EventComplete, event.Type, "no tool call is produced")
+		}
+	})
+
+	t.Run("complete input finishes the tool call", func(t *testing.T) {
+		events := collect(t, append(start,
+			`{"type": "content_block_delta", "index": 0, "delta": {"type": "input_json_delta", "partial_json": " \"content\": \"hi\"}"}}`,
+		)...)
+		require.GreaterOrEqual(t, len(events), 2)
+		stop, complete := events[len(events)-2], events[len(events)-1]
+		assert.Equal(t, EventToolUseStop, stop.Type)
+		assert.Equal(t, "toolu_1", stop.ToolCall.ID)
+
+		require.Equal(t, EventComplete, complete.Type)
+		assert.Equal(t, message.FinishReasonToolUse, complete.Response.FinishReason)
+		require.Len(t, complete.Response.ToolCalls, 1)
+		toolCall := complete.Response.ToolCalls[0]
+		assert.Equal(t, "write", toolCall.Name)
+		assert.JSONEq(t, `{"file_path": "notes.md", "content": "hi"}`, toolCall.Input)
+		assert.True(t, toolCall.Finished)
+	})
+}
+
+func TestAnthropicClient_RateLimitRetry(t *testing.T) {
+	answer := streamServer(t,
+		`{"type": "message_start", "message": {"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet-4", "content": [], "usage": {"input_tokens": 10, "output_tokens": 1}}}`,
+		`{"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}`,
+		`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Hello"}}`,
+		`{"type": "content_block_stop", "index": 0}`,
+		`{"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 2}}`,
+		`{"type": "message_stop"}`,
+	)
+	// The first two requests are rate limited, then the answer is streamed
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"type": "error", "error": {"type": "rate_limit_error", "message": "Number of request tokens has exceeded your per-minute rate limit"}}`)
+			return
+		}
+		http.Redirect(w, r, answer.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(server.Close)
+
+	client := newTestAnthropicClient()
+	// Leave retrying to the client rather than the SDK
+	client.client = anthropic.NewClient(option.WithBaseURL(server.URL), option.WithAPIKey("test-key"), option.WithMaxRetries(0))
+
+	var retries []RetryInfo
+	var last ProviderEvent
+	for event := range client.stream(context.Background(), []message.Message{userMessage("Hi")}, nil) {
+		if event.Type == EventRetry {
+			require.NotNil(t, event.Retry)
+			retries = append(retries, *event.Retry)
+		}
+		last = event
+	}
+
+	assert.Equal(t, []RetryInfo{
+		{Attempt: 1, MaxAttempts: maxRetries, Delay: 0},
+		{Attempt: 2, MaxAttempts: maxRetries, Delay: 0},
+	}, retries)
+	assert.Equal(t, 3, requests)
+	require.Equal(t, EventComplete, last.Type)
+	assert.Equal(t, "Hello", last.Response.Content)
+}
+
+func TestAnthropicClient_WithoutPromptCache(t *testing.T) {
+	client := newTestAnthropicClient()
+	messages := client.convertMessages([]message.Message{userMessage("Name this conversation")})
+
+	params := client.preparedMessages(WithoutPromptCache(context.Background()), messages, nil)
+	raw, err := json.Marshal(params)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "cache_control")
+
+	params = client.preparedMessages(context.Background(), client.convertMessages([]message.Message{userMessage("Name this conversation")}), nil)
+	raw, err = json.Marshal(params)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), "cache_control")
+}
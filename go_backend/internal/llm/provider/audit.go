@@ -0,0 +1,168 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"mix/internal/config"
+	"mix/internal/llm/models"
+	"mix/internal/llm/tools"
+	"mix/internal/logging"
+	"mix/internal/message"
+)
+
+const redactedSecret = "[REDACTED]"
+
+// secretPatterns match credentials that may show up in prompts, tool output or headers
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-[A-Za-z0-9_-]{16,}`),
+	regexp.MustCompile(`AIza[0-9A-Za-z_-]{35}`),
+	regexp.MustCompile(`(?:AKIA|ASIA)[0-9A-Z]{16}`),
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,}`),
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]{16,}`),
+}
+
+// auditEntry is one line of the LLM audit log: a provider call and its outcome
+type auditEntry struct {
+	Time       time.Time            `json:"time"`
+	SessionID  string               `json:"sessionId,omitempty"`
+	MessageID  string               `json:"messageId,omitempty"`
+	Provider   models.ModelProvider `json:"provider"`
+	Model      models.ModelID       `json:"model"`
+	Stream     bool                 `json:"stream"`
+	DurationMs int64                `json:"durationMs"`
+	Request    auditRequest         `json:"request"`
+	Response   *auditResponse       `json:"response,omitempty"`
+	Error      string               `json:"error,omitempty"`
+}
+
+type auditRequest struct {
+	System   string         `json:"system,omitempty"`
+	Messages []auditMessage `json:"messages"`
+	Tools    []string       `json:"tools,omitempty"`
+}
+
+type auditMessage struct {
+	Role        message.MessageRole  `json:"role"`
+	Content     string               `json:"content,omitempty"`
+	ToolCalls   []message.ToolCall   `json:"toolCalls,omitempty"`
+	ToolResults []message.ToolResult `json:"toolResults,omitempty"`
+	Attachments int                  `json:"attachments,omitempty"`
+}
+
+type auditResponse struct {
+	Content      string               `json:"content,omitempty"`
+	ToolCalls    []message.ToolCall   `json:"toolCalls,omitempty"`
+	FinishReason message.FinishReason `json:"finishReason,omitempty"`
+	Usage        auditUsage           `json:"usage"`
+}
+
+type auditUsage struct {
+	InputTokens         int64 `json:"inputTokens"`
+	OutputTokens        int64 `json:"outputTokens"`
+	CacheCreationTokens int64 `json:"cacheCreationTokens"`
+	CacheReadTokens     int64 `json:"cacheReadTokens"`
+	ReasoningTokens     int64 `json:"reasoningTokens"`
+}
+
+// auditLog writes one JSON line per provider call
+type auditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// defaultAuditLog is the audit log configured by config.AuditLog, or nil if it's disabled
+var defaultAuditLog = sync.OnceValue(func() *auditLog {
+	cfg := config.Get()
+	if !cfg.AuditLog.Enabled {
+		return nil
+	}
+	path := cfg.AuditLog.Path
+	if path == "" {
+		path = filepath.Join(cfg.Data.Directory, "llm-audit.jsonl")
+	}
+	maxBytes := int64(cfg.AuditLog.MaxSizeMB) * 1024 * 1024
+	return &auditLog{w: logging.NewRotatingFile(path, maxBytes, cfg.AuditLog.MaxFiles)}
+})
+
+// record logs a call made with opts. Secrets, including the provider's API key, are redacted.
+func (l *auditLog) record(ctx context.Context, opts providerClientOptions, stream bool, start time.Time, messages []message.Message, availableTools []tools.BaseTool, response *ProviderResponse, callErr error) {
+	if l == nil {
+		return
+	}
+
+	sessionID, messageID := tools.GetContextValues(ctx)
+	entry := auditEntry{
+		Time:       start,
+		SessionID:  sessionID,
+		MessageID:  messageID,
+		Provider:   opts.model.Provider,
+		Model:      opts.model.ID,
+		Stream:     stream,
+		DurationMs: time.Since(start).Milliseconds(),
+		Request: auditRequest{
+			System:   opts.systemMessage,
+			Messages: make([]auditMessage, 0, len(messages)),
+		},
+	}
+	for _, msg := range messages {
+		entry.Request.Messages = append(entry.Request.Messages, auditMessage{
+			Role:        msg.Role,
+			Content:     msg.Content().String(),
+			ToolCalls:   msg.ToolCalls(),
+			ToolResults: msg.ToolResults(),
+			// Attachment data would bloat the log, so only count it
+			Attachments: len(msg.BinaryContent()) + len(msg.ImageURLContent()),
+		})
+	}
+	for _, tool := range availableTools {
+		entry.Request.Tools = append(entry.Request.Tools, tool.Info().Name)
+	}
+	if response != nil {
+		entry.Response = &auditResponse{
+			Content:      response.Content,
+			ToolCalls:    response.ToolCalls,
+			FinishReason: response.FinishReason,
+			Usage:        auditUsage(response.Usage),
+		}
+	}
+	if callErr != nil {
+		entry.Error = callErr.Error()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logging.Error("Failed to encode audit log entry", "error", err)
+		return
+	}
+	redacted := redactSecrets(string(line), opts.apiKey) + "\n"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := io.WriteString(l.w, redacted); err != nil {
+		logging.Error("Failed to write audit log entry", "error", err)
+	}
+}
+
+// redactSecrets replaces the known secrets and anything that looks like a credential in s
+func redactSecrets(s string, known ...string) string {
+	for _, secret := range known {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redactedSecret)
+		}
+	}
+	for _, pattern := range secretPatterns {
+		if pattern.NumSubexp() > 0 {
+			s = pattern.ReplaceAllString(s, "${1}"+redactedSecret)
+		} else {
+			s = pattern.ReplaceAllString(s, redactedSecret)
+		}
+	}
+	return s
+}
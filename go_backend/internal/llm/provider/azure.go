@@ -10,6 +10,14 @@ import (
 	"github.com/openai/openai-go/option"
 )
 
+type azureOptions struct {
+	endpoint   string
+	apiVersion string
+	deployment string
+}
+
+type AzureOption func(*azureOptions)
+
 type azureClient struct {
 	*openaiClient
 }
@@ -17,35 +25,81 @@ type azureClient struct {
 type AzureClient ProviderClient
 
 func newAzureClient(opts providerClientOptions) (AzureClient, error) {
+	azureOpts := azureOptions{
+		endpoint:   os.Getenv("AZURE_OPENAI_ENDPOINT"),    // ex: https://foo.openai.azure.com
+		apiVersion: os.Getenv("AZURE_OPENAI_API_VERSION"), // ex: 2025-04-01-preview
+	}
+	for _, o := range opts.azureOptions {
+		o(&azureOpts)
+	}
 
-	endpoint := os.Getenv("AZURE_OPENAI_ENDPOINT")      // ex: https://foo.openai.azure.com
-	apiVersion := os.Getenv("AZURE_OPENAI_API_VERSION") // ex: 2025-04-01-preview
-
-	if endpoint == "" {
-		return nil, fmt.Errorf("Azure provider requires AZURE_OPENAI_ENDPOINT environment variable to be set")
+	if azureOpts.endpoint == "" {
+		return nil, fmt.Errorf("Azure provider requires an endpoint: set AZURE_OPENAI_ENDPOINT or providers.azure.endpoint")
 	}
-	if apiVersion == "" {
-		return nil, fmt.Errorf("Azure provider requires AZURE_OPENAI_API_VERSION environment variable to be set")
+	if azureOpts.apiVersion == "" {
+		return nil, fmt.Errorf("Azure provider requires an API version: set AZURE_OPENAI_API_VERSION or providers.azure.apiVersion")
 	}
 
 	reqOpts := []option.RequestOption{
-		azure.WithEndpoint(endpoint, apiVersion),
+		azure.WithEndpoint(azureOpts.endpoint, azureOpts.apiVersion),
 	}
 
-	if opts.apiKey != "" || os.Getenv("AZURE_OPENAI_API_KEY") != "" {
-		key := opts.apiKey
-		if key == "" {
-			key = os.Getenv("AZURE_OPENAI_API_KEY")
-		}
+	key := opts.apiKey
+	if key == "" {
+		key = os.Getenv("AZURE_OPENAI_API_KEY")
+	}
+	if key != "" {
 		reqOpts = append(reqOpts, azure.WithAPIKey(key))
-	} else if cred, err := azidentity.NewDefaultAzureCredential(nil); err == nil {
+	} else {
+		// No api-key means Entra ID authentication
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, fmt.Errorf("Azure provider has no API key and Entra ID credentials are unavailable: %w", err)
+		}
 		reqOpts = append(reqOpts, azure.WithTokenCredential(cred))
 	}
 
+	for key, value := range opts.headers {
+		reqOpts = append(reqOpts, option.WithHeader(key, value))
+	}
+
+	// Azure routes requests by deployment name, sent in place of the model name
+	if azureOpts.deployment != "" {
+		opts.model.APIModel = azureOpts.deployment
+	}
+
+	openaiOpts := openaiOptions{
+		reasoningEffort: "medium",
+	}
+	for _, o := range opts.openaiOptions {
+		o(&openaiOpts)
+	}
+
 	base := &openaiClient{
 		providerOptions: opts,
+		options:         openaiOpts,
 		client:          openai.NewClient(reqOpts...),
 	}
 
 	return &azureClient{openaiClient: base}, nil
 }
+
+// WithAzureEndpoint sets the resource endpoint and API version, overriding
+// AZURE_OPENAI_ENDPOINT and AZURE_OPENAI_API_VERSION
+func WithAzureEndpoint(endpoint, apiVersion string) AzureOption {
+	return func(options *azureOptions) {
+		if endpoint != "" {
+			options.endpoint = endpoint
+		}
+		if apiVersion != "" {
+			options.apiVersion = apiVersion
+		}
+	}
+}
+
+// WithAzureDeployment sets the deployment to send requests to. Defaults to the model's API name.
+func WithAzureDeployment(deployment string) AzureOption {
+	return func(options *azureOptions) {
+		options.deployment = deployment
+	}
+}
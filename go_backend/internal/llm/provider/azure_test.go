@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mix/internal/llm/models"
+	"mix/internal/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAzureClient_DeploymentRouting(t *testing.T) {
+	var gotPath, gotVersion, gotKey, gotModel string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotVersion = r.URL.Query().Get("api-version")
+		gotKey = r.Header.Get("Api-Key")
+		body, _ := io.ReadAll(r.Body)
+		var request struct {
+			Model string `json:"model"`
+		}
+		json.Unmarshal(body, &request)
+		gotModel = request.Model
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{
+			"id": "chatcmpl-1",
+			"object": "chat.completion",
+			"model": "gpt-4.1",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "hello from azure"}}],
+			"usage": {"prompt_tokens": 10, "completion_tokens": 3, "total_tokens": 13}
+		}`)
+	}))
+	defer server.Close()
+
+	client, err := newAzureClient(providerClientOptions{
+		apiKey:    "test-key",
+		model:     models.SupportedModels[models.AzureGPT41],
+		maxTokens: 256,
+		azureOptions: []AzureOption{
+			WithAzureEndpoint(server.URL, "2025-04-01-preview"),
+			WithAzureDeployment("team-gpt41"),
+		},
+	})
+	require.NoError(t, err)
+
+	response, err := client.send(context.Background(), []message.Message{userMessage("hi")}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello from azure", response.Content)
+
+	assert.Equal(t, "/openai/deployments/team-gpt41/chat/completions", gotPath)
+	assert.Equal(t, "2025-04-01-preview", gotVersion)
+	assert.Equal(t, "test-key", gotKey)
+	assert.Equal(t, "team-gpt41", gotModel)
+}
+
+func TestAzureClient_RequiresEndpoint(t *testing.T) {
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "")
+	t.Setenv("AZURE_OPENAI_API_VERSION", "2025-04-01-preview")
+
+	_, err := newAzureClient(providerClientOptions{apiKey: "test-key", model: models.SupportedModels[models.AzureGPT41]})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "requires an endpoint")
+}
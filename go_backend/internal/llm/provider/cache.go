@@ -0,0 +1,17 @@
+package provider
+
+import "context"
+
+type promptCacheContextKey struct{}
+
+// WithoutPromptCache returns a context whose requests place no prompt caching breakpoints,
+// for one-off requests whose prefix won't be reused
+func WithoutPromptCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, promptCacheContextKey{}, true)
+}
+
+// PromptCacheDisabled reports whether caching was turned off with WithoutPromptCache
+func PromptCacheDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(promptCacheContextKey{}).(bool)
+	return disabled
+}
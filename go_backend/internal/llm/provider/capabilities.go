@@ -0,0 +1,37 @@
+package provider
+
+import "mix/internal/llm/models"
+
+// Capabilities are the features a provider supports for its model, so callers can
+// decide what to send without checking the model and provider themselves
+type Capabilities struct {
+	Tools       bool
+	Attachments bool
+	Reasoning   bool
+	Streaming   bool
+	// ResponseFormat is whether the provider can be asked for JSON output
+	ResponseFormat bool
+}
+
+// ModelCapabilities returns the capabilities of model through its provider
+func ModelCapabilities(model models.Model) Capabilities {
+	return Capabilities{
+		Tools:       model.SupportsTools,
+		Attachments: model.SupportsAttachments,
+		Reasoning:   model.CanReason,
+		// Every client implements StreamResponse
+		Streaming:      true,
+		ResponseFormat: supportsResponseFormat(model.Provider),
+	}
+}
+
+// supportsResponseFormat reports whether the provider's API has a JSON output mode. The
+// OpenAI compatible APIs and Gemini do; Anthropic and Bedrock do not.
+func supportsResponseFormat(provider models.ModelProvider) bool {
+	switch provider {
+	case models.ProviderOpenAI, models.ProviderAzure, models.ProviderGROQ, models.ProviderOpenRouter,
+		models.ProviderXAI, models.ProviderLocal, models.ProviderGemini, models.ProviderVertexAI:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go"
+	"google.golang.org/genai"
+)
+
+// ErrorCategory groups failed requests by what the user can do about them
+type ErrorCategory string
+
+const (
+	// ErrorCategoryAuth is a rejected API key or expired login
+	ErrorCategoryAuth ErrorCategory = "auth"
+	// ErrorCategoryRateLimit is a rate limit or overloaded provider that outlasted the retries
+	ErrorCategoryRateLimit ErrorCategory = "rate_limit"
+	// ErrorCategoryConnection is a provider that could not be reached or failed on its side
+	ErrorCategoryConnection ErrorCategory = "connection"
+	// ErrorCategoryContent is a request the provider refused or a response that was unusable
+	ErrorCategoryContent ErrorCategory = "content"
+)
+
+// Guidance suggests what to do about an error in the category
+func (c ErrorCategory) Guidance() string {
+	switch c {
+	case ErrorCategoryAuth:
+		return "The provider rejected the credentials. Check the API key in your config or environment, or log in again."
+	case ErrorCategoryRateLimit:
+		return "The provider is rate limiting requests or is overloaded. Wait a minute and try again."
+	case ErrorCategoryConnection:
+		return "Could not reach the provider. Check your network connection and the provider's status, then try again."
+	default:
+		return "The provider could not process this request. Try rephrasing it, or start a new session if the conversation is very long."
+	}
+}
+
+// ClassifyError returns the category of an error from a provider request, using the
+// status code of the provider's API error where there is one
+func ClassifyError(err error) ErrorCategory {
+	if status, ok := apiErrorStatus(err); ok {
+		switch {
+		case status == 401 || status == 403:
+			return ErrorCategoryAuth
+		case status == 429 || status == 529:
+			return ErrorCategoryRateLimit
+		case status >= 500:
+			return ErrorCategoryConnection
+		}
+		return ErrorCategoryContent
+	}
+
+	if errors.Is(err, ErrMaxRetries) {
+		return ErrorCategoryRateLimit
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrIncompleteToolCall) {
+		return ErrorCategoryConnection
+	}
+
+	// Errors raised before or after the API call, such as running out of retries
+	text := strings.ToLower(err.Error())
+	switch {
+	case contains(text, "rate limit", "quota exceeded", "too many requests", "overloaded"):
+		return ErrorCategoryRateLimit
+	case contains(text, "unauthorized", "api key", "authentication", "oauth", "token refresh"):
+		return ErrorCategoryAuth
+	case contains(text, "connection refused", "connection reset", "no such host", "timeout"):
+		return ErrorCategoryConnection
+	}
+	return ErrorCategoryContent
+}
+
+// apiErrorStatus returns the HTTP status of an API error from any of the provider SDKs
+func apiErrorStatus(err error) (int, bool) {
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.StatusCode, true
+	}
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		return openaiErr.StatusCode, true
+	}
+	var geminiErr genai.APIError
+	if errors.As(err, &geminiErr) {
+		return geminiErr.Code, true
+	}
+	return 0, false
+}
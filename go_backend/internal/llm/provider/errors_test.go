@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genai"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		category ErrorCategory
+	}{
+		{"anthropic invalid key", &anthropic.Error{StatusCode: 401}, ErrorCategoryAuth},
+		{"anthropic overloaded", fmt.Errorf("stream: %w", &anthropic.Error{StatusCode: 529}), ErrorCategoryRateLimit},
+		{"anthropic bad request", &anthropic.Error{StatusCode: 400}, ErrorCategoryContent},
+		{"openai forbidden", &openai.Error{StatusCode: 403}, ErrorCategoryAuth},
+		{"openai rate limit", &openai.Error{StatusCode: 429}, ErrorCategoryRateLimit},
+		{"openai server error", &openai.Error{StatusCode: 502}, ErrorCategoryConnection},
+		{"gemini quota", genai.APIError{Code: 429}, ErrorCategoryRateLimit},
+		{"gemini invalid argument", genai.APIError{Code: 400}, ErrorCategoryContent},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrorCategoryConnection},
+		{"deadline", context.DeadlineExceeded, ErrorCategoryConnection},
+		{"retries exhausted", fmt.Errorf("%w: 8 retries", ErrMaxRetries), ErrorCategoryRateLimit},
+		{"retries exhausted message", errors.New("maximum retry attempts reached for rate limit: 9 retries"), ErrorCategoryRateLimit},
+		{"oauth refresh", errors.New("failed to refresh OAuth token: invalid_grant"), ErrorCategoryAuth},
+		{"empty response", ErrEmptyResponse, ErrorCategoryContent},
+		{"truncated tool call", fmt.Errorf("%w: write", ErrIncompleteToolCall), ErrorCategoryConnection},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.category, ClassifyError(tt.err))
+		})
+	}
+}
+
+func TestErrorCategory_Guidance(t *testing.T) {
+	assert.Contains(t, ErrorCategoryAuth.Guidance(), "API key")
+	assert.Contains(t, ErrorCategoryRateLimit.Guidance(), "Wait")
+	assert.Contains(t, ErrorCategoryConnection.Guidance(), "network connection")
+	assert.Contains(t, ErrorCategoryContent.Guidance(), "rephrasing")
+}
@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
 
@@ -22,10 +25,22 @@ import (
 
 type geminiOptions struct {
 	disableCache bool
+	// vertexAI routes requests through Vertex AI in project and location instead of the Gemini API
+	vertexAI bool
+	project  string
+	location string
+	// emptyResponseRetries is how many times a response with no content or tool calls is retried
+	emptyResponseRetries int
 }
 
 type GeminiOption func(*geminiOptions)
 
+// defaultEmptyResponseRetries retries an empty Gemini response once; they are usually transient
+const defaultEmptyResponseRetries = 1
+
+// ErrEmptyResponse is returned when the model keeps answering with no content or tool calls
+var ErrEmptyResponse = errors.New("the model returned an empty response")
+
 type geminiClient struct {
 	providerOptions providerClientOptions
 	options         geminiOptions
@@ -35,14 +50,14 @@ type geminiClient struct {
 type GeminiClient ProviderClient
 
 func newGeminiClient(opts providerClientOptions) GeminiClient {
-	geminiOpts := geminiOptions{}
+	geminiOpts := geminiOptions{emptyResponseRetries: defaultEmptyResponseRetries}
 	for _, o := range opts.geminiOptions {
 		o(&geminiOpts)
 	}
 
-	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{APIKey: opts.apiKey, Backend: genai.BackendGeminiAPI})
+	client, err := genai.NewClient(context.Background(), geminiClientConfig(opts, geminiOpts))
 	if err != nil {
-		logging.Error("Failed to create Gemini client", "error", err)
+		logging.Error("Failed to create Gemini client", "error", err, "vertexAI", geminiOpts.vertexAI)
 		return nil
 	}
 
@@ -53,8 +68,23 @@ func newGeminiClient(opts providerClientOptions) GeminiClient {
 	}
 }
 
+// convertMessages converts the conversation to Gemini contents. Gemini requires the
+// responses to a model turn's function calls to come right after that turn, so every
+// response to a turn is merged into one function content placed after it, in the order
+// of the calls.
 func (g *geminiClient) convertMessages(messages []message.Message) []*genai.Content {
 	var history []*genai.Content
+
+	// The names of the function calls made so far, by tool call id, and the position of
+	// each call in the latest model turn that made any, whose place in history is
+	// callTurn. A result answers the latest call with its id, so a repeated id can't
+	// match a call from an earlier turn.
+	callNames := map[string]string{}
+	var calls map[string]int
+	callTurn := -1
+	// The responses to the calls of callTurn so far
+	var responses []functionResponse
+
 	for _, msg := range messages {
 		switch msg.Role {
 		case message.User:
@@ -96,37 +126,54 @@ func (g *geminiClient) convertMessages(messages []message.Message) []*genai.Cont
 					Parts: assistantParts,
 				})
 			}
+			if toolCalls := msg.ToolCalls(); len(toolCalls) > 0 {
+				calls = make(map[string]int, len(toolCalls))
+				for i, call := range toolCalls {
+					calls[call.ID] = i
+					callNames[call.ID] = call.Name
+				}
+				callTurn = len(history) - 1
+				responses = nil
+			}
 
 		case message.Tool:
+			added := false
 			for _, result := range msg.ToolResults() {
 				response := map[string]interface{}{"result": result.Content}
 				parsed, err := parseJsonToMap(result.Content)
 				if err == nil {
 					response = parsed
 				}
-
-				var toolCall message.ToolCall
-				for _, m := range messages {
-					if m.Role == message.Assistant {
-						for _, call := range m.ToolCalls() {
-							if call.ID == result.ToolCallID {
-								toolCall = call
-								break
-							}
-						}
-					}
+				index, ok := calls[result.ToolCallID]
+				if !ok {
+					index = len(calls)
 				}
-
-				history = append(history, &genai.Content{
-					Parts: []*genai.Part{
-						{
-							FunctionResponse: &genai.FunctionResponse{
-								Name:     toolCall.Name,
-								Response: response,
-							},
-						},
+				responses = append(responses, functionResponse{index: index, part: &genai.Part{
+					FunctionResponse: &genai.FunctionResponse{
+						Name:     callNames[result.ToolCallID],
+						Response: response,
 					},
-					Role: "function",
+				}})
+				added = true
+			}
+			if added {
+				history = placeFunctionResponses(history, callTurn, responses)
+				if callTurn < 0 {
+					responses = nil
+				}
+			}
+			// Images returned by tools follow the function responses as user content
+			if images := msg.BinaryContent(); len(images) > 0 {
+				var parts []*genai.Part
+				for _, binaryContent := range images {
+					parts = append(parts, &genai.Part{InlineData: &genai.Blob{
+						MIMEType: binaryContent.MIMEType,
+						Data:     binaryContent.Data,
+					}})
+				}
+				history = append(history, &genai.Content{
+					Parts: parts,
+					Role:  "user",
 				})
 			}
 		}
@@ -135,6 +182,35 @@ func (g *geminiClient) convertMessages(messages []message.Message) []*genai.Cont
 	return history
 }
 
+// functionResponse is a function response and the position of its call in the model turn
+type functionResponse struct {
+	index int
+	part  *genai.Part
+}
+
+// placeFunctionResponses sets the function content right after the model turn at
+// callTurn to the turn's responses in the order of its calls, or appends the responses
+// when there is no such turn. Responses to unknown calls come last.
+func placeFunctionResponses(history []*genai.Content, callTurn int, responses []functionResponse) []*genai.Content {
+	slices.SortStableFunc(responses, func(a, b functionResponse) int {
+		return a.index - b.index
+	})
+	parts := make([]*genai.Part, len(responses))
+	for i, response := range responses {
+		parts[i] = response.part
+	}
+
+	if callTurn < 0 {
+		return append(history, &genai.Content{Role: "function", Parts: parts})
+	}
+	next := callTurn + 1
+	if next < len(history) && history[next].Role == "function" {
+		history[next].Parts = parts
+		return history
+	}
+	return slices.Insert(history, next, &genai.Content{Role: "function", Parts: parts})
+}
+
 func (g *geminiClient) convertTools(tools []toolspkg.BaseTool) []*genai.Tool {
 	geminiTool := &genai.Tool{}
 	geminiTool.FunctionDeclarations = make([]*genai.FunctionDeclaration, 0, len(tools))
@@ -168,6 +244,33 @@ func (g *geminiClient) finishReason(reason genai.FinishReason) message.FinishRea
 	}
 }
 
+// generateConfig builds the request config, with the tools and the tool choice from ctx
+func (g *geminiClient) generateConfig(ctx context.Context, tools []toolspkg.BaseTool) *genai.GenerateContentConfig {
+	config := &genai.GenerateContentConfig{
+		MaxOutputTokens: int32(g.providerOptions.maxTokens),
+		SystemInstruction: &genai.Content{
+			Parts: []*genai.Part{{Text: g.providerOptions.systemMessage}},
+		},
+	}
+	if len(tools) == 0 {
+		return config
+	}
+
+	config.Tools = g.convertTools(tools)
+	switch choice := ToolChoiceFromContext(ctx); choice.Mode {
+	case ToolChoiceNone:
+		config.ToolConfig = &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{Mode: genai.FunctionCallingConfigModeNone}}
+	case ToolChoiceRequired:
+		config.ToolConfig = &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{Mode: genai.FunctionCallingConfigModeAny}}
+	case ToolChoiceTool:
+		config.ToolConfig = &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{
+			Mode:                 genai.FunctionCallingConfigModeAny,
+			AllowedFunctionNames: []string{choice.ToolName},
+		}}
+	}
+	return config
+}
+
 func (g *geminiClient) send(ctx context.Context, messages []message.Message, tools []toolspkg.BaseTool) (*ProviderResponse, error) {
 	// Convert messages
 	geminiMessages := g.convertMessages(messages)
@@ -180,18 +283,10 @@ func (g *geminiClient) send(ctx context.Context, messages []message.Message, too
 
 	history := geminiMessages[:len(geminiMessages)-1] // All but last message
 	lastMsg := geminiMessages[len(geminiMessages)-1]
-	config := &genai.GenerateContentConfig{
-		MaxOutputTokens: int32(g.providerOptions.maxTokens),
-		SystemInstruction: &genai.Content{
-			Parts: []*genai.Part{{Text: g.providerOptions.systemMessage}},
-		},
-	}
-	if len(tools) > 0 {
-		config.Tools = g.convertTools(tools)
-	}
-	chat, _ := g.client.Chats.Create(ctx, g.providerOptions.model.APIModel, config, history)
+	chat, _ := g.client.Chats.Create(ctx, g.providerOptions.model.APIModel, g.generateConfig(ctx, tools), history)
 
 	attempts := 0
+	emptyResponses := 0
 	for {
 		attempts++
 		var toolCalls []message.ToolCall
@@ -242,11 +337,15 @@ func (g *geminiClient) send(ctx context.Context, messages []message.Message, too
 
 		// Check for completely empty response (no content and no tool calls)
 		if content == "" && len(toolCalls) == 0 {
-			logging.Warn("Gemini returned empty response with no content or tool calls")
-			// Extract sessionID from context and log detailed debug information
-			if sessionID, ok := ctx.Value(toolspkg.SessionIDContextKey).(string); ok {
-				g.logEmptyResponseDetails(sessionID, messages, tools, resp)
+			g.logEmptyResponse(ctx, messages, tools, resp)
+			if emptyResponses >= g.options.emptyResponseRetries {
+				return nil, ErrEmptyResponse
 			}
+			emptyResponses++
+			logging.Warn(fmt.Sprintf("Retrying empty Gemini response... attempt %d of %d", emptyResponses, g.options.emptyResponseRetries))
+			// A fresh chat, so the empty turn isn't part of the retried request
+			chat, _ = g.client.Chats.Create(ctx, g.providerOptions.model.APIModel, g.generateConfig(ctx, tools), history)
+			continue
 		}
 
 		finishReason := message.FinishReasonEndTurn
@@ -278,18 +377,10 @@ func (g *geminiClient) stream(ctx context.Context, messages []message.Message, t
 
 	history := geminiMessages[:len(geminiMessages)-1] // All but last message
 	lastMsg := geminiMessages[len(geminiMessages)-1]
-	config := &genai.GenerateContentConfig{
-		MaxOutputTokens: int32(g.providerOptions.maxTokens),
-		SystemInstruction: &genai.Content{
-			Parts: []*genai.Part{{Text: g.providerOptions.systemMessage}},
-		},
-	}
-	if len(tools) > 0 {
-		config.Tools = g.convertTools(tools)
-	}
-	chat, _ := g.client.Chats.Create(ctx, g.providerOptions.model.APIModel, config, history)
+	chat, _ := g.client.Chats.Create(ctx, g.providerOptions.model.APIModel, g.generateConfig(ctx, tools), history)
 
 	attempts := 0
+	emptyResponses := 0
 	eventChan := make(chan ProviderEvent)
 
 	go func() {
@@ -299,7 +390,7 @@ func (g *geminiClient) stream(ctx context.Context, messages []message.Message, t
 			attempts++
 
 			currentContent := ""
-			toolCalls := []message.ToolCall{}
+			var calls functionCallAccumulator
 			var finalResp *genai.GenerateContentResponse
 
 			eventChan <- ProviderEvent{Type: EventContentStart}
@@ -318,6 +409,7 @@ func (g *geminiClient) stream(ctx context.Context, messages []message.Message, t
 					}
 					if retry {
 						logging.Warn(fmt.Sprintf("Retrying due to rate limit... attempt %d of %d", attempts, maxRetries))
+						eventChan <- retryEvent(attempts, after)
 						select {
 						case <-ctx.Done():
 							if ctx.Err() != nil {
@@ -337,6 +429,7 @@ func (g *geminiClient) stream(ctx context.Context, messages []message.Message, t
 				finalResp = resp
 
 				if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+					var chunkCalls []*genai.FunctionCall
 					for _, part := range resp.Candidates[0].Content.Parts {
 						switch {
 						case part.Text != "":
@@ -349,42 +442,30 @@ func (g *geminiClient) stream(ctx context.Context, messages []message.Message, t
 								currentContent += delta
 							}
 						case part.FunctionCall != nil:
-							id := "call_" + uuid.New().String()
-							args, _ := json.Marshal(part.FunctionCall.Args)
-							newCall := message.ToolCall{
-								ID:       id,
-								Name:     part.FunctionCall.Name,
-								Input:    string(args),
-								Type:     "function",
-								Finished: true,
-							}
-
-							isNew := true
-							for _, existing := range toolCalls {
-								if existing.Name == newCall.Name && existing.Input == newCall.Input {
-									isNew = false
-									break
-								}
-							}
-
-							if isNew {
-								toolCalls = append(toolCalls, newCall)
-							}
+							chunkCalls = append(chunkCalls, part.FunctionCall)
 						}
 					}
+					calls.add(chunkCalls)
 				}
 			}
 
+			toolCalls := calls.toolCalls()
+
 			eventChan <- ProviderEvent{Type: EventContentStop}
 
 			if finalResp != nil {
 				// Check for completely empty response (no content and no tool calls)
 				if currentContent == "" && len(toolCalls) == 0 {
-					logging.Warn("Gemini returned empty response with no content or tool calls")
-					// Extract sessionID from context and log detailed debug information
-					if sessionID, ok := ctx.Value(toolspkg.SessionIDContextKey).(string); ok {
-						g.logEmptyResponseDetails(sessionID, messages, tools, finalResp)
+					g.logEmptyResponse(ctx, messages, tools, finalResp)
+					if emptyResponses >= g.options.emptyResponseRetries {
+						eventChan <- ProviderEvent{Type: EventError, Error: ErrEmptyResponse}
+						return
 					}
+					emptyResponses++
+					logging.Warn(fmt.Sprintf("Retrying empty Gemini response... attempt %d of %d", emptyResponses, g.options.emptyResponseRetries))
+					// A fresh chat, so the empty turn isn't part of the retried request
+					chat, _ = g.client.Chats.Create(ctx, g.providerOptions.model.APIModel, g.generateConfig(ctx, tools), history)
+					continue
 				}
 
 				finishReason := message.FinishReasonEndTurn
@@ -412,10 +493,97 @@ func (g *geminiClient) stream(ctx context.Context, messages []message.Message, t
 	return eventChan
 }
 
+// functionCallAccumulator collects the function calls of a streamed response. Calls are
+// tracked by position: a chunk either starts new calls or resends calls already seen,
+// possibly with more of their arguments filled in, in which case they are merged into
+// the earlier calls instead of being run twice. Calls carrying an ID are matched by ID.
+type functionCallAccumulator struct {
+	calls []message.ToolCall
+	ids   []string
+	args  []map[string]any
+}
+
+// add merges the function calls from one streamed chunk, in the order they appear
+func (a *functionCallAccumulator) add(chunk []*genai.FunctionCall) {
+	if len(chunk) == 0 {
+		return
+	}
+
+	// A chunk resends earlier calls if its first call continues the first or the latest call
+	base := len(a.calls)
+	if first := chunk[0]; first.ID == "" && base > 0 {
+		if a.continues(0, first) {
+			base = 0
+		} else if a.continues(base-1, first) {
+			base--
+		}
+	}
+
+	for i, call := range chunk {
+		if call.ID != "" {
+			if index := slices.Index(a.ids, call.ID); index >= 0 {
+				a.update(index, call)
+				continue
+			}
+		} else if position := base + i; position < len(a.calls) && a.continues(position, call) {
+			a.update(position, call)
+			continue
+		}
+		a.append(call)
+	}
+}
+
+// continues reports whether call is the call at index again, with the same or more arguments
+func (a *functionCallAccumulator) continues(index int, call *genai.FunctionCall) bool {
+	if a.calls[index].Name != call.Name || a.ids[index] != call.ID {
+		return false
+	}
+	for key, previous := range a.args[index] {
+		current, ok := call.Args[key]
+		if !ok {
+			return false
+		}
+		// Streamed string arguments may grow between chunks
+		previousText, isText := previous.(string)
+		currentText, _ := current.(string)
+		if isText && strings.HasPrefix(currentText, previousText) {
+			continue
+		}
+		if !reflect.DeepEqual(previous, current) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *functionCallAccumulator) update(index int, call *genai.FunctionCall) {
+	input, _ := json.Marshal(call.Args)
+	a.calls[index].Input = string(input)
+	a.args[index] = call.Args
+}
+
+func (a *functionCallAccumulator) append(call *genai.FunctionCall) {
+	input, _ := json.Marshal(call.Args)
+	a.calls = append(a.calls, message.ToolCall{
+		ID:       "call_" + uuid.New().String(),
+		Name:     call.Name,
+		Input:    string(input),
+		Type:     "function",
+		Finished: true,
+	})
+	a.ids = append(a.ids, call.ID)
+	a.args = append(a.args, call.Args)
+}
+
+// toolCalls returns the accumulated calls, or an empty slice if there are none
+func (a *functionCallAccumulator) toolCalls() []message.ToolCall {
+	return append([]message.ToolCall{}, a.calls...)
+}
+
 func (g *geminiClient) shouldRetry(attempts int, err error) (bool, int64, error) {
 	// Check if error is a rate limit error
 	if attempts > maxRetries {
-		return false, 0, fmt.Errorf("maximum retry attempts reached for rate limit: %d retries", maxRetries)
+		return false, 0, fmt.Errorf("%w: %d retries", ErrMaxRetries, maxRetries)
 	}
 
 	// Gemini doesn't have a standard error type we can check against
@@ -484,6 +652,45 @@ func WithGeminiDisableCache() GeminiOption {
 	}
 }
 
+// WithGeminiEmptyResponseRetries sets how many times a response with no content or tool
+// calls is retried before failing with ErrEmptyResponse; 0 disables retrying
+func WithGeminiEmptyResponseRetries(retries int) GeminiOption {
+	return func(options *geminiOptions) {
+		options.emptyResponseRetries = max(retries, 0)
+	}
+}
+
+// WithGeminiVertexAI sends requests through Vertex AI, authenticating with Google Cloud
+// application default credentials instead of an API key
+func WithGeminiVertexAI(project, location string) GeminiOption {
+	return func(options *geminiOptions) {
+		options.vertexAI = true
+		options.project = project
+		options.location = location
+	}
+}
+
+// geminiClientConfig selects the genai backend for the client options
+func geminiClientConfig(opts providerClientOptions, geminiOpts geminiOptions) *genai.ClientConfig {
+	var httpOptions genai.HTTPOptions
+	if len(opts.headers) > 0 {
+		httpOptions.Headers = make(http.Header, len(opts.headers))
+		for key, value := range opts.headers {
+			httpOptions.Headers.Set(key, value)
+		}
+	}
+
+	if geminiOpts.vertexAI {
+		return &genai.ClientConfig{
+			Project:     geminiOpts.project,
+			Location:    geminiOpts.location,
+			Backend:     genai.BackendVertexAI,
+			HTTPOptions: httpOptions,
+		}
+	}
+	return &genai.ClientConfig{APIKey: opts.apiKey, Backend: genai.BackendGeminiAPI, HTTPOptions: httpOptions}
+}
+
 // Helper functions
 func parseJsonToMap(jsonStr string) (map[string]interface{}, error) {
 	var result map[string]interface{}
@@ -574,6 +781,15 @@ func contains(s string, substrs ...string) bool {
 	return false
 }
 
+// logEmptyResponse warns about a response with no content or tool calls and, when the
+// request belongs to a session, writes its details for debugging
+func (g *geminiClient) logEmptyResponse(ctx context.Context, messages []message.Message, tools []toolspkg.BaseTool, resp *genai.GenerateContentResponse) {
+	logging.Warn("Gemini returned empty response with no content or tool calls")
+	if sessionID, ok := ctx.Value(toolspkg.SessionIDContextKey).(string); ok {
+		g.logEmptyResponseDetails(sessionID, messages, tools, resp)
+	}
+}
+
 // logEmptyResponseDetails logs detailed request and response information when Gemini returns empty responses
 func (g *geminiClient) logEmptyResponseDetails(sessionID string, messages []message.Message, tools []toolspkg.BaseTool, resp *genai.GenerateContentResponse) {
 	timestamp := time.Now().Format("20060102-150405")
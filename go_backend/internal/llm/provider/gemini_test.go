@@ -0,0 +1,282 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"mix/internal/llm/models"
+	"mix/internal/llm/tools"
+	"mix/internal/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genai"
+)
+
+func TestGeminiClientConfig_Backend(t *testing.T) {
+	opts := providerClientOptions{apiKey: "gemini-key"}
+
+	t.Run("gemini api", func(t *testing.T) {
+		cfg := geminiClientConfig(opts, geminiOptions{})
+		assert.Equal(t, genai.BackendGeminiAPI, cfg.Backend)
+		assert.Equal(t, "gemini-key", cfg.APIKey)
+	})
+
+	t.Run("vertex ai", func(t *testing.T) {
+		var geminiOpts geminiOptions
+		WithGeminiVertexAI("my-project", "us-central1")(&geminiOpts)
+
+		cfg := geminiClientConfig(opts, geminiOpts)
+		assert.Equal(t, genai.BackendVertexAI, cfg.Backend)
+		assert.Equal(t, "my-project", cfg.Project)
+		assert.Equal(t, "us-central1", cfg.Location)
+		assert.Empty(t, cfg.APIKey)
+	})
+}
+
+func TestFunctionCallAccumulator(t *testing.T) {
+	call := func(name string, args map[string]any) *genai.FunctionCall {
+		return &genai.FunctionCall{Name: name, Args: args}
+	}
+	inputs := func(a *functionCallAccumulator) []string {
+		var result []string
+		for _, toolCall := range a.toolCalls() {
+			result = append(result, toolCall.Name+" "+toolCall.Input)
+		}
+		return result
+	}
+
+	t.Run("incremental chunks add distinct calls", func(t *testing.T) {
+		var a functionCallAccumulator
+		a.add([]*genai.FunctionCall{call("view", map[string]any{"file_path": "/a.go"})})
+		a.add([]*genai.FunctionCall{call("view", map[string]any{"file_path": "/b.go"})})
+		assert.Equal(t, []string{`view {"file_path":"/a.go"}`, `view {"file_path":"/b.go"}`}, inputs(&a))
+	})
+
+	t.Run("resent call is merged", func(t *testing.T) {
+		var a functionCallAccumulator
+		a.add([]*genai.FunctionCall{call("grep", map[string]any{"pattern": "foo", "path": "/src"})})
+		a.add([]*genai.FunctionCall{call("grep", map[string]any{"path": "/src", "pattern": "foo"})})
+		assert.Equal(t, []string{`grep {"path":"/src","pattern":"foo"}`}, inputs(&a))
+	})
+
+	t.Run("partial arguments accumulate", func(t *testing.T) {
+		var a functionCallAccumulator
+		a.add([]*genai.FunctionCall{call("bash", map[string]any{"command": "go te"})})
+		a.add([]*genai.FunctionCall{call("bash", map[string]any{"command": "go test ./..."})})
+		a.add([]*genai.FunctionCall{call("bash", map[string]any{"command": "go test ./...", "timeout": float64(60)})})
+		require.Len(t, a.toolCalls(), 1)
+		assert.Equal(t, `bash {"command":"go test ./...","timeout":60}`, inputs(&a)[0])
+	})
+
+	t.Run("cumulative chunks resend every call", func(t *testing.T) {
+		var a functionCallAccumulator
+		a.add([]*genai.FunctionCall{call("ls", map[string]any{"path": "/a"})})
+		a.add([]*genai.FunctionCall{call("ls", map[string]any{"path": "/a"}), call("ls", map[string]any{"path": "/b"})})
+		assert.Equal(t, []string{`ls {"path":"/a"}`, `ls {"path":"/b"}`}, inputs(&a))
+	})
+
+	t.Run("identical calls in one chunk are kept", func(t *testing.T) {
+		var a functionCallAccumulator
+		a.add([]*genai.FunctionCall{call("bash", map[string]any{"command": "date"}), call("bash", map[string]any{"command": "date"})})
+		calls := a.toolCalls()
+		require.Len(t, calls, 2)
+		assert.NotEqual(t, calls[0].ID, calls[1].ID)
+	})
+
+	t.Run("calls with IDs are matched by ID", func(t *testing.T) {
+		var a functionCallAccumulator
+		a.add([]*genai.FunctionCall{{ID: "1", Name: "view", Args: map[string]any{"file_path": "/a.go"}}})
+		a.add([]*genai.FunctionCall{{ID: "2", Name: "view", Args: map[string]any{"file_path": "/a.go"}}})
+		a.add([]*genai.FunctionCall{{ID: "1", Name: "view", Args: map[string]any{"file_path": "/a.go", "limit": float64(10)}}})
+		assert.Equal(t, []string{`view {"file_path":"/a.go","limit":10}`, `view {"file_path":"/a.go"}`}, inputs(&a))
+	})
+
+	t.Run("no calls", func(t *testing.T) {
+		var a functionCallAccumulator
+		a.add(nil)
+		assert.NotNil(t, a.toolCalls())
+		assert.Empty(t, a.toolCalls())
+	})
+}
+
+func TestGeminiClient_ToolChoice(t *testing.T) {
+	client := &geminiClient{providerOptions: providerClientOptions{maxTokens: 1024}}
+	offered := []tools.BaseTool{stubTool{name: "view"}}
+	config := func(choice ToolChoice, offered []tools.BaseTool) *genai.GenerateContentConfig {
+		return client.generateConfig(WithToolChoice(context.Background(), choice), offered)
+	}
+
+	assert.Nil(t, config(ToolChoice{Mode: ToolChoiceAuto}, offered).ToolConfig)
+	assert.Nil(t, config(ToolChoice{Mode: ToolChoiceRequired}, nil).ToolConfig)
+
+	none := config(ToolChoice{Mode: ToolChoiceNone}, offered).ToolConfig
+	require.NotNil(t, none)
+	assert.Equal(t, genai.FunctionCallingConfigModeNone, none.FunctionCallingConfig.Mode)
+
+	required := config(ToolChoice{Mode: ToolChoiceRequired}, offered).ToolConfig
+	require.NotNil(t, required)
+	assert.Equal(t, genai.FunctionCallingConfigModeAny, required.FunctionCallingConfig.Mode)
+	assert.Empty(t, required.FunctionCallingConfig.AllowedFunctionNames)
+
+	specific := config(ToolChoice{Mode: ToolChoiceTool, ToolName: "view"}, offered).ToolConfig
+	require.NotNil(t, specific)
+	assert.Equal(t, genai.FunctionCallingConfigModeAny, specific.FunctionCallingConfig.Mode)
+	assert.Equal(t, []string{"view"}, specific.FunctionCallingConfig.AllowedFunctionNames)
+}
+
+// newTestGeminiClient returns a client for a server that answers each request with the
+// next of the given texts, where an empty text is a response with no content
+func newTestGeminiClient(t *testing.T, texts []string, opts ...GeminiOption) (*geminiClient, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1)) - 1
+		text := texts[min(n, len(texts)-1)]
+		parts := "[]"
+		if text != "" {
+			parts = fmt.Sprintf(`[{"text": %q}]`, text)
+		}
+		body := fmt.Sprintf(`{"candidates": [{"content": {"role": "model", "parts": %s}, "finishReason": "STOP"}], "usageMetadata": {"promptTokenCount": 5, "candidatesTokenCount": 2}}`, parts)
+
+		if strings.Contains(r.URL.Path, "streamGenerateContent") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: "+body+"\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	genaiClient, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test-key",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	require.NoError(t, err)
+
+	geminiOpts := geminiOptions{emptyResponseRetries: defaultEmptyResponseRetries}
+	for _, o := range opts {
+		o(&geminiOpts)
+	}
+	return &geminiClient{
+		providerOptions: providerClientOptions{model: models.SupportedModels[models.Gemini25Flash], maxTokens: 256},
+		options:         geminiOpts,
+		client:          genaiClient,
+	}, &requests
+}
+
+func TestGeminiClient_EmptyResponseRetry(t *testing.T) {
+	messages := []message.Message{userMessage("hello")}
+
+	t.Run("send retries an empty response", func(t *testing.T) {
+		client, requests := newTestGeminiClient(t, []string{"", "hello from gemini"})
+		response, err := client.send(context.Background(), messages, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "hello from gemini", response.Content)
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("stream retries an empty response", func(t *testing.T) {
+		client, requests := newTestGeminiClient(t, []string{"", "hello from gemini"})
+		var complete *ProviderResponse
+		for event := range client.stream(context.Background(), messages, nil) {
+			require.NoError(t, event.Error)
+			if event.Type == EventComplete {
+				complete = event.Response
+			}
+		}
+		require.NotNil(t, complete)
+		assert.Equal(t, "hello from gemini", complete.Content)
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("still empty after retrying", func(t *testing.T) {
+		client, requests := newTestGeminiClient(t, []string{""}, WithGeminiEmptyResponseRetries(2))
+		_, err := client.send(context.Background(), messages, nil)
+		assert.ErrorIs(t, err, ErrEmptyResponse)
+		assert.Equal(t, int32(3), requests.Load())
+
+		var streamErr error
+		for event := range client.stream(context.Background(), messages, nil) {
+			if event.Type == EventError {
+				streamErr = event.Error
+			}
+		}
+		assert.ErrorIs(t, streamErr, ErrEmptyResponse)
+	})
+
+	t.Run("retrying disabled", func(t *testing.T) {
+		client, requests := newTestGeminiClient(t, []string{"", "hello from gemini"}, WithGeminiEmptyResponseRetries(0))
+		_, err := client.send(context.Background(), messages, nil)
+		assert.ErrorIs(t, err, ErrEmptyResponse)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+}
+
+func TestGeminiClient_ConvertFunctionResponses(t *testing.T) {
+	user := func(text string) message.Message {
+		return message.Message{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: text}}}
+	}
+	calls := func(calls ...message.ToolCall) message.Message {
+		parts := make([]message.ContentPart, len(calls))
+		for i, call := range calls {
+			parts[i] = call
+		}
+		return message.Message{Role: message.Assistant, Parts: parts}
+	}
+	results := func(results ...message.ToolResult) message.Message {
+		parts := make([]message.ContentPart, len(results))
+		for i, result := range results {
+			parts[i] = result
+		}
+		return message.Message{Role: message.Tool, Parts: parts}
+	}
+
+	history := (&geminiClient{}).convertMessages([]message.Message{
+		user("look around"),
+		calls(
+			message.ToolCall{ID: "call-1", Name: "view", Input: `{"file_path":"a.go"}`},
+			message.ToolCall{ID: "call-2", Name: "ls", Input: `{}`},
+			message.ToolCall{ID: "call-3", Name: "glob", Input: `{"pattern":"*.go"}`},
+		),
+		// Results arrive out of order and split across messages
+		results(message.ToolResult{ToolCallID: "call-3", Content: "a.go"}, message.ToolResult{ToolCallID: "call-1", Content: "package a"}),
+		results(message.ToolResult{ToolCallID: "call-2", Content: "a.go b.go"}),
+		user("now search"),
+		// The id repeats, but the result belongs to this turn's call
+		calls(message.ToolCall{ID: "call-1", Name: "grep", Input: `{"pattern":"func"}`}),
+		user("hurry up"),
+		results(message.ToolResult{ToolCallID: "call-1", Content: "a.go:3"}),
+	})
+
+	type response struct {
+		role  string
+		names []string
+	}
+	var got []response
+	for _, content := range history {
+		entry := response{role: content.Role}
+		for _, part := range content.Parts {
+			if part.FunctionResponse != nil {
+				entry.names = append(entry.names, part.FunctionResponse.Name)
+			}
+		}
+		got = append(got, entry)
+	}
+	assert.Equal(t, []response{
+		{role: "user"},
+		{role: "model"},
+		{role: "function", names: []string{"view", "ls", "glob"}},
+		{role: "user"},
+		{role: "model"},
+		{role: "function", names: []string{"grep"}},
+		{role: "user"},
+	}, got)
+}
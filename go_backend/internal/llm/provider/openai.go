@@ -57,6 +57,9 @@ func newOpenAIClient(opts providerClientOptions) OpenAIClient {
 			openaiClientOptions = append(openaiClientOptions, option.WithHeader(key, value))
 		}
 	}
+	for key, value := range opts.headers {
+		openaiClientOptions = append(openaiClientOptions, option.WithHeader(key, value))
+	}
 
 	client := openai.NewClient(openaiClientOptions...)
 	return &openaiClient{
@@ -120,6 +123,15 @@ func (o *openaiClient) convertMessages(messages []message.Message) (openaiMessag
 					openai.ToolMessage(result.Content, result.ToolCallID),
 				)
 			}
+			// Tool messages only hold text, so images returned by tools follow as a user message
+			if images := msg.BinaryContent(); len(images) > 0 {
+				var content []openai.ChatCompletionContentPartUnionParam
+				for _, binaryContent := range images {
+					imageURL := openai.ChatCompletionContentPartImageImageURLParam{URL: binaryContent.String(models.ProviderOpenAI)}
+					content = append(content, openai.ChatCompletionContentPartUnionParam{OfImageURL: &openai.ChatCompletionContentPartImageParam{ImageURL: imageURL}})
+				}
+				openaiMessages = append(openaiMessages, openai.UserMessage(content))
+			}
 		}
 	}
 
@@ -186,8 +198,26 @@ func (o *openaiClient) preparedParams(messages []openai.ChatCompletionMessagePar
 	return params
 }
 
+// applyToolChoice sets the requested tool choice on a request that offers tools
+func (o *openaiClient) applyToolChoice(params *openai.ChatCompletionNewParams, choice ToolChoice) {
+	if len(params.Tools) == 0 {
+		return
+	}
+	switch choice.Mode {
+	case ToolChoiceNone, ToolChoiceRequired:
+		params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: openai.String(string(choice.Mode))}
+	case ToolChoiceTool:
+		params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{
+			OfChatCompletionNamedToolChoice: &openai.ChatCompletionNamedToolChoiceParam{
+				Function: openai.ChatCompletionNamedToolChoiceFunctionParam{Name: choice.ToolName},
+			},
+		}
+	}
+}
+
 func (o *openaiClient) send(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (response *ProviderResponse, err error) {
 	params := o.preparedParams(o.convertMessages(messages), o.convertTools(tools))
+	o.applyToolChoice(&params, ToolChoiceFromContext(ctx))
 	cfg := config.Get()
 	if cfg.Debug {
 		jsonData, _ := json.Marshal(params)
@@ -241,6 +271,7 @@ func (o *openaiClient) send(ctx context.Context, messages []message.Message, too
 
 func (o *openaiClient) stream(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
 	params := o.preparedParams(o.convertMessages(messages), o.convertTools(tools))
+	o.applyToolChoice(&params, ToolChoiceFromContext(ctx))
 	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{
 		IncludeUsage: openai.Bool(true),
 	}
@@ -314,6 +345,7 @@ func (o *openaiClient) stream(ctx context.Context, messages []message.Message, t
 			}
 			if retry {
 				logging.Warn(fmt.Sprintf("Retrying due to rate limit... attempt %d of %d", attempts, maxRetries))
+				eventChan <- retryEvent(attempts, after)
 				select {
 				case <-ctx.Done():
 					// context cancelled
@@ -346,7 +378,7 @@ func (o *openaiClient) shouldRetry(attempts int, err error) (bool, int64, error)
 	}
 
 	if attempts > maxRetries {
-		return false, 0, fmt.Errorf("maximum retry attempts reached for rate limit: %d retries", maxRetries)
+		return false, 0, fmt.Errorf("%w: %d retries", ErrMaxRetries, maxRetries)
 	}
 
 	retryMs := 0
@@ -385,12 +417,15 @@ func (o *openaiClient) toolCalls(completion openai.ChatCompletion) []message.Too
 func (o *openaiClient) usage(completion openai.ChatCompletion) TokenUsage {
 	cachedTokens := completion.Usage.PromptTokensDetails.CachedTokens
 	inputTokens := completion.Usage.PromptTokens - cachedTokens
+	// Completion tokens include the reasoning tokens, which are reported separately
+	reasoningTokens := completion.Usage.CompletionTokensDetails.ReasoningTokens
 
 	return TokenUsage{
 		InputTokens:         inputTokens,
-		OutputTokens:        completion.Usage.CompletionTokens,
+		OutputTokens:        completion.Usage.CompletionTokens - reasoningTokens,
 		CacheCreationTokens: 0, // OpenAI doesn't provide this directly
 		CacheReadTokens:     cachedTokens,
+		ReasoningTokens:     reasoningTokens,
 	}
 }
 
@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mix/internal/llm/models"
+	"mix/internal/llm/tools"
+	"mix/internal/message"
+
+	"github.com/openai/openai-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIClient_UsageWithReasoningTokens(t *testing.T) {
+	payload := `{
+		"id": "chatcmpl-1",
+		"object": "chat.completion",
+		"model": "o3-mini",
+		"choices": [],
+		"usage": {
+			"prompt_tokens": 1200,
+			"completion_tokens": 900,
+			"total_tokens": 2100,
+			"prompt_tokens_details": {"cached_tokens": 200},
+			"completion_tokens_details": {"reasoning_tokens": 700}
+		}
+	}`
+	var completion openai.ChatCompletion
+	require.NoError(t, json.Unmarshal([]byte(payload), &completion))
+
+	usage := (&openaiClient{}).usage(completion)
+	assert.Equal(t, TokenUsage{
+		InputTokens:     1000,
+		OutputTokens:    200,
+		CacheReadTokens: 200,
+		ReasoningTokens: 700,
+	}, usage)
+
+	// Reasoning tokens are billed at the output rate
+	model := models.Model{CostPer1MIn: 1, CostPer1MOut: 4, CostPer1MOutCached: 0.5}
+	assert.InDelta(t, 1000*1/1e6+200*0.5/1e6+900*4/1e6, usage.Cost(model), 1e-12)
+}
+
+func TestOpenAIClient_ToolChoice(t *testing.T) {
+	var gotToolChoice json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request struct {
+			ToolChoice json.RawMessage `json:"tool_choice"`
+		}
+		json.Unmarshal(body, &request)
+		gotToolChoice = request.ToolChoice
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{
+			"id": "chatcmpl-1",
+			"object": "chat.completion",
+			"model": "gpt-4.1",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "ok"}}],
+			"usage": {"prompt_tokens": 10, "completion_tokens": 1, "total_tokens": 11}
+		}`)
+	}))
+	defer server.Close()
+
+	client := newOpenAIClient(providerClientOptions{
+		apiKey:        "test-key",
+		model:         models.SupportedModels[models.GPT41],
+		maxTokens:     256,
+		openaiOptions: []OpenAIOption{WithOpenAIBaseURL(server.URL)},
+	})
+	offered := []tools.BaseTool{stubTool{name: "view"}, stubTool{name: "ls"}}
+
+	tests := []struct {
+		name   string
+		choice ToolChoice
+		tools  []tools.BaseTool
+		want   string
+	}{
+		{"auto is left to the default", ToolChoice{Mode: ToolChoiceAuto}, offered, ""},
+		{"none", ToolChoice{Mode: ToolChoiceNone}, offered, `"none"`},
+		{"required", ToolChoice{Mode: ToolChoiceRequired}, offered, `"required"`},
+		{"specific tool", ToolChoice{Mode: ToolChoiceTool, ToolName: "view"}, offered, `{"function":{"name":"view"},"type":"function"}`},
+		{"ignored without tools", ToolChoice{Mode: ToolChoiceRequired}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotToolChoice = nil
+			ctx := WithToolChoice(context.Background(), tt.choice)
+			_, err := client.send(ctx, []message.Message{userMessage("hi")}, tt.tools)
+			require.NoError(t, err)
+			if tt.want == "" {
+				assert.Empty(t, gotToolChoice)
+			} else {
+				assert.JSONEq(t, tt.want, string(gotToolChoice))
+			}
+		})
+	}
+}
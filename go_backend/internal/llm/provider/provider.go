@@ -2,8 +2,10 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"mix/internal/llm/models"
 	"mix/internal/llm/tools"
@@ -14,6 +16,9 @@ type EventType string
 
 const maxRetries = 8
 
+// ErrMaxRetries is returned when a request is still rate limited after maxRetries retries
+var ErrMaxRetries = errors.New("maximum retry attempts reached for rate limit")
+
 const (
 	EventContentStart  EventType = "content_start"
 	EventToolUseStart  EventType = "tool_use_start"
@@ -25,6 +30,7 @@ const (
 	EventComplete      EventType = "complete"
 	EventError         EventType = "error"
 	EventWarning       EventType = "warning"
+	EventRetry         EventType = "retry"
 )
 
 type TokenUsage struct {
@@ -32,6 +38,16 @@ type TokenUsage struct {
 	OutputTokens        int64
 	CacheCreationTokens int64
 	CacheReadTokens     int64
+	// ReasoningTokens are hidden reasoning tokens, not included in OutputTokens
+	ReasoningTokens int64
+}
+
+// Cost returns the price of the usage for model. Reasoning tokens are billed as output.
+func (u TokenUsage) Cost(model models.Model) float64 {
+	return model.CostPer1MInCached/1e6*float64(u.CacheCreationTokens) +
+		model.CostPer1MOutCached/1e6*float64(u.CacheReadTokens) +
+		model.CostPer1MIn/1e6*float64(u.InputTokens) +
+		model.CostPer1MOut/1e6*float64(u.OutputTokens+u.ReasoningTokens)
 }
 
 type ProviderResponse struct {
@@ -41,6 +57,17 @@ type ProviderResponse struct {
 	FinishReason message.FinishReason
 }
 
+// RetryInfo describes a rate-limited call that is about to be retried
+type RetryInfo struct {
+	Attempt     int
+	MaxAttempts int
+	Delay       time.Duration
+}
+
+func (r RetryInfo) String() string {
+	return fmt.Sprintf("Rate limited, retrying in %ds (attempt %d of %d)", int(r.Delay.Round(time.Second).Seconds()), r.Attempt, r.MaxAttempts)
+}
+
 type ProviderEvent struct {
 	Type EventType
 
@@ -48,6 +75,7 @@ type ProviderEvent struct {
 	Thinking string
 	Response *ProviderResponse
 	ToolCall *message.ToolCall
+	Retry    *RetryInfo
 	Error    error
 }
 type Provider interface {
@@ -56,6 +84,9 @@ type Provider interface {
 	StreamResponse(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent
 
 	Model() models.Model
+
+	// Capabilities reports the features the provider supports for its model
+	Capabilities() Capabilities
 }
 
 type providerClientOptions struct {
@@ -63,11 +94,14 @@ type providerClientOptions struct {
 	model         models.Model
 	maxTokens     int64
 	systemMessage string
+	// headers are sent with every request, on top of the provider's own
+	headers map[string]string
 
 	anthropicOptions []AnthropicOption
 	openaiOptions    []OpenAIOption
 	geminiOptions    []GeminiOption
 	bedrockOptions   []BedrockOption
+	azureOptions     []AzureOption
 }
 
 type ProviderClientOption func(*providerClientOptions)
@@ -80,6 +114,8 @@ type ProviderClient interface {
 type baseProvider[C ProviderClient] struct {
 	options providerClientOptions
 	client  C
+	// audit overrides the configured audit log
+	audit *auditLog
 }
 
 func NewProvider(providerName models.ModelProvider, opts ...ProviderClientOption) (Provider, error) {
@@ -165,6 +201,18 @@ func NewProvider(providerName models.ModelProvider, opts ...ProviderClientOption
 	return nil, fmt.Errorf("provider not supported: %s", providerName)
 }
 
+// retryEvent builds the event emitted before waiting afterMs to retry a rate-limited stream
+func retryEvent(attempts int, afterMs int64) ProviderEvent {
+	return ProviderEvent{
+		Type: EventRetry,
+		Retry: &RetryInfo{
+			Attempt:     attempts,
+			MaxAttempts: maxRetries,
+			Delay:       time.Duration(afterMs) * time.Millisecond,
+		},
+	}
+}
+
 func (p *baseProvider[C]) cleanMessages(messages []message.Message) (cleaned []message.Message) {
 	for _, msg := range messages {
 		// The message has no content
@@ -178,16 +226,50 @@ func (p *baseProvider[C]) cleanMessages(messages []message.Message) (cleaned []m
 
 func (p *baseProvider[C]) SendMessages(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*ProviderResponse, error) {
 	messages = p.cleanMessages(messages)
-	return p.client.send(ctx, messages, tools)
+	start := time.Now()
+	response, err := p.client.send(ctx, messages, tools)
+	p.auditLog().record(ctx, p.options, false, start, messages, tools, response, err)
+	return response, err
 }
 
 func (p *baseProvider[C]) Model() models.Model {
 	return p.options.model
 }
 
+func (p *baseProvider[C]) Capabilities() Capabilities {
+	return ModelCapabilities(p.options.model)
+}
+
 func (p *baseProvider[C]) StreamResponse(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
 	messages = p.cleanMessages(messages)
-	return p.client.stream(ctx, messages, tools)
+	audit := p.auditLog()
+	if audit == nil {
+		return p.client.stream(ctx, messages, tools)
+	}
+
+	start := time.Now()
+	events := p.client.stream(ctx, messages, tools)
+	audited := make(chan ProviderEvent)
+	go func() {
+		defer close(audited)
+		for event := range events {
+			switch event.Type {
+			case EventComplete:
+				audit.record(ctx, p.options, true, start, messages, tools, event.Response, nil)
+			case EventError:
+				audit.record(ctx, p.options, true, start, messages, tools, nil, event.Error)
+			}
+			audited <- event
+		}
+	}()
+	return audited
+}
+
+func (p *baseProvider[C]) auditLog() *auditLog {
+	if p.audit != nil {
+		return p.audit
+	}
+	return defaultAuditLog()
 }
 
 func WithAPIKey(apiKey string) ProviderClientOption {
@@ -214,6 +296,14 @@ func WithSystemMessage(systemMessage string) ProviderClientOption {
 	}
 }
 
+// WithHeaders sends extra headers with every request, such as those an auth proxy or
+// gateway in front of the provider requires
+func WithHeaders(headers map[string]string) ProviderClientOption {
+	return func(options *providerClientOptions) {
+		options.headers = headers
+	}
+}
+
 func WithAnthropicOptions(anthropicOptions ...AnthropicOption) ProviderClientOption {
 	return func(options *providerClientOptions) {
 		options.anthropicOptions = anthropicOptions
@@ -237,3 +327,9 @@ func WithBedrockOptions(bedrockOptions ...BedrockOption) ProviderClientOption {
 		options.bedrockOptions = bedrockOptions
 	}
 }
+
+func WithAzureOptions(azureOptions ...AzureOption) ProviderClientOption {
+	return func(options *providerClientOptions) {
+		options.azureOptions = azureOptions
+	}
+}
@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mix/internal/llm/models"
+	"mix/internal/message"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// headerServer answers every request with body and keeps the headers of the last one
+func headerServer(t *testing.T, body string) (*httptest.Server, *http.Header) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &got
+}
+
+const (
+	anthropicTestResponse = `{"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet-4", "content": [{"type": "text", "text": "hello"}], "stop_reason": "end_turn", "usage": {"input_tokens": 5, "output_tokens": 1}}`
+	openaiTestResponse    = `{"id": "chatcmpl-1", "object": "chat.completion", "model": "gpt-4.1", "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "hello"}}], "usage": {"prompt_tokens": 5, "completion_tokens": 1, "total_tokens": 6}}`
+	geminiTestResponse    = `{"candidates": [{"content": {"role": "model", "parts": [{"text": "hello"}]}, "finishReason": "STOP"}]}`
+)
+
+func TestNewProvider_Headers(t *testing.T) {
+	// No stored OAuth credentials, so Anthropic uses the API key
+	t.Setenv("HOME", t.TempDir())
+	headers := map[string]string{"X-Gateway-Org": "org-123", "Anthropic-Beta": "custom-beta"}
+	messages := []message.Message{userMessage("hello")}
+
+	t.Run("anthropic", func(t *testing.T) {
+		server, got := headerServer(t, anthropicTestResponse)
+		t.Setenv("ANTHROPIC_BASE_URL", server.URL)
+
+		p, err := NewProvider(models.ProviderAnthropic,
+			WithAPIKey("test-key"),
+			WithModel(models.SupportedModels[models.Claude4Sonnet]),
+			WithMaxTokens(256),
+			WithHeaders(headers),
+		)
+		require.NoError(t, err)
+		_, err = p.SendMessages(context.Background(), messages, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "org-123", got.Get("X-Gateway-Org"))
+		assert.Equal(t, "custom-beta", got.Get("Anthropic-Beta"))
+	})
+
+	t.Run("anthropic oauth merges betas", func(t *testing.T) {
+		server, got := headerServer(t, anthropicTestResponse)
+		client := &anthropicClient{providerOptions: providerClientOptions{headers: headers}}
+		c := anthropic.NewClient(append(client.oauthClientOptions("oauth-token"), option.WithBaseURL(server.URL))...)
+
+		_, err := c.Messages.New(context.Background(), anthropic.MessageNewParams{
+			Model:     anthropic.Model("claude-sonnet-4"),
+			MaxTokens: 256,
+			Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("hello"))},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer oauth-token", got.Get("Authorization"))
+		assert.Equal(t, "org-123", got.Get("X-Gateway-Org"))
+		assert.ElementsMatch(t, []string{anthropicOAuthBeta, "custom-beta"}, strings.Split(got.Get("Anthropic-Beta"), ","))
+	})
+
+	t.Run("openai", func(t *testing.T) {
+		server, got := headerServer(t, openaiTestResponse)
+		p, err := NewProvider(models.ProviderOpenAI,
+			WithAPIKey("test-key"),
+			WithModel(models.SupportedModels[models.GPT41]),
+			WithMaxTokens(256),
+			WithHeaders(headers),
+			WithOpenAIOptions(WithOpenAIBaseURL(server.URL)),
+		)
+		require.NoError(t, err)
+		_, err = p.SendMessages(context.Background(), messages, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "org-123", got.Get("X-Gateway-Org"))
+		assert.Equal(t, "Bearer test-key", got.Get("Authorization"))
+	})
+
+	t.Run("gemini", func(t *testing.T) {
+		server, got := headerServer(t, geminiTestResponse)
+		t.Setenv("GOOGLE_GEMINI_BASE_URL", server.URL)
+
+		p, err := NewProvider(models.ProviderGemini,
+			WithAPIKey("test-key"),
+			WithModel(models.SupportedModels[models.Gemini25Flash]),
+			WithMaxTokens(256),
+			WithHeaders(headers),
+		)
+		require.NoError(t, err)
+		_, err = p.SendMessages(context.Background(), messages, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "org-123", got.Get("X-Gateway-Org"))
+		assert.Equal(t, "test-key", got.Get("X-Goog-Api-Key"))
+	})
+}
+
+func TestModelCapabilities(t *testing.T) {
+	claude := models.SupportedModels[models.Claude4Sonnet]
+	assert.Equal(t, Capabilities{
+		Tools:       claude.SupportsTools,
+		Attachments: claude.SupportsAttachments,
+		Reasoning:   claude.CanReason,
+		Streaming:   true,
+	}, ModelCapabilities(claude))
+
+	assert.True(t, ModelCapabilities(models.Model{Provider: models.ProviderOpenAI}).ResponseFormat)
+	assert.True(t, ModelCapabilities(models.Model{Provider: models.ProviderGemini}).ResponseFormat)
+	assert.False(t, ModelCapabilities(models.Model{Provider: models.ProviderBedrock}).ResponseFormat)
+
+	p, err := NewProvider(models.ProviderAnthropic, WithModel(claude), WithAPIKey("key"))
+	require.NoError(t, err)
+	assert.Equal(t, ModelCapabilities(claude), p.Capabilities())
+}
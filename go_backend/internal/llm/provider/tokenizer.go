@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"mix/internal/llm/models"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// charsPerToken is the rough number of characters per token used when a provider has
+// no tokenizer
+const charsPerToken = 4
+
+// Tokenizer counts the tokens a model reads for a piece of text
+type Tokenizer interface {
+	CountTokens(text string) int64
+}
+
+// TokenizerFactory returns the tokenizer for a model, or nil if it has none
+type TokenizerFactory func(model models.Model) Tokenizer
+
+var (
+	tokenizersMu sync.RWMutex
+	tokenizers   = map[models.ModelProvider]TokenizerFactory{
+		models.ProviderOpenAI: tiktokenTokenizer,
+		models.ProviderAzure:  tiktokenTokenizer,
+	}
+)
+
+// RegisterTokenizer sets the tokenizer used for a provider's models, replacing any
+// tokenizer registered before
+func RegisterTokenizer(provider models.ModelProvider, factory TokenizerFactory) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	tokenizers[provider] = factory
+}
+
+// TokenizerFor returns the tokenizer for a model and true, or an estimating tokenizer
+// and false when there is no tokenizer for the model's provider
+func TokenizerFor(model models.Model) (Tokenizer, bool) {
+	tokenizersMu.RLock()
+	factory, ok := tokenizers[model.Provider]
+	tokenizersMu.RUnlock()
+	if ok {
+		if tokenizer := factory(model); tokenizer != nil {
+			return tokenizer, true
+		}
+	}
+	return EstimatingTokenizer{}, false
+}
+
+// EstimatingTokenizer estimates tokens from the length of the text
+type EstimatingTokenizer struct{}
+
+func (EstimatingTokenizer) CountTokens(text string) int64 {
+	return int64((utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken)
+}
+
+// tiktokenEncodings caches the loaded encodings by name, since loading one parses its
+// whole vocabulary
+var tiktokenEncodings sync.Map
+
+var setBpeLoader sync.Once
+
+type tiktokenCounter struct {
+	encoding *tiktoken.Tiktoken
+}
+
+func (t tiktokenCounter) CountTokens(text string) int64 {
+	return int64(len(t.encoding.Encode(text, nil, nil)))
+}
+
+// tiktokenTokenizer returns the tiktoken encoding of an OpenAI model. Models tiktoken
+// doesn't know yet use o200k_base, the encoding of every current OpenAI model.
+func tiktokenTokenizer(model models.Model) Tokenizer {
+	// Use the vocabularies built into the binary rather than downloading them
+	setBpeLoader.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+
+	name, ok := tiktoken.MODEL_TO_ENCODING[model.APIModel]
+	if !ok {
+		name = tiktoken.MODEL_O200K_BASE
+		longest := 0
+		for prefix, encoding := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+			if strings.HasPrefix(model.APIModel, prefix) && len(prefix) > longest {
+				name, longest = encoding, len(prefix)
+			}
+		}
+	}
+
+	if cached, ok := tiktokenEncodings.Load(name); ok {
+		return tiktokenCounter{encoding: cached.(*tiktoken.Tiktoken)}
+	}
+	encoding, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		return nil
+	}
+	tiktokenEncodings.Store(name, encoding)
+	return tiktokenCounter{encoding: encoding}
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"mix/internal/llm/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenizerFor(t *testing.T) {
+	t.Run("openai models use tiktoken", func(t *testing.T) {
+		tokenizer, ok := TokenizerFor(models.SupportedModels[models.GPT4o])
+		assert.True(t, ok)
+		assert.Equal(t, int64(2), tokenizer.CountTokens("hello world"))
+	})
+
+	t.Run("models tiktoken doesn't know use o200k_base", func(t *testing.T) {
+		tokenizer, ok := TokenizerFor(models.Model{Provider: models.ProviderOpenAI, APIModel: "o4-mini"})
+		assert.True(t, ok)
+		assert.Equal(t, int64(2), tokenizer.CountTokens("hello world"))
+	})
+
+	t.Run("other providers estimate", func(t *testing.T) {
+		tokenizer, ok := TokenizerFor(models.SupportedModels[models.Claude4Sonnet])
+		assert.False(t, ok)
+		assert.Equal(t, int64(3), tokenizer.CountTokens("hello world"))
+	})
+
+	t.Run("registered tokenizer", func(t *testing.T) {
+		RegisterTokenizer(models.ProviderMock, func(models.Model) Tokenizer { return wordTokenizer{} })
+		t.Cleanup(func() {
+			tokenizersMu.Lock()
+			delete(tokenizers, models.ProviderMock)
+			tokenizersMu.Unlock()
+		})
+		tokenizer, ok := TokenizerFor(models.Model{Provider: models.ProviderMock})
+		assert.True(t, ok)
+		assert.Equal(t, int64(3), tokenizer.CountTokens("one two three"))
+	})
+}
+
+func TestTokenizer_EstimateVsTiktoken(t *testing.T) {
+	tokenizer, _ := TokenizerFor(models.SupportedModels[models.GPT4o])
+	estimate := EstimatingTokenizer{}
+
+	// Ordinary prose is close to the estimate, while other text can be far off either way
+	prose := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 50)
+	assert.InEpsilon(t, estimate.CountTokens(prose), tokenizer.CountTokens(prose), 0.25)
+
+	indentation := strings.Repeat(" ", 400)
+	assert.Less(t, tokenizer.CountTokens(indentation), estimate.CountTokens(indentation))
+
+	digits := strings.Repeat("7", 400)
+	assert.Greater(t, tokenizer.CountTokens(digits), estimate.CountTokens(digits))
+
+	cjk := strings.Repeat("日本語のテキスト", 50)
+	assert.Greater(t, tokenizer.CountTokens(cjk), estimate.CountTokens(cjk))
+}
+
+// wordTokenizer counts one token per word
+type wordTokenizer struct{}
+
+func (wordTokenizer) CountTokens(text string) int64 {
+	return int64(len(strings.Fields(text)))
+}
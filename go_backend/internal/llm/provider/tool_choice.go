@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ToolChoiceMode controls whether the model may, must, or must not call tools
+type ToolChoiceMode string
+
+const (
+	// ToolChoiceAuto lets the model decide whether to call a tool
+	ToolChoiceAuto ToolChoiceMode = "auto"
+	// ToolChoiceNone prevents tool calls even though tools are offered
+	ToolChoiceNone ToolChoiceMode = "none"
+	// ToolChoiceRequired makes the model call at least one tool
+	ToolChoiceRequired ToolChoiceMode = "required"
+	// ToolChoiceTool makes the model call the tool named in ToolChoice.ToolName
+	ToolChoiceTool ToolChoiceMode = "tool"
+)
+
+// ToolChoice is the tool calling behaviour requested for a run
+type ToolChoice struct {
+	Mode     ToolChoiceMode
+	ToolName string
+}
+
+// forced reports whether the choice makes the model call a tool
+func (c ToolChoice) forced() bool {
+	return c.Mode == ToolChoiceRequired || c.Mode == ToolChoiceTool
+}
+
+// ParseToolChoice parses "auto", "none", "required", or the name of the tool to force
+func ParseToolChoice(value string) (ToolChoice, error) {
+	value = strings.TrimSpace(value)
+	switch ToolChoiceMode(strings.ToLower(value)) {
+	case "", ToolChoiceAuto:
+		return ToolChoice{Mode: ToolChoiceAuto}, nil
+	case ToolChoiceNone:
+		return ToolChoice{Mode: ToolChoiceNone}, nil
+	case ToolChoiceRequired:
+		return ToolChoice{Mode: ToolChoiceRequired}, nil
+	}
+	if strings.ContainsAny(value, " \t\n") {
+		return ToolChoice{}, fmt.Errorf("invalid tool choice %q: expected auto, none, required, or a tool name", value)
+	}
+	return ToolChoice{Mode: ToolChoiceTool, ToolName: value}, nil
+}
+
+type toolChoiceContextKey struct{}
+
+// WithToolChoice returns a context whose requests use the given tool choice. Providers
+// read it per request, so a run can force a tool without reconfiguring the provider.
+func WithToolChoice(ctx context.Context, choice ToolChoice) context.Context {
+	return context.WithValue(ctx, toolChoiceContextKey{}, choice)
+}
+
+// ToolChoiceFromContext returns the tool choice set with WithToolChoice, or auto
+func ToolChoiceFromContext(ctx context.Context) ToolChoice {
+	if choice, ok := ctx.Value(toolChoiceContextKey{}).(ToolChoice); ok && choice.Mode != "" {
+		return choice
+	}
+	return ToolChoice{Mode: ToolChoiceAuto}
+}
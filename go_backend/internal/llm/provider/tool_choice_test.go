@@ -0,0 +1,25 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseToolChoice(t *testing.T) {
+	for input, want := range map[string]ToolChoice{
+		"":         {Mode: ToolChoiceAuto},
+		"Auto":     {Mode: ToolChoiceAuto},
+		"none":     {Mode: ToolChoiceNone},
+		"required": {Mode: ToolChoiceRequired},
+		"view":     {Mode: ToolChoiceTool, ToolName: "view"},
+	} {
+		got, err := ParseToolChoice(input)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, input)
+	}
+
+	_, err := ParseToolChoice("two words")
+	assert.Error(t, err)
+}
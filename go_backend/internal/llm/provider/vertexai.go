@@ -1,35 +1,15 @@
 package provider
 
 import (
-	"context"
-	"os"
-
-	"mix/internal/logging"
-
-	"google.golang.org/genai"
+	"mix/internal/config"
 )
 
 type VertexAIClient ProviderClient
 
+// newVertexAIClient is a Gemini client on the Vertex AI backend. The project and location
+// come from the environment unless the Gemini options set them.
 func newVertexAIClient(opts providerClientOptions) VertexAIClient {
-	geminiOpts := geminiOptions{}
-	for _, o := range opts.geminiOptions {
-		o(&geminiOpts)
-	}
-
-	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
-		Project:  os.Getenv("VERTEXAI_PROJECT"),
-		Location: os.Getenv("VERTEXAI_LOCATION"),
-		Backend:  genai.BackendVertexAI,
-	})
-	if err != nil {
-		logging.Error("Failed to create VertexAI client", "error", err)
-		return nil
-	}
-
-	return &geminiClient{
-		providerOptions: opts,
-		options:         geminiOpts,
-		client:          client,
-	}
+	project, location := config.VertexAIProjectAndLocation()
+	opts.geminiOptions = append([]GeminiOption{WithGeminiVertexAI(project, location)}, opts.geminiOptions...)
+	return newGeminiClient(opts)
 }
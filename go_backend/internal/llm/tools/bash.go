@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"mix/internal/config"
@@ -13,13 +16,16 @@ import (
 )
 
 type BashParams struct {
-	Command string `json:"command"`
-	Timeout int    `json:"timeout"`
+	Command    string `json:"command"`
+	Timeout    int    `json:"timeout"`
+	FullOutput bool   `json:"full_output"`
+	Cwd        string `json:"cwd"`
 }
 
 type BashPermissionsParams struct {
 	Command string `json:"command"`
 	Timeout int    `json:"timeout"`
+	Cwd     string `json:"cwd"`
 }
 
 type BashResponseMetadata struct {
@@ -28,6 +34,10 @@ type BashResponseMetadata struct {
 }
 type bashTool struct {
 	permissions permission.Service
+
+	// Last directory each session's commands ran in, so sequential commands share it
+	dirsMu sync.Mutex
+	dirs   map[string]string
 }
 
 const (
@@ -61,6 +71,7 @@ func bashDescription() string {
 func NewBashTool(permission permission.Service) BaseTool {
 	return &bashTool{
 		permissions: permission,
+		dirs:        make(map[string]string),
 	}
 }
 
@@ -77,6 +88,14 @@ func (b *bashTool) Info() ToolInfo {
 				"type":        "number",
 				"description": "Optional timeout in milliseconds (max 600000)",
 			},
+			"full_output": map[string]any{
+				"type":        "boolean",
+				"description": "Return all output lines instead of only the first and last lines of long output",
+			},
+			"cwd": map[string]any{
+				"type":        "string",
+				"description": "Directory to run the command in, absolute or relative to the working directory. Later commands in the session keep using it",
+			},
 		},
 		Required: []string{"command"},
 	}
@@ -105,6 +124,11 @@ func (b *bashTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		}
 	}
 
+	shellCfg := config.Get().Shell
+	if err := checkCommandFilter(params.Command, shellCfg.AllowedCommands, shellCfg.DeniedCommands); err != nil {
+		return NewTextErrorResponse(err.Error()), nil
+	}
+
 	isSafeReadOnly := false
 	cmdLower := strings.ToLower(params.Command)
 
@@ -121,16 +145,26 @@ func (b *bashTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 	if sessionID == "" || messageID == "" {
 		return ToolResponse{}, fmt.Errorf("session ID and message ID are required for creating a new file")
 	}
+
+	dir, err := resolveCwd(config.WorkingDirectory(), params.Cwd)
+	if err != nil {
+		return NewTextErrorResponse(err.Error()), nil
+	}
+	if params.Cwd == "" {
+		dir = b.sessionDir(sessionID, dir)
+	}
+
 	if !isSafeReadOnly {
 		p := b.permissions.Request(
 			permission.CreatePermissionRequest{
 				SessionID:   sessionID,
-				Path:        config.WorkingDirectory(),
+				Path:        dir,
 				ToolName:    BashToolName,
 				Action:      "execute",
 				Description: fmt.Sprintf("Execute command: %s", params.Command),
 				Params: BashPermissionsParams{
 					Command: params.Command,
+					Cwd:     dir,
 				},
 			},
 		)
@@ -140,11 +174,16 @@ func (b *bashTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 	}
 	startTime := time.Now()
 	shell := shell.GetPersistentShell(config.WorkingDirectory())
-	stdout, stderr, exitCode, interrupted, err := shell.Exec(ctx, params.Command, params.Timeout)
+	stdout, stderr, exitCode, interrupted, cwd, err := shell.ExecInDir(ctx, dir, params.Command, params.Timeout)
 	if err != nil {
 		return ToolResponse{}, fmt.Errorf("error executing command: %w", err)
 	}
+	b.setSessionDir(sessionID, cwd)
 
+	if !params.FullOutput {
+		stdout = truncateLines(stdout, shellCfg.OutputHeadLines, shellCfg.OutputTailLines)
+		stderr = truncateLines(stderr, shellCfg.OutputHeadLines, shellCfg.OutputTailLines)
+	}
 	stdout = truncateOutput(stdout)
 	stderr = truncateOutput(stderr)
 
@@ -181,6 +220,84 @@ func (b *bashTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 	return WithResponseMetadata(NewTextResponse(stdout), metadata), nil
 }
 
+// resolveCwd returns the directory a command should run in. An empty cwd resolves to
+// root; relative paths are taken from root and the result must stay inside it.
+func resolveCwd(root, cwd string) (string, error) {
+	if cwd == "" {
+		return root, nil
+	}
+
+	dir := cwd
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	dir = filepath.Clean(dir)
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("cwd %s is outside the working directory %s", cwd, root)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("cwd does not exist: %s", dir)
+		}
+		return "", fmt.Errorf("error accessing cwd: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cwd is not a directory: %s", dir)
+	}
+	return dir, nil
+}
+
+// sessionDir returns the directory the session's last command ended in, or fallback
+// if there is none, it no longer exists or it is outside the working directory
+func (b *bashTool) sessionDir(sessionID, fallback string) string {
+	b.dirsMu.Lock()
+	dir, ok := b.dirs[sessionID]
+	b.dirsMu.Unlock()
+
+	if !ok {
+		return fallback
+	}
+	// A command may cd out of the working directory, which a cwd couldn't
+	resolved, err := resolveCwd(config.WorkingDirectory(), dir)
+	if err != nil {
+		return fallback
+	}
+	return resolved
+}
+
+func (b *bashTool) setSessionDir(sessionID, dir string) {
+	if dir == "" {
+		return
+	}
+	b.dirsMu.Lock()
+	defer b.dirsMu.Unlock()
+	b.dirs[sessionID] = dir
+}
+
+// truncateLines keeps the first head and last tail lines of content and replaces
+// the lines in between with a marker. A limit of zero or less disables truncation.
+func truncateLines(content string, head, tail int) string {
+	if head <= 0 || tail <= 0 {
+		return content
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if len(lines) <= head+tail {
+		return content
+	}
+
+	omitted := len(lines) - head - tail
+	return fmt.Sprintf("%s\n... %d lines omitted ...\n%s",
+		strings.Join(lines[:head], "\n"),
+		omitted,
+		strings.Join(lines[len(lines)-tail:], "\n"),
+	)
+}
+
 func truncateOutput(content string) string {
 	if len(content) <= MaxOutputLength {
 		return content
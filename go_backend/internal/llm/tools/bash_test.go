@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mix/internal/config"
+	"mix/internal/permission"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestTruncateLines(t *testing.T) {
+	t.Run("output within the limit is unchanged", func(t *testing.T) {
+		content := numberedLines(10)
+		assert.Equal(t, content, truncateLines(content, 5, 5))
+	})
+
+	t.Run("keeps head and tail lines with an omitted marker", func(t *testing.T) {
+		result := truncateLines(numberedLines(100), 3, 2)
+		assert.Equal(t, "line 1\nline 2\nline 3\n... 95 lines omitted ...\nline 99\nline 100", result)
+	})
+
+	t.Run("one line over the limit", func(t *testing.T) {
+		result := truncateLines(numberedLines(11), 5, 5)
+		assert.Contains(t, result, "... 1 lines omitted ...")
+		assert.True(t, strings.HasPrefix(result, "line 1\n"))
+		assert.True(t, strings.HasSuffix(result, "line 11"))
+	})
+
+	t.Run("output without trailing newline", func(t *testing.T) {
+		content := strings.TrimSuffix(numberedLines(7), "\n")
+		assert.Equal(t, "line 1\n... 5 lines omitted ...\nline 7", truncateLines(content, 1, 1))
+	})
+
+	t.Run("zero limits disable truncation", func(t *testing.T) {
+		content := numberedLines(1000)
+		assert.Equal(t, content, truncateLines(content, 0, 0))
+	})
+
+	t.Run("empty output", func(t *testing.T) {
+		assert.Equal(t, "", truncateLines("", 5, 5))
+	})
+}
+
+func TestResolveCwd(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	require.NoError(t, os.Mkdir(sub, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("x"), 0o644))
+
+	tests := []struct {
+		name     string
+		cwd      string
+		expected string
+		err      string
+	}{
+		{"empty uses root", "", root, ""},
+		{"relative", "sub", sub, ""},
+		{"absolute", sub, sub, ""},
+		{"relative with dot segments", "sub/../sub/.", sub, ""},
+		{"escapes root", "..", "", "outside the working directory"},
+		{"absolute outside root", filepath.Dir(root), "", "outside the working directory"},
+		{"missing", "missing", "", "does not exist"},
+		{"not a directory", "file.txt", "", "not a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := resolveCwd(root, tt.cwd)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, dir)
+		})
+	}
+}
+
+func TestBashTool_Cwd(t *testing.T) {
+	tool := NewBashTool(permission.NewPermissionService())
+	root := config.WorkingDirectory()
+	shellDir := filepath.Join(root, "shell")
+
+	pwd := func(sessionID, cwd string) string {
+		ctx := context.WithValue(context.Background(), SessionIDContextKey, sessionID)
+		ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+		input, err := json.Marshal(BashParams{Command: "pwd", Cwd: cwd})
+		require.NoError(t, err)
+		response, err := tool.Run(ctx, ToolCall{Name: BashToolName, Input: string(input)})
+		require.NoError(t, err)
+		return strings.TrimSpace(response.Content)
+	}
+
+	assert.Equal(t, root, pwd("session-a", ""))
+	assert.Equal(t, shellDir, pwd("session-a", "shell"))
+	assert.Equal(t, root, pwd("session-a", root))
+	assert.Equal(t, shellDir, pwd("session-a", shellDir))
+
+	// The directory persists for the session but not for others
+	assert.Equal(t, shellDir, pwd("session-a", ""))
+	assert.Equal(t, root, pwd("session-b", ""))
+
+	assert.Contains(t, pwd("session-a", "/"), "outside the working directory")
+}
+
+func TestBashTool_CdOutOfWorkingDirectory(t *testing.T) {
+	tool := NewBashTool(grantingPermissions(t))
+	root := config.WorkingDirectory()
+
+	run := func(command string) string {
+		ctx := context.WithValue(context.Background(), SessionIDContextKey, "session")
+		ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+		input, err := json.Marshal(BashParams{Command: command})
+		require.NoError(t, err)
+		response, err := tool.Run(ctx, ToolCall{Name: BashToolName, Input: string(input)})
+		require.NoError(t, err)
+		return strings.TrimSpace(response.Content)
+	}
+
+	run("cd ..")
+	// The next command without a cwd runs in the working directory again
+	assert.Equal(t, root, run("pwd"))
+}
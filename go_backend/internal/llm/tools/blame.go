@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// blameTimeout bounds how long the view tool waits for git blame
+const blameTimeout = 5 * time.Second
+
+// blameCommit is the part of a commit shown next to the lines it last changed
+type blameCommit struct {
+	author string
+	date   string
+}
+
+// errNotTracked is returned by gitBlame when the file is outside a git repository or has
+// no history in it
+var errNotTracked = errors.New("file is not tracked by git")
+
+// gitBlame returns an annotation of the short commit, date and author for lines start
+// through end of filePath, keyed by 1-based line number. The lines must exist in the
+// file. It returns errNotTracked when git has no history for the file.
+func gitBlame(ctx context.Context, filePath string, start, end int) (map[int]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, blameTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", "blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", start, end), "--", filepath.Base(filePath))
+	cmd.Dir = filepath.Dir(filePath)
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("git blame did not finish within %s", blameTimeout)
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to run git blame: %w", err)
+		}
+		stderr := strings.TrimPrefix(strings.TrimSpace(string(exitErr.Stderr)), "fatal: ")
+		if isUntrackedBlameError(stderr) {
+			return nil, errNotTracked
+		}
+		return nil, fmt.Errorf("git blame failed: %s", stderr)
+	}
+	return parseBlame(string(out)), nil
+}
+
+// isUntrackedBlameError reports whether git blame failed because there is no repository,
+// no commit yet, or no committed version of the file
+func isUntrackedBlameError(stderr string) bool {
+	return strings.HasPrefix(stderr, "not a git repository") ||
+		strings.HasPrefix(stderr, "no such path") ||
+		strings.HasPrefix(stderr, "no such ref: HEAD")
+}
+
+// parseBlame reads git blame --porcelain output. Commit details are only given the first
+// time a commit appears, so they are kept for the lines that follow.
+func parseBlame(output string) map[int]string {
+	annotations := make(map[int]string)
+	commits := make(map[string]*blameCommit)
+	var hash string
+	var line int
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if strings.HasPrefix(text, "\t") {
+			annotations[line] = blameAnnotation(hash, commits[hash])
+			continue
+		}
+
+		key, value, _ := strings.Cut(text, " ")
+		switch key {
+		case "author":
+			commits[hash].author = value
+		case "author-time":
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+				commits[hash].date = time.Unix(seconds, 0).UTC().Format(time.DateOnly)
+			}
+		default:
+			// A header line: the commit, the line in the original file and in this one
+			fields := strings.Fields(text)
+			if len(fields) < 3 || !isCommitHash(fields[0]) {
+				continue
+			}
+			hash = fields[0]
+			line, _ = strconv.Atoi(fields[2])
+			if commits[hash] == nil {
+				commits[hash] = &blameCommit{}
+			}
+		}
+	}
+	return annotations
+}
+
+// isCommitHash reports whether s is a full SHA-1 or SHA-256 commit hash
+func isCommitHash(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	return strings.Trim(s, "0123456789abcdef") == ""
+}
+
+// blameAnnotation describes the commit that last changed a line. Git reports lines that
+// are not committed yet under an all-zero hash.
+func blameAnnotation(hash string, commit *blameCommit) string {
+	if strings.Trim(hash, "0") == "" || commit == nil {
+		return "uncommitted"
+	}
+	return fmt.Sprintf("%s %s %s", hash[:8], commit.date, commit.author)
+}
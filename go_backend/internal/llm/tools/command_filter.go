@@ -0,0 +1,331 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// wrapperCommands run the command given in their arguments, so the wrapped command is
+// checked as well as the wrapper
+var wrapperCommands = []string{"env", "command", "builtin", "exec", "nohup", "nice", "time", "timeout", "xargs", "sudo", "doas"}
+
+// shellCommands run the script given with -c, which is parsed and checked too
+var shellCommands = []string{"sh", "bash", "zsh", "dash", "ksh"}
+
+// wrapperArg matches the options, assignments and durations between a wrapper and its command
+var wrapperArg = regexp.MustCompile(`^(-.*|[A-Za-z_][A-Za-z0-9_]*=.*|[0-9.]+[smhd]?)$`)
+
+// wrapperValueOptions are the wrapper options that take the next argument as their
+// value, so the value isn't mistaken for the wrapped command
+var wrapperValueOptions = map[string][]string{
+	"env":     {"-u", "--unset", "-C", "--chdir"},
+	"exec":    {"-a"},
+	"nice":    {"-n", "--adjustment"},
+	"time":    {"-f", "--format", "-o", "--output"},
+	"timeout": {"-s", "--signal", "-k", "--kill-after"},
+	"xargs":   {"-a", "--arg-file", "-d", "--delimiter", "-E", "-I", "-L", "--max-lines", "-n", "--max-args", "-P", "--max-procs", "-s", "--max-chars"},
+	"sudo":    {"-u", "--user", "-g", "--group", "-C", "--close-from", "-D", "--chdir", "-h", "--host", "-p", "--prompt", "-r", "--role", "-t", "--type", "-T", "--command-timeout", "-U", "--other-user"},
+	"doas":    {"-u", "-C"},
+}
+
+// shellValueOptions are the shell options that take the next argument as their value
+var shellValueOptions = []string{"-o", "+o", "-O", "+O", "--rcfile", "--init-file"}
+
+// flagAliases maps the long and alternative forms of common flags to the short flag
+// they stand for, so "rm -rf" also matches "rm --recursive --force" and "rm -Rf"
+var flagAliases = map[string]map[string]string{
+	"rm":    {"--recursive": "r", "-R": "r", "--force": "f", "--dir": "d"},
+	"cp":    {"--recursive": "r", "-R": "r", "--force": "f"},
+	"mv":    {"--force": "f"},
+	"chmod": {"--recursive": "R"},
+	"chown": {"--recursive": "R"},
+	"git":   {"--force": "f", "--delete": "d", "--all": "a"},
+}
+
+// checkCommandFilter parses a shell command and checks every command it runs, including
+// those in pipelines, substitutions, sh -c scripts and wrappers such as env or xargs,
+// against the configured lists. A command matching a denied pattern is rejected, and
+// when allowed patterns are set every command must match one of them.
+//
+// A pattern is a command name followed by optional subcommands and flags, such as
+// "sudo", "rm -rf" or "git push". Short flags match in any order or grouping, so
+// "rm -rf" also matches "rm -r -f" and "rm -fr", and common long flags match their
+// short form, so it matches "rm --recursive --force" too. A shell reading its script
+// from standard input can't be checked and is rejected.
+func checkCommandFilter(command string, allowed, denied []string) error {
+	if len(allowed) == 0 && len(denied) == 0 {
+		return nil
+	}
+	return checkScript(command, allowed, denied, 0)
+}
+
+// maxScriptDepth limits how deeply nested sh -c scripts are parsed
+const maxScriptDepth = 4
+
+func checkScript(script string, allowed, denied []string, depth int) error {
+	if depth > maxScriptDepth {
+		return fmt.Errorf("command is nested too deeply to check against shell.allowedCommands and shell.deniedCommands")
+	}
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), "")
+	if err != nil {
+		return fmt.Errorf("command could not be parsed to check it against shell.allowedCommands and shell.deniedCommands: %w", err)
+	}
+
+	var checkErr error
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if checkErr != nil {
+			return false
+		}
+		call, ok := node.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		args, ok := literalArgs(call.Args)
+		if !ok {
+			checkErr = fmt.Errorf("command names built from variables or substitutions can't be checked against shell.allowedCommands and shell.deniedCommands")
+			return false
+		}
+		checkErr = checkArgs(args, allowed, denied, depth)
+		return true
+	})
+	return checkErr
+}
+
+// checkArgs checks one command, then the command it wraps or the script it runs
+func checkArgs(args []string, allowed, denied []string, depth int) error {
+	for _, pattern := range denied {
+		if matchesCommandPattern(args, strings.Fields(pattern), false) {
+			return fmt.Errorf("command '%s' is blocked by shell.deniedCommands (matches %q)", strings.Join(args, " "), pattern)
+		}
+	}
+	if len(allowed) > 0 {
+		permitted := false
+		for _, pattern := range allowed {
+			if matchesCommandPattern(args, strings.Fields(pattern), true) {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return fmt.Errorf("command '%s' is not in shell.allowedCommands", strings.Join(args, " "))
+		}
+	}
+
+	name := commandName(args[0])
+	switch {
+	case containsFold(shellCommands, name):
+		script, fromStdin := shellScript(args[1:])
+		if fromStdin {
+			return fmt.Errorf("command '%s' reads its script from standard input, which can't be checked against shell.allowedCommands and shell.deniedCommands", strings.Join(args, " "))
+		}
+		if script != "" {
+			return checkScript(script, allowed, denied, depth+1)
+		}
+	case strings.EqualFold(name, "eval") && len(args) > 1:
+		return checkScript(strings.Join(args[1:], " "), allowed, denied, depth+1)
+	case containsFold(wrapperCommands, name):
+		if rest := wrappedArgs(strings.ToLower(name), args[1:]); len(rest) > 0 {
+			return checkArgs(rest, allowed, denied, depth)
+		}
+	}
+	return nil
+}
+
+// shellScript returns the script a shell runs with -c, which may be grouped with other
+// short options as in -ec. fromStdin is set when the shell reads its script from
+// standard input, where a pipe or heredoc can feed it anything: with -s, or with
+// neither -c nor a script file.
+func shellScript(args []string) (script string, fromStdin bool) {
+	command, stdin := false, false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--" || arg == "-":
+			if i+1 < len(args) && command {
+				return args[i+1], false
+			}
+			return "", stdin || i+1 == len(args)
+		case slices.Contains(shellValueOptions, arg):
+			i++
+		case strings.HasPrefix(arg, "--"):
+		case strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "+"):
+			command = command || strings.ContainsRune(arg[1:], 'c')
+			stdin = stdin || strings.ContainsRune(arg[1:], 's')
+		case command:
+			return arg, false
+		default:
+			// A script file, which runs as the file's contents
+			return "", stdin
+		}
+	}
+	return "", !command
+}
+
+// wrappedArgs returns the command a wrapper runs, skipping the wrapper's options and
+// their values, assignments and durations
+func wrappedArgs(name string, args []string) []string {
+	valueOptions := wrapperValueOptions[name]
+	for len(args) > 0 && wrapperArg.MatchString(args[0]) {
+		arg := args[0]
+		args = args[1:]
+		if takesValue(arg, valueOptions) && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+	return args
+}
+
+// takesValue reports whether a wrapper option is followed by a separate value. In a group
+// of short options such as -iu, the first option that takes a value ends the group and
+// only uses the next argument if nothing follows it.
+func takesValue(arg string, valueOptions []string) bool {
+	if strings.HasPrefix(arg, "--") {
+		return slices.Contains(valueOptions, arg)
+	}
+	flags := arg[1:]
+	for i, flag := range flags {
+		if slices.Contains(valueOptions, "-"+string(flag)) {
+			return i == len(flags)-1
+		}
+	}
+	return false
+}
+
+// matchesCommandPattern reports whether a command matches a pattern. The pattern's
+// subcommands must be the command's first arguments when strict is set (for the allow
+// list), and may appear anywhere after the name otherwise (for the deny list), so an
+// option placed before a denied subcommand does not get around it.
+func matchesCommandPattern(args []string, pattern []string, strict bool) bool {
+	if len(pattern) == 0 || !strings.EqualFold(commandName(args[0]), pattern[0]) {
+		return false
+	}
+	aliases := flagAliases[strings.ToLower(pattern[0])]
+
+	var positional []string
+	shortFlags := map[string]bool{}
+	longFlags := map[string]bool{}
+	for _, arg := range args[1:] {
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			name, _, _ := strings.Cut(arg, "=")
+			if short, ok := aliases[name]; ok {
+				shortFlags[short] = true
+			}
+			longFlags[name] = true
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for _, flag := range arg[1:] {
+				if short, ok := aliases["-"+string(flag)]; ok {
+					shortFlags[short] = true
+				}
+				shortFlags[string(flag)] = true
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	next := 0
+	for _, word := range pattern[1:] {
+		switch {
+		case strings.HasPrefix(word, "--"):
+			if short, ok := aliases[word]; ok {
+				if !shortFlags[short] {
+					return false
+				}
+			} else if !longFlags[word] {
+				return false
+			}
+		case strings.HasPrefix(word, "-"):
+			for _, flag := range word[1:] {
+				if short, ok := aliases["-"+string(flag)]; ok {
+					flag = rune(short[0])
+				}
+				if !shortFlags[string(flag)] {
+					return false
+				}
+			}
+		default:
+			for next < len(positional) && positional[next] != word && !strict {
+				next++
+			}
+			if next >= len(positional) || positional[next] != word {
+				return false
+			}
+			next++
+		}
+	}
+	return true
+}
+
+// commandName returns a command without its directory, so /bin/rm is checked as rm
+func commandName(arg string) string {
+	return filepath.Base(arg)
+}
+
+// literalArgs returns the words of a command with quoting removed, or false if the
+// command name depends on a variable or substitution. Other such words are left empty,
+// so they never match a pattern; substitutions are checked as commands of their own.
+func literalArgs(words []*syntax.Word) ([]string, bool) {
+	args := make([]string, 0, len(words))
+	for i, word := range words {
+		arg, ok := literalWord(word.Parts)
+		if !ok && i == 0 {
+			return nil, false
+		}
+		args = append(args, arg)
+	}
+	return args, true
+}
+
+func literalWord(parts []syntax.WordPart) (string, bool) {
+	var b strings.Builder
+	for _, part := range parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(unescape(part.Value))
+		case *syntax.SglQuoted:
+			b.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			inner, ok := literalWord(part.Parts)
+			if !ok {
+				return "", false
+			}
+			b.WriteString(inner)
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// unescape removes the backslashes from an unquoted shell word
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
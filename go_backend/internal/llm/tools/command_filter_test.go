@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mix/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCommandFilter(t *testing.T) {
+	assert.NoError(t, checkCommandFilter("sudo rm -rf /", nil, nil))
+
+	denied := []string{"rm -rf", "sudo", "git push"}
+
+	tests := []struct {
+		name    string
+		command string
+		allowed []string
+		err     string
+	}{
+		{"plain rm", "rm file.txt", nil, ""},
+		{"unrelated command", "ls -la *.go", nil, ""},
+		{"denied flags", "rm -rf /", nil, `matches "rm -rf"`},
+		{"split flags", "rm -r -f build", nil, `matches "rm -rf"`},
+		{"reordered flags", "/bin/rm -fr build", nil, `matches "rm -rf"`},
+		{"quoted name", `'r''m' -rf build`, nil, `matches "rm -rf"`},
+		{"escaped name", `\rm -rf build`, nil, `matches "rm -rf"`},
+		{"after another command", "echo hi && sudo ls", nil, `matches "sudo"`},
+		{"in a pipeline", "ls | sudo tee /etc/hosts", nil, `matches "sudo"`},
+		{"in a substitution", "echo $(sudo whoami)", nil, `matches "sudo"`},
+		{"in sh -c", `bash -c "rm -rf /"`, nil, `matches "rm -rf"`},
+		{"in eval", `eval "sudo ls"`, nil, `matches "sudo"`},
+		{"behind env", "env FOO=1 sudo ls", nil, `matches "sudo"`},
+		{"behind xargs", "find . | xargs -0 rm -rf", nil, `matches "rm -rf"`},
+		{"in sh -c grouped with other flags", `bash -ec "sudo id"`, nil, `matches "sudo"`},
+		{"in sh -c after options", `sh -o pipefail -xc 'sudo id'`, nil, `matches "sudo"`},
+		{"shell script file", "bash ./build.sh", nil, ""},
+		{"shell reading a pipe", "echo 'sudo id' | sh", nil, "reads its script from standard input"},
+		{"shell reading a heredoc", "sh <<EOF\nsudo id\nEOF", nil, "reads its script from standard input"},
+		{"shell reading stdin with -s", "bash -s arg < script.sh", nil, "reads its script from standard input"},
+		{"behind timeout with a signal", "timeout -s KILL 5 rm -rf /", nil, `matches "rm -rf"`},
+		{"behind timeout with a kill delay", "timeout -k 10 5m sudo ls", nil, `matches "sudo"`},
+		{"behind env unsetting a variable", "env -u VAR sudo ls", nil, `matches "sudo"`},
+		{"behind doas with a user", "doas -u root git push", nil, `matches "git push"`},
+		{"behind nice with an adjustment", "nice -n 10 rm -rf build", nil, `matches "rm -rf"`},
+		{"behind xargs with a replacement", "ls | xargs -I {} rm -rf {}", nil, `matches "rm -rf"`},
+		{"behind xargs with a count", "ls | xargs -n 1 rm -rf", nil, `matches "rm -rf"`},
+		{"long flags", "rm --recursive --force build", nil, `matches "rm -rf"`},
+		{"long and short flags", "rm -f --recursive build", nil, `matches "rm -rf"`},
+		{"alternative short flag", "rm -Rf build", nil, `matches "rm -rf"`},
+		{"only one long flag", "rm --force file.txt", nil, ""},
+		{"option before subcommand", "git -C . push origin main", nil, `matches "git push"`},
+		{"other subcommand", "git status", nil, ""},
+		{"dynamic name", "$CMD -rf /", nil, "built from variables"},
+		{"unparsable", "echo 'unterminated", nil, "could not be parsed"},
+		{"allowed command", "ls -la", []string{"ls", "git status"}, ""},
+		{"allowed subcommand", "git status --short", []string{"ls", "git status"}, ""},
+		{"subcommand not allowed", "git log", []string{"ls", "git status"}, "not in shell.allowedCommands"},
+		{"pipeline into command not allowed", "ls | cat", []string{"ls", "git status"}, "'cat' is not in shell.allowedCommands"},
+		{"denied wins over allowed", "sudo ls", []string{"sudo", "ls"}, `matches "sudo"`},
+		{"allowed shell reading a pipe", "ls | sh", []string{"ls", "sh"}, "reads its script from standard input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCommandFilter(tt.command, tt.allowed, denied)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestBashTool_CommandFilter(t *testing.T) {
+	loadWebPermissions(t, false)
+	config.Get().Shell.DeniedCommands = []string{"sudo"}
+
+	ctx := context.WithValue(context.Background(), SessionIDContextKey, "session")
+	ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+	input, err := json.Marshal(BashParams{Command: "touch marker && sudo ls"})
+	require.NoError(t, err)
+	response, err := NewBashTool(grantingPermissions(t)).Run(ctx, ToolCall{Name: BashToolName, Input: string(input)})
+	require.NoError(t, err)
+	assert.True(t, response.IsError)
+	assert.Contains(t, response.Content, "blocked by shell.deniedCommands")
+
+	// Nothing runs when any part of the command is blocked
+	_, err = os.Stat(filepath.Join(config.WorkingDirectory(), "marker"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffContextLines is the number of unchanged lines shown around each hunk
+const diffContextLines = 3
+
+type diffLine struct {
+	op   diffmatchpatch.Operation
+	text string
+}
+
+// lineDiff diffs oldContent and newContent line by line. Every entry is a single line,
+// ending in a newline unless it is the last line of a file without one.
+func lineDiff(oldContent, newContent string) []diffLine {
+	dmp := diffmatchpatch.New()
+	oldChars, newChars, lineArray := dmp.DiffLinesToRunes(oldContent, newContent)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMainRunes([]rune(oldChars), []rune(newChars), false), lineArray)
+
+	var lines []diffLine
+	for _, d := range diffs {
+		for _, line := range strings.SplitAfter(d.Text, "\n") {
+			if line != "" {
+				lines = append(lines, diffLine{op: d.Type, text: line})
+			}
+		}
+	}
+	return lines
+}
+
+// unifiedDiff renders the line changes between oldContent and newContent as a unified diff.
+// An empty oldPath marks a newly created file.
+func unifiedDiff(oldPath, newPath, oldContent, newContent string) string {
+	lines := lineDiff(oldContent, newContent)
+
+	if oldPath == "" {
+		oldPath = "/dev/null"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldPath, newPath)
+
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].op == diffmatchpatch.DiffEqual {
+			i++
+			oldLine++
+			newLine++
+			continue
+		}
+
+		// Extend the hunk until diffContextLines*2 unchanged lines separate it from the next change
+		start := max(i-diffContextLines, 0)
+		end := i
+		for end < len(lines) {
+			if lines[end].op != diffmatchpatch.DiffEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].op == diffmatchpatch.DiffEqual {
+				run++
+			}
+			if run == len(lines) || run-end > diffContextLines*2 {
+				end = min(end+diffContextLines, len(lines))
+				break
+			}
+			end = run
+		}
+
+		hunkOld, hunkNew := oldLine-(i-start), newLine-(i-start)
+		var oldCount, newCount int
+		var body strings.Builder
+		for _, line := range lines[start:end] {
+			prefix := " "
+			switch line.op {
+			case diffmatchpatch.DiffInsert:
+				prefix = "+"
+				newCount++
+			case diffmatchpatch.DiffDelete:
+				prefix = "-"
+				oldCount++
+			default:
+				oldCount++
+				newCount++
+			}
+			body.WriteString(prefix + line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount))
+		b.WriteString(body.String())
+
+		for _, line := range lines[i:end] {
+			if line.op != diffmatchpatch.DiffInsert {
+				oldLine++
+			}
+			if line.op != diffmatchpatch.DiffDelete {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// hunkRange formats a hunk header range; an empty range points at the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -13,12 +13,15 @@ import (
 	"mix/internal/history"
 	"mix/internal/logging"
 	"mix/internal/permission"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
 type EditParams struct {
 	FilePath  string `json:"file_path"`
 	OldString string `json:"old_string"`
 	NewString string `json:"new_string"`
+	DryRun    bool   `json:"dry_run,omitempty"`
 }
 
 type EditPermissionsParams struct {
@@ -30,6 +33,7 @@ type EditResponseMetadata struct {
 	Diff      string `json:"diff"`
 	Additions int    `json:"additions"`
 	Removals  int    `json:"removals"`
+	DryRun    bool   `json:"dry_run,omitempty"`
 }
 
 type editTool struct {
@@ -65,6 +69,10 @@ func (e *editTool) Info() ToolInfo {
 				"type":        "string",
 				"description": "The text to replace it with",
 			},
+			"dry_run": map[string]any{
+				"type":        "boolean",
+				"description": "Return the diff of the edit without writing the file",
+			},
 		},
 		Required: []string{"file_path", "old_string", "new_string"},
 	}
@@ -88,21 +96,14 @@ func (e *editTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 	var response ToolResponse
 	var err error
 
-	if params.OldString == "" {
-		response, err = e.createNewFile(ctx, params.FilePath, params.NewString)
-		if err != nil {
-			return response, err
-		}
+	switch {
+	case params.OldString == "":
+		response, err = e.createNewFile(ctx, params.FilePath, params.NewString, params.DryRun)
+	case params.NewString == "":
+		response, err = e.deleteContent(ctx, params.FilePath, params.OldString, params.DryRun)
+	default:
+		response, err = e.replaceContent(ctx, params.FilePath, params.OldString, params.NewString, params.DryRun)
 	}
-
-	if params.NewString == "" {
-		response, err = e.deleteContent(ctx, params.FilePath, params.OldString)
-		if err != nil {
-			return response, err
-		}
-	}
-
-	response, err = e.replaceContent(ctx, params.FilePath, params.OldString, params.NewString)
 	if err != nil {
 		return response, err
 	}
@@ -118,7 +119,7 @@ func (e *editTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 	return response, nil
 }
 
-func (e *editTool) createNewFile(ctx context.Context, filePath, content string) (ToolResponse, error) {
+func (e *editTool) createNewFile(ctx context.Context, filePath, content string, dryRun bool) (ToolResponse, error) {
 	fileInfo, err := os.Stat(filePath)
 	if err == nil {
 		if fileInfo.IsDir() {
@@ -129,24 +130,17 @@ func (e *editTool) createNewFile(ctx context.Context, filePath, content string)
 		return ToolResponse{}, fmt.Errorf("failed to access file: %w", err)
 	}
 
-	dir := filepath.Dir(filePath)
-	if err = os.MkdirAll(dir, 0o755); err != nil {
-		return ToolResponse{}, fmt.Errorf("failed to create parent directories: %w", err)
-	}
-
 	sessionID, messageID := GetContextValues(ctx)
 	if sessionID == "" || messageID == "" {
 		return ToolResponse{}, fmt.Errorf("session ID and message ID are required for creating a new file")
 	}
 
-	// Simple diff replacement for new file creation
-	diffText := fmt.Sprintf("--- /dev/null\n+++ %s\n", filePath)
-	lines := strings.Split(content, "\n")
-	for i, line := range lines {
-		diffText += fmt.Sprintf("@@ -%d,0 +%d,1 @@\n+%s\n", i+1, i+1, line)
+	diffText := unifiedDiff("", filePath, "", content)
+	additions, removals := CountLineChanges("", content)
+	if dryRun {
+		return dryRunResponse(filePath, diffText, additions, removals), nil
 	}
-	additions := len(lines)
-	removals := 0
+
 	rootDir := config.WorkingDirectory()
 	permissionPath := filepath.Dir(filePath)
 	if strings.HasPrefix(filePath, rootDir) {
@@ -169,7 +163,11 @@ func (e *editTool) createNewFile(ctx context.Context, filePath, content string)
 		return ToolResponse{}, permission.ErrorPermissionDenied
 	}
 
-	err = os.WriteFile(filePath, []byte(content), 0o644)
+	if err = os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return ToolResponse{}, fmt.Errorf("failed to create parent directories: %w", err)
+	}
+
+	err = writeFile(ctx, filePath, []byte(content))
 	if err != nil {
 		return ToolResponse{}, fmt.Errorf("failed to write file: %w", err)
 	}
@@ -189,10 +187,10 @@ func (e *editTool) createNewFile(ctx context.Context, filePath, content string)
 	}
 
 	recordFileWrite(filePath)
-	recordFileRead(filePath)
+	recordFileRead(ctx, filePath)
 
 	return WithResponseMetadata(
-		NewTextResponse("File created: "+filePath),
+		NewTextResponse("File created: "+filePath+"\n"+editSummary(additions, removals)),
 		EditResponseMetadata{
 			Diff:      diffText,
 			Additions: additions,
@@ -201,7 +199,7 @@ func (e *editTool) createNewFile(ctx context.Context, filePath, content string)
 	), nil
 }
 
-func (e *editTool) deleteContent(ctx context.Context, filePath, oldString string) (ToolResponse, error) {
+func (e *editTool) deleteContent(ctx context.Context, filePath, oldString string, dryRun bool) (ToolResponse, error) {
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -252,12 +250,11 @@ func (e *editTool) deleteContent(ctx context.Context, filePath, oldString string
 		return ToolResponse{}, fmt.Errorf("session ID and message ID are required for creating a new file")
 	}
 
-	// Simple diff replacement for content editing
-	diffText := fmt.Sprintf("--- %s\n+++ %s\n", filePath, filePath)
-	oldLines := strings.Split(oldContent, "\n")
-	newLines := strings.Split(newContent, "\n")
-	additions := len(newLines)
-	removals := len(oldLines)
+	diffText := unifiedDiff(filePath, filePath, oldContent, newContent)
+	additions, removals := CountLineChanges(oldContent, newContent)
+	if dryRun {
+		return dryRunResponse(filePath, diffText, additions, removals), nil
+	}
 
 	rootDir := config.WorkingDirectory()
 	permissionPath := filepath.Dir(filePath)
@@ -281,7 +278,7 @@ func (e *editTool) deleteContent(ctx context.Context, filePath, oldString string
 		return ToolResponse{}, permission.ErrorPermissionDenied
 	}
 
-	err = os.WriteFile(filePath, []byte(newContent), 0o644)
+	err = writeFile(ctx, filePath, []byte(newContent))
 	if err != nil {
 		return ToolResponse{}, fmt.Errorf("failed to write file: %w", err)
 	}
@@ -309,10 +306,10 @@ func (e *editTool) deleteContent(ctx context.Context, filePath, oldString string
 	}
 
 	recordFileWrite(filePath)
-	recordFileRead(filePath)
+	recordFileRead(ctx, filePath)
 
 	return WithResponseMetadata(
-		NewTextResponse("Content deleted from file: "+filePath),
+		NewTextResponse("Content deleted from file: "+filePath+"\n"+editSummary(additions, removals)),
 		EditResponseMetadata{
 			Diff:      diffText,
 			Additions: additions,
@@ -321,7 +318,7 @@ func (e *editTool) deleteContent(ctx context.Context, filePath, oldString string
 	), nil
 }
 
-func (e *editTool) replaceContent(ctx context.Context, filePath, oldString, newString string) (ToolResponse, error) {
+func (e *editTool) replaceContent(ctx context.Context, filePath, oldString, newString string, dryRun bool) (ToolResponse, error) {
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -374,12 +371,11 @@ func (e *editTool) replaceContent(ctx context.Context, filePath, oldString, newS
 	if sessionID == "" || messageID == "" {
 		return ToolResponse{}, fmt.Errorf("session ID and message ID are required for creating a new file")
 	}
-	// Simple diff replacement for content editing
-	diffText := fmt.Sprintf("--- %s\n+++ %s\n", filePath, filePath)
-	oldLines := strings.Split(oldContent, "\n")
-	newLines := strings.Split(newContent, "\n")
-	additions := len(newLines)
-	removals := len(oldLines)
+	diffText := unifiedDiff(filePath, filePath, oldContent, newContent)
+	additions, removals := CountLineChanges(oldContent, newContent)
+	if dryRun {
+		return dryRunResponse(filePath, diffText, additions, removals), nil
+	}
 	rootDir := config.WorkingDirectory()
 	permissionPath := filepath.Dir(filePath)
 	if strings.HasPrefix(filePath, rootDir) {
@@ -402,7 +398,7 @@ func (e *editTool) replaceContent(ctx context.Context, filePath, oldString, newS
 		return ToolResponse{}, permission.ErrorPermissionDenied
 	}
 
-	err = os.WriteFile(filePath, []byte(newContent), 0o644)
+	err = writeFile(ctx, filePath, []byte(newContent))
 	if err != nil {
 		return ToolResponse{}, fmt.Errorf("failed to write file: %w", err)
 	}
@@ -430,13 +426,44 @@ func (e *editTool) replaceContent(ctx context.Context, filePath, oldString, newS
 	}
 
 	recordFileWrite(filePath)
-	recordFileRead(filePath)
+	recordFileRead(ctx, filePath)
 
 	return WithResponseMetadata(
-		NewTextResponse("Content replaced in file: "+filePath),
+		NewTextResponse("Content replaced in file: "+filePath+"\n"+editSummary(additions, removals)),
 		EditResponseMetadata{
 			Diff:      diffText,
 			Additions: additions,
 			Removals:  removals,
 		}), nil
 }
+
+// CountLineChanges returns how many lines were added and removed going from oldContent to newContent
+func CountLineChanges(oldContent, newContent string) (additions, removals int) {
+	for _, line := range lineDiff(oldContent, newContent) {
+		switch line.op {
+		case diffmatchpatch.DiffInsert:
+			additions++
+		case diffmatchpatch.DiffDelete:
+			removals++
+		}
+	}
+	return additions, removals
+}
+
+// dryRunResponse previews an edit that was not applied
+func dryRunResponse(filePath, diffText string, additions, removals int) ToolResponse {
+	return WithResponseMetadata(
+		NewTextResponse(fmt.Sprintf("Dry run, no changes written to %s\n%s\n\n%s", filePath, editSummary(additions, removals), diffText)),
+		EditResponseMetadata{
+			Diff:      diffText,
+			Additions: additions,
+			Removals:  removals,
+			DryRun:    true,
+		},
+	)
+}
+
+// editSummary is the short change size shown to the model after an edit, e.g. "+12/-3 lines"
+func editSummary(additions, removals int) string {
+	return fmt.Sprintf("+%d/-%d lines", additions, removals)
+}
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mix/internal/permission"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// grantingPermissions returns a permission service that approves every request
+func grantingPermissions(t *testing.T) permission.Service {
+	t.Helper()
+	service := permission.NewPermissionService()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	requests := service.Subscribe(ctx)
+	go func() {
+		for event := range requests {
+			service.Grant(event.Payload)
+		}
+	}()
+	return service
+}
+
+func TestCountLineChanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		old       string
+		new       string
+		additions int
+		removals  int
+	}{
+		{"new file", "", "a\nb\nc\n", 3, 0},
+		{"modified line", "a\nb\nc\n", "a\nB\nc\n", 1, 1},
+		{"inserted lines", "a\nc\n", "a\nb1\nb2\nc\n", 2, 0},
+		{"deleted lines", "a\nb\nc\n", "a\n", 0, 2},
+		{"unchanged", "a\n", "a\n", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			additions, removals := CountLineChanges(tt.old, tt.new)
+			assert.Equal(t, tt.additions, additions)
+			assert.Equal(t, tt.removals, removals)
+		})
+	}
+}
+
+func TestEditTool_Summary(t *testing.T) {
+	files, ctx := newTestHistory(t)
+	ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+	tool := NewEditTool(grantingPermissions(t), files)
+	filePath := filepath.Join(t.TempDir(), "main.go")
+
+	run := func(params EditParams) ToolResponse {
+		input, err := json.Marshal(params)
+		require.NoError(t, err)
+		response, err := tool.Run(ctx, ToolCall{Name: EditToolName, Input: string(input)})
+		require.NoError(t, err)
+		require.False(t, response.IsError, response.Content)
+		return response
+	}
+
+	response := run(EditParams{FilePath: filePath, NewString: "package main\n\nfunc main() {\n}\n"})
+	assert.Contains(t, response.Content, "File created: "+filePath)
+	assert.Contains(t, response.Content, "+4/-0 lines")
+
+	response = run(EditParams{
+		FilePath:  filePath,
+		OldString: "func main() {\n}",
+		NewString: "func main() {\n\tprintln(\"one\")\n\tprintln(\"two\")\n}",
+	})
+	assert.Contains(t, response.Content, "Content replaced in file: "+filePath)
+	assert.Contains(t, response.Content, "+2/-0 lines")
+
+	// Structured metadata carries the same counts
+	var metadata EditResponseMetadata
+	require.NoError(t, json.Unmarshal([]byte(response.Metadata), &metadata))
+	assert.Equal(t, 2, metadata.Additions)
+	assert.Equal(t, 0, metadata.Removals)
+	assert.NotEmpty(t, metadata.Diff)
+
+	response = run(EditParams{FilePath: filePath, OldString: "\tprintln(\"two\")\n"})
+	assert.Contains(t, response.Content, "Content deleted from file: "+filePath)
+	assert.Contains(t, response.Content, "+0/-1 lines")
+
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nfunc main() {\n\tprintln(\"one\")\n}\n", string(content))
+}
+
+func TestEditTool_DryRun(t *testing.T) {
+	files, ctx := newTestHistory(t)
+	ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+	// Nobody answers permission requests, so a request would block the test
+	tool := NewEditTool(permission.NewPermissionService(), files)
+	dir := t.TempDir()
+	sessionID, _ := GetContextValues(ctx)
+
+	run := func(params EditParams) (ToolResponse, EditResponseMetadata) {
+		params.DryRun = true
+		input, err := json.Marshal(params)
+		require.NoError(t, err)
+		response, err := tool.Run(ctx, ToolCall{Name: EditToolName, Input: string(input)})
+		require.NoError(t, err)
+		require.False(t, response.IsError, response.Content)
+		var metadata EditResponseMetadata
+		require.NoError(t, json.Unmarshal([]byte(response.Metadata), &metadata))
+		assert.True(t, metadata.DryRun)
+		return response, metadata
+	}
+
+	t.Run("create", func(t *testing.T) {
+		filePath := filepath.Join(dir, "nested", "new.go")
+		response, metadata := run(EditParams{FilePath: filePath, NewString: "package main\n"})
+		assert.Contains(t, response.Content, "Dry run, no changes written to "+filePath)
+		assert.Contains(t, metadata.Diff, "+package main")
+		assert.NoDirExists(t, filepath.Dir(filePath))
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		filePath := filepath.Join(dir, "main.go")
+		original := "package main\n\nfunc main() {\n}\n"
+		require.NoError(t, os.WriteFile(filePath, []byte(original), 0o644))
+		recordFileRead(ctx, filePath)
+
+		response, metadata := run(EditParams{FilePath: filePath, OldString: "func main() {\n}", NewString: "func run() {\n}"})
+		assert.Contains(t, response.Content, "+1/-1 lines")
+		assert.Contains(t, metadata.Diff, "-func main() {\n+func run() {\n")
+
+		content, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, original, string(content))
+		_, err = files.GetByPathAndSession(ctx, filePath, sessionID)
+		assert.Error(t, err, "dry run must not record file history")
+	})
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Run("new file", func(t *testing.T) {
+		assert.Equal(t, "--- /dev/null\n+++ new.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n", unifiedDiff("", "new.txt", "", "a\nb\n"))
+	})
+
+	t.Run("context around a change", func(t *testing.T) {
+		old := numberedLines(10)
+		updated := strings.Replace(old, "line 5\n", "line five\n", 1)
+		expected := "--- f\n+++ f\n@@ -2,7 +2,7 @@\n line 2\n line 3\n line 4\n-line 5\n+line five\n line 6\n line 7\n line 8\n"
+		assert.Equal(t, expected, unifiedDiff("f", "f", old, updated))
+	})
+
+	t.Run("distant changes get separate hunks", func(t *testing.T) {
+		old := numberedLines(20)
+		updated := strings.Replace(strings.Replace(old, "line 2\n", "", 1), "line 19\n", "line 19\nextra\n", 1)
+		diff := unifiedDiff("f", "f", old, updated)
+		assert.Contains(t, diff, "@@ -1,5 +1,4 @@\n line 1\n-line 2\n line 3\n")
+		assert.Contains(t, diff, "@@ -17,4 +16,5 @@\n line 17\n line 18\n line 19\n+extra\n line 20\n")
+	})
+
+	t.Run("missing trailing newline", func(t *testing.T) {
+		assert.Equal(t, "--- f\n+++ f\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n", unifiedDiff("f", "f", "a", "b"))
+	})
+}
@@ -1,11 +1,17 @@
 package tools
 
 import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -14,6 +20,7 @@ import (
 
 	md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/brotli"
 )
 
 type FetchParams struct {
@@ -28,6 +35,10 @@ type FetchPermissionsParams struct {
 	Timeout int    `json:"timeout,omitempty"`
 }
 
+type FetchResponseMetadata struct {
+	URL string `json:"url"`
+}
+
 type fetchTool struct {
 	client      *http.Client
 	permissions permission.Service
@@ -35,17 +46,32 @@ type fetchTool struct {
 
 const (
 	FetchToolName = "fetch"
+
+	maxFetchRedirects = 10
 )
 
+// errDeniedDomain is returned for a URL, or a redirect, to a host in permissions.deniedDomains
+var errDeniedDomain = errors.New("domain is denied by permissions.deniedDomains")
+
 func NewFetchTool(permissions permission.Service) BaseTool {
 	return &fetchTool{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		client:      newFetchClient(30 * time.Second),
 		permissions: permissions,
 	}
 }
 
+func newFetchClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+			}
+			return checkDeniedDomain(req.URL)
+		},
+	}
+}
+
 func (t *fetchTool) Info() ToolInfo {
 	return ToolInfo{
 		Name:        FetchToolName,
@@ -88,24 +114,35 @@ func (t *fetchTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error
 		return NewTextErrorResponse("URL must start with http:// or https://"), nil
 	}
 
+	target, err := url.Parse(params.URL)
+	if err != nil {
+		return NewTextErrorResponse("Invalid URL: " + err.Error()), nil
+	}
+	if err := checkDeniedDomain(target); err != nil {
+		return NewTextErrorResponse(err.Error()), nil
+	}
+
 	sessionID, messageID := GetContextValues(ctx)
 	if sessionID == "" || messageID == "" {
 		return ToolResponse{}, fmt.Errorf("session ID and message ID are required for creating a new file")
 	}
 
-	p := t.permissions.Request(
-		permission.CreatePermissionRequest{
-			SessionID:   sessionID,
-			Path:        config.WorkingDirectory(),
-			ToolName:    FetchToolName,
-			Action:      "fetch",
-			Description: fmt.Sprintf("Fetch content from URL: %s", params.URL),
-			Params:      FetchPermissionsParams(params),
-		},
-	)
+	// Fetching only reads, so it can be approved for every URL in the config
+	if !config.Get().Permissions.AutoApproveWeb {
+		p := t.permissions.Request(
+			permission.CreatePermissionRequest{
+				SessionID:   sessionID,
+				Path:        config.WorkingDirectory(),
+				ToolName:    FetchToolName,
+				Action:      "fetch",
+				Description: fmt.Sprintf("Fetch content from URL: %s", params.URL),
+				Params:      FetchPermissionsParams(params),
+			},
+		)
 
-	if !p {
-		return ToolResponse{}, permission.ErrorPermissionDenied
+		if !p {
+			return ToolResponse{}, permission.ErrorPermissionDenied
+		}
 	}
 
 	client := t.client
@@ -114,9 +151,7 @@ func (t *fetchTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error
 		if params.Timeout > maxTimeout {
 			params.Timeout = maxTimeout
 		}
-		client = &http.Client{
-			Timeout: time.Duration(params.Timeout) * time.Second,
-		}
+		client = newFetchClient(time.Duration(params.Timeout) * time.Second)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", params.URL, nil)
@@ -125,8 +160,13 @@ func (t *fetchTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error
 	}
 
 	req.Header.Set("User-Agent", "mix/1.0")
+	// Setting this ourselves turns off the transport's transparent gzip, so decodeBody handles every encoding
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
 
 	resp, err := client.Do(req)
+	if errors.Is(err, errDeniedDomain) {
+		return NewTextErrorResponse("Redirect refused: " + errors.Unwrap(err).Error()), nil
+	}
 	if err != nil {
 		return ToolResponse{}, fmt.Errorf("failed to fetch URL: %w", err)
 	}
@@ -136,8 +176,13 @@ func (t *fetchTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error
 		return NewTextErrorResponse(fmt.Sprintf("Request failed with status code: %d", resp.StatusCode)), nil
 	}
 
+	bodyReader, err := decodeBody(resp.Body, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return NewTextErrorResponse("Failed to decompress response body: " + err.Error()), nil
+	}
+
 	maxSize := int64(5 * 1024 * 1024) // 5MB
-	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+	body, err := io.ReadAll(io.LimitReader(bodyReader, maxSize))
 	if err != nil {
 		return NewTextErrorResponse("Failed to read response body: " + err.Error()), nil
 	}
@@ -148,30 +193,49 @@ func (t *fetchTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error
 	switch format {
 	case "text":
 		if strings.Contains(contentType, "text/html") {
-			text, err := extractTextFromHTML(content)
+			content, err = extractTextFromHTML(content)
 			if err != nil {
 				return NewTextErrorResponse("Failed to extract text from HTML: " + err.Error()), nil
 			}
-			return NewTextResponse(text), nil
 		}
-		return NewTextResponse(content), nil
 
 	case "markdown":
 		if strings.Contains(contentType, "text/html") {
-			markdown, err := convertHTMLToMarkdown(content)
+			content, err = convertHTMLToMarkdown(content)
 			if err != nil {
 				return NewTextErrorResponse("Failed to convert HTML to Markdown: " + err.Error()), nil
 			}
-			return NewTextResponse(markdown), nil
+		} else {
+			content = "```\n" + content + "\n```"
 		}
+	}
 
-		return NewTextResponse("```\n" + content + "\n```"), nil
-
-	case "html":
-		return NewTextResponse(content), nil
+	finalURL := resp.Request.URL.String()
+	if finalURL != params.URL {
+		content = fmt.Sprintf("Redirected to: %s\n\n%s", finalURL, content)
+	}
+	return WithResponseMetadata(NewTextResponse(content), FetchResponseMetadata{URL: finalURL}), nil
+}
 
+// decodeBody wraps body to decompress the given Content-Encoding
+func decodeBody(body io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		// Deflate should be zlib-wrapped, but some servers send a raw stream
+		buffered := bufio.NewReader(body)
+		header, err := buffered.Peek(2)
+		if err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	case "br":
+		return brotli.NewReader(body), nil
 	default:
-		return NewTextResponse(content), nil
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
 	}
 }
 
@@ -197,3 +261,17 @@ func convertHTMLToMarkdown(html string) (string, error) {
 
 	return markdown, nil
 }
+
+// checkDeniedDomain returns an error if the URL's host is one of the denied domains or
+// a subdomain of one
+func checkDeniedDomain(u *url.URL) error {
+	// A fully qualified name such as example.com. resolves to the same host
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, domain := range config.Get().Permissions.DeniedDomains {
+		domain = strings.ToLower(strings.Trim(domain, "."))
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return fmt.Errorf("%w: %s", errDeniedDomain, host)
+		}
+	}
+	return nil
+}
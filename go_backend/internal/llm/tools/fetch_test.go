@@ -0,0 +1,241 @@
+package tools
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"mix/internal/config"
+	"mix/internal/permission"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compress(t *testing.T, encoding, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		var err error
+		w, err = flate.NewWriter(&buf, flate.DefaultCompression)
+		require.NoError(t, err)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	}
+	_, err := w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func runFetch(t *testing.T, params FetchParams) ToolResponse {
+	t.Helper()
+	ctx := context.WithValue(context.Background(), SessionIDContextKey, "session")
+	ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+	input, err := json.Marshal(params)
+	require.NoError(t, err)
+	response, err := NewFetchTool(grantingPermissions(t)).Run(ctx, ToolCall{Name: FetchToolName, Input: string(input)})
+	require.NoError(t, err)
+	return response
+}
+
+func TestFetchTool_Decompression(t *testing.T) {
+	const content = "hello from a compressed response"
+
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate", "br"} {
+		t.Run(encoding, func(t *testing.T) {
+			var acceptEncoding string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				acceptEncoding = r.Header.Get("Accept-Encoding")
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Encoding", strings.TrimPrefix(encoding, "raw-"))
+				w.Write(compress(t, encoding, content))
+			}))
+			defer server.Close()
+
+			response := runFetch(t, FetchParams{URL: server.URL, Format: "text"})
+			assert.False(t, response.IsError)
+			assert.Equal(t, content, response.Content)
+			assert.Equal(t, "gzip, deflate, br", acceptEncoding)
+		})
+	}
+}
+
+func TestFetchTool_Redirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var hop, total int
+		fmt.Sscanf(r.URL.Path, "/hop/%d/%d", &hop, &total)
+		if hop < total {
+			http.Redirect(w, r, fmt.Sprintf("%s/hop/%d/%d", server.URL, hop+1, total), http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compress(t, "gzip", "arrived"))
+	}))
+	defer server.Close()
+
+	t.Run("reports the final URL", func(t *testing.T) {
+		response := runFetch(t, FetchParams{URL: server.URL + "/hop/0/3", Format: "text"})
+		assert.False(t, response.IsError)
+		finalURL := server.URL + "/hop/3/3"
+		assert.Equal(t, "Redirected to: "+finalURL+"\n\narrived", response.Content)
+
+		var metadata FetchResponseMetadata
+		require.NoError(t, json.Unmarshal([]byte(response.Metadata), &metadata))
+		assert.Equal(t, finalURL, metadata.URL)
+	})
+
+	t.Run("no redirect", func(t *testing.T) {
+		response := runFetch(t, FetchParams{URL: server.URL + "/hop/0/0", Format: "text"})
+		assert.Equal(t, "arrived", response.Content)
+	})
+
+	t.Run("stops after too many redirects", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), SessionIDContextKey, "session")
+		ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+		input, err := json.Marshal(FetchParams{URL: fmt.Sprintf("%s/hop/0/%d", server.URL, maxFetchRedirects+1), Format: "text"})
+		require.NoError(t, err)
+		_, err = NewFetchTool(grantingPermissions(t)).Run(ctx, ToolCall{Name: FetchToolName, Input: string(input)})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "stopped after 10 redirects")
+	})
+}
+
+// loadTestConfig loads the config from a .mix.json in a temporary home directory
+func loadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfgJSON := `{"agents": {"main": {"model": "claude-4-sonnet"}, "sub": {"model": "claude-4-sonnet"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".mix.json"), []byte(cfgJSON), 0o644))
+
+	cfg, err := config.Load(home, false, false)
+	require.NoError(t, err)
+	return cfg
+}
+
+// loadWebPermissions loads a test config with the given web permission settings
+func loadWebPermissions(t *testing.T, autoApprove bool, deniedDomains ...string) {
+	t.Helper()
+	cfg := loadTestConfig(t)
+	cfg.Permissions.AutoApproveWeb = autoApprove
+	cfg.Permissions.DeniedDomains = deniedDomains
+}
+
+// denyingPermissions denies every request and counts the prompts
+func denyingPermissions(t *testing.T) (permission.Service, *atomic.Int32) {
+	t.Helper()
+	service := permission.NewPermissionService()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	requests := service.Subscribe(ctx)
+	var prompts atomic.Int32
+	go func() {
+		for event := range requests {
+			prompts.Add(1)
+			service.Deny(event.Payload)
+		}
+	}()
+	return service, &prompts
+}
+
+func TestFetchTool_WebPermissions(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, strings.Replace(r.Host, "127.0.0.1", "http://localhost", 1)+"/page", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	run := func(permissions permission.Service, url string) (ToolResponse, error) {
+		ctx := context.WithValue(context.Background(), SessionIDContextKey, "session")
+		ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+		input, err := json.Marshal(FetchParams{URL: url, Format: "text"})
+		require.NoError(t, err)
+		return NewFetchTool(permissions).Run(ctx, ToolCall{Name: FetchToolName, Input: string(input)})
+	}
+
+	t.Run("prompts by default", func(t *testing.T) {
+		loadWebPermissions(t, false)
+		permissions, prompts := denyingPermissions(t)
+		_, err := run(permissions, server.URL)
+		assert.ErrorIs(t, err, permission.ErrorPermissionDenied)
+		assert.Equal(t, int32(1), prompts.Load())
+	})
+
+	t.Run("auto-approved", func(t *testing.T) {
+		loadWebPermissions(t, true)
+		permissions, prompts := denyingPermissions(t)
+		response, err := run(permissions, server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "page", response.Content)
+		assert.Zero(t, prompts.Load())
+	})
+
+	t.Run("denied domain", func(t *testing.T) {
+		loadWebPermissions(t, true, "example.com", "127.0.0.1")
+		before := hits.Load()
+		response, err := run(grantingPermissions(t), server.URL)
+		require.NoError(t, err)
+		assert.True(t, response.IsError)
+		assert.Contains(t, response.Content, "denied by permissions.deniedDomains: 127.0.0.1")
+		assert.Equal(t, before, hits.Load(), "the denied host is never contacted")
+	})
+
+	t.Run("denied subdomain", func(t *testing.T) {
+		loadWebPermissions(t, true, "Example.com")
+		response, err := run(grantingPermissions(t), "https://docs.example.com/page")
+		require.NoError(t, err)
+		assert.True(t, response.IsError)
+		assert.Contains(t, response.Content, "docs.example.com")
+	})
+
+	t.Run("redirect to a denied domain", func(t *testing.T) {
+		loadWebPermissions(t, true, "localhost")
+		response, err := run(grantingPermissions(t), server.URL+"/away")
+		require.NoError(t, err)
+		assert.True(t, response.IsError)
+		assert.Equal(t, "Redirect refused: domain is denied by permissions.deniedDomains: localhost", response.Content)
+	})
+
+	t.Run("fully qualified domain", func(t *testing.T) {
+		loadWebPermissions(t, true, "example.com")
+		response, err := run(grantingPermissions(t), "https://example.com./page")
+		require.NoError(t, err)
+		assert.True(t, response.IsError)
+		assert.Contains(t, response.Content, "example.com")
+		assert.Error(t, checkDeniedDomain(&url.URL{Host: "docs.example.com.:443"}))
+	})
+
+	t.Run("similar domain is allowed", func(t *testing.T) {
+		loadWebPermissions(t, true, "example.com")
+		assert.NoError(t, checkDeniedDomain(&url.URL{Host: "notexample.com"}))
+	})
+}
@@ -1,10 +1,25 @@
 package tools
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
+// binarySniffLength is how many leading bytes are inspected when detecting binary files
+const binarySniffLength = 8000
+
+const (
+	// largeWriteSize is the size from which file writes are chunked and report progress
+	largeWriteSize = 1 << 20
+	writeChunkSize = 256 << 10
+)
+
 // File record to track when files were read/written
 type fileRecord struct {
 	path      string
@@ -17,7 +32,9 @@ var (
 	fileRecordMutex sync.RWMutex
 )
 
-func recordFileRead(path string) {
+func recordFileRead(ctx context.Context, path string) {
+	watchFileRead(ctx, path)
+
 	fileRecordMutex.Lock()
 	defer fileRecordMutex.Unlock()
 
@@ -40,6 +57,20 @@ func getLastReadTime(path string) time.Time {
 	return record.readTime
 }
 
+// invalidateFileRead forgets that a file was read, reporting whether it had been
+func invalidateFileRead(path string) bool {
+	fileRecordMutex.Lock()
+	defer fileRecordMutex.Unlock()
+
+	record, exists := fileRecords[path]
+	if !exists || record.readTime.IsZero() {
+		return false
+	}
+	record.readTime = time.Time{}
+	fileRecords[path] = record
+	return true
+}
+
 func recordFileWrite(path string) {
 	fileRecordMutex.Lock()
 	defer fileRecordMutex.Unlock()
@@ -51,3 +82,77 @@ func recordFileWrite(path string) {
 	record.writeTime = time.Now()
 	fileRecords[path] = record
 }
+
+// isBinaryFile reports whether the file looks binary, using the same null-byte
+// heuristic as git and grep on the first few kilobytes
+func isBinaryFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, binarySniffLength)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return bytes.IndexByte(buf[:n], 0) != -1, nil
+}
+
+// writeFile writes content to a temporary file next to path and renames it over path once
+// complete, so a failed or interrupted write leaves the existing file intact. Large
+// contents are written in chunks, reporting progress and stopping if ctx is cancelled.
+func writeFile(ctx context.Context, path string, content []byte) error {
+	// Write through symlinks rather than replacing them
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	perm := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Once renamed there is nothing left to remove
+	defer os.Remove(tmp.Name())
+
+	if err := writeChunks(ctx, tmp, path, content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeChunks(ctx context.Context, w io.Writer, path string, content []byte) error {
+	if len(content) < largeWriteSize {
+		_, err := w.Write(content)
+		return err
+	}
+
+	for written := 0; written < len(content); {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := w.Write(content[written:min(written+writeChunkSize, len(content))])
+		written += n
+		if err != nil {
+			return err
+		}
+		reportProgress(ctx, ToolProgress{
+			Message:   fmt.Sprintf("Writing %s: %d%%", filepath.Base(path), written*100/len(content)),
+			Completed: int64(written),
+			Total:     int64(len(content)),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	large := []byte(strings.Repeat("x", largeWriteSize+writeChunkSize/2))
+
+	t.Run("replaces the file and keeps its permissions", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file.txt")
+		require.NoError(t, os.WriteFile(path, []byte("original"), 0o600))
+
+		require.NoError(t, writeFile(context.Background(), path, []byte("updated")))
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "updated", string(content))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("writes through symlinks", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "target.txt")
+		link := filepath.Join(dir, "link.txt")
+		require.NoError(t, os.WriteFile(target, []byte("original"), 0o644))
+		require.NoError(t, os.Symlink(target, link))
+
+		require.NoError(t, writeFile(context.Background(), link, []byte("updated")))
+		content, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "updated", string(content))
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeSymlink, info.Mode().Type())
+	})
+
+	t.Run("reports progress for large writes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "large.txt")
+		var progress []ToolProgress
+		ctx := WithProgress(context.Background(), func(p ToolProgress) { progress = append(progress, p) })
+
+		require.NoError(t, writeFile(ctx, path, large))
+		require.Len(t, progress, 5)
+		assert.Equal(t, int64(writeChunkSize), progress[0].Completed)
+		assert.Equal(t, int64(len(large)), progress[4].Completed)
+		assert.Equal(t, int64(len(large)), progress[4].Total)
+		assert.Equal(t, "Writing large.txt: 100%", progress[4].Message)
+	})
+
+	t.Run("interrupted write leaves the original file intact", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "file.txt")
+		require.NoError(t, os.WriteFile(path, []byte("original"), 0o644))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ctx = WithProgress(ctx, func(ToolProgress) { cancel() })
+
+		err := writeFile(ctx, path, large)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "the partial temporary file is removed")
+	})
+}
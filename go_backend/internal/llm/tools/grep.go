@@ -23,6 +23,7 @@ type GrepParams struct {
 	Path        string `json:"path"`
 	Include     string `json:"include"`
 	LiteralText bool   `json:"literal_text"`
+	Binary      bool   `json:"binary"`
 }
 
 type grepMatch struct {
@@ -30,6 +31,7 @@ type grepMatch struct {
 	modTime  time.Time
 	lineNum  int
 	lineText string
+	binary   bool
 }
 
 type GrepResponseMetadata struct {
@@ -68,6 +70,10 @@ func (g *grepTool) Info() ToolInfo {
 				"type":        "boolean",
 				"description": "If true, the pattern will be treated as literal text with special regex characters escaped. Default is false.",
 			},
+			"binary": map[string]any{
+				"type":        "boolean",
+				"description": "If true, binary files are searched too and reported by path only. Default is false.",
+			},
 		},
 		Required: []string{"pattern"},
 	}
@@ -106,7 +112,7 @@ func (g *grepTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		searchPath = config.WorkingDirectory()
 	}
 
-	matches, truncated, err := searchFiles(searchPattern, searchPath, params.Include, 100)
+	matches, truncated, err := searchFiles(searchPattern, searchPath, params.Include, params.Binary, 100)
 	if err != nil {
 		return ToolResponse{}, fmt.Errorf("error searching files: %w", err)
 	}
@@ -126,7 +132,9 @@ func (g *grepTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 				currentFile = match.path
 				output += fmt.Sprintf("%s:\n", match.path)
 			}
-			if match.lineNum > 0 {
+			if match.binary {
+				output += "  Binary file matches\n"
+			} else if match.lineNum > 0 {
 				output += fmt.Sprintf("  Line %d: %s\n", match.lineNum, match.lineText)
 			} else {
 				output += fmt.Sprintf("  %s\n", match.path)
@@ -147,10 +155,10 @@ func (g *grepTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 	), nil
 }
 
-func searchFiles(pattern, rootPath, include string, limit int) ([]grepMatch, bool, error) {
-	matches, err := searchWithRipgrep(pattern, rootPath, include)
+func searchFiles(pattern, rootPath, include string, binary bool, limit int) ([]grepMatch, bool, error) {
+	matches, err := searchWithRipgrep(pattern, rootPath, include, binary)
 	if err != nil {
-		matches, err = searchFilesWithRegex(pattern, rootPath, include)
+		matches, err = searchFilesWithRegex(pattern, rootPath, include, binary)
 		if err != nil {
 			return nil, false, err
 		}
@@ -168,7 +176,7 @@ func searchFiles(pattern, rootPath, include string, limit int) ([]grepMatch, boo
 	return matches, truncated, nil
 }
 
-func searchWithRipgrep(pattern, path, include string) ([]grepMatch, error) {
+func searchWithRipgrep(pattern, path, include string, binary bool) ([]grepMatch, error) {
 	_, err := exec.LookPath("rg")
 	if err != nil {
 		return nil, fmt.Errorf("ripgrep not found: %w", err)
@@ -179,6 +187,10 @@ func searchWithRipgrep(pattern, path, include string) ([]grepMatch, error) {
 	if include != "" {
 		args = append(args, "--glob", include)
 	}
+	if binary {
+		// Search binary files but only report that they match
+		args = append(args, "--binary")
+	}
 	args = append(args, path)
 
 	cmd := exec.Command("rg", args...)
@@ -198,6 +210,20 @@ func searchWithRipgrep(pattern, path, include string) ([]grepMatch, error) {
 			continue
 		}
 
+		// Binary files are reported as "file: binary file matches (...)"
+		if binaryPath, _, found := strings.Cut(line, ": binary file matches"); found {
+			fileInfo, err := os.Stat(binaryPath)
+			if err != nil {
+				continue
+			}
+			matches = append(matches, grepMatch{
+				path:    binaryPath,
+				modTime: fileInfo.ModTime(),
+				binary:  true,
+			})
+			continue
+		}
+
 		// Parse ripgrep output format: file:line:content
 		parts := strings.SplitN(line, ":", 3)
 		if len(parts) < 3 {
@@ -227,7 +253,7 @@ func searchWithRipgrep(pattern, path, include string) ([]grepMatch, error) {
 	return matches, nil
 }
 
-func searchFilesWithRegex(pattern, rootPath, include string) ([]grepMatch, error) {
+func searchFilesWithRegex(pattern, rootPath, include string, binary bool) ([]grepMatch, error) {
 	matches := []grepMatch{}
 
 	regex, err := regexp.Compile(pattern)
@@ -261,6 +287,14 @@ func searchFilesWithRegex(pattern, rootPath, include string) ([]grepMatch, error
 			return nil
 		}
 
+		isBinary, err := isBinaryFile(path)
+		if err != nil {
+			return nil // Skip files we can't read
+		}
+		if isBinary && !binary {
+			return nil
+		}
+
 		match, lineNum, lineText, err := fileContainsPattern(path, regex)
 		if err != nil {
 			return nil // Skip files we can't read
@@ -272,6 +306,7 @@ func searchFilesWithRegex(pattern, rootPath, include string) ([]grepMatch, error
 				modTime:  info.ModTime(),
 				lineNum:  lineNum,
 				lineText: lineText,
+				binary:   isBinary,
 			})
 
 			if len(matches) >= 200 {
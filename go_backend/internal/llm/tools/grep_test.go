@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBinaryFixtures(t *testing.T) string {
+	t.Helper()
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "data.bin"), []byte("header\x00\x01\x02needle\x00trailer"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "notes.txt"), []byte("first line\nneedle here\n"), 0o644))
+	return tempDir
+}
+
+func TestIsBinaryFile(t *testing.T) {
+	tempDir := writeBinaryFixtures(t)
+
+	isBinary, err := isBinaryFile(filepath.Join(tempDir, "data.bin"))
+	require.NoError(t, err)
+	assert.True(t, isBinary)
+
+	isBinary, err = isBinaryFile(filepath.Join(tempDir, "notes.txt"))
+	require.NoError(t, err)
+	assert.False(t, isBinary)
+}
+
+func TestSearchFilesWithRegex_Binary(t *testing.T) {
+	// Search relative to the temp dir so the /tmp prefix isn't treated as an ignored directory
+	t.Chdir(writeBinaryFixtures(t))
+
+	t.Run("skips binary files by default", func(t *testing.T) {
+		matches, err := searchFilesWithRegex("needle", ".", "", false)
+		require.NoError(t, err)
+		require.Len(t, matches, 1)
+		assert.Equal(t, "notes.txt", matches[0].path)
+		assert.False(t, matches[0].binary)
+	})
+
+	t.Run("includes binary files when requested", func(t *testing.T) {
+		matches, err := searchFilesWithRegex("needle", ".", "", true)
+		require.NoError(t, err)
+		require.Len(t, matches, 2)
+
+		var binaryPaths []string
+		for _, match := range matches {
+			if match.binary {
+				binaryPaths = append(binaryPaths, match.path)
+			}
+		}
+		assert.Equal(t, []string{"data.bin"}, binaryPaths)
+	})
+}
+
+func TestGrepTool_Binary(t *testing.T) {
+	t.Chdir(writeBinaryFixtures(t))
+	tool := NewGrepTool()
+
+	run := func(params GrepParams) string {
+		input, err := json.Marshal(params)
+		require.NoError(t, err)
+		response, err := tool.Run(context.Background(), ToolCall{Name: GrepToolName, Input: string(input)})
+		require.NoError(t, err)
+		return response.Content
+	}
+
+	output := run(GrepParams{Pattern: "needle", Path: "."})
+	assert.Contains(t, output, "needle here")
+	assert.NotContains(t, output, "data.bin")
+	assert.NotContains(t, output, "\x00")
+
+	output = run(GrepParams{Pattern: "needle", Path: ".", Binary: true})
+	assert.Contains(t, output, "data.bin")
+	assert.Contains(t, output, "Binary file matches")
+	assert.NotContains(t, output, "\x00")
+}
+
+func TestViewTool_Binary(t *testing.T) {
+	tempDir := writeBinaryFixtures(t)
+	tool := NewViewTool(nil)
+
+	input, err := json.Marshal(ViewParams{FilePath: filepath.Join(tempDir, "data.bin")})
+	require.NoError(t, err)
+	response, err := tool.Run(context.Background(), ToolCall{Name: ViewToolName, Input: string(input)})
+	require.NoError(t, err)
+
+	assert.Contains(t, response.Content, "Binary file")
+	assert.Contains(t, response.Content, "23 bytes, skipped")
+	assert.NotContains(t, response.Content, "\x00")
+}
@@ -0,0 +1,198 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mix/internal/config"
+	"mix/internal/permission"
+)
+
+type OpenInEditorParams struct {
+	FilePath string `json:"file_path"`
+}
+
+// OpenInEditorResponseMetadata is the application a file was opened in and the tools
+// to edit it with there
+type OpenInEditorResponseMetadata struct {
+	Application string   `json:"application"`
+	Tools       []string `json:"tools"`
+}
+
+// Editor is an application files are routed to, with the tools the agent edits them
+// with once they are open and how to use them
+type Editor struct {
+	Application string
+	Tools       []string
+	Guidance    string
+}
+
+type openInEditorTool struct {
+	permissions permission.Service
+}
+
+const OpenInEditorToolName = "open_in_editor"
+
+var (
+	pixelmatorEditor = Editor{
+		Application: "Pixelmator Pro",
+		Tools:       []string{PixelmatorThumbnailToolName, BashToolName},
+		Guidance:    "Edit it with the Pixelmator Pro image editing operations run through bash, and look at the result with pixelmator_thumbnail.",
+	}
+	blenderEditor = Editor{
+		Application: "Blender",
+		Tools:       []string{"execute_blender_code"},
+		Guidance:    "Edit it with the Blender video editing functions run through execute_blender_code.",
+	}
+)
+
+// knownEditors are the applications the agent has tools for
+var knownEditors = []Editor{pixelmatorEditor, blenderEditor}
+
+// defaultEditors routes file extensions, without the dot, to their editor
+var defaultEditors = map[string]Editor{
+	"pxd":   pixelmatorEditor,
+	"pxm":   pixelmatorEditor,
+	"psd":   pixelmatorEditor,
+	"png":   pixelmatorEditor,
+	"jpg":   pixelmatorEditor,
+	"jpeg":  pixelmatorEditor,
+	"heic":  pixelmatorEditor,
+	"tif":   pixelmatorEditor,
+	"tiff":  pixelmatorEditor,
+	"webp":  pixelmatorEditor,
+	"gif":   pixelmatorEditor,
+	"blend": blenderEditor,
+	"mp4":   blenderEditor,
+	"mov":   blenderEditor,
+	"mkv":   blenderEditor,
+}
+
+// EditorFor returns the editor a file is opened in by its extension. The editors
+// setting adds extensions or sends them to another application; an application the
+// agent has no tools for is still opened, but left to the user.
+func EditorFor(path string) (Editor, bool) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if ext == "" {
+		return Editor{}, false
+	}
+	if application := strings.TrimSpace(config.Get().Editors[ext]); application != "" {
+		for _, editor := range knownEditors {
+			if strings.EqualFold(editor.Application, application) {
+				return editor, true
+			}
+		}
+		return Editor{Application: application}, true
+	}
+	editor, ok := defaultEditors[ext]
+	return editor, ok
+}
+
+// EditorExtensions returns every extension that has an editor, sorted
+func EditorExtensions() []string {
+	extensions := make([]string, 0, len(defaultEditors))
+	for ext := range defaultEditors {
+		extensions = append(extensions, ext)
+	}
+	for ext, application := range config.Get().Editors {
+		if _, ok := defaultEditors[ext]; !ok && strings.TrimSpace(application) != "" {
+			extensions = append(extensions, ext)
+		}
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+func NewOpenInEditorTool(permission permission.Service) BaseTool {
+	return &openInEditorTool{
+		permissions: permission,
+	}
+}
+
+func (o *openInEditorTool) Info() ToolInfo {
+	return ToolInfo{
+		Name: OpenInEditorToolName,
+		Description: `Opens a file in the application used to edit files of its type, such as Pixelmator Pro for images and Blender for video, and tells you which tools to continue with.
+Use it before editing a creative file rather than choosing the application yourself. Text and code files are edited with the edit and write tools instead.`,
+		Parameters: map[string]any{
+			"file_path": map[string]any{
+				"type":        "string",
+				"description": "The absolute path to the file to open",
+			},
+		},
+		Required: []string{"file_path"},
+	}
+}
+
+func (o *openInEditorTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error) {
+	var params OpenInEditorParams
+	if err := json.Unmarshal([]byte(call.Input), &params); err != nil {
+		return NewTextErrorResponse("invalid parameters"), nil
+	}
+	if params.FilePath == "" {
+		return NewTextErrorResponse("file_path is required"), nil
+	}
+	if !filepath.IsAbs(params.FilePath) {
+		return NewTextErrorResponse("file_path must be an absolute path, not a relative path"), nil
+	}
+
+	editor, ok := EditorFor(params.FilePath)
+	if !ok {
+		return NewTextErrorResponse(fmt.Sprintf("No editor is set up for %s files. Files with these extensions can be opened: %s",
+			filepath.Ext(params.FilePath), strings.Join(EditorExtensions(), ", "))), nil
+	}
+	if _, err := os.Stat(params.FilePath); err != nil {
+		if os.IsNotExist(err) {
+			return NewTextErrorResponse(fmt.Sprintf("File not found: %s", params.FilePath)), nil
+		}
+		return ToolResponse{}, fmt.Errorf("failed to access file: %w", err)
+	}
+
+	sessionID, messageID := GetContextValues(ctx)
+	if sessionID == "" || messageID == "" {
+		return ToolResponse{}, fmt.Errorf("session ID and message ID are required to open a file")
+	}
+
+	granted := o.permissions.Request(
+		permission.CreatePermissionRequest{
+			SessionID:   sessionID,
+			Path:        params.FilePath,
+			ToolName:    OpenInEditorToolName,
+			Action:      "open",
+			Description: fmt.Sprintf("Open %s in %s", params.FilePath, editor.Application),
+			Params:      params,
+		},
+	)
+	if !granted {
+		return ToolResponse{}, permission.ErrorPermissionDenied
+	}
+
+	if _, err := runAppleScript(ctx, openScript(editor.Application, params.FilePath)); err != nil {
+		return NewTextErrorResponse(fmt.Sprintf("Failed to open %s in %s: %s", params.FilePath, editor.Application, err)), nil
+	}
+
+	text := fmt.Sprintf("Opened %s in %s.", params.FilePath, editor.Application)
+	if len(editor.Tools) > 0 {
+		text += fmt.Sprintf(" Continue with these tools: %s.", strings.Join(editor.Tools, ", "))
+	}
+	if editor.Guidance != "" {
+		text += " " + editor.Guidance
+	} else {
+		text += " There are no tools for editing it there, so leave the editing to the user."
+	}
+	metadata := OpenInEditorResponseMetadata{Application: editor.Application, Tools: editor.Tools}
+	return WithResponseMetadata(NewTextResponse(text), metadata), nil
+}
+
+// openScript opens path in application and brings it to the front
+func openScript(application, path string) string {
+	return fmt.Sprintf(`tell application %s
+	open POSIX file %s
+	activate
+end tell`, appleScriptQuote(application), appleScriptQuote(path))
+}
@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mix/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditorFor(t *testing.T) {
+	cfg := config.Get()
+	original := cfg.Editors
+	t.Cleanup(func() { cfg.Editors = original })
+	cfg.Editors = nil
+
+	tests := []struct {
+		path        string
+		application string
+		ok          bool
+	}{
+		{"/art/cover.pxd", "Pixelmator Pro", true},
+		{"/art/photo.JPG", "Pixelmator Pro", true},
+		{"/art/layers.psd", "Pixelmator Pro", true},
+		{"/film/edit.blend", "Blender", true},
+		{"/film/take-1.mov", "Blender", true},
+		{"/src/main.go", "", false},
+		{"/art/Makefile", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			editor, ok := EditorFor(tt.path)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.application, editor.Application)
+		})
+	}
+
+	t.Run("configured editors", func(t *testing.T) {
+		cfg.Editors = map[string]string{
+			"afphoto": "Affinity Photo",
+			"psd":     "Adobe Photoshop",
+			"psb":     "pixelmator pro",
+		}
+
+		editor, ok := EditorFor("/art/poster.afphoto")
+		require.True(t, ok)
+		assert.Equal(t, Editor{Application: "Affinity Photo"}, editor)
+
+		editor, _ = EditorFor("/art/layers.psd")
+		assert.Equal(t, "Adobe Photoshop", editor.Application)
+		assert.Empty(t, editor.Tools)
+
+		// Extensions routed to an application the agent has tools for get those tools
+		editor, _ = EditorFor("/art/huge.psb")
+		assert.Equal(t, pixelmatorEditor, editor)
+
+		assert.Contains(t, EditorExtensions(), "afphoto")
+		assert.Contains(t, EditorExtensions(), "pxd")
+	})
+}
+
+func TestOpenInEditorTool(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "cover.pxd")
+	require.NoError(t, os.WriteFile(image, []byte("pxd"), 0o644))
+
+	run := func(t *testing.T, input string) ToolResponse {
+		t.Helper()
+		ctx := context.WithValue(context.Background(), SessionIDContextKey, "session")
+		ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+		response, err := NewOpenInEditorTool(grantingPermissions(t)).Run(ctx, ToolCall{Name: OpenInEditorToolName, Input: input})
+		require.NoError(t, err)
+		return response
+	}
+	stub := func(t *testing.T, err error) *string {
+		var script string
+		original := runAppleScript
+		runAppleScript = func(ctx context.Context, s string) (string, error) {
+			script = s
+			return "", err
+		}
+		t.Cleanup(func() { runAppleScript = original })
+		return &script
+	}
+
+	t.Run("routes to the editor", func(t *testing.T) {
+		script := stub(t, nil)
+		response := run(t, `{"file_path": "`+image+`"}`)
+		assert.False(t, response.IsError)
+		assert.Equal(t, openScript("Pixelmator Pro", image), *script)
+		assert.Contains(t, *script, `tell application "Pixelmator Pro"`)
+		assert.Contains(t, response.Content, "Opened "+image+" in Pixelmator Pro")
+		assert.Contains(t, response.Content, "Continue with these tools: pixelmator_thumbnail, bash.")
+
+		var metadata OpenInEditorResponseMetadata
+		require.NoError(t, json.Unmarshal([]byte(response.Metadata), &metadata))
+		assert.Equal(t, OpenInEditorResponseMetadata{
+			Application: "Pixelmator Pro",
+			Tools:       []string{PixelmatorThumbnailToolName, BashToolName},
+		}, metadata)
+	})
+
+	t.Run("unsupported file type", func(t *testing.T) {
+		script := stub(t, nil)
+		response := run(t, `{"file_path": "`+filepath.Join(dir, "notes.txt")+`"}`)
+		assert.True(t, response.IsError)
+		assert.Contains(t, response.Content, "No editor is set up for .txt files")
+		assert.Empty(t, *script)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		stub(t, nil)
+		response := run(t, `{"file_path": "`+filepath.Join(dir, "missing.png")+`"}`)
+		assert.True(t, response.IsError)
+		assert.Contains(t, response.Content, "File not found")
+	})
+
+	t.Run("application fails to open it", func(t *testing.T) {
+		stub(t, errors.New("Pixelmator Pro got an error: The document could not be opened"))
+		response := run(t, `{"file_path": "`+image+`"}`)
+		assert.True(t, response.IsError)
+		assert.Contains(t, response.Content, "could not be opened")
+	})
+
+	t.Run("relative path", func(t *testing.T) {
+		response := run(t, `{"file_path": "cover.pxd"}`)
+		assert.True(t, response.IsError)
+	})
+}
@@ -0,0 +1,164 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxOutlineSignature caps the length of a signature in an outline
+const maxOutlineSignature = 200
+
+// outlineEntry is a declaration in a file outline
+type outlineEntry struct {
+	Line      int
+	Depth     int
+	Signature string
+}
+
+var (
+	pythonDeclaration = regexp.MustCompile(`^\s*((async\s+)?def|class)\s+\w+`)
+	jsDeclaration     = regexp.MustCompile(`^\s*(export\s+)?(default\s+)?((async\s+)?function\b|(abstract\s+)?class\s+\w+|(declare\s+)?(interface|type|enum)\s+\w+|(const|let|var)\s+\w+\s*(:[^=]+)?=\s*(async\s+)?(\([^)]*\)|\w+)\s*(:[^=]+)?=>)`)
+	// jsMethod matches an indented name followed by parameters and a body, as class methods are
+	jsMethod        = regexp.MustCompile(`^\s+((public|private|protected|static|readonly|async|get|set)\s+)*(#?\w+)\s*(<[^>]*>)?\([^)]*\)\s*(:[^{]+)?\{`)
+	rustDeclaration = regexp.MustCompile(`^\s*(pub(\([\w:]+\))?\s+)?((const\s+)?(async\s+)?(unsafe\s+)?(extern\s+"\w+"\s+)?fn|struct|enum|trait|union|mod|type|(unsafe\s+)?impl)\b`)
+
+	// jsKeywords start statements that jsMethod would otherwise take for methods
+	jsKeywords = map[string]bool{"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true, "function": true}
+)
+
+func isJSDeclaration(line string) bool {
+	if jsDeclaration.MatchString(line) {
+		return true
+	}
+	match := jsMethod.FindStringSubmatch(line)
+	return match != nil && !jsKeywords[match[3]]
+}
+
+// fileOutline returns the declarations in a code file, or false for unsupported
+// languages and files that cannot be parsed
+func fileOutline(path string, content []byte) ([]outlineEntry, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		return goOutline(content)
+	case ".py":
+		return lineOutline(content, pythonDeclaration.MatchString), true
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx":
+		return lineOutline(content, isJSDeclaration), true
+	case ".rs":
+		return lineOutline(content, rustDeclaration.MatchString), true
+	}
+	return nil, false
+}
+
+// goOutline lists Go types, functions and methods using the standard parser
+func goOutline(content []byte) ([]outlineEntry, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false
+	}
+
+	var entries []outlineEntry
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			// Print the declaration without its body
+			signature := &ast.FuncDecl{Recv: d.Recv, Name: d.Name, Type: d.Type}
+			entries = append(entries, outlineEntry{
+				Line:      fset.Position(d.Pos()).Line,
+				Signature: goNodeString(fset, signature),
+			})
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				entries = append(entries, outlineEntry{
+					Line:      fset.Position(typeSpec.Pos()).Line,
+					Signature: "type " + typeSpec.Name.Name + goTypeKind(typeSpec.Type),
+				})
+				if iface, ok := typeSpec.Type.(*ast.InterfaceType); ok {
+					for _, method := range iface.Methods.List {
+						if len(method.Names) == 0 {
+							continue
+						}
+						entries = append(entries, outlineEntry{
+							Line:      fset.Position(method.Pos()).Line,
+							Depth:     1,
+							Signature: method.Names[0].Name + strings.TrimPrefix(goNodeString(fset, method.Type), "func"),
+						})
+					}
+				}
+			}
+		}
+	}
+	return entries, true
+}
+
+// goTypeKind describes a type declaration's underlying type briefly
+func goTypeKind(expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.StructType:
+		return " struct"
+	case *ast.InterfaceType:
+		return " interface"
+	case *ast.FuncType:
+		return " func"
+	}
+	return ""
+}
+
+func goNodeString(fset *token.FileSet, node any) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	// Keep signatures that span lines on one
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+// lineOutline finds declarations line by line, nesting them by indentation
+func lineOutline(content []byte, isDeclaration func(line string) bool) []outlineEntry {
+	var entries []outlineEntry
+	// indents holds the indentation of the enclosing declarations
+	var indents []int
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !isDeclaration(line) {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		for len(indents) > 0 && indents[len(indents)-1] >= indent {
+			indents = indents[:len(indents)-1]
+		}
+		entries = append(entries, outlineEntry{
+			Line:      i + 1,
+			Depth:     len(indents),
+			Signature: strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "{")),
+		})
+		indents = append(indents, indent)
+	}
+	return entries
+}
+
+// formatOutline renders outline entries with their line numbers in cat -n style
+func formatOutline(entries []outlineEntry) string {
+	var lines []string
+	for _, entry := range entries {
+		signature := entry.Signature
+		if len(signature) > maxOutlineSignature {
+			signature = signature[:maxOutlineSignature] + "..."
+		}
+		lines = append(lines, fmt.Sprintf("%6d\t%s%s", entry.Line, strings.Repeat("  ", entry.Depth), signature))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,516 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"mix/internal/config"
+	"mix/internal/history"
+	"mix/internal/logging"
+	"mix/internal/permission"
+)
+
+type PatchParams struct {
+	Patch string `json:"patch"`
+}
+
+type PatchPermissionsParams struct {
+	FilePath string `json:"file_path"`
+	Diff     string `json:"diff"`
+}
+
+// PatchFileResult describes the change a patch made to one file
+type PatchFileResult struct {
+	FilePath  string `json:"file_path"`
+	Action    string `json:"action"` // "created", "modified" or "deleted"
+	Hunks     int    `json:"hunks"`
+	Additions int    `json:"additions"`
+	Removals  int    `json:"removals"`
+}
+
+type PatchResponseMetadata struct {
+	Files     []PatchFileResult `json:"files"`
+	Additions int               `json:"additions"`
+	Removals  int               `json:"removals"`
+}
+
+type patchTool struct {
+	permissions permission.Service
+	files       history.Service
+}
+
+const (
+	PatchToolName = "apply_patch"
+)
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// filePatch is the part of a unified diff that changes a single file. An empty
+// oldPath creates the file and an empty newPath deletes it.
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []patchHunk
+}
+
+type patchHunk struct {
+	header   string
+	oldStart int
+	oldCount int
+	lines    []patchLine
+}
+
+type patchLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+	// noNewline is set by a "\ No newline at end of file" marker
+	noNewline bool
+}
+
+// fileChange is a patch applied in memory, ready to be written
+type fileChange struct {
+	path       string
+	oldContent string
+	newContent string
+	existed    bool
+	result     PatchFileResult
+}
+
+func NewPatchTool(permissions permission.Service, files history.Service) BaseTool {
+	return &patchTool{
+		permissions: permissions,
+		files:       files,
+	}
+}
+
+func (p *patchTool) Info() ToolInfo {
+	return ToolInfo{
+		Name:        PatchToolName,
+		Description: LoadToolDescription("apply_patch"),
+		Parameters: map[string]any{
+			"patch": map[string]any{
+				"type":        "string",
+				"description": "The unified diff to apply. It may change several files",
+			},
+		},
+		Required: []string{"patch"},
+	}
+}
+
+func (p *patchTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error) {
+	var params PatchParams
+	if err := json.Unmarshal([]byte(call.Input), &params); err != nil {
+		return NewTextErrorResponse("invalid parameters"), nil
+	}
+
+	if strings.TrimSpace(params.Patch) == "" {
+		return NewTextErrorResponse("patch is required"), nil
+	}
+
+	patches, err := parsePatch(params.Patch)
+	if err != nil {
+		return NewTextErrorResponse(fmt.Sprintf("invalid patch: %s", err)), nil
+	}
+
+	sessionID, messageID := GetContextValues(ctx)
+	if sessionID == "" || messageID == "" {
+		return ToolResponse{}, fmt.Errorf("session ID and message ID are required for applying a patch")
+	}
+
+	// Apply every hunk in memory first so a bad hunk leaves all files untouched
+	changes := make([]fileChange, 0, len(patches))
+	seen := make(map[string]bool)
+	for _, fp := range patches {
+		change, errMsg := applyFilePatch(fp)
+		if errMsg != "" {
+			return NewTextErrorResponse("Patch not applied, no files were changed.\n" + errMsg), nil
+		}
+		if seen[change.path] {
+			return NewTextErrorResponse(fmt.Sprintf("Patch not applied, no files were changed.\n%s is changed more than once in the patch", change.path)), nil
+		}
+		seen[change.path] = true
+		changes = append(changes, change)
+	}
+
+	rootDir := config.WorkingDirectory()
+	for _, change := range changes {
+		permissionPath := filepath.Dir(change.path)
+		if strings.HasPrefix(change.path, rootDir) {
+			permissionPath = rootDir
+		}
+		granted := p.permissions.Request(
+			permission.CreatePermissionRequest{
+				SessionID:   sessionID,
+				Path:        permissionPath,
+				ToolName:    PatchToolName,
+				Action:      "write",
+				Description: fmt.Sprintf("Apply patch to %s (%s)", change.path, change.result.Action),
+				Params: PatchPermissionsParams{
+					FilePath: change.path,
+					Diff:     unifiedDiff(change.oldPathForDiff(), change.path, change.oldContent, change.newContent),
+				},
+			},
+		)
+		if !granted {
+			return ToolResponse{}, permission.ErrorPermissionDenied
+		}
+	}
+
+	if err := writeChanges(changes); err != nil {
+		return ToolResponse{}, err
+	}
+
+	metadata := PatchResponseMetadata{}
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "Patch applied to %d file(s):\n", len(changes))
+	for _, change := range changes {
+		p.recordHistory(ctx, sessionID, change)
+		recordFileWrite(change.path)
+		recordFileRead(ctx, change.path)
+
+		result := change.result
+		metadata.Files = append(metadata.Files, result)
+		metadata.Additions += result.Additions
+		metadata.Removals += result.Removals
+		fmt.Fprintf(&summary, "- %s: %s, %d hunk(s) applied, %s\n", result.FilePath, result.Action, result.Hunks, editSummary(result.Additions, result.Removals))
+	}
+
+	text := fmt.Sprintf("<result>\n%s</result>\n", summary.String())
+	return WithResponseMetadata(NewTextResponse(text), metadata), nil
+}
+
+func (c fileChange) oldPathForDiff() string {
+	if !c.existed {
+		return ""
+	}
+	return c.path
+}
+
+// recordHistory stores the file's versions before and after the patch
+func (p *patchTool) recordHistory(ctx context.Context, sessionID string, change fileChange) {
+	file, err := p.files.GetByPathAndSession(ctx, change.path, sessionID)
+	if err != nil {
+		if file, err = p.files.Create(ctx, sessionID, change.path, change.oldContent); err != nil {
+			logging.Debug("Error creating file history", "error", err)
+			return
+		}
+	}
+	if file.Content != change.oldContent {
+		// The file was changed outside the session, store an intermediate version
+		if _, err := p.files.CreateVersion(ctx, sessionID, change.path, change.oldContent); err != nil {
+			logging.Debug("Error creating file history version", "error", err)
+		}
+	}
+	if _, err := p.files.CreateVersion(ctx, sessionID, change.path, change.newContent); err != nil {
+		logging.Debug("Error creating file history version", "error", err)
+	}
+}
+
+// writeChanges writes all changes, restoring the files already written if one fails
+func writeChanges(changes []fileChange) error {
+	for i, change := range changes {
+		var err error
+		if change.result.Action == "deleted" {
+			err = os.Remove(change.path)
+		} else {
+			if err = os.MkdirAll(filepath.Dir(change.path), 0o755); err == nil {
+				err = os.WriteFile(change.path, []byte(change.newContent), 0o644)
+			}
+		}
+		if err == nil {
+			continue
+		}
+
+		for _, written := range changes[:i] {
+			if written.existed {
+				os.WriteFile(written.path, []byte(written.oldContent), 0o644)
+			} else {
+				os.Remove(written.path)
+			}
+		}
+		return fmt.Errorf("failed to write %s, patch rolled back: %w", change.path, err)
+	}
+	return nil
+}
+
+// applyFilePatch applies fp to the file on disk in memory. A non-empty message
+// explains why the patch doesn't apply.
+func applyFilePatch(fp filePatch) (fileChange, string) {
+	relPath := fp.newPath
+	action := "modified"
+	switch {
+	case fp.oldPath == "":
+		action = "created"
+	case fp.newPath == "":
+		relPath = fp.oldPath
+		action = "deleted"
+	case fp.oldPath != fp.newPath:
+		return fileChange{}, fmt.Sprintf("%s: renaming files is not supported, use the bash tool with mv first", fp.oldPath)
+	}
+
+	path := relPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(config.WorkingDirectory(), path)
+	}
+	change := fileChange{
+		path:   path,
+		result: PatchFileResult{FilePath: path, Action: action, Hunks: len(fp.hunks)},
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return fileChange{}, fmt.Sprintf("%s: path is a directory, not a file", path)
+	case err == nil && action == "created":
+		return fileChange{}, fmt.Sprintf("%s: file already exists", path)
+	case err == nil:
+		lastRead := getLastReadTime(path)
+		if lastRead.IsZero() {
+			return fileChange{}, fmt.Sprintf("%s: you must read the file before editing it. Use the View tool first", path)
+		}
+		if info.ModTime().After(lastRead) {
+			return fileChange{}, fmt.Sprintf("%s: file has been modified since it was last read (mod time: %s, last read: %s)",
+				path, info.ModTime().Format(time.RFC3339), lastRead.Format(time.RFC3339))
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fileChange{}, fmt.Sprintf("%s: failed to read file: %s", path, err)
+		}
+		change.oldContent = string(content)
+		change.existed = true
+	case !os.IsNotExist(err):
+		return fileChange{}, fmt.Sprintf("%s: failed to access file: %s", path, err)
+	case action != "created":
+		return fileChange{}, fmt.Sprintf("%s: file not found", path)
+	}
+
+	newContent, errMsg := applyHunks(change.oldContent, fp.hunks)
+	if errMsg != "" {
+		return fileChange{}, fmt.Sprintf("%s: %s", path, errMsg)
+	}
+	if action == "deleted" && newContent != "" {
+		return fileChange{}, fmt.Sprintf("%s: the patch deletes the file but doesn't remove all of its content", path)
+	}
+	change.newContent = newContent
+	change.result.Additions, change.result.Removals = CountLineChanges(change.oldContent, newContent)
+	return change, ""
+}
+
+// applyHunks applies hunks in order. A hunk is matched at its stated line first and
+// then at the nearest offset after the previous hunk; context must match exactly.
+func applyHunks(content string, hunks []patchHunk) (string, string) {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var result []string
+	next := 0
+	for i, hunk := range hunks {
+		var old []string
+		for _, line := range hunk.lines {
+			if line.op != '+' {
+				old = append(old, line.text)
+			}
+		}
+
+		expected := hunk.oldStart - 1
+		if hunk.oldCount == 0 {
+			// An empty old range names the line the new lines go after
+			expected = hunk.oldStart
+		}
+		pos := findHunk(lines, old, expected, next)
+		if pos < 0 {
+			return "", fmt.Sprintf("hunk %d (%s) does not match the file contents near line %d. Expected:\n%s",
+				i+1, hunk.header, hunk.oldStart, strings.Join(old, "\n"))
+		}
+
+		result = append(result, lines[next:pos]...)
+		for _, line := range hunk.lines {
+			switch line.op {
+			case ' ':
+				// Keep the file's own line, including its line ending
+				result = append(result, lines[pos])
+				pos++
+			case '-':
+				pos++
+			case '+':
+				text := line.text
+				if !line.noNewline {
+					text += "\n"
+				}
+				result = append(result, text)
+			}
+		}
+		next = pos
+	}
+	result = append(result, lines[next:]...)
+	return strings.Join(result, ""), ""
+}
+
+// findHunk returns where old matches lines, searching outward from expected but never
+// before minPos, or -1 if it doesn't match anywhere
+func findHunk(lines, old []string, expected, minPos int) int {
+	maxPos := len(lines) - len(old)
+	matches := func(pos int) bool {
+		if pos < minPos || pos > maxPos {
+			return false
+		}
+		for i, text := range old {
+			if strings.TrimSuffix(lines[pos+i], "\n") != text {
+				return false
+			}
+		}
+		return true
+	}
+
+	for offset := 0; expected-offset >= minPos || expected+offset <= maxPos; offset++ {
+		if matches(expected - offset) {
+			return expected - offset
+		}
+		if matches(expected + offset) {
+			return expected + offset
+		}
+	}
+	return -1
+}
+
+// parsePatch reads the file patches in a unified diff. Git headers and other
+// lines outside of hunks are ignored.
+func parsePatch(patch string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	var patches []filePatch
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "--- ") {
+			continue
+		}
+		if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+			return nil, fmt.Errorf("line %d: expected a +++ header after %q", i+2, lines[i])
+		}
+		fp := filePatch{
+			oldPath: patchPath(lines[i][4:]),
+			newPath: patchPath(lines[i+1][4:]),
+		}
+		if strings.HasPrefix(fp.oldPath, "a/") && strings.HasPrefix(fp.newPath, "b/") {
+			fp.oldPath, fp.newPath = fp.oldPath[2:], fp.newPath[2:]
+		} else if fp.oldPath == "" && strings.HasPrefix(fp.newPath, "b/") {
+			fp.newPath = fp.newPath[2:]
+		} else if fp.newPath == "" && strings.HasPrefix(fp.oldPath, "a/") {
+			fp.oldPath = fp.oldPath[2:]
+		}
+		if fp.oldPath == "" && fp.newPath == "" {
+			return nil, fmt.Errorf("line %d: both file paths are /dev/null", i+1)
+		}
+		i += 2
+
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@") {
+			hunk, consumed, err := parseHunk(lines[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s, line %d: %w", fp.displayPath(), i+1, err)
+			}
+			fp.hunks = append(fp.hunks, hunk)
+			i += consumed
+		}
+		if len(fp.hunks) == 0 {
+			return nil, fmt.Errorf("%s has no hunks", fp.displayPath())
+		}
+		patches = append(patches, fp)
+		// Step back so the loop increment lands on the line after the last hunk
+		i--
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file changes found, expected --- and +++ headers followed by @@ hunks")
+	}
+	return patches, nil
+}
+
+// parseHunk reads the hunk starting at lines[0] and returns how many lines it spans
+func parseHunk(lines []string) (patchHunk, int, error) {
+	m := hunkHeaderPattern.FindStringSubmatch(lines[0])
+	if m == nil {
+		return patchHunk{}, 0, fmt.Errorf("malformed hunk header %q", lines[0])
+	}
+	count := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	oldStart, _ := strconv.Atoi(m[1])
+	hunk := patchHunk{
+		header:   m[0],
+		oldStart: oldStart,
+		oldCount: count(m[2]),
+	}
+	newCount := count(m[4])
+
+	i := 1
+	oldSeen, newSeen := 0, 0
+	for oldSeen < hunk.oldCount || newSeen < newCount {
+		// The patch's final newline leaves an empty last line, which isn't part of a hunk
+		if i >= len(lines) || (i == len(lines)-1 && lines[i] == "") {
+			return patchHunk{}, 0, fmt.Errorf("hunk %s ends early, expected %d old and %d new lines", hunk.header, hunk.oldCount, newCount)
+		}
+		line := lines[i]
+		switch {
+		case line == "":
+			// Editors often strip the trailing space of an empty context line
+			hunk.lines = append(hunk.lines, patchLine{op: ' '})
+			oldSeen++
+			newSeen++
+		case line[0] == ' ':
+			hunk.lines = append(hunk.lines, patchLine{op: ' ', text: line[1:]})
+			oldSeen++
+			newSeen++
+		case line[0] == '-':
+			hunk.lines = append(hunk.lines, patchLine{op: '-', text: line[1:]})
+			oldSeen++
+		case line[0] == '+':
+			hunk.lines = append(hunk.lines, patchLine{op: '+', text: line[1:]})
+			newSeen++
+		case line[0] == '\\':
+			if len(hunk.lines) > 0 {
+				hunk.lines[len(hunk.lines)-1].noNewline = true
+			}
+		default:
+			return patchHunk{}, 0, fmt.Errorf("hunk %s has an unexpected line %q", hunk.header, line)
+		}
+		i++
+	}
+	if oldSeen != hunk.oldCount || newSeen != newCount {
+		return patchHunk{}, 0, fmt.Errorf("hunk %s line counts don't match its header", hunk.header)
+	}
+	if i < len(lines) && strings.HasPrefix(lines[i], "\\") {
+		hunk.lines[len(hunk.lines)-1].noNewline = true
+		i++
+	}
+	return hunk, i, nil
+}
+
+// patchPath strips the timestamp from a diff header path; /dev/null becomes ""
+func patchPath(header string) string {
+	path := header
+	if tab := strings.Index(path, "\t"); tab >= 0 {
+		path = path[:tab]
+	}
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return ""
+	}
+	return path
+}
+
+func (fp filePatch) displayPath() string {
+	if fp.newPath != "" {
+		return fp.newPath
+	}
+	return fp.oldPath
+}
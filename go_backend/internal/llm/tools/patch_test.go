@@ -0,0 +1,158 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchTool(t *testing.T) {
+	files, ctx := newTestHistory(t)
+	ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+	sessionID, _ := GetContextValues(ctx)
+	tool := NewPatchTool(grantingPermissions(t), files)
+	dir := t.TempDir()
+
+	run := func(patch string) (ToolResponse, PatchResponseMetadata) {
+		input, err := json.Marshal(PatchParams{Patch: patch})
+		require.NoError(t, err)
+		response, err := tool.Run(ctx, ToolCall{Name: PatchToolName, Input: string(input)})
+		require.NoError(t, err)
+		var metadata PatchResponseMetadata
+		if !response.IsError {
+			require.NoError(t, json.Unmarshal([]byte(response.Metadata), &metadata))
+		}
+		return response, metadata
+	}
+	// write creates a file the agent has read, as patches only apply to those
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		recordFileRead(ctx, path)
+		return path
+	}
+	read := func(path string) string {
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("clean apply", func(t *testing.T) {
+		path := write("lines.txt", numberedLines(20))
+		patch := "--- " + path + "\n+++ " + path + "\n" +
+			"@@ -1,4 +1,3 @@\n line 1\n-line 2\n line 3\n line 4\n" +
+			"@@ -17,4 +16,5 @@\n line 17\n line 18\n line 19\n+extra\n line 20\n"
+
+		response, metadata := run(patch)
+		require.False(t, response.IsError, response.Content)
+		assert.Contains(t, response.Content, "2 hunk(s) applied, +1/-1 lines")
+
+		assert.Equal(t, strings.Replace(strings.Replace(numberedLines(20), "line 2\n", "", 1), "line 19\n", "line 19\nextra\n", 1), read(path))
+		require.Len(t, metadata.Files, 1)
+		assert.Equal(t, PatchFileResult{FilePath: path, Action: "modified", Hunks: 2, Additions: 1, Removals: 1}, metadata.Files[0])
+
+		versions, err := files.ListBySession(ctx, sessionID)
+		require.NoError(t, err)
+		var contents []string
+		for _, version := range versions {
+			if version.Path == path {
+				contents = append(contents, version.Content)
+			}
+		}
+		assert.ElementsMatch(t, []string{numberedLines(20), read(path)}, contents)
+	})
+
+	t.Run("hunk found at an offset", func(t *testing.T) {
+		path := write("offset.txt", "header\nheader\n"+numberedLines(5))
+		response, _ := run("--- " + path + "\n+++ " + path + "\n@@ -2,3 +2,3 @@\n line 2\n-line 3\n+line three\n line 4\n")
+		require.False(t, response.IsError, response.Content)
+		assert.Equal(t, "header\nheader\nline 1\nline 2\nline three\nline 4\nline 5\n", read(path))
+	})
+
+	t.Run("context mismatch changes nothing", func(t *testing.T) {
+		first := write("first.txt", "alpha\nbeta\n")
+		second := write("second.txt", "one\ntwo\n")
+		patch := "--- " + first + "\n+++ " + first + "\n@@ -1,2 +1,2 @@\n alpha\n-beta\n+BETA\n" +
+			"--- " + second + "\n+++ " + second + "\n@@ -1,2 +1,2 @@\n uno\n-two\n+TWO\n"
+
+		response, _ := run(patch)
+		require.True(t, response.IsError)
+		assert.Contains(t, response.Content, "no files were changed")
+		assert.Contains(t, response.Content, second+": hunk 1 (@@ -1,2 +1,2 @@) does not match")
+		assert.Equal(t, "alpha\nbeta\n", read(first))
+		assert.Equal(t, "one\ntwo\n", read(second))
+	})
+
+	t.Run("multiple files", func(t *testing.T) {
+		modified := write("multi.go", "package main\n\nfunc main() {\n}\n")
+		removed := write("obsolete.txt", "old\n")
+		created := filepath.Join(dir, "pkg", "new.go")
+		patch := "diff --git a/multi.go b/multi.go\n" +
+			"--- " + modified + "\n+++ " + modified + "\n@@ -3,2 +3,3 @@\n func main() {\n+\trun()\n }\n" +
+			"--- /dev/null\n+++ " + created + "\n@@ -0,0 +1,2 @@\n+package pkg\n+\n" +
+			"--- " + removed + "\n+++ /dev/null\n@@ -1 +0,0 @@\n-old\n"
+
+		response, metadata := run(patch)
+		require.False(t, response.IsError, response.Content)
+		assert.Contains(t, response.Content, "Patch applied to 3 file(s)")
+		assert.Equal(t, "package main\n\nfunc main() {\n\trun()\n}\n", read(modified))
+		assert.Equal(t, "package pkg\n\n", read(created))
+		assert.NoFileExists(t, removed)
+
+		var actions []string
+		for _, file := range metadata.Files {
+			actions = append(actions, file.Action)
+		}
+		assert.Equal(t, []string{"modified", "created", "deleted"}, actions)
+		assert.Equal(t, 3, metadata.Additions)
+		assert.Equal(t, 1, metadata.Removals)
+	})
+
+	t.Run("unread file", func(t *testing.T) {
+		path := filepath.Join(dir, "unread.txt")
+		require.NoError(t, os.WriteFile(path, []byte("alpha\nbeta\n"), 0o644))
+
+		response, _ := run("--- " + path + "\n+++ " + path + "\n@@ -1,2 +1,2 @@\n alpha\n-beta\n+BETA\n")
+		require.True(t, response.IsError)
+		assert.Contains(t, response.Content, path+": you must read the file before editing it")
+		assert.Equal(t, "alpha\nbeta\n", read(path))
+	})
+
+	t.Run("malformed patch", func(t *testing.T) {
+		response, _ := run("just some text")
+		require.True(t, response.IsError)
+		assert.Contains(t, response.Content, "invalid patch")
+
+		path := write("short.txt", "a\nb\n")
+		response, _ = run("--- " + path + "\n+++ " + path + "\n@@ -1,2 +1,2 @@\n a\n")
+		require.True(t, response.IsError)
+		assert.Contains(t, response.Content, "ends early")
+	})
+}
+
+func TestApplyHunks_NoNewlineAtEnd(t *testing.T) {
+	patches, err := parsePatch("--- f\n+++ f\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n")
+	require.NoError(t, err)
+	require.Len(t, patches, 1)
+
+	content, errMsg := applyHunks("a", patches[0].hunks)
+	require.Empty(t, errMsg)
+	assert.Equal(t, "b", content)
+}
+
+func TestParsePatch_GitPrefixes(t *testing.T) {
+	patches, err := parsePatch("diff --git a/main.go b/main.go\nindex 83db48f..bf269f4 100644\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-a\n+b\n" +
+		"--- /dev/null\n+++ b/new.go\n@@ -0,0 +1 @@\n+c\n")
+	require.NoError(t, err)
+	require.Len(t, patches, 2)
+	assert.Equal(t, "main.go", patches[0].oldPath)
+	assert.Equal(t, "main.go", patches[0].newPath)
+	assert.Equal(t, "", patches[1].oldPath)
+	assert.Equal(t, "new.go", patches[1].newPath)
+}
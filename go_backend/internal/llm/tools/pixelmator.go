@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mix/internal/config"
+	"mix/internal/message"
+	"mix/internal/permission"
+	"mix/internal/utils"
+)
+
+type PixelmatorThumbnailParams struct {
+	MaxSize int `json:"max_size"`
+}
+
+type pixelmatorThumbnailTool struct {
+	permissions permission.Service
+}
+
+const (
+	PixelmatorThumbnailToolName = "pixelmator_thumbnail"
+
+	// defaultThumbnailSize keeps thumbnails small enough to send with every look at the canvas
+	defaultThumbnailSize = 768
+	minThumbnailSize     = 64
+	maxThumbnailSize     = 2048
+)
+
+// runAppleScript runs the export script; tests replace it to check the script
+var runAppleScript = utils.ExecuteAppleScript
+
+func NewPixelmatorThumbnailTool(permission permission.Service) BaseTool {
+	return &pixelmatorThumbnailTool{
+		permissions: permission,
+	}
+}
+
+func (p *pixelmatorThumbnailTool) returnsImages() {}
+
+func (p *pixelmatorThumbnailTool) Info() ToolInfo {
+	return ToolInfo{
+		Name: PixelmatorThumbnailToolName,
+		Description: `Captures a downscaled JPEG of the document open in Pixelmator Pro and returns it as an image, so you can see the current canvas.
+Use it after editing to check the result, or before editing to understand what the document contains.
+The document itself is not changed.`,
+		Parameters: map[string]any{
+			"max_size": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("The longest side of the thumbnail in pixels (default %d, between %d and %d)", defaultThumbnailSize, minThumbnailSize, maxThumbnailSize),
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (p *pixelmatorThumbnailTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error) {
+	var params PixelmatorThumbnailParams
+	if call.Input != "" {
+		if err := json.Unmarshal([]byte(call.Input), &params); err != nil {
+			return NewTextErrorResponse("invalid parameters"), nil
+		}
+	}
+	if params.MaxSize == 0 {
+		params.MaxSize = defaultThumbnailSize
+	}
+	if params.MaxSize < minThumbnailSize || params.MaxSize > maxThumbnailSize {
+		return NewTextErrorResponse(fmt.Sprintf("max_size must be between %d and %d", minThumbnailSize, maxThumbnailSize)), nil
+	}
+
+	sessionID, messageID := GetContextValues(ctx)
+	if sessionID == "" || messageID == "" {
+		return ToolResponse{}, fmt.Errorf("session ID and message ID are required for Pixelmator operations")
+	}
+
+	granted := p.permissions.Request(
+		permission.CreatePermissionRequest{
+			SessionID:   sessionID,
+			Path:        config.WorkingDirectory(),
+			ToolName:    PixelmatorThumbnailToolName,
+			Action:      "thumbnail",
+			Description: "Capture a thumbnail of the current Pixelmator Pro document",
+			Params:      params,
+		},
+	)
+	if !granted {
+		return ToolResponse{}, permission.ErrorPermissionDenied
+	}
+
+	dir, err := os.MkdirTemp("", "mix-pixelmator-")
+	if err != nil {
+		return ToolResponse{}, fmt.Errorf("failed to create thumbnail directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "thumbnail.jpg")
+
+	if _, err := runAppleScript(ctx, thumbnailScript(path, params.MaxSize)); err != nil {
+		if strings.Contains(err.Error(), "front document") {
+			return NewTextErrorResponse("No document is currently open in Pixelmator Pro"), nil
+		}
+		return ToolResponse{}, fmt.Errorf("failed to export thumbnail from Pixelmator Pro: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ToolResponse{}, fmt.Errorf("thumbnail was not exported: %w", err)
+	}
+
+	return NewImageResponse(
+		fmt.Sprintf("Thumbnail of the current Pixelmator Pro document (longest side %dpx)", params.MaxSize),
+		message.BinaryContent{MIMEType: "image/jpeg", Data: data},
+	), nil
+}
+
+// thumbnailScript exports the front document as a JPEG and scales it down with Image Events
+// so its longest side is maxSize. Documents already smaller than that are left as they are.
+func thumbnailScript(path string, maxSize int) string {
+	quoted := appleScriptQuote(path)
+	return fmt.Sprintf(`tell application "Pixelmator Pro"
+	export front document to POSIX file %[1]s as JPEG with compression factor 0.8
+end tell
+tell application "Image Events"
+	set thumbnail to open POSIX file %[1]s
+	set {imageWidth, imageHeight} to dimensions of thumbnail
+	if imageWidth > %[2]d or imageHeight > %[2]d then
+		scale thumbnail to size %[2]d
+		save thumbnail
+	end if
+	close thumbnail
+end tell`, quoted, maxSize)
+}
+
+// appleScriptQuote returns s as an AppleScript string literal
+func appleScriptQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
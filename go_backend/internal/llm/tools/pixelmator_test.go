@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAppleScript replaces runAppleScript for the test, recording the script and handing
+// the export path to export
+func stubAppleScript(t *testing.T, export func(path string) error) *string {
+	t.Helper()
+	var script string
+	exportPath := regexp.MustCompile(`POSIX file "([^"]+)"`)
+	original := runAppleScript
+	runAppleScript = func(ctx context.Context, s string) (string, error) {
+		script = s
+		match := exportPath.FindStringSubmatch(s)
+		require.NotNil(t, match)
+		return "", export(match[1])
+	}
+	t.Cleanup(func() { runAppleScript = original })
+	return &script
+}
+
+func runThumbnail(t *testing.T, input string) ToolResponse {
+	t.Helper()
+	ctx := context.WithValue(context.Background(), SessionIDContextKey, "session")
+	ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+	response, err := NewPixelmatorThumbnailTool(grantingPermissions(t)).Run(ctx, ToolCall{Name: PixelmatorThumbnailToolName, Input: input})
+	require.NoError(t, err)
+	return response
+}
+
+func TestPixelmatorThumbnailTool(t *testing.T) {
+	jpeg := []byte{0xff, 0xd8, 0xff, 0xe0, 'J', 'F', 'I', 'F'}
+
+	t.Run("returns the exported thumbnail", func(t *testing.T) {
+		var exported string
+		script := stubAppleScript(t, func(path string) error {
+			exported = path
+			return os.WriteFile(path, jpeg, 0o644)
+		})
+
+		response := runThumbnail(t, `{"max_size": 512}`)
+		assert.False(t, response.IsError)
+		assert.Equal(t, ToolResponseTypeImage, response.Type)
+		require.NotNil(t, response.Image)
+		assert.Equal(t, "image/jpeg", response.Image.MIMEType)
+		assert.Equal(t, jpeg, response.Image.Data)
+
+		assert.Equal(t, thumbnailScript(exported, 512), *script)
+		assert.Contains(t, *script, `export front document to POSIX file "`+exported+`" as JPEG`)
+		assert.Contains(t, *script, "scale thumbnail to size 512")
+		assert.NoFileExists(t, exported, "the temporary export is removed")
+	})
+
+	t.Run("defaults the size", func(t *testing.T) {
+		script := stubAppleScript(t, func(path string) error { return os.WriteFile(path, jpeg, 0o644) })
+		runThumbnail(t, "")
+		assert.Contains(t, *script, "scale thumbnail to size 768")
+	})
+
+	t.Run("no open document", func(t *testing.T) {
+		stubAppleScript(t, func(path string) error {
+			return errors.New(`applescript execution failed: exit status 1 - stderr: Can't get front document`)
+		})
+		response := runThumbnail(t, "")
+		assert.True(t, response.IsError)
+		assert.Equal(t, "No document is currently open in Pixelmator Pro", response.Content)
+	})
+
+	t.Run("size out of range", func(t *testing.T) {
+		response := runThumbnail(t, `{"max_size": 10000}`)
+		assert.True(t, response.IsError)
+	})
+
+	assert.True(t, ReturnsImages(NewPixelmatorThumbnailTool(nil)))
+	assert.False(t, ReturnsImages(NewLsTool()))
+}
+
+func TestAppleScriptQuote(t *testing.T) {
+	assert.Equal(t, `"/tmp/a \"b\" \\c.jpg"`, appleScriptQuote(`/tmp/a "b" \c.jpg`))
+}
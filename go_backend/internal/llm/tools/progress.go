@@ -0,0 +1,25 @@
+package tools
+
+import "context"
+
+// ToolProgress reports how far a long-running tool call has got. ToolCallID is filled in
+// by whoever runs the tool.
+type ToolProgress struct {
+	ToolCallID string
+	Message    string
+	Completed  int64
+	Total      int64
+}
+
+type progressContextKey struct{}
+
+// WithProgress returns a context in which tools report their progress to report
+func WithProgress(ctx context.Context, report func(ToolProgress)) context.Context {
+	return context.WithValue(ctx, progressContextKey{}, report)
+}
+
+func reportProgress(ctx context.Context, progress ToolProgress) {
+	if report, ok := ctx.Value(progressContextKey{}).(func(ToolProgress)); ok {
+		report(progress)
+	}
+}
@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"mix/internal/config"
+)
+
+// RedactedSecret replaces secrets masked in tool results
+const RedactedSecret = "[redacted]"
+
+// defaultRedactedTools are the tools whose results are checked for secrets unless
+// redaction.tools is set. File contents read with view are left alone so edits
+// can match them.
+var defaultRedactedTools = []string{BashToolName, FetchToolName, PythonExecutionToolName}
+
+// secretPatterns match common secret formats. When a pattern has a capture group only
+// the group is masked, so the name of an assignment or header stays readable.
+var secretPatterns = []*regexp.Regexp{
+	// AWS access key IDs and secret access keys
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`),
+	// Bearer tokens in headers and curl commands
+	regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{16,}=*)`),
+	// OpenAI and Anthropic style keys
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{20,}`),
+	// GitHub, Slack and Google API tokens
+	regexp.MustCompile(`\b(?:ghp|gho|ghu|ghs|ghr|github_pat)_[A-Za-z0-9_]{20,}`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`),
+	// Environment variables such as OPENAI_API_KEY=... or DB_PASSWORD: ...
+	regexp.MustCompile(`\b[A-Z][A-Z0-9_]*(?:API_KEY|APIKEY|SECRET|TOKEN|PASSWORD|PASSWD)[A-Z0-9_]*["']?\s*[=:]\s*["']?([^\s"']{8,})`),
+	// PEM private keys
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+}
+
+var (
+	configuredPatternsMu sync.Mutex
+	configuredPatterns   = map[string]*regexp.Regexp{}
+)
+
+// RedactToolResult masks secrets in the result of the named tool, following the
+// redaction setting
+func RedactToolResult(toolName, content string) string {
+	redaction := config.Get().Redaction
+	if redaction.Disabled || content == "" {
+		return content
+	}
+	redactedTools := redaction.Tools
+	if len(redactedTools) == 0 {
+		redactedTools = defaultRedactedTools
+	}
+	if !slices.Contains(redactedTools, toolName) {
+		return content
+	}
+	return RedactSecrets(content, redaction.Patterns...)
+}
+
+// RedactSecrets masks the built-in secret formats and the given extra patterns in text.
+// Extra patterns that don't compile are skipped; config validation reports them.
+func RedactSecrets(text string, extra ...string) string {
+	for _, pattern := range secretPatterns {
+		text = redactMatches(text, pattern)
+	}
+	for _, source := range extra {
+		if pattern := configuredPattern(source); pattern != nil {
+			text = redactMatches(text, pattern)
+		}
+	}
+	return text
+}
+
+// redactMatches replaces every match of pattern, or its first group when it has one
+func redactMatches(text string, pattern *regexp.Regexp) string {
+	matches := pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if len(match) >= 4 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(RedactedSecret)
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func configuredPattern(source string) *regexp.Regexp {
+	configuredPatternsMu.Lock()
+	defer configuredPatternsMu.Unlock()
+	pattern, ok := configuredPatterns[source]
+	if !ok {
+		// A pattern that doesn't compile is cached as nil
+		pattern, _ = regexp.Compile(source)
+		configuredPatterns[source] = pattern
+	}
+	return pattern
+}
@@ -28,6 +28,7 @@ type PersistentShell struct {
 
 type commandExecution struct {
 	command    string
+	dir        string
 	timeout    time.Duration
 	resultChan chan commandResult
 	ctx        context.Context
@@ -38,6 +39,7 @@ type commandResult struct {
 	stderr      string
 	exitCode    int
 	interrupted bool
+	cwd         string
 	err         error
 }
 
@@ -133,12 +135,12 @@ func newPersistentShell(cwd string) *PersistentShell {
 
 func (s *PersistentShell) processCommands() {
 	for cmd := range s.commandQueue {
-		result := s.execCommand(cmd.command, cmd.timeout, cmd.ctx)
+		result := s.execCommand(cmd.command, cmd.dir, cmd.timeout, cmd.ctx)
 		cmd.resultChan <- result
 	}
 }
 
-func (s *PersistentShell) execCommand(command string, timeout time.Duration, ctx context.Context) commandResult {
+func (s *PersistentShell) execCommand(command, dir string, timeout time.Duration, ctx context.Context) commandResult {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -163,6 +165,10 @@ func (s *PersistentShell) execCommand(command string, timeout time.Duration, ctx
 		os.Remove(cwdFile)
 	}()
 
+	if dir != "" {
+		command = fmt.Sprintf("cd %s && eval %s", shellQuote(dir), shellQuote(command))
+	}
+
 	fullCommand := fmt.Sprintf(`
 eval %s < /dev/null > %s 2> %s
 EXEC_EXIT_CODE=$?
@@ -242,6 +248,7 @@ echo $EXEC_EXIT_CODE > %s
 		stderr:      stderr,
 		exitCode:    exitCode,
 		interrupted: interrupted,
+		cwd:         s.cwd,
 	}
 }
 
@@ -271,8 +278,15 @@ func (s *PersistentShell) killChildren() {
 }
 
 func (s *PersistentShell) Exec(ctx context.Context, command string, timeoutMs int) (string, string, int, bool, error) {
+	stdout, stderr, exitCode, interrupted, _, err := s.ExecInDir(ctx, "", command, timeoutMs)
+	return stdout, stderr, exitCode, interrupted, err
+}
+
+// ExecInDir runs command after changing to dir, or in the shell's current directory
+// if dir is empty. It also returns the shell's working directory once the command finishes.
+func (s *PersistentShell) ExecInDir(ctx context.Context, dir, command string, timeoutMs int) (string, string, int, bool, string, error) {
 	if !s.isAlive {
-		return "", "Shell is not alive", 1, false, errors.New("shell is not alive")
+		return "", "Shell is not alive", 1, false, "", errors.New("shell is not alive")
 	}
 
 	timeout := time.Duration(timeoutMs) * time.Millisecond
@@ -280,13 +294,14 @@ func (s *PersistentShell) Exec(ctx context.Context, command string, timeoutMs in
 	resultChan := make(chan commandResult)
 	s.commandQueue <- &commandExecution{
 		command:    command,
+		dir:        dir,
 		timeout:    timeout,
 		resultChan: resultChan,
 		ctx:        ctx,
 	}
 
 	result := <-resultChan
-	return result.stdout, result.stderr, result.exitCode, result.interrupted, result.err
+	return result.stdout, result.stderr, result.exitCode, result.interrupted, result.cwd, result.err
 }
 
 func (s *PersistentShell) Close() {
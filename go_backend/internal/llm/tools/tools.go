@@ -3,6 +3,8 @@ package tools
 import (
 	"context"
 	"encoding/json"
+
+	"mix/internal/message"
 )
 
 type ToolInfo struct {
@@ -32,6 +34,9 @@ type ToolResponse struct {
 	Content  string           `json:"content"`
 	Metadata string           `json:"metadata,omitempty"`
 	IsError  bool             `json:"is_error"`
+	// Image is the picture returned by an image response. It is sent to the model
+	// alongside the tool result rather than serialized with it.
+	Image *message.BinaryContent `json:"-"`
 }
 
 func NewTextResponse(content string) ToolResponse {
@@ -41,6 +46,15 @@ func NewTextResponse(content string) ToolResponse {
 	}
 }
 
+// NewImageResponse returns an image for the model to look at, with content describing it
+func NewImageResponse(content string, image message.BinaryContent) ToolResponse {
+	return ToolResponse{
+		Type:    ToolResponseTypeImage,
+		Content: content,
+		Image:   &image,
+	}
+}
+
 func WithResponseMetadata(response ToolResponse, metadata any) ToolResponse {
 	if metadata != nil {
 		metadataBytes, err := json.Marshal(metadata)
@@ -71,6 +85,18 @@ type BaseTool interface {
 	Run(ctx context.Context, params ToolCall) (ToolResponse, error)
 }
 
+// imageTool is implemented by tools whose results are images
+type imageTool interface {
+	returnsImages()
+}
+
+// ReturnsImages reports whether a tool's results are images, which only models that
+// accept attachments can use
+func ReturnsImages(tool BaseTool) bool {
+	_, ok := tool.(imageTool)
+	return ok
+}
+
 func GetContextValues(ctx context.Context) (string, string) {
 	sessionID := ctx.Value(SessionIDContextKey)
 	messageID := ctx.Value(MessageIDContextKey)
@@ -4,37 +4,59 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"mix/internal/fileutil"
+	"mix/internal/history"
 	"mix/internal/logging"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
 type ViewParams struct {
-	FilePath string `json:"file_path"`
-	Offset   int    `json:"offset"`
-	Limit    int    `json:"limit"`
+	FilePath    string `json:"file_path"`
+	Offset      int    `json:"offset"`
+	Limit       int    `json:"limit"`
+	ShowChanges bool   `json:"show_changes"`
+	Outline     bool   `json:"outline"`
+	Blame       bool   `json:"blame"`
 }
 
 type viewTool struct {
+	files history.Service
 }
 
 type ViewResponseMetadata struct {
 	FilePath string `json:"file_path"`
 	Content  string `json:"content"`
+	// Files lists the files read when file_path is a glob pattern
+	Files []string `json:"files,omitempty"`
 }
 
 const (
 	ViewToolName     = "view"
 	DefaultReadLimit = 2000
 	MaxLineLength    = 2000
+
+	// changedLineMarker follows the line number of lines that differ from the prior version
+	changedLineMarker = "~"
+
+	// MaxGlobFiles and MaxGlobBytes cap how much a glob file_path reads in one call
+	MaxGlobFiles = 20
+	MaxGlobBytes = 100 * 1024
 )
 
-func NewViewTool() BaseTool {
-	return &viewTool{}
+// NewViewTool creates the view tool. files may be nil, in which case show_changes has
+// no history to compare against.
+func NewViewTool(files history.Service) BaseTool {
+	return &viewTool{files: files}
 }
 
 func (v *viewTool) Info() ToolInfo {
@@ -44,7 +66,7 @@ func (v *viewTool) Info() ToolInfo {
 		Parameters: map[string]any{
 			"file_path": map[string]any{
 				"type":        "string",
-				"description": "The absolute path to the file to read",
+				"description": "The absolute path to the file to read, or an absolute glob pattern (e.g. /project/src/*.go) to read several files",
 			},
 			"offset": map[string]any{
 				"type":        "integer",
@@ -54,6 +76,18 @@ func (v *viewTool) Info() ToolInfo {
 				"type":        "integer",
 				"description": "The number of lines to read (defaults to 2000)",
 			},
+			"show_changes": map[string]any{
+				"type":        "boolean",
+				"description": "Mark lines that changed since the previous version of the file recorded in this session",
+			},
+			"outline": map[string]any{
+				"type":        "boolean",
+				"description": "Return only the file's type, function and method signatures with their line numbers (Go, Python, JavaScript/TypeScript, Rust)",
+			},
+			"blame": map[string]any{
+				"type":        "boolean",
+				"description": "Annotate each line with the commit, date and author that last changed it, when the file is tracked by git",
+			},
 		},
 		Required: []string{"file_path"},
 	}
@@ -77,6 +111,13 @@ func (v *viewTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		return NewTextErrorResponse("file_path must be an absolute path, not a relative path"), nil
 	}
 
+	// A path with glob characters that doesn't exist as written is expanded
+	if strings.ContainsAny(filePath, "*?[{") {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			return viewGlob(ctx, filePath)
+		}
+	}
+
 	// Check if file exists
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
@@ -132,7 +173,7 @@ func (v *viewTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		imageDescription := fmt.Sprintf("Image file (%s) at %s\nFile size: %d bytes\n",
 			imageType, filePath, fileInfo.Size())
 
-		recordFileRead(filePath)
+		recordFileRead(ctx, filePath)
 		return WithResponseMetadata(
 			NewTextResponse(imageDescription),
 			ViewResponseMetadata{
@@ -155,7 +196,7 @@ func (v *viewTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		videoDescription := fmt.Sprintf("Video file (%s) at %s\nFile size: %d bytes\n",
 			videoType, filePath, fileInfo.Size())
 
-		recordFileRead(filePath)
+		recordFileRead(ctx, filePath)
 		return WithResponseMetadata(
 			NewTextResponse(videoDescription),
 			ViewResponseMetadata{
@@ -178,7 +219,7 @@ func (v *viewTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		audioDescription := fmt.Sprintf("Audio file (%s) at %s\nFile size: %d bytes\n",
 			audioType, filePath, fileInfo.Size())
 
-		recordFileRead(filePath)
+		recordFileRead(ctx, filePath)
 		return WithResponseMetadata(
 			NewTextResponse(audioDescription),
 			ViewResponseMetadata{
@@ -188,6 +229,30 @@ func (v *viewTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		), nil
 	}
 
+	// Skip binary files instead of returning garbled bytes
+	isBinary, err := isBinaryFile(filePath)
+	if err != nil {
+		return ToolResponse{}, fmt.Errorf("error reading file: %w", err)
+	}
+	if isBinary {
+		binaryDescription := fmt.Sprintf("Binary file at %s, %d bytes, skipped\n", filePath, fileInfo.Size())
+
+		recordFileRead(ctx, filePath)
+		return WithResponseMetadata(
+			NewTextResponse(binaryDescription),
+			ViewResponseMetadata{
+				FilePath: filePath,
+				Content:  binaryDescription,
+			},
+		), nil
+	}
+
+	if params.Outline {
+		if response, ok, err := viewOutline(filePath); err != nil || ok {
+			return response, err
+		}
+	}
+
 	// Read the file content
 	content, lineCount, err := readTextFile(filePath, params.Offset, params.Limit)
 	if err != nil {
@@ -197,7 +262,7 @@ func (v *viewTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 	// Handle empty files
 	if content == "" && lineCount == 0 {
 		output := "<file>\n<system-reminder>\nFile exists but has empty contents.\n</system-reminder>\n</file>\n"
-		recordFileRead(filePath)
+		recordFileRead(ctx, filePath)
 		return WithResponseMetadata(
 			NewTextResponse(output),
 			ViewResponseMetadata{
@@ -210,7 +275,45 @@ func (v *viewTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 	// LSP functionality removed
 	output := "<file>\n"
 	// Format the output with line numbers
-	output += addLineNumbers(content, params.Offset+1)
+	startLine := params.Offset + 1
+	var notes []string
+	var changed map[int]bool
+	if params.ShowChanges {
+		var found bool
+		changed, found, err = v.changedLines(ctx, filePath)
+		if err != nil {
+			return ToolResponse{}, fmt.Errorf("error comparing file history: %w", err)
+		}
+		if !found {
+			notes = append(notes, "(No earlier version of this file is recorded in this session to compare against)")
+		}
+	}
+	var blame map[int]string
+	if params.Blame {
+		// Only existing lines can be blamed, and an offset past the end of the file has none
+		end := min(params.Offset+len(strings.Split(content, "\n")), lineCount)
+		if startLine <= end {
+			var blameErr error
+			blame, blameErr = gitBlame(ctx, filePath, startLine, end)
+			switch {
+			case errors.Is(blameErr, errNotTracked):
+				notes = append(notes, "(This file is not tracked by git, so lines are not annotated)")
+			case blameErr != nil:
+				notes = append(notes, fmt.Sprintf("(Lines are not annotated: %v)", blameErr))
+			}
+		}
+	}
+	switch {
+	case blame != nil:
+		output += addLineNumbersWithBlame(content, startLine, changed, blame)
+	case params.ShowChanges:
+		output += addLineNumbersWithChanges(content, startLine, changed)
+	default:
+		output += addLineNumbers(content, startLine)
+	}
+	for _, note := range notes {
+		output += "\n\n" + note
+	}
 
 	// Add a note if the content was truncated
 	if lineCount > params.Offset+len(strings.Split(content, "\n")) {
@@ -219,7 +322,7 @@ func (v *viewTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 	}
 	output += "\n</file>\n"
 	// LSP diagnostics functionality removed
-	recordFileRead(filePath)
+	recordFileRead(ctx, filePath)
 	return WithResponseMetadata(
 		NewTextResponse(output),
 		ViewResponseMetadata{
@@ -229,6 +332,124 @@ func (v *viewTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 	), nil
 }
 
+// viewOutline returns the declarations of a code file, or false when its language has
+// no outline support so the caller reads it in full
+func viewOutline(filePath string) (ToolResponse, bool, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return ToolResponse{}, false, fmt.Errorf("error reading file: %w", err)
+	}
+	entries, ok := fileOutline(filePath, content)
+	if !ok {
+		return ToolResponse{}, false, nil
+	}
+
+	lineCount := strings.Count(string(content), "\n") + 1
+	output := "<outline>\n" + formatOutline(entries) + "\n</outline>\n"
+	if len(entries) == 0 {
+		output = "<outline>\n(No declarations found)\n</outline>\n"
+	}
+	output += fmt.Sprintf("\n(%d declarations in %d lines. Use offset and limit to read a region.)", len(entries), lineCount)
+
+	// Not recorded as a read: the outline alone is not enough to edit the file from
+	return WithResponseMetadata(
+		NewTextResponse(output),
+		ViewResponseMetadata{
+			FilePath: filePath,
+			Content:  formatOutline(entries),
+		},
+	), true, nil
+}
+
+// viewGlob reads the files matching an absolute glob pattern, each under its own header.
+// It stops after MaxGlobFiles files or once the contents would exceed MaxGlobBytes.
+func viewGlob(ctx context.Context, pattern string) (ToolResponse, error) {
+	base, relPattern := doublestar.SplitPattern(pattern)
+	if !doublestar.ValidatePattern(relPattern) {
+		return NewTextErrorResponse(fmt.Sprintf("Invalid glob pattern: %s", pattern)), nil
+	}
+	if _, err := os.Stat(base); err != nil {
+		return NewTextErrorResponse(fmt.Sprintf("No files match %s", pattern)), nil
+	}
+
+	matches, _, err := fileutil.GlobWithDoublestar(relPattern, base, 0)
+	if err != nil {
+		return ToolResponse{}, fmt.Errorf("error expanding glob: %w", err)
+	}
+	if len(matches) == 0 {
+		return NewTextErrorResponse(fmt.Sprintf("No files match %s", pattern)), nil
+	}
+	sort.Strings(matches)
+
+	var output, contents string
+	var files []string
+	size := 0
+	for i, path := range matches {
+		if len(files) == MaxGlobFiles {
+			output += fmt.Sprintf("(Stopped after %d files; %d more match. Use a narrower pattern to read them.)\n", MaxGlobFiles, len(matches)-i)
+			break
+		}
+
+		content, err := globFileContent(path)
+		if err != nil {
+			return ToolResponse{}, fmt.Errorf("error reading file: %w", err)
+		}
+		if size+len(content) > MaxGlobBytes {
+			output += fmt.Sprintf("(Stopped at the %d byte limit; %d more file(s) match. Read them individually or use a narrower pattern.)\n", MaxGlobBytes, len(matches)-i)
+			break
+		}
+		size += len(content)
+
+		output += fmt.Sprintf("<file path=\"%s\">\n%s\n</file>\n", path, content)
+		contents += content
+		files = append(files, path)
+		recordFileRead(ctx, path)
+	}
+
+	return WithResponseMetadata(
+		NewTextResponse(output),
+		ViewResponseMetadata{
+			FilePath: pattern,
+			Content:  contents,
+			Files:    files,
+		},
+	), nil
+}
+
+// globFileContent returns a matched file's lines numbered as a single view would show
+// them, or a short note for media and binary files
+func globFileContent(path string) (string, error) {
+	if isImage, kind := isImageFile(path); isImage {
+		return fmt.Sprintf("Image file (%s), contents not shown", kind), nil
+	}
+	if isVideo, kind := isVideoFile(path); isVideo {
+		return fmt.Sprintf("Video file (%s), contents not shown", kind), nil
+	}
+	if isAudio, kind := isAudioFile(path); isAudio {
+		return fmt.Sprintf("Audio file (%s), contents not shown", kind), nil
+	}
+	isBinary, err := isBinaryFile(path)
+	if err != nil {
+		return "", err
+	}
+	if isBinary {
+		return "Binary file, skipped", nil
+	}
+
+	content, lineCount, err := readTextFile(path, 0, DefaultReadLimit)
+	if err != nil {
+		return "", err
+	}
+	if content == "" && lineCount == 0 {
+		return "(empty file)", nil
+	}
+	numbered := addLineNumbers(content, 1)
+	if lineCount > DefaultReadLimit {
+		numbered += fmt.Sprintf("\n\n(File has more lines. View it on its own with 'offset' to read beyond line %d)", DefaultReadLimit)
+	}
+	return numbered, nil
+}
+
 func addLineNumbers(content string, startLine int) string {
 	if content == "" {
 		return ""
@@ -248,6 +469,103 @@ func addLineNumbers(content string, startLine int) string {
 	return strings.Join(result, "\n")
 }
 
+// addLineNumbersWithChanges formats like addLineNumbers and marks the changed line numbers
+func addLineNumbersWithChanges(content string, startLine int, changed map[int]bool) string {
+	if content == "" {
+		return ""
+	}
+
+	lines := strings.Split(content, "\n")
+
+	var result []string
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+
+		lineNum := i + startLine
+		marker := ""
+		if changed[lineNum] {
+			marker = changedLineMarker
+		}
+		result = append(result, fmt.Sprintf("%6d%s\t%s", lineNum, marker, line))
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// addLineNumbersWithBlame formats like addLineNumbersWithChanges and follows each line
+// number with the blame annotation of the line
+func addLineNumbersWithBlame(content string, startLine int, changed map[int]bool, blame map[int]string) string {
+	if content == "" {
+		return ""
+	}
+
+	lines := strings.Split(content, "\n")
+
+	var result []string
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+
+		lineNum := i + startLine
+		marker := ""
+		if changed[lineNum] {
+			marker = changedLineMarker
+		}
+		result = append(result, fmt.Sprintf("%6d%s\t%s\t%s", lineNum, marker, blame[lineNum], line))
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// changedLines returns the 1-based line numbers of the file on disk that differ from the
+// most recent differing version in the session's file history. found is false when no
+// such version exists.
+func (v *viewTool) changedLines(ctx context.Context, filePath string) (map[int]bool, bool, error) {
+	sessionID, _ := GetContextValues(ctx)
+	if v.files == nil || sessionID == "" {
+		return nil, false, nil
+	}
+
+	current, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	files, err := v.files.ListBySession(ctx, sessionID)
+	if err != nil {
+		return nil, false, err
+	}
+	var versions []history.File
+	for _, file := range files {
+		if file.Path == filePath {
+			versions = append(versions, file)
+		}
+	}
+	history.SortVersions(versions)
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].Content != string(current) {
+			return diffLines(versions[i].Content, string(current)), true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// diffLines returns the 1-based line numbers in current that were added or modified relative to previous
+func diffLines(previous, current string) map[int]bool {
+	changed := make(map[int]bool)
+	line := 1
+	for _, d := range lineDiff(previous, current) {
+		switch d.op {
+		case diffmatchpatch.DiffEqual:
+			line++
+		case diffmatchpatch.DiffInsert:
+			changed[line] = true
+			line++
+		}
+	}
+	return changed
+}
+
 func readTextFile(filePath string, offset, limit int) (string, int, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -0,0 +1,372 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mix/internal/db"
+	"mix/internal/history"
+	"mix/internal/session"
+
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHistory returns a file history backed by a temp database, with a session to store versions under
+func newTestHistory(t *testing.T) (history.Service, context.Context) {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, db.SetupTestDatabase(conn))
+
+	queries := db.New(conn)
+	sess, err := session.NewService(queries).Create(context.Background(), "test session")
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), SessionIDContextKey, sess.ID)
+	return history.NewService(queries, conn), ctx
+}
+
+func TestDiffLines(t *testing.T) {
+	previous := "a\nb\nc\nd"
+	current := "a\nB\nc\nnew\nd"
+	assert.Equal(t, map[int]bool{2: true, 4: true}, diffLines(previous, current))
+	assert.Empty(t, diffLines(current, current))
+}
+
+func TestViewTool_ShowChanges(t *testing.T) {
+	files, ctx := newTestHistory(t)
+	sessionID, _ := GetContextValues(ctx)
+	filePath := filepath.Join(t.TempDir(), "main.go")
+	before := "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"
+	after := "package main\n\nfunc main() {\n\tprintln(\"hello, world\")\n\tprintln(\"bye\")\n}\n"
+
+	// Mirror what the edit tool stores: the original content, then the edited version
+	_, err := files.Create(ctx, sessionID, filePath, before)
+	require.NoError(t, err)
+	_, err = files.CreateVersion(ctx, sessionID, filePath, after)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filePath, []byte(after), 0o644))
+
+	tool := NewViewTool(files)
+	run := func(params ViewParams) string {
+		input, err := json.Marshal(params)
+		require.NoError(t, err)
+		response, err := tool.Run(ctx, ToolCall{Name: ViewToolName, Input: string(input)})
+		require.NoError(t, err)
+		return response.Content
+	}
+
+	output := run(ViewParams{FilePath: filePath, ShowChanges: true})
+	assert.Contains(t, output, "     3\tfunc main() {")
+	assert.Contains(t, output, "     4~\t\tprintln(\"hello, world\")")
+	assert.Contains(t, output, "     5~\t\tprintln(\"bye\")")
+	assert.Contains(t, output, "     6\t}")
+
+	// Offsets keep absolute line numbers
+	output = run(ViewParams{FilePath: filePath, Offset: 4, Limit: 1, ShowChanges: true})
+	assert.Contains(t, output, "     5~\t\tprintln(\"bye\")")
+
+	// Default output has no markers
+	output = run(ViewParams{FilePath: filePath})
+	assert.NotContains(t, output, "~")
+}
+
+func TestViewTool_ShowChangesWithoutHistory(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("one\ntwo\n"), 0o644))
+
+	files, ctx := newTestHistory(t)
+	input, err := json.Marshal(ViewParams{FilePath: filePath, ShowChanges: true})
+	require.NoError(t, err)
+	response, err := NewViewTool(files).Run(ctx, ToolCall{Name: ViewToolName, Input: string(input)})
+	require.NoError(t, err)
+
+	assert.Contains(t, response.Content, "     1\tone")
+	assert.Contains(t, response.Content, "No earlier version of this file")
+}
+
+func TestViewTool_Glob(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+	run := func(filePath string) (ToolResponse, ViewResponseMetadata) {
+		input, err := json.Marshal(ViewParams{FilePath: filePath})
+		require.NoError(t, err)
+		response, err := NewViewTool(nil).Run(context.Background(), ToolCall{Name: ViewToolName, Input: string(input)})
+		require.NoError(t, err)
+		var metadata ViewResponseMetadata
+		if !response.IsError {
+			require.NoError(t, json.Unmarshal([]byte(response.Metadata), &metadata))
+		}
+		return response, metadata
+	}
+
+	a := write("src/a.go", "package a\n")
+	b := write("src/b.go", "package b\n\nfunc B() {}\n")
+	write("src/notes.txt", "not go\n")
+	nested := write("src/sub/c.go", "package sub\n")
+
+	t.Run("expands matching files with headers", func(t *testing.T) {
+		response, metadata := run(filepath.Join(dir, "src", "*.go"))
+		require.False(t, response.IsError, response.Content)
+		assert.Equal(t, []string{a, b}, metadata.Files)
+		assert.Contains(t, response.Content, "<file path=\""+a+"\">\n     1\tpackage a\n</file>")
+		assert.Contains(t, response.Content, "     3\tfunc B() {}")
+		assert.NotContains(t, response.Content, "not go")
+	})
+
+	t.Run("doublestar matches nested files", func(t *testing.T) {
+		_, metadata := run(filepath.Join(dir, "src", "**", "*.go"))
+		assert.Equal(t, []string{a, b, nested}, metadata.Files)
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		response, _ := run(filepath.Join(dir, "src", "*.rs"))
+		require.True(t, response.IsError)
+		assert.Contains(t, response.Content, "No files match")
+	})
+
+	t.Run("size cap", func(t *testing.T) {
+		line := strings.Repeat("x", 1000) + "\n"
+		write("big/1.txt", strings.Repeat(line, 60))
+		write("big/2.txt", strings.Repeat(line, 60))
+
+		response, metadata := run(filepath.Join(dir, "big", "*.txt"))
+		require.False(t, response.IsError, response.Content)
+		assert.Len(t, metadata.Files, 1)
+		assert.Contains(t, response.Content, "byte limit; 1 more file(s) match")
+	})
+
+	t.Run("file count cap", func(t *testing.T) {
+		for i := 0; i < MaxGlobFiles+2; i++ {
+			write(fmt.Sprintf("many/%02d.txt", i), "line\n")
+		}
+
+		response, metadata := run(filepath.Join(dir, "many", "*.txt"))
+		require.False(t, response.IsError, response.Content)
+		assert.Len(t, metadata.Files, MaxGlobFiles)
+		assert.Contains(t, response.Content, "2 more match")
+	})
+}
+
+func TestViewTool_Outline(t *testing.T) {
+	dir := t.TempDir()
+	outline := func(name, content string) ToolResponse {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		input, err := json.Marshal(ViewParams{FilePath: path, Outline: true})
+		require.NoError(t, err)
+		response, err := NewViewTool(nil).Run(context.Background(), ToolCall{Name: ViewToolName, Input: string(input)})
+		require.NoError(t, err)
+		require.False(t, response.IsError, response.Content)
+		return response
+	}
+
+	t.Run("go", func(t *testing.T) {
+		response := outline("server.go", `package server
+
+// Server serves requests
+type Server struct {
+	addr string
+}
+
+type Handler interface {
+	Serve(ctx context.Context, req *Request) (Response, error)
+}
+
+const timeout = 5
+
+func New(addr string,
+	opts ...Option) *Server {
+	return &Server{addr: addr}
+}
+
+func (s *Server) Start() error {
+	return nil
+}
+`)
+		assert.Contains(t, response.Content, strings.Join([]string{
+			"     4\ttype Server struct",
+			"     8\ttype Handler interface",
+			"     9\t  Serve(ctx context.Context, req *Request) (Response, error)",
+			"    14\tfunc New(addr string, opts ...Option) *Server",
+			"    19\tfunc (s *Server) Start() error",
+		}, "\n"))
+		assert.NotContains(t, response.Content, "timeout")
+		assert.NotContains(t, response.Content, "return")
+		assert.Contains(t, response.Content, "(5 declarations in 22 lines.")
+	})
+
+	t.Run("python", func(t *testing.T) {
+		response := outline("shapes.py", `import math
+
+class Circle:
+    def __init__(self, radius):
+        self.radius = radius
+
+    async def area(self) -> float:
+        if self.radius:
+            return math.pi * self.radius ** 2
+
+def main():
+    print(Circle(1).area())
+`)
+		assert.Contains(t, response.Content, strings.Join([]string{
+			"     3\tclass Circle:",
+			"     4\t  def __init__(self, radius):",
+			"     7\t  async def area(self) -> float:",
+			"    11\tdef main():",
+		}, "\n"))
+		assert.NotContains(t, response.Content, "print")
+	})
+
+	t.Run("typescript", func(t *testing.T) {
+		response := outline("store.ts", `export interface Item { id: string }
+
+export class Store {
+  private items: Item[] = [];
+
+  add(item: Item): void {
+    if (item.id) {
+      this.items.push(item);
+    }
+  }
+}
+
+export const count = (store: Store) => store.size;
+`)
+		assert.Contains(t, response.Content, strings.Join([]string{
+			"     1\texport interface Item { id: string }",
+			"     3\texport class Store",
+			"     6\t  add(item: Item): void",
+			"    13\texport const count = (store: Store) => store.size;",
+		}, "\n"))
+		assert.NotContains(t, response.Content, "if (item.id)")
+	})
+
+	t.Run("unsupported languages are read in full", func(t *testing.T) {
+		response := outline("notes.txt", "first line\nsecond line\n")
+		assert.Contains(t, response.Content, "     1\tfirst line\n     2\tsecond line")
+		assert.NotContains(t, response.Content, "<outline>")
+	})
+
+	t.Run("go that does not parse is read in full", func(t *testing.T) {
+		response := outline("broken.go", "package broken\n\nfunc {\n")
+		assert.Contains(t, response.Content, "     3\tfunc {")
+	})
+}
+
+func TestViewTool_Blame(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Ada", "GIT_AUTHOR_EMAIL=ada@example.com", "GIT_AUTHOR_DATE=2024-03-01T12:00:00Z",
+			"GIT_COMMITTER_NAME=Ada", "GIT_COMMITTER_EMAIL=ada@example.com", "GIT_COMMITTER_DATE=2024-03-01T12:00:00Z",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_SYSTEM=/dev/null",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	view := func(params ViewParams) string {
+		input, err := json.Marshal(params)
+		require.NoError(t, err)
+		response, err := NewViewTool(nil).Run(context.Background(), ToolCall{Name: ViewToolName, Input: string(input)})
+		require.NoError(t, err)
+		require.False(t, response.IsError, response.Content)
+		return response.Content
+	}
+
+	path := filepath.Join(dir, "main.go")
+	require.NoError(t, os.WriteFile(path, []byte("package main\n\nfunc main() {}\n"), 0o644))
+	git("init", "-q")
+	git("add", "main.go")
+	git("commit", "-q", "-m", "Add main")
+	require.NoError(t, os.WriteFile(path, []byte("package main\n\nfunc main() { println() }\n"), 0o644))
+
+	t.Run("tracked file", func(t *testing.T) {
+		output := view(ViewParams{FilePath: path, Blame: true})
+		assert.Regexp(t, `(?m)^     1\t[0-9a-f]{8} 2024-03-01 Ada\tpackage main$`, output)
+		assert.Contains(t, output, "     3\tuncommitted\tfunc main() { println() }")
+	})
+
+	t.Run("offset", func(t *testing.T) {
+		output := view(ViewParams{FilePath: path, Blame: true, Offset: 2, Limit: 1})
+		assert.Contains(t, output, "     3\tuncommitted\tfunc main() { println() }")
+		assert.NotContains(t, output, "package main")
+	})
+
+	t.Run("offset past the end of the file", func(t *testing.T) {
+		output := view(ViewParams{FilePath: path, Blame: true, Offset: 10})
+		assert.NotContains(t, output, "not tracked by git")
+		assert.NotContains(t, output, "not annotated")
+	})
+
+	t.Run("last lines", func(t *testing.T) {
+		// The requested window runs past the end, only existing lines are blamed
+		output := view(ViewParams{FilePath: path, Blame: true, Offset: 1, Limit: 10})
+		assert.Contains(t, output, "     3\tuncommitted\tfunc main() { println() }")
+		assert.NotContains(t, output, "not tracked by git")
+	})
+
+	t.Run("untracked file", func(t *testing.T) {
+		other := filepath.Join(t.TempDir(), "notes.txt")
+		require.NoError(t, os.WriteFile(other, []byte("hello\n"), 0o644))
+		output := view(ViewParams{FilePath: other, Blame: true})
+		assert.Contains(t, output, "     1\thello")
+		assert.Contains(t, output, "not tracked by git")
+	})
+
+	t.Run("untracked file in the repository", func(t *testing.T) {
+		other := filepath.Join(dir, "notes.txt")
+		require.NoError(t, os.WriteFile(other, []byte("hello\n"), 0o644))
+		output := view(ViewParams{FilePath: other, Blame: true})
+		assert.Contains(t, output, "not tracked by git")
+	})
+}
+
+func TestGitBlame_Errors(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	require.NoError(t, os.WriteFile(path, []byte("package main\n"), 0o644))
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Ada", "-c", "user.email=ada@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git("init", "-q")
+
+	_, err := gitBlame(context.Background(), path, 1, 1)
+	assert.ErrorIs(t, err, errNotTracked)
+
+	git("add", "main.go")
+	git("commit", "-q", "-m", "Add main")
+
+	// Other failures are reported as they are instead of as an untracked file
+	_, err = gitBlame(context.Background(), path, 5, 6)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errNotTracked)
+	assert.Contains(t, err.Error(), "git blame failed")
+}
@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"mix/internal/logging"
+	"mix/internal/pubsub"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileChangedEvent reports that a file read in a session was changed on disk by
+// something other than the agent
+type FileChangedEvent struct {
+	SessionID string
+	Path      string
+}
+
+// FileWatcher watches the files the agent has read. When one changes externally its
+// read is marked stale, so the edit tools require viewing it again before editing.
+type FileWatcher struct {
+	*pubsub.Broker[FileChangedEvent]
+
+	watcher *fsnotify.Watcher
+	mu      sync.Mutex
+	dirs    map[string]bool
+	// sessions maps each watched file to the sessions that read it
+	sessions map[string]map[string]bool
+}
+
+// fileChangeSettleDelay is how long a change is left before it is checked, giving the
+// tools time to record the read that follows their own writes
+const fileChangeSettleDelay = 100 * time.Millisecond
+
+var (
+	activeWatcher   *FileWatcher
+	activeWatcherMu sync.RWMutex
+)
+
+// StartFileWatcher starts watching files as they are read and makes the watcher the
+// active one. Close stops it.
+func StartFileWatcher() (*FileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	w := &FileWatcher{
+		Broker:   pubsub.NewBroker[FileChangedEvent](),
+		watcher:  watcher,
+		dirs:     make(map[string]bool),
+		sessions: make(map[string]map[string]bool),
+	}
+	go w.run()
+
+	activeWatcherMu.Lock()
+	activeWatcher = w
+	activeWatcherMu.Unlock()
+	return w, nil
+}
+
+// Close stops the watcher and its subscriptions
+func (w *FileWatcher) Close() error {
+	activeWatcherMu.Lock()
+	if activeWatcher == w {
+		activeWatcher = nil
+	}
+	activeWatcherMu.Unlock()
+
+	w.Shutdown()
+	return w.watcher.Close()
+}
+
+// watchFileRead starts watching a file read in the session from ctx, if a watcher is running
+func watchFileRead(ctx context.Context, path string) {
+	activeWatcherMu.RLock()
+	w := activeWatcher
+	activeWatcherMu.RUnlock()
+	if w == nil {
+		return
+	}
+
+	sessionID, _ := GetContextValues(ctx)
+	if err := w.watch(sessionID, path); err != nil {
+		logging.Debug("Failed to watch file", "path", path, "error", err)
+	}
+}
+
+// watch adds a file read by a session. The parent directory is watched rather than
+// the file itself so editors that save by replacing the file are still noticed.
+func (w *FileWatcher) watch(sessionID, path string) error {
+	path = filepath.Clean(path)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	dir := filepath.Dir(path)
+	if !w.dirs[dir] {
+		if err := w.watcher.Add(dir); err != nil {
+			return err
+		}
+		w.dirs[dir] = true
+	}
+
+	if w.sessions[path] == nil {
+		w.sessions[path] = make(map[string]bool)
+	}
+	w.sessions[path][sessionID] = true
+	return nil
+}
+
+func (w *FileWatcher) run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				path := filepath.Clean(event.Name)
+				time.AfterFunc(fileChangeSettleDelay, func() { w.handleChange(path) })
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			logging.Debug("File watcher error", "error", err)
+		}
+	}
+}
+
+// handleChange marks the read of a changed file stale and notifies the sessions that
+// read it. Changes the agent made itself are ignored, since the tools record a fresh
+// read after every write.
+func (w *FileWatcher) handleChange(path string) {
+	w.mu.Lock()
+	sessions := w.sessions[path]
+	if len(sessions) == 0 {
+		w.mu.Unlock()
+		return
+	}
+
+	if info, err := os.Stat(path); err == nil && !info.ModTime().After(getLastReadTime(path)) {
+		w.mu.Unlock()
+		return
+	}
+	delete(w.sessions, path)
+	w.mu.Unlock()
+
+	if !invalidateFileRead(path) {
+		return
+	}
+	logging.Debug("File changed externally", "path", path)
+	for sessionID := range sessions {
+		w.Publish(pubsub.UpdatedEvent, FileChangedEvent{SessionID: sessionID, Path: path})
+	}
+}
@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mix/internal/permission"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWatcher_InvalidatesExternallyModifiedFiles(t *testing.T) {
+	files, ctx := newTestHistory(t)
+	sessionID, _ := GetContextValues(ctx)
+
+	watcher, err := StartFileWatcher()
+	require.NoError(t, err)
+	t.Cleanup(func() { watcher.Close() })
+
+	subCtx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	changes := watcher.Subscribe(subCtx)
+
+	filePath := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("original\n"), 0o644))
+	recordFileRead(ctx, filePath)
+	require.False(t, getLastReadTime(filePath).IsZero())
+
+	// Modification times can be coarser than the read timestamp
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, os.WriteFile(filePath, []byte("changed elsewhere\n"), 0o644))
+
+	select {
+	case change := <-changes:
+		assert.Equal(t, FileChangedEvent{SessionID: sessionID, Path: filePath}, change.Payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event for the modified file")
+	}
+	assert.True(t, getLastReadTime(filePath).IsZero(), "the read must be marked stale")
+
+	// Editing now requires viewing the file again
+	tool := NewEditTool(permission.NewPermissionService(), files)
+	input, err := json.Marshal(EditParams{FilePath: filePath, OldString: "changed", NewString: "edited", DryRun: true})
+	require.NoError(t, err)
+	response, err := tool.Run(ctx, ToolCall{Name: EditToolName, Input: string(input)})
+	require.NoError(t, err)
+	assert.True(t, response.IsError)
+	assert.Contains(t, response.Content, "you must read the file before editing it")
+}
+
+func TestFileWatcher_IgnoresOwnWrites(t *testing.T) {
+	_, ctx := newTestHistory(t)
+
+	watcher, err := StartFileWatcher()
+	require.NoError(t, err)
+	t.Cleanup(func() { watcher.Close() })
+
+	filePath := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("original\n"), 0o644))
+	recordFileRead(ctx, filePath)
+
+	// The tools record a fresh read right after writing, as the edit tool does
+	require.NoError(t, os.WriteFile(filePath, []byte("written by the agent\n"), 0o644))
+	recordFileRead(ctx, filePath)
+
+	time.Sleep(200 * time.Millisecond)
+	assert.False(t, getLastReadTime(filePath).IsZero())
+}
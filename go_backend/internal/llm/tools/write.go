@@ -152,7 +152,7 @@ func (w *writeTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error
 		return ToolResponse{}, permission.ErrorPermissionDenied
 	}
 
-	err = os.WriteFile(filePath, []byte(params.Content), 0o644)
+	err = writeFile(ctx, filePath, []byte(params.Content))
 	if err != nil {
 		return ToolResponse{}, fmt.Errorf("error writing file: %w", err)
 	}
@@ -180,7 +180,7 @@ func (w *writeTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error
 	}
 
 	recordFileWrite(filePath)
-	recordFileRead(filePath)
+	recordFileRead(ctx, filePath)
 	// LSP diagnostics functionality removed
 
 	result := fmt.Sprintf("File successfully written: %s", filePath)
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingFile is an append-only file that is rotated once it would grow past
+// maxBytes. Rotated files are kept as path.1 (newest) through path.<maxBackups>.
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func NewRotatingFile(path string, maxBytes int64, maxBackups int) *RotatingFile {
+	return &RotatingFile{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxBackups: maxBackups,
+	}
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("creating log directory: %w", err)
+	}
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("reading log file size: %w", err)
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("closing log file: %w", err)
+	}
+	r.file = nil
+
+	if r.maxBackups <= 0 {
+		os.Remove(r.path)
+	} else {
+		os.Remove(r.backupPath(r.maxBackups))
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			os.Rename(r.backupPath(i), r.backupPath(i+1))
+		}
+		if err := os.Rename(r.path, r.backupPath(1)); err != nil {
+			return fmt.Errorf("rotating log file: %w", err)
+		}
+	}
+	return r.open()
+}
+
+func (r *RotatingFile) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
@@ -0,0 +1,31 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logFile := NewRotatingFile(path, 10, 2)
+	t.Cleanup(func() { logFile.Close() })
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := logFile.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	read := func(path string) string {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "fourth\n", read(path))
+	assert.Equal(t, "third\n", read(path+".1"))
+	assert.Equal(t, "second\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3")
+}
@@ -1,8 +1,98 @@
 package message
 
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
 type Attachment struct {
 	FilePath string
 	FileName string
 	MimeType string
 	Content  []byte
 }
+
+// fileReferencePattern matches @path references at the start of the text or after whitespace
+var fileReferencePattern = regexp.MustCompile(`(?:^|\s)@(\S+)`)
+
+// FileReferences returns the paths referenced with @ in the text, in order of appearance.
+// Trailing sentence punctuation is not treated as part of the path.
+func FileReferences(text string) []string {
+	var paths []string
+	for _, match := range fileReferencePattern.FindAllStringSubmatch(text, -1) {
+		if path := strings.TrimRight(match[1], ",.;:!?)"); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// ImageAttachments builds an attachment for every referenced path that is an image.
+// Relative paths are resolved against baseDir. Non-image paths are skipped so they
+// stay as plain path mentions in the message text. Duplicate paths are attached once.
+func ImageAttachments(baseDir string, paths []string) ([]Attachment, error) {
+	var attachments []Attachment
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+		if !strings.HasPrefix(mimeType, "image/") {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment %s: %w", path, err)
+		}
+		if detected := http.DetectContentType(content); strings.HasPrefix(detected, "image/") {
+			mimeType = detected
+		}
+
+		attachments = append(attachments, Attachment{
+			FilePath: path,
+			FileName: filepath.Base(path),
+			MimeType: mimeType,
+			Content:  content,
+		})
+	}
+	return attachments, nil
+}
+
+// InferMimeType returns the MIME type of an attachment, sniffed from its content or taken
+// from the extension of its path or name, or "" when neither identifies it. Sniffed image
+// types win over the extension, as for referenced images.
+func InferMimeType(attachment Attachment) string {
+	var detected string
+	if len(attachment.Content) > 0 {
+		detected = http.DetectContentType(attachment.Content)
+		if strings.HasPrefix(detected, "image/") {
+			return detected
+		}
+	}
+
+	for _, name := range []string{attachment.FilePath, attachment.FileName} {
+		if mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); mimeType != "" {
+			mimeType, _, _ = strings.Cut(mimeType, ";")
+			return mimeType
+		}
+	}
+
+	// DetectContentType falls back to application/octet-stream when it finds nothing
+	if detected == "" || detected == "application/octet-stream" {
+		return ""
+	}
+	detected, _, _ = strings.Cut(detected, ";")
+	return detected
+}
@@ -0,0 +1,79 @@
+package message
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileReferences(t *testing.T) {
+	t.Run("collects every reference in order", func(t *testing.T) {
+		refs := FileReferences("@a.png compare with @images/b.jpg and @notes.txt")
+		assert.Equal(t, []string{"a.png", "images/b.jpg", "notes.txt"}, refs)
+	})
+
+	t.Run("ignores @ inside words", func(t *testing.T) {
+		assert.Empty(t, FileReferences("mail me at user@example.com"))
+	})
+}
+
+func TestImageAttachments(t *testing.T) {
+	tmpDir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "first.png"), png, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "second.jpg"), jpeg, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("hello"), 0o644))
+
+	t.Run("builds one attachment per image", func(t *testing.T) {
+		refs := FileReferences("look at @first.png and @second.jpg, see @notes.txt")
+		attachments, err := ImageAttachments(tmpDir, refs)
+		require.NoError(t, err)
+		require.Len(t, attachments, 2)
+
+		assert.Equal(t, filepath.Join(tmpDir, "first.png"), attachments[0].FilePath)
+		assert.Equal(t, "first.png", attachments[0].FileName)
+		assert.Equal(t, "image/png", attachments[0].MimeType)
+		assert.Equal(t, png, attachments[0].Content)
+
+		assert.Equal(t, "second.jpg", attachments[1].FileName)
+		assert.Equal(t, "image/jpeg", attachments[1].MimeType)
+	})
+
+	t.Run("attaches duplicate references once", func(t *testing.T) {
+		absPath := filepath.Join(tmpDir, "first.png")
+		attachments, err := ImageAttachments(tmpDir, []string{"first.png", absPath})
+		require.NoError(t, err)
+		assert.Len(t, attachments, 1)
+	})
+
+	t.Run("missing image is an error", func(t *testing.T) {
+		_, err := ImageAttachments(tmpDir, []string{"missing.png"})
+		assert.Error(t, err)
+	})
+}
+
+func TestInferMimeType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	tests := []struct {
+		name       string
+		attachment Attachment
+		want       string
+	}{
+		{"sniffed image", Attachment{FilePath: "/tmp/upload", Content: png}, "image/png"},
+		{"sniffed image over a wrong extension", Attachment{FileName: "photo.jpg", Content: png}, "image/png"},
+		{"extension", Attachment{FilePath: "/tmp/report.pdf", Content: []byte("not really a pdf")}, "application/pdf"},
+		{"file name", Attachment{FileName: "canvas.webp"}, "image/webp"},
+		{"sniffed text", Attachment{FilePath: "/tmp/notes", Content: []byte("plain words")}, "text/plain"},
+		{"unknown", Attachment{FilePath: "/tmp/blob", Content: []byte{0x00, 0x01, 0x02}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, InferMimeType(tt.attachment))
+		})
+	}
+}
@@ -23,10 +23,12 @@ type CreateMessageParams struct {
 type Service interface {
 	pubsub.Suscriber[Message]
 	Create(ctx context.Context, sessionID string, params CreateMessageParams) (Message, error)
+	Copy(ctx context.Context, sessionID string, message Message) (Message, error)
 	Update(ctx context.Context, message Message) error
 	Get(ctx context.Context, id string) (Message, error)
 	List(ctx context.Context, sessionID string) ([]Message, error)
 	Delete(ctx context.Context, id string) error
+	DeleteWithToolPairs(ctx context.Context, id string) ([]string, error)
 	DeleteSessionMessages(ctx context.Context, sessionID string) error
 	ListUserMessageHistory(ctx context.Context, sessionID string, limit, offset int64) ([]Message, error)
 	ListPreviousSessionsUserMessages(ctx context.Context, excludeSessionID string, limit, offset int64) ([]Message, error)
@@ -57,6 +59,61 @@ func (s *service) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+// DeleteWithToolPairs deletes a message together with the messages holding the other half of
+// its tool calls (the assistant tool use for a tool result, or the results for a tool use),
+// so the remaining conversation stays valid for providers. It returns the deleted message IDs.
+func (s *service) DeleteWithToolPairs(ctx context.Context, id string) ([]string, error) {
+	target, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	toolCallIDs := make(map[string]bool)
+	for _, call := range target.ToolCalls() {
+		toolCallIDs[call.ID] = true
+	}
+	for _, result := range target.ToolResults() {
+		toolCallIDs[result.ToolCallID] = true
+	}
+
+	toDelete := []Message{target}
+	if len(toolCallIDs) > 0 {
+		messages, err := s.List(ctx, target.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range messages {
+			if msg.ID != target.ID && pairsWith(msg, toolCallIDs) {
+				toDelete = append(toDelete, msg)
+			}
+		}
+	}
+
+	deleted := make([]string, 0, len(toDelete))
+	for _, msg := range toDelete {
+		if err := s.q.DeleteMessage(ctx, msg.ID); err != nil {
+			return deleted, err
+		}
+		s.Publish(pubsub.DeletedEvent, msg)
+		deleted = append(deleted, msg.ID)
+	}
+	return deleted, nil
+}
+
+func pairsWith(msg Message, toolCallIDs map[string]bool) bool {
+	for _, call := range msg.ToolCalls() {
+		if toolCallIDs[call.ID] {
+			return true
+		}
+	}
+	for _, result := range msg.ToolResults() {
+		if toolCallIDs[result.ToolCallID] {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *service) Create(ctx context.Context, sessionID string, params CreateMessageParams) (Message, error) {
 	if params.Role != Assistant {
 		params.Parts = append(params.Parts, Finish{
@@ -85,6 +142,37 @@ func (s *service) Create(ctx context.Context, sessionID string, params CreateMes
 	return message, nil
 }
 
+// Copy creates a new message in sessionID with the same role, model and parts as message
+func (s *service) Copy(ctx context.Context, sessionID string, message Message) (Message, error) {
+	partsJSON, err := marshallParts(message.Parts)
+	if err != nil {
+		return Message{}, err
+	}
+	dbMessage, err := s.q.CreateMessage(ctx, db.CreateMessageParams{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Role:      string(message.Role),
+		Parts:     string(partsJSON),
+		Model:     sql.NullString{String: string(message.Model), Valid: true},
+	})
+	if err != nil {
+		return Message{}, err
+	}
+	copied, err := s.fromDBItem(dbMessage)
+	if err != nil {
+		return Message{}, err
+	}
+	s.Publish(pubsub.CreatedEvent, copied)
+
+	// Carry over the finish time, which is only set on update
+	if copied.IsFinished() {
+		if err := s.Update(ctx, copied); err != nil {
+			return Message{}, err
+		}
+	}
+	return copied, nil
+}
+
 func (s *service) DeleteSessionMessages(ctx context.Context, sessionID string) error {
 	messages, err := s.List(ctx, sessionID)
 	if err != nil {
@@ -218,6 +306,16 @@ type partWrapper struct {
 	Data ContentPart `json:"data"`
 }
 
+// MarshalParts encodes content parts the way they are stored, each tagged with its type
+func MarshalParts(parts []ContentPart) ([]byte, error) {
+	return marshallParts(parts)
+}
+
+// UnmarshalParts decodes content parts encoded by MarshalParts
+func UnmarshalParts(data []byte) ([]ContentPart, error) {
+	return unmarshallParts(data)
+}
+
 func marshallParts(parts []ContentPart) ([]byte, error) {
 	wrappedParts := make([]partWrapper, len(parts))
 
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"log"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
@@ -80,6 +81,11 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 		return true
 	}
 
+	if isAllowlisted(opts.ToolName) {
+		log.Printf("Tool %s is allowlisted, skipping permission prompt", opts.ToolName)
+		return true
+	}
+
 	dir := filepath.Dir(opts.Path)
 	if dir == "." {
 		dir = config.WorkingDirectory()
@@ -120,6 +126,11 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 	}
 }
 
+// isAllowlisted reports whether the tool is configured to run without prompting
+func isAllowlisted(toolName string) bool {
+	return slices.Contains(config.Get().Permissions.AllowedTools, toolName)
+}
+
 func NewPermissionService() Service {
 	return &permissionService{
 		Broker:             pubsub.NewBroker[PermissionRequest](),
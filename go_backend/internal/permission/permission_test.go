@@ -0,0 +1,80 @@
+package permission
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mix/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	cfgJSON := `{"agents": {"main": {"model": "claude-4-sonnet"}, "sub": {"model": "claude-4-sonnet"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".mix.json"), []byte(cfgJSON), 0o644))
+
+	cfg, err := config.Load(tmpDir, false, false)
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestPermissionService_Allowlist(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Permissions.AllowedTools = []string{"view", "ls", "grep"}
+
+	t.Run("allowlisted tool is approved without prompting", func(t *testing.T) {
+		service := NewPermissionService()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := service.Subscribe(ctx)
+
+		granted := service.Request(CreatePermissionRequest{
+			SessionID: "session",
+			ToolName:  "view",
+			Action:    "read",
+			Path:      cfg.WorkingDir,
+		})
+
+		assert.True(t, granted)
+		select {
+		case event := <-events:
+			t.Fatalf("unexpected permission prompt for %s", event.Payload.ToolName)
+		default:
+		}
+	})
+
+	t.Run("tool outside the allowlist is prompted", func(t *testing.T) {
+		service := NewPermissionService()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := service.Subscribe(ctx)
+
+		result := make(chan bool, 1)
+		go func() {
+			result <- service.Request(CreatePermissionRequest{
+				SessionID: "session",
+				ToolName:  "bash",
+				Action:    "execute",
+				Path:      cfg.WorkingDir,
+			})
+		}()
+
+		select {
+		case event := <-events:
+			assert.Equal(t, "bash", event.Payload.ToolName)
+			service.Deny(event.Payload)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected a permission prompt for bash")
+		}
+
+		assert.False(t, <-result)
+	})
+}
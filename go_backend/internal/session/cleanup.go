@@ -0,0 +1,35 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// CleanupPolicy selects idle sessions for deletion: those last updated more than
+// MaxAge ago that hold at most MaxMessages messages.
+type CleanupPolicy struct {
+	MaxAge      time.Duration
+	MaxMessages int64
+}
+
+// DeleteIdle deletes the sessions matching policy as of now, skipping any for which
+// keep returns true, and returns the deleted sessions.
+func DeleteIdle(ctx context.Context, sessions Service, policy CleanupPolicy, now time.Time, keep func(Session) bool) ([]Session, error) {
+	all, err := sessions.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := now.Add(-policy.MaxAge).Unix()
+	var deleted []Session
+	for _, session := range all {
+		if session.UpdatedAt > cutoff || session.MessageCount > policy.MaxMessages || keep(session) {
+			continue
+		}
+		if err := sessions.Delete(ctx, session.ID); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, session)
+	}
+	return deleted, nil
+}
@@ -27,6 +27,7 @@ type Session struct {
 type Service interface {
 	pubsub.Suscriber[Session]
 	Create(ctx context.Context, title string) (Session, error)
+	CreateChild(ctx context.Context, parentSessionID, title string) (Session, error)
 	Get(ctx context.Context, id string) (Session, error)
 	List(ctx context.Context) ([]Session, error)
 	Save(ctx context.Context, session Session) (Session, error)
@@ -51,7 +52,20 @@ func (s *service) Create(ctx context.Context, title string) (Session, error) {
 	return session, nil
 }
 
-// Removed complex session creation methods for embedded binary
+// CreateChild creates a session linked to a parent session, e.g. for a sub-task
+func (s *service) CreateChild(ctx context.Context, parentSessionID, title string) (Session, error) {
+	dbSession, err := s.q.CreateSession(ctx, db.CreateSessionParams{
+		ID:              uuid.New().String(),
+		ParentSessionID: sql.NullString{String: parentSessionID, Valid: true},
+		Title:           title,
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	session := s.fromDBItem(dbSession)
+	s.Publish(pubsub.CreatedEvent, session)
+	return session, nil
+}
 
 func (s *service) Delete(ctx context.Context, id string) error {
 	session, err := s.Get(ctx, id)
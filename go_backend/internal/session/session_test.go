@@ -0,0 +1,46 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mix/internal/db"
+	"mix/internal/message"
+
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionService_UpdatedAt(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, db.SetupTestDatabase(conn))
+
+	ctx := context.Background()
+	queries := db.New(conn)
+	sessions := NewService(queries)
+	messages := message.NewService(queries)
+
+	session, err := sessions.Create(ctx, "test session")
+	require.NoError(t, err)
+
+	// Timestamps have second granularity
+	time.Sleep(1100 * time.Millisecond)
+
+	_, err = messages.Create(ctx, session.ID, message.CreateMessageParams{
+		Role:  message.User,
+		Parts: []message.ContentPart{message.TextContent{Text: "hello"}},
+	})
+	require.NoError(t, err)
+
+	after, err := sessions.Get(ctx, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), after.MessageCount)
+	assert.Greater(t, after.UpdatedAt, session.UpdatedAt)
+}
@@ -21,6 +21,7 @@ interface ContextData {
   maxTokens: number;
   totalTokens: number;
   usagePercent: number;
+  estimated?: boolean;
   components: ComponentBreakdown[];
   warningLevel?: string;
   warningMessage?: string;
@@ -98,7 +99,7 @@ export function ContextDisplay({ data }: ContextDisplayProps) {
             >
               <TableCell>{component.name}</TableCell>
               <TableCell className="text-right">
-                {(component.name === 'System Prompt' || component.name === 'Tool Descriptions') ? '~' : ''}{formatTokens(component.tokens)}
+                {data.estimated ? '~' : ''}{formatTokens(component.tokens)}
               </TableCell>
               <TableCell className="text-right">
                 {component.percentage.toFixed(1)}%
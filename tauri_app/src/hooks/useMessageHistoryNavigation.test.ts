@@ -0,0 +1,36 @@
+import { describe, expect, it } from 'vitest';
+import { filterHistoryByPrefix } from '@/hooks/useMessageHistoryNavigation';
+
+describe('filterHistoryByPrefix', () => {
+  const history = [
+    'Resize the image to 1080p',
+    'render the scene',
+    'Open cover.pxd',
+    'resize',
+  ];
+
+  it('returns every entry without a prefix', () => {
+    expect(filterHistoryByPrefix(history, '')).toEqual(history);
+    expect(filterHistoryByPrefix(history, '   ')).toEqual(history);
+  });
+
+  it('keeps the entries starting with the prefix, in order', () => {
+    expect(filterHistoryByPrefix(history, 're')).toEqual([
+      'Resize the image to 1080p',
+      'render the scene',
+      'resize',
+    ]);
+  });
+
+  it('ignores case and leading whitespace', () => {
+    expect(filterHistoryByPrefix(history, '  OPEN')).toEqual(['Open cover.pxd']);
+  });
+
+  it('skips entries equal to the prefix', () => {
+    expect(filterHistoryByPrefix(history, 'Resize')).toEqual(['Resize the image to 1080p']);
+  });
+
+  it('returns nothing when no entry matches', () => {
+    expect(filterHistoryByPrefix(history, 'delete')).toEqual([]);
+  });
+});
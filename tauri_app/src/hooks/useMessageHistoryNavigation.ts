@@ -8,6 +8,16 @@ interface UseMessageHistoryNavigationProps {
   batchSize?: number;
 }
 
+// Returns the history entries starting with the typed prefix, so typing a few
+// characters before pressing up cycles only through matching prompts
+export function filterHistoryByPrefix(texts: string[], prefix: string): string[] {
+  const needle = prefix.trimStart().toLowerCase();
+  if (!needle.trim()) return texts;
+  return texts.filter(
+    (entry) => entry.toLowerCase().startsWith(needle) && entry.toLowerCase() !== needle
+  );
+}
+
 export function useMessageHistoryNavigation({ 
   sessionId, 
   text, 
@@ -23,7 +33,9 @@ export function useMessageHistoryNavigation({
   });
 
   const navigateHistory = (direction: 'up' | 'down') => {
-    const allHistoryTexts = messageHistory.getAllHistoryTexts();
+    // The text typed before entering history mode filters the entries
+    const prefix = historyIndex === -1 ? text : originalText;
+    const allHistoryTexts = filterHistoryByPrefix(messageHistory.getAllHistoryTexts(), prefix);
     
     // Initialize history mode on first use
     if (historyIndex === -1 && direction === 'up') {